@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/hiway/natshd/internal/config"
 	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
 	"github.com/hiway/natshd/internal/supervisor"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -22,10 +28,19 @@ const (
 
 // CLIOptions represents command-line options
 type CLIOptions struct {
-	ConfigFile  string
-	LogLevel    string
-	ShowHelp    bool
-	ShowVersion bool
+	ConfigFile    string
+	LogLevel      string
+	LogFormat     string
+	ShowHelp      bool
+	ShowVersion   bool
+	TestScript    string
+	SamplePayload string
+	// Topology export and comparison against a running daemon
+	ExportTopology  bool
+	CompareTopology string
+	TopologyHost    string
+	// Validate discovers services without connecting to NATS, then exits
+	Validate bool
 }
 
 func main() {
@@ -51,6 +66,38 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	// Exercise a single script locally without connecting to NATS
+	if options.TestScript != "" {
+		cfg, err := testScriptConfiguration(os.Stdout, options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Script test failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := runTestScript(ctx, os.Stdout, *cfg, options.TestScript, options.SamplePayload); err != nil {
+			fmt.Fprintf(os.Stderr, "Script test failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Check the scripts directory without connecting to NATS
+	if options.Validate {
+		if err := runValidate(os.Stdout, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Validation failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Export or compare what a running daemon serves, then exit
+	if options.ExportTopology || options.CompareTopology != "" {
+		if err := runTopology(os.Stdout, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Topology failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Run the application
 	if err := runApplication(ctx, options); err != nil {
 		fmt.Fprintf(os.Stderr, "Application error: %v\n", err)
@@ -67,8 +114,15 @@ func parseFlags(args []string) (CLIOptions, error) {
 
 	fs.StringVar(&options.ConfigFile, "config", "config.toml", "Path to configuration file")
 	fs.StringVar(&options.LogLevel, "log-level", "", "Override log level (trace, debug, info, warn, error)")
+	fs.StringVar(&options.LogFormat, "log-format", "", "Override log format (json, console)")
 	fs.BoolVar(&options.ShowHelp, "help", false, "Show help information")
 	fs.BoolVar(&options.ShowVersion, "version", false, "Show version information")
+	fs.StringVar(&options.TestScript, "test-script", "", "Run a single script's info and sample requests locally, then exit")
+	fs.StringVar(&options.SamplePayload, "sample-payload", "", "Payload sent to each endpoint when using -test-script")
+	fs.BoolVar(&options.Validate, "validate", false, "List the services discovered in scripts_path without connecting to NATS, then exit")
+	fs.BoolVar(&options.ExportTopology, "export-topology", false, "Print the topology a running daemon serves as JSON, then exit")
+	fs.StringVar(&options.CompareTopology, "compare-topology", "", "Compare a running daemon's topology with an exported file, then exit")
+	fs.StringVar(&options.TopologyHost, "topology-host", "", "Host whose topology to export or compare (default: this host)")
 
 	// Parse flags
 	if err := fs.Parse(args[1:]); err != nil {
@@ -91,28 +145,131 @@ func loadConfiguration(configPath string, options CLIOptions) (*config.Config, e
 		cfg.LogLevel = options.LogLevel
 	}
 
+	// Override log format if provided via CLI
+	if options.LogFormat != "" {
+		cfg.LogFormat = options.LogFormat
+	}
+
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
+	// A missing credentials file would otherwise surface as a connect error
+	if cfg.NatsCredsFile != "" {
+		if _, err := os.Stat(cfg.NatsCredsFile); err != nil {
+			return nil, fmt.Errorf("nats_creds_file %s is not readable: %w", cfg.NatsCredsFile, err)
+		}
+	}
+
 	return &cfg, nil
 }
 
 // connectToNATS establishes a connection to the NATS server
-func connectToNATS(natsURL string) (*nats.Conn, error) {
-	conn, err := nats.Connect(natsURL)
+func connectToNATS(cfg *config.Config, logger zerolog.Logger) (*nats.Conn, error) {
+	conn, err := nats.Connect(cfg.NatsURL, natsOptions(cfg, logger)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to NATS server at %s: %w", natsURL, err)
+		return nil, fmt.Errorf("failed to connect to NATS server at %s: %w", cfg.NatsURL, err)
 	}
 
 	return conn, nil
 }
 
-// setupApplicationLogger configures the application logger
-func setupApplicationLogger(cfg *config.Config) (zerolog.Logger, error) {
-	logger := logging.SetupLogger(cfg.LogLevel)
-	return logger, nil
+// natsOptions builds the connection options from the configuration; without
+// credentials the connection is anonymous. Zero reconnect settings keep the
+// nats.go defaults. Connection churn is logged through logger.
+func natsOptions(cfg *config.Config, logger zerolog.Logger) []nats.Option {
+	opts := []nats.Option{
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			event := logger.Warn()
+			if err != nil {
+				event = event.Err(err)
+			}
+			event.Msg("Disconnected from NATS server")
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info().
+				Str("nats_url", conn.ConnectedUrl()).
+				Uint64("reconnects", conn.Stats().Reconnects).
+				Msg("Reconnected to NATS server")
+		}),
+		nats.ClosedHandler(func(conn *nats.Conn) {
+			event := logger.Warn()
+			if err := conn.LastError(); err != nil {
+				event = event.Err(err)
+			}
+			event.Msg("NATS connection closed")
+		}),
+	}
+
+	// 0 is an explicit "don't reconnect"; LoadConfig turns a missing setting into -1
+	opts = append(opts, nats.MaxReconnects(cfg.ReconnectMax))
+	if cfg.ReconnectWaitMs > 0 {
+		opts = append(opts, nats.ReconnectWait(time.Duration(cfg.ReconnectWaitMs)*time.Millisecond))
+	}
+	if cfg.ReconnectBufferBytes > 0 {
+		opts = append(opts, nats.ReconnectBufSize(cfg.ReconnectBufferBytes))
+	}
+
+	if cfg.NatsUser != "" {
+		opts = append(opts, nats.UserInfo(cfg.NatsUser, cfg.NatsPassword))
+	}
+	if cfg.NatsToken != "" {
+		opts = append(opts, nats.Token(cfg.NatsToken))
+	}
+	if cfg.NatsCredsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.NatsCredsFile))
+	}
+	return opts
+}
+
+// setupApplicationLogger configures the application logger. The returned function
+// flushes buffered log output, closes the log file and must be called on shutdown.
+func setupApplicationLogger(cfg *config.Config) (zerolog.Logger, func() error, error) {
+	logging.SetPayloadRedaction(cfg.LogRedactKeys, cfg.LogPayloadMaxBytes)
+	logging.SetRequestLogSampling(cfg.LogSampleRate)
+
+	var file io.Writer
+	closeFile := func() error { return nil }
+	if cfg.LogFile != "" {
+		rotatingFile, err := logging.NewRotatingFile(cfg.LogFile, int64(cfg.LogMaxSizeMB)<<20)
+		if err != nil {
+			return zerolog.Logger{}, nil, err
+		}
+		file, closeFile = rotatingFile, rotatingFile.Close
+	}
+
+	if cfg.LogBufferSize <= 0 {
+		logger := logging.SetupLoggerWithFile(os.Stdout, file, cfg.LogLevel, cfg.LogFormat, cfg.LogLabels())
+		return logger, closeFile, nil
+	}
+
+	writer := logging.NewBufferedWriter(os.Stdout, cfg.LogBufferSize, time.Duration(cfg.LogFlushIntervalMs)*time.Millisecond)
+	logger := logging.SetupLoggerWithFile(writer, file, cfg.LogLevel, cfg.LogFormat, cfg.LogLabels())
+	return logger, func() error { return errors.Join(writer.Close(), closeFile()) }, nil
+}
+
+// setupAccessLog opens the configured access log. The returned function closes
+// the log file and must be called on shutdown; a nil access log means it is disabled.
+func setupAccessLog(cfg *config.Config) (*logging.AccessLog, func() error, error) {
+	switch cfg.AccessLog {
+	case "":
+		return nil, func() error { return nil }, nil
+	case "-":
+		accessLog, err := logging.NewAccessLog(os.Stdout, cfg.AccessLogFormat)
+		return accessLog, func() error { return nil }, err
+	}
+
+	file, err := os.OpenFile(cfg.AccessLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open access log %s: %w", cfg.AccessLog, err)
+	}
+	accessLog, err := logging.NewAccessLog(file, cfg.AccessLogFormat)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return accessLog, file.Close, nil
 }
 
 // runApplication runs the main application logic
@@ -124,10 +281,12 @@ func runApplication(ctx context.Context, options CLIOptions) error {
 	}
 
 	// Setup logging
-	logger, err := setupApplicationLogger(cfg)
+	logger, flushLogs, err := setupApplicationLogger(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to setup logger: %w", err)
 	}
+	// Deferred first so it runs last, after every other shutdown log line
+	defer flushLogs()
 
 	logger.Info().
 		Str("app", AppName).
@@ -138,24 +297,36 @@ func runApplication(ctx context.Context, options CLIOptions) error {
 		Str("log_level", cfg.LogLevel).
 		Msg("Starting NATS Shell Daemon")
 
+	accessLog, closeAccessLog, err := setupAccessLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAccessLog()
+
 	// Connect to NATS
-	natsConn, err := connectToNATS(cfg.NatsURL)
+	natsConn, err := connectToNATS(cfg, logger)
 	if err != nil {
 		return err
 	}
+	// Start only returns once every micro service has deregistered, so closing here is safe
 	defer natsConn.Close()
 
 	logger.Info().
 		Str("nats_url", cfg.NatsURL).
+		Int64("max_payload", natsConn.MaxPayload()).
 		Msg("Connected to NATS server")
 
 	// Create service manager
 	serviceManager := supervisor.NewManager(cfg.ScriptsPath, natsConn, logger, *cfg)
+	serviceManager.SetAccessLog(accessLog)
 
 	logger.Info().
 		Str("scripts_path", cfg.ScriptsPath).
 		Msg("Service manager created")
 
+	// Rescan the scripts directory on SIGHUP, e.g. after a bulk deploy
+	go reloadOnSignal(ctx, serviceManager, logger)
+
 	// Start the service manager
 	logger.Info().Msg("Starting service manager...")
 	err = serviceManager.Start(ctx)
@@ -170,6 +341,220 @@ func runApplication(ctx context.Context, options CLIOptions) error {
 	return nil
 }
 
+// reloadOnSignal reloads the service manager on every SIGHUP until ctx is done
+func reloadOnSignal(ctx context.Context, serviceManager *supervisor.ServiceManager, logger zerolog.Logger) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			logger.Info().Msg("Received SIGHUP, reloading services")
+			if err := serviceManager.Reload(); err != nil {
+				logger.Error().Err(err).Msg("Failed to reload services")
+			}
+		}
+	}
+}
+
+// testScriptConfiguration loads the config -test-script runs scripts with, falling
+// back to the defaults when there is no config file, so scripts can be tried out
+// before natshd is set up
+func testScriptConfiguration(out io.Writer, options CLIOptions) (*config.Config, error) {
+	if _, err := os.Stat(options.ConfigFile); os.IsNotExist(err) {
+		fmt.Fprintf(out, "No config file at %s, running the script with default settings\n", options.ConfigFile)
+		cfg := config.DefaultConfig()
+		// The script runs in its own directory, as it would in scripts_path
+		cfg.ScriptsPath = filepath.Dir(options.TestScript)
+		return &cfg, nil
+	}
+	return loadConfiguration(options.ConfigFile, options)
+}
+
+// runTestScript probes a script's service definition, prints its endpoints, and
+// optionally runs a sample payload through each endpoint without NATS
+func runTestScript(ctx context.Context, out io.Writer, cfg config.Config, scriptPath, samplePayload string) error {
+	// Run the script the way the daemon would, with the configured interpreter,
+	// command template, environment, working directory and rlimits
+	runner := service.NewScriptRunnerWithOptions(scriptPath, cfg.RunnerOptions(scriptPath, ""))
+
+	definition, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get service definition: %w", err)
+	}
+
+	fmt.Fprintf(out, "Service: %s\n", definition.Name)
+	if definition.Version != "" {
+		fmt.Fprintf(out, "Version: %s\n", definition.Version)
+	}
+	if definition.Description != "" {
+		fmt.Fprintf(out, "Description: %s\n", definition.Description)
+	}
+
+	fmt.Fprintf(out, "Endpoints:\n")
+	for _, endpoint := range definition.Endpoints {
+		fmt.Fprintf(out, "  - %s (%s)\n", endpoint.Name, endpoint.Subject)
+		if endpoint.Description != "" {
+			fmt.Fprintf(out, "    %s\n", endpoint.Description)
+		}
+	}
+
+	if samplePayload == "" {
+		return nil
+	}
+
+	// Requests run under the service's own rlimits, known now that it has a name
+	runner = service.NewScriptRunnerWithOptions(scriptPath, cfg.RunnerOptions(scriptPath, definition.Name))
+
+	failed := 0
+	for _, endpoint := range definition.Endpoints {
+		fmt.Fprintf(out, "\nRequest %s <- %s\n", endpoint.Subject, samplePayload)
+
+		result, err := runner.ExecuteRequest(ctx, endpoint.Subject, []byte(samplePayload))
+		if err != nil {
+			fmt.Fprintf(out, "  error: %v\n", err)
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(out, "  exit code: %d\n", result.ExitCode)
+		if len(result.Stdout) > 0 {
+			fmt.Fprintf(out, "  stdout:\n%s\n", result.Stdout)
+		}
+		if len(result.Stderr) > 0 {
+			fmt.Fprintf(out, "  stderr:\n%s\n", result.Stderr)
+		}
+		if !result.Success {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sample requests failed", failed, len(definition.Endpoints))
+	}
+
+	return nil
+}
+
+// runValidate discovers the services in scripts_path without a NATS connection,
+// prints each service with its endpoints and every script that failed to load,
+// and fails if any did
+func runValidate(out io.Writer, options CLIOptions) error {
+	cfg, err := loadConfiguration(options.ConfigFile, options)
+	if err != nil {
+		return err
+	}
+
+	serviceManager := supervisor.NewManager(cfg.ScriptsPath, nil, zerolog.Nop(), *cfg)
+	scriptErrors, err := serviceManager.Validate()
+
+	topology := serviceManager.Topology()
+	for _, topologyService := range topology.Services {
+		fmt.Fprintf(out, "Service: %s", topologyService.Name)
+		if topologyService.Version != "" {
+			fmt.Fprintf(out, " (%s)", topologyService.Version)
+		}
+		fmt.Fprintln(out)
+		for _, endpoint := range topologyService.Endpoints {
+			fmt.Fprintf(out, "  - %s (%s) %s\n", endpoint.Name, endpoint.Subject, endpoint.Script)
+		}
+	}
+	for _, scriptError := range scriptErrors {
+		fmt.Fprintf(out, "Invalid: %v\n", scriptError)
+	}
+
+	if err != nil {
+		return err
+	}
+	if len(scriptErrors) > 0 {
+		return fmt.Errorf("%d invalid scripts in %s", len(scriptErrors), cfg.ScriptsPath)
+	}
+	fmt.Fprintf(out, "%d services valid\n", len(topology.Services))
+	return nil
+}
+
+// topologyRequestTimeout bounds how long -export-topology and -compare-topology
+// wait for the daemon to answer
+const topologyRequestTimeout = 5 * time.Second
+
+// runTopology fetches the topology a running daemon serves, then prints it
+// (-export-topology) or the differences from an exported file (-compare-topology)
+func runTopology(out io.Writer, options CLIOptions) error {
+	cfg, err := loadConfiguration(options.ConfigFile, options)
+	if err != nil {
+		return err
+	}
+
+	natsConn, err := connectToNATS(cfg, zerolog.Nop())
+	if err != nil {
+		return err
+	}
+	defer natsConn.Close()
+
+	subject := cfg.PrefixSubject(supervisor.TopologySubject)
+	if options.TopologyHost != "" {
+		subject = cfg.PrefixSubjectWith(options.TopologyHost, supervisor.TopologySubject)
+	}
+	topology, err := fetchTopology(natsConn, subject)
+	if err != nil {
+		return err
+	}
+
+	if options.CompareTopology != "" {
+		return compareTopology(out, options.CompareTopology, topology)
+	}
+	return exportTopology(out, topology)
+}
+
+// fetchTopology requests a daemon's topology on its admin topology subject
+func fetchTopology(natsConn *nats.Conn, subject string) (supervisor.Topology, error) {
+	var topology supervisor.Topology
+
+	msg, err := natsConn.Request(subject, nil, topologyRequestTimeout)
+	if err != nil {
+		return topology, fmt.Errorf("failed to request topology on %s: %w", subject, err)
+	}
+	if err := json.Unmarshal(msg.Data, &topology); err != nil {
+		return topology, fmt.Errorf("failed to decode topology: %w", err)
+	}
+	return topology, nil
+}
+
+// exportTopology writes a topology as indented JSON, ready to be saved and diffed
+func exportTopology(out io.Writer, topology supervisor.Topology) error {
+	data, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode topology: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
+
+// compareTopology prints how a topology differs from one exported to path, and
+// fails when they differ so scripts can detect drift from the exit code
+func compareTopology(out io.Writer, path string, topology supervisor.Topology) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read topology file: %w", err)
+	}
+	var exported supervisor.Topology
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return fmt.Errorf("failed to decode topology file %s: %w", path, err)
+	}
+
+	changes := supervisor.DiffTopology(exported, topology)
+	for _, change := range changes {
+		fmt.Fprintln(out, change)
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("topology differs from %s in %d places", path, len(changes))
+	}
+	return nil
+}
+
 // showHelp displays help information
 func showHelp() {
 	fmt.Printf(`%s - NATS Shell Micro Service Daemon
@@ -180,14 +565,24 @@ USAGE:
 OPTIONS:
     -config <path>       Path to configuration file (default: config.toml)
     -log-level <level>   Override log level (trace, debug, info, warn, error)
+    -log-format <format> Override log format (json, console)
     -help               Show this help message
     -version            Show version information
+    -test-script <path>  Run a script's info and sample requests locally, then exit
+    -sample-payload <json>
+                         Payload sent to each endpoint when using -test-script
+    -validate            List the services in scripts_path without NATS, then exit
+    -export-topology     Print the topology a running daemon serves as JSON, then exit
+    -compare-topology <path>
+                         Compare a running daemon's topology with an exported file
+    -topology-host <host>
+                         Host to export or compare (default: this host)
 
 DESCRIPTION:
     %s is a specialized service that discovers and hosts NATS microservices 
     from shell scripts on the local filesystem. It monitors a specified 
-    directory for shell scripts (*.sh) and automatically registers each 
-    script as a unique NATS microservice.
+    directory for shell scripts (*.sh, or include_globs) and 
+    automatically registers each script as a unique NATS microservice.
 
 CONFIGURATION:
     The configuration file is in TOML format with the following structure:
@@ -206,13 +601,28 @@ EXAMPLES:
     # Override log level to debug
     %s -log-level debug
 
+    # Readable, colorized logs in a terminal
+    %s -log-format console
+
     # Show version
     %s -version
 
+    # Test a script locally without NATS
+    %s -test-script ./scripts/greeting.sh -sample-payload '{"name": "Alice"}'
+
+    # Check the scripts directory in CI
+    %s -validate -config config.toml
+
+    # Check that web02 serves the same topology as web01
+    %s -export-topology -topology-host web01 > web01.json
+    %s -compare-topology web01.json -topology-host web02
+
 SIGNALS:
     SIGINT, SIGTERM    Gracefully shutdown the daemon
+    SIGHUP             Rescan scripts_path: add new scripts, restart services whose
+                       info changed, remove services of vanished scripts
 
-`, AppName, AppName, AppName, AppName, AppName, AppName, AppName)
+`, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName)
 }
 
 // showVersion displays version information
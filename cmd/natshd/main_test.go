@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hiway/natshd/internal/config"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
 )
 
 func TestParseFlags(t *testing.T) {
@@ -44,6 +51,15 @@ func TestParseFlags(t *testing.T) {
 			},
 			hasError: false,
 		},
+		{
+			name: "custom log format",
+			args: []string{"natshd", "-log-format", "console"},
+			expected: CLIOptions{
+				ConfigFile: "config.toml",
+				LogFormat:  "console",
+			},
+			hasError: false,
+		},
 		{
 			name: "all custom flags",
 			args: []string{"natshd", "-config", "my-config.toml", "-log-level", "warn"},
@@ -71,6 +87,35 @@ func TestParseFlags(t *testing.T) {
 			},
 			hasError: false,
 		},
+		{
+			name: "test script flags",
+			args: []string{"natshd", "-test-script", "./scripts/greeting.sh", "-sample-payload", "{}"},
+			expected: CLIOptions{
+				ConfigFile:    "config.toml",
+				TestScript:    "./scripts/greeting.sh",
+				SamplePayload: "{}",
+			},
+			hasError: false,
+		},
+		{
+			name: "validate flag",
+			args: []string{"natshd", "-validate", "-config", "ci.toml"},
+			expected: CLIOptions{
+				ConfigFile: "ci.toml",
+				Validate:   true,
+			},
+			hasError: false,
+		},
+		{
+			name: "topology flags",
+			args: []string{"natshd", "-compare-topology", "web01.json", "-topology-host", "web02"},
+			expected: CLIOptions{
+				ConfigFile:      "config.toml",
+				CompareTopology: "web01.json",
+				TopologyHost:    "web02",
+			},
+			hasError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -94,6 +139,10 @@ func TestParseFlags(t *testing.T) {
 					t.Errorf("Expected LogLevel %s, got %s", tt.expected.LogLevel, options.LogLevel)
 				}
 
+				if options.LogFormat != tt.expected.LogFormat {
+					t.Errorf("Expected LogFormat %s, got %s", tt.expected.LogFormat, options.LogFormat)
+				}
+
 				if options.ShowHelp != tt.expected.ShowHelp {
 					t.Errorf("Expected ShowHelp %v, got %v", tt.expected.ShowHelp, options.ShowHelp)
 				}
@@ -101,6 +150,30 @@ func TestParseFlags(t *testing.T) {
 				if options.ShowVersion != tt.expected.ShowVersion {
 					t.Errorf("Expected ShowVersion %v, got %v", tt.expected.ShowVersion, options.ShowVersion)
 				}
+
+				if options.TestScript != tt.expected.TestScript {
+					t.Errorf("Expected TestScript %s, got %s", tt.expected.TestScript, options.TestScript)
+				}
+
+				if options.SamplePayload != tt.expected.SamplePayload {
+					t.Errorf("Expected SamplePayload %s, got %s", tt.expected.SamplePayload, options.SamplePayload)
+				}
+
+				if options.Validate != tt.expected.Validate {
+					t.Errorf("Expected Validate %v, got %v", tt.expected.Validate, options.Validate)
+				}
+
+				if options.ExportTopology != tt.expected.ExportTopology {
+					t.Errorf("Expected ExportTopology %v, got %v", tt.expected.ExportTopology, options.ExportTopology)
+				}
+
+				if options.CompareTopology != tt.expected.CompareTopology {
+					t.Errorf("Expected CompareTopology %s, got %s", tt.expected.CompareTopology, options.CompareTopology)
+				}
+
+				if options.TopologyHost != tt.expected.TopologyHost {
+					t.Errorf("Expected TopologyHost %s, got %s", tt.expected.TopologyHost, options.TopologyHost)
+				}
 			}
 		})
 	}
@@ -152,6 +225,25 @@ log_level = "info"
 				LogLevel:    "debug",
 			},
 		},
+		{
+			name:       "CLI log format override",
+			configFile: "format.toml",
+			configData: `
+nats_url = "nats://localhost:4222"
+scripts_path = "./scripts"
+log_format = "json"
+`,
+			cliOptions: CLIOptions{
+				LogFormat: "console",
+			},
+			expectError: false,
+			expectConfig: &config.Config{
+				NatsURL:     "nats://localhost:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				LogFormat:   "console",
+			},
+		},
 		{
 			name:        "missing config file",
 			configFile:  "nonexistent.toml",
@@ -213,6 +305,10 @@ log_level = "info"
 				if cfg.LogLevel != tt.expectConfig.LogLevel {
 					t.Errorf("Expected LogLevel %s, got %s", tt.expectConfig.LogLevel, cfg.LogLevel)
 				}
+
+				if tt.expectConfig.LogFormat != "" && cfg.LogFormat != tt.expectConfig.LogFormat {
+					t.Errorf("Expected LogFormat %s, got %s", tt.expectConfig.LogFormat, cfg.LogFormat)
+				}
 			}
 		})
 	}
@@ -239,7 +335,55 @@ func TestConnectToNATS(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			conn, err := connectToNATS(tt.natsURL)
+			conn, err := connectToNATS(&config.Config{NatsURL: tt.natsURL}, zerolog.Nop())
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestConnectToNATS_UserPassword(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{
+		Host:     "127.0.0.1",
+		Port:     -1,
+		NoLog:    true,
+		NoSigs:   true,
+		Username: "natshd",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready for connections")
+	}
+	defer ns.Shutdown()
+
+	tests := []struct {
+		name        string
+		user        string
+		password    string
+		expectError bool
+	}{
+		{name: "correct credentials", user: "natshd", password: "secret"},
+		{name: "wrong password", user: "natshd", password: "wrong", expectError: true},
+		{name: "anonymous", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := connectToNATS(&config.Config{NatsURL: ns.ClientURL(), NatsUser: tt.user, NatsPassword: tt.password}, zerolog.Nop())
 
 			if tt.expectError && err == nil {
 				t.Error("Expected error but got none")
@@ -256,6 +400,186 @@ func TestConnectToNATS(t *testing.T) {
 	}
 }
 
+func TestLoadConfiguration_MissingCredsFile(t *testing.T) {
+	tempDir := t.TempDir()
+	credsPath := filepath.Join(tempDir, "missing.creds")
+	configPath := filepath.Join(tempDir, "creds.toml")
+	configData := `
+nats_url = "tls://connect.ngs.global"
+scripts_path = "./scripts"
+nats_creds_file = "` + credsPath + `"
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err := loadConfiguration(configPath, CLIOptions{})
+	if err == nil {
+		t.Fatal("Expected error for missing creds file but got none")
+	}
+	if !strings.Contains(err.Error(), credsPath) {
+		t.Errorf("Expected error to mention %s, got: %v", credsPath, err)
+	}
+
+	if err := os.WriteFile(credsPath, []byte("placeholder"), 0600); err != nil {
+		t.Fatalf("Failed to create creds file: %v", err)
+	}
+	cfg, err := loadConfiguration(configPath, CLIOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error with creds file present: %v", err)
+	}
+	if cfg.NatsCredsFile != credsPath {
+		t.Errorf("Expected NatsCredsFile %s, got %s", credsPath, cfg.NatsCredsFile)
+	}
+}
+
+func TestNatsOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              config.Config
+		expectedUser     string
+		expectedPassword string
+		expectedToken    string
+		expectCreds      bool
+	}{
+		{name: "anonymous", cfg: config.Config{}},
+		{name: "user and password", cfg: config.Config{NatsUser: "natshd", NatsPassword: "secret"}, expectedUser: "natshd", expectedPassword: "secret"},
+		{name: "token", cfg: config.Config{NatsToken: "s3cr3t"}, expectedToken: "s3cr3t"},
+		{name: "creds file", cfg: config.Config{NatsCredsFile: "natshd.creds"}, expectCreds: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The creds option checks the file when applied
+			if tt.cfg.NatsCredsFile != "" {
+				tt.cfg.NatsCredsFile = filepath.Join(t.TempDir(), tt.cfg.NatsCredsFile)
+				if err := os.WriteFile(tt.cfg.NatsCredsFile, []byte("placeholder"), 0600); err != nil {
+					t.Fatalf("Failed to create creds file: %v", err)
+				}
+			}
+
+			opts := nats.GetDefaultOptions()
+			for _, opt := range natsOptions(&tt.cfg, zerolog.Nop()) {
+				if err := opt(&opts); err != nil {
+					t.Fatalf("Failed to apply option: %v", err)
+				}
+			}
+
+			if opts.User != tt.expectedUser {
+				t.Errorf("Expected user '%s', got '%s'", tt.expectedUser, opts.User)
+			}
+			if opts.Password != tt.expectedPassword {
+				t.Errorf("Expected password '%s', got '%s'", tt.expectedPassword, opts.Password)
+			}
+			if opts.Token != tt.expectedToken {
+				t.Errorf("Expected token '%s', got '%s'", tt.expectedToken, opts.Token)
+			}
+			if (opts.UserJWT != nil) != tt.expectCreds {
+				t.Errorf("Expected credentials callbacks set to be %v, got %v", tt.expectCreds, opts.UserJWT != nil)
+			}
+		})
+	}
+}
+
+func TestNatsOptions_Reconnect(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               config.Config
+		expectedMax       int
+		expectedWait      time.Duration
+		expectedBufferLen int
+	}{
+		{
+			name:              "zero reconnect_max disables reconnects, the rest keep nats.go defaults",
+			cfg:               config.Config{},
+			expectedMax:       0,
+			expectedWait:      nats.DefaultReconnectWait,
+			expectedBufferLen: nats.DefaultReconnectBufSize,
+		},
+		{
+			name:              "configured",
+			cfg:               config.Config{ReconnectMax: -1, ReconnectWaitMs: 250, ReconnectBufferBytes: 1024},
+			expectedMax:       -1,
+			expectedWait:      250 * time.Millisecond,
+			expectedBufferLen: 1024,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := nats.GetDefaultOptions()
+			for _, opt := range natsOptions(&tt.cfg, zerolog.Nop()) {
+				if err := opt(&opts); err != nil {
+					t.Fatalf("Failed to apply option: %v", err)
+				}
+			}
+
+			if opts.MaxReconnect != tt.expectedMax {
+				t.Errorf("Expected MaxReconnect %d, got %d", tt.expectedMax, opts.MaxReconnect)
+			}
+			if opts.ReconnectWait != tt.expectedWait {
+				t.Errorf("Expected ReconnectWait %v, got %v", tt.expectedWait, opts.ReconnectWait)
+			}
+			if opts.ReconnectBufSize != tt.expectedBufferLen {
+				t.Errorf("Expected ReconnectBufSize %d, got %d", tt.expectedBufferLen, opts.ReconnectBufSize)
+			}
+			if opts.DisconnectedErrCB == nil || opts.ReconnectedCB == nil || opts.ClosedCB == nil {
+				t.Error("Expected disconnect, reconnect and closed handlers to be registered")
+			}
+		})
+	}
+}
+
+func TestConnectToNATS_LogsReconnect(t *testing.T) {
+	serverOpts := &server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true}
+	ns, err := server.NewServer(serverOpts)
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready for connections")
+	}
+
+	var logOutput syncBuffer
+	logger := zerolog.New(&logOutput)
+	conn, err := connectToNATS(&config.Config{NatsURL: ns.ClientURL(), ReconnectMax: -1, ReconnectWaitMs: 50}, logger)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Restart the server on the same port
+	serverOpts.Port = ns.Addr().(*net.TCPAddr).Port
+	ns.Shutdown()
+	ns.WaitForShutdown()
+
+	ns, err = server.NewServer(serverOpts)
+	if err != nil {
+		t.Fatalf("Failed to recreate NATS server: %v", err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("Restarted NATS server not ready for connections")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logOutput.String(), "Reconnected to NATS server") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected reconnect to be logged, got: %s", logOutput.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !strings.Contains(logOutput.String(), "Disconnected from NATS server") {
+		t.Errorf("Expected disconnect to be logged, got: %s", logOutput.String())
+	}
+	if !conn.IsConnected() {
+		t.Error("Expected the connection to be usable after the server restarted")
+	}
+}
+
 func TestRunApplication(t *testing.T) {
 	// Create temporary directory and config for testing
 	tempDir := t.TempDir()
@@ -304,6 +628,239 @@ func TestShowVersion(t *testing.T) {
 	showVersion()
 }
 
+// testScriptDefaults is the config -test-script uses for a script when there is no config file
+func testScriptDefaults(scriptPath string) config.Config {
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = filepath.Dir(scriptPath)
+	return cfg
+}
+
+func TestRunTestScript(t *testing.T) {
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := runTestScript(ctx, &out, testScriptDefaults("../../scripts/greeting.sh"), "../../scripts/greeting.sh", `{"name": "Alice"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v, output: %s", err, out.String())
+	}
+
+	output := out.String()
+	for _, expected := range []string{"Service: GreetingService", "Greet (greeting.greet)", "Farewell (greeting.farewell)", "exit code: 0", "Alice"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRunTestScript_InvalidScript(t *testing.T) {
+	var out bytes.Buffer
+
+	err := runTestScript(context.Background(), &out, config.DefaultConfig(), "/nonexistent/script.sh", "")
+	if err == nil {
+		t.Error("Expected error for missing script")
+	}
+}
+
+func TestRunTestScript_UsesConfiguredRunnerOptions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Not executable, so it only runs through the configured interpreter
+	scriptPath := filepath.Join(tempDir, "env.sh")
+	script := `if [[ "$1" == "info" ]]; then
+  echo '{"name": "EnvService", "endpoints": [{"name": "Show", "subject": "env.show"}]}'
+  exit 0
+fi
+echo "region=$REGION"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	configPath := filepath.Join(tempDir, "config.toml")
+	configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "` + tempDir + `"
+interpreter = "/bin/bash"
+
+[script_env]
+REGION = "us-east"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	cfg, err := testScriptConfiguration(&out, CLIOptions{ConfigFile: configPath})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := runTestScript(ctx, &out, *cfg, scriptPath, `{}`); err != nil {
+		t.Fatalf("Unexpected error: %v, output: %s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "region=us-east") {
+		t.Errorf("Expected the script to run with script_env, got:\n%s", out.String())
+	}
+
+	// Without the config the daemon would not run it either
+	out.Reset()
+	defaults, err := testScriptConfiguration(&out, CLIOptions{ConfigFile: filepath.Join(tempDir, "missing.toml"), TestScript: scriptPath})
+	if err != nil {
+		t.Fatalf("Expected defaults without a config file, got %v", err)
+	}
+	if !strings.Contains(out.String(), "default settings") {
+		t.Errorf("Expected a note about default settings, got %q", out.String())
+	}
+	if err := runTestScript(ctx, &out, *defaults, scriptPath, ""); err == nil {
+		t.Error("Expected a non-executable script to fail without the configured interpreter")
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	greeting, err := os.ReadFile("../../scripts/greeting.sh")
+	if err != nil {
+		t.Fatalf("Failed to read greeting script: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		scripts     map[string]string
+		expectError bool
+		expected    []string
+	}{
+		{
+			name:     "valid scripts",
+			scripts:  map[string]string{"greeting.sh": string(greeting)},
+			expected: []string{"Service: GreetingService", "  - Greet (greeting.greet) greeting.sh", "1 services valid"},
+		},
+		{
+			name: "invalid script",
+			scripts: map[string]string{
+				"greeting.sh": string(greeting),
+				"broken.sh":   "#!/usr/bin/env bash\necho 'not json'\n",
+			},
+			expectError: true,
+			expected:    []string{"Service: GreetingService", "Invalid: ", "broken.sh: failed to get service definition"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			scriptsDir := filepath.Join(tempDir, "scripts")
+			if err := os.MkdirAll(scriptsDir, 0755); err != nil {
+				t.Fatalf("Failed to create scripts directory: %v", err)
+			}
+			for fileName, content := range tt.scripts {
+				if err := os.WriteFile(filepath.Join(scriptsDir, fileName), []byte(content), 0755); err != nil {
+					t.Fatalf("Failed to create test script: %v", err)
+				}
+			}
+
+			// Nothing listens here: validation must not connect
+			configPath := filepath.Join(tempDir, "ci.toml")
+			configData := `nats_url = "nats://nonexistent:4222"
+scripts_path = "` + scriptsDir + `"
+`
+			if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var out bytes.Buffer
+			err := runValidate(&out, CLIOptions{ConfigFile: configPath, Validate: true})
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunTopology(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready for connections")
+	}
+	defer ns.Shutdown()
+
+	// Stand in for the daemon on web02
+	conn, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS server: %v", err)
+	}
+	defer conn.Close()
+	_, err = conn.Subscribe("web02.natshd.topology", func(msg *nats.Msg) {
+		msg.Respond([]byte(`{"services": [{"name": "GreetingService", "version": "1.1.0", "prefix": "host", "scripts": ["greeting.sh"], "endpoints": [{"name": "Greet", "subject": "greeting.greet", "script": "greeting.sh"}]}]}`))
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.toml")
+	configData := `nats_url = "` + ns.ClientURL() + `"
+scripts_path = "` + tempDir + `"
+hostname = "web01"
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	// Export web02's topology as indented JSON
+	var exported bytes.Buffer
+	options := CLIOptions{ConfigFile: configPath, ExportTopology: true, TopologyHost: "web02"}
+	if err := runTopology(&exported, options); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if !strings.Contains(exported.String(), "\n  \"services\": [") {
+		t.Errorf("Expected indented JSON, got:\n%s", exported.String())
+	}
+
+	// Comparing web02 with its own export finds nothing
+	exportPath := filepath.Join(tempDir, "web02.json")
+	if err := os.WriteFile(exportPath, exported.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to save export: %v", err)
+	}
+	var out bytes.Buffer
+	options = CLIOptions{ConfigFile: configPath, CompareTopology: exportPath, TopologyHost: "web02"}
+	if err := runTopology(&out, options); err != nil {
+		t.Errorf("Expected matching topology, got %v:\n%s", err, out.String())
+	}
+
+	// Comparing with an older export reports the drift
+	older := strings.Replace(exported.String(), `"1.1.0"`, `"1.0.0"`, 1)
+	if err := os.WriteFile(exportPath, []byte(older), 0644); err != nil {
+		t.Fatalf("Failed to save export: %v", err)
+	}
+	out.Reset()
+	if err := runTopology(&out, options); err == nil {
+		t.Error("Expected an error for a differing topology")
+	}
+	if expected := `~ service GreetingService version "1.0.0" -> "1.1.0"`; !strings.Contains(out.String(), expected) {
+		t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+	}
+
+	// The default host is the one from the config, which no daemon answers for here
+	options = CLIOptions{ConfigFile: configPath, ExportTopology: true}
+	if err := runTopology(&out, options); err == nil {
+		t.Error("Expected an error without a daemon on web01")
+	}
+}
+
 func TestApplicationSetup(t *testing.T) {
 	// Create temporary directory and config
 	tempDir := t.TempDir()
@@ -359,13 +916,17 @@ func TestValidateApplicationComponents(t *testing.T) {
 	}
 
 	// Test logger setup
-	logger, err := setupApplicationLogger(cfg)
+	logger, flushLogs, err := setupApplicationLogger(cfg)
 	if err != nil {
 		t.Errorf("Failed to setup logger: %v", err)
 	}
 
 	// Test that we can actually log with the logger
 	logger.Info().Msg("Test log message")
+
+	if err := flushLogs(); err != nil {
+		t.Errorf("Failed to flush logs: %v", err)
+	}
 }
 
 func TestSignalHandling(t *testing.T) {
@@ -385,3 +946,21 @@ func TestSignalHandling(t *testing.T) {
 		t.Error("Expected context to be cancelled")
 	}
 }
+
+// syncBuffer is a bytes.Buffer safe for the NATS callbacks' goroutines
+type syncBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
@@ -2,9 +2,16 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
 )
 
 // Config represents the application configuration
@@ -13,15 +20,301 @@ type Config struct {
 	ScriptsPath string `toml:"scripts_path"`
 	LogLevel    string `toml:"log_level"`
 	Hostname    string `toml:"hostname"`
+
+	// LogFormat is "json" (default) for one JSON object per line, or "console"
+	// for colorized, human-readable lines while developing
+	LogFormat string `toml:"log_format"`
+
+	// NatsUser and NatsPassword authenticate the NATS connection; both empty
+	// connects anonymously
+	NatsUser     string `toml:"nats_user"`
+	NatsPassword string `toml:"nats_password"`
+
+	// NatsToken authenticates the NATS connection with a shared token instead
+	// of a user and password
+	NatsToken string `toml:"nats_token"`
+
+	// NatsCredsFile is a .creds file holding a user JWT and NKey seed, as used
+	// by NGS and other decentralized JWT deployments
+	NatsCredsFile string `toml:"nats_creds_file"`
+
+	// ReconnectMax is how many times to reconnect after losing the NATS
+	// connection before giving up; -1 (default) retries forever
+	ReconnectMax int `toml:"reconnect_max"`
+	// ReconnectWaitMs is the pause between reconnect attempts to the same server
+	ReconnectWaitMs int `toml:"reconnect_wait_ms"`
+	// ReconnectBufferBytes buffers outgoing messages (e.g. replies) while reconnecting
+	ReconnectBufferBytes int `toml:"reconnect_buffer_bytes"`
+
+	// AccessLog is a file receiving one line per request, separate from the JSON
+	// log; "-" writes to stdout and empty disables it
+	AccessLog string `toml:"access_log"`
+	// AccessLogFormat is the access log line with {time}, {service}, {subject},
+	// {status}, {duration_ms}, {request_bytes} and {response_bytes} placeholders
+	AccessLogFormat string `toml:"access_log_format"`
+
+	// StatsdAddr is a StatsD server ("host:port") receiving request counts and
+	// timings over UDP; empty disables metrics
+	StatsdAddr string `toml:"statsd_addr"`
+
+	// Environment and Region are static labels attached to every log line
+	Environment string `toml:"environment"`
+	Region      string `toml:"region"`
+
+	// LogBufferSize buffers log output in memory up to this many bytes to save
+	// syscalls under heavy load (0 = write every line immediately)
+	LogBufferSize int `toml:"log_buffer_size"`
+	// LogFlushIntervalMs is the longest buffered log lines wait before being written
+	LogFlushIntervalMs int `toml:"log_flush_interval_ms"`
+	// LogFile also writes JSON logs to this file, rotated once it would grow past
+	// LogMaxSizeMB megabytes (empty = stdout only)
+	LogFile      string `toml:"log_file"`
+	LogMaxSizeMB int    `toml:"log_max_size_mb"`
+	// LogRedactKeys are top-level JSON keys (case-insensitive) whose values are
+	// logged as "***" in request logs, e.g. "password"
+	LogRedactKeys []string `toml:"log_redact_keys"`
+	// LogPayloadMaxBytes cuts longer payloads in request logs (0 = log whole)
+	LogPayloadMaxBytes int `toml:"log_payload_max_bytes"`
+	// LogSampleRate logs only 1 in this many successful requests at debug level;
+	// failed requests are always logged (0 or 1 = log every request)
+	LogSampleRate int `toml:"log_sample_rate"`
+
+	// MaxFileEventWorkers bounds how many debounced file event actions run at once
+	MaxFileEventWorkers int `toml:"max_file_event_workers"`
+	// MaxConcurrentRestarts bounds how many services restart at once after their
+	// scripts change; further restarts queue for a free slot
+	MaxConcurrentRestarts int `toml:"max_concurrent_restarts"`
+	// DebounceIntervalMs is how long file events settle before an action runs
+	DebounceIntervalMs int `toml:"debounce_interval_ms"`
+	// MaxDiscoveryDepth limits how many directory levels below scripts_path are
+	// searched for scripts; 1 means only scripts_path itself (0 = unlimited)
+	MaxDiscoveryDepth int `toml:"max_discovery_depth"`
+	// MaxConcurrentRequests is the shared budget of concurrent script executions
+	// across all services, consumed by each endpoint's cost (0 = unlimited)
+	MaxConcurrentRequests int `toml:"max_concurrent_requests"`
+	// MaxConcurrent caps concurrent script executions of each service, on top of
+	// the shared max_concurrent_requests budget (0 = unlimited)
+	MaxConcurrent int `toml:"max_concurrent"`
+	// ServiceMaxConcurrent overrides max_concurrent for services by name
+	ServiceMaxConcurrent map[string]int `toml:"service_max_concurrent"`
+	// ConcurrencyOverflow is what happens to requests over max_concurrent:
+	// "queue" (default) waits for a slot, "reject" fails with "too busy" at once
+	ConcurrencyOverflow string `toml:"concurrency_overflow"`
+	// ConcurrencyQueueSize bounds the requests queued per service; more are
+	// rejected as too busy (default 100, 0 queues none)
+	ConcurrencyQueueSize int `toml:"concurrency_queue_size"`
+	// ProcessStartRate paces script process starts to at most this many per
+	// ProcessStartIntervalMs, smoothing fork bursts (0 = unpaced)
+	ProcessStartRate       int `toml:"process_start_rate"`
+	ProcessStartIntervalMs int `toml:"process_start_interval_ms"`
+	// RequestTimeoutMs stops a request, including its wait for a free slot, that
+	// runs longer than this (default 30s, -1 = no limit)
+	RequestTimeoutMs int `toml:"request_timeout_ms"`
+	// CircuitBreakerThreshold is how many consecutive timeouts open an endpoint's
+	// circuit breaker, failing its requests fast for the cooldown (0 = disabled)
+	CircuitBreakerThreshold int `toml:"circuit_breaker_threshold"`
+	// CircuitBreakerCooldownMs is how long an open breaker fails requests fast
+	// before letting a trial request through
+	CircuitBreakerCooldownMs int `toml:"circuit_breaker_cooldown_ms"`
+	// DrainTimeoutMs is how long a stopping or removed service waits for in-flight
+	// requests to respond before giving up on them
+	DrainTimeoutMs int `toml:"drain_timeout_ms"`
+	// RequestScheduling decides who gets freed budget when requests are queued:
+	// "fifo" (default) serves in arrival order, "fair" round-robins across services
+	RequestScheduling string `toml:"request_scheduling"`
+	// CommandTemplate wraps script execution for sandboxing or testing, e.g.
+	// "firejail --quiet {{.Script}} {{.Arg}}" (empty = run the script directly)
+	CommandTemplate string `toml:"command_template"`
+	// Interpreter runs every script as "interpreter script arg", e.g. "/bin/bash",
+	// so scripts on filesystems without the executable bit still load
+	Interpreter string `toml:"interpreter"`
+	// StdinLineEndings set to "lf" normalizes request payload line endings before
+	// they are written to a script's stdin (empty = pass bytes verbatim)
+	StdinLineEndings string `toml:"stdin_line_endings"`
+	// StdinTrailingNewline appends a newline to request payloads that lack one
+	StdinTrailingNewline bool `toml:"stdin_trailing_newline"`
+	// InfoFormat set to "jsonc" lets info output carry comments and trailing
+	// commas (empty or "json" = strict JSON)
+	InfoFormat string `toml:"info_format"`
+	// CleanEnv runs scripts with only the PassEnv variables instead of inheriting
+	// natshd's entire environment, which may hold secrets meant for natshd alone
+	CleanEnv bool     `toml:"clean_env"`
+	PassEnv  []string `toml:"pass_env"`
+	// ScriptEnv sets variables for every script, e.g. ENVIRONMENT = "prod",
+	// overriding inherited variables of the same name
+	ScriptEnv map[string]string `toml:"script_env"`
+	// ScriptWorkdir is the working directory scripts run in: unset runs them in
+	// scripts_path, "" in the directory holding each script
+	ScriptWorkdir *string `toml:"script_workdir"`
+	// Rlimits caps the resources of every script process (Unix only), and
+	// ServiceRlimits overrides individual limits for services by name
+	Rlimits        service.Rlimits            `toml:"rlimits"`
+	ServiceRlimits map[string]service.Rlimits `toml:"service_rlimits"`
+	// RequireScriptOwner only loads scripts owned by this "user" or "user:group"
+	// (names or numeric ids, Unix only); empty loads scripts of any owner
+	RequireScriptOwner string `toml:"require_script_owner"`
+	// MaxScriptSizeBytes skips larger script files instead of running them
+	// (0 = unlimited)
+	MaxScriptSizeBytes int64 `toml:"max_script_size_bytes"`
+	// MaxOutputBytes caps the stdout and stderr captured from each request's
+	// script; output past it is discarded and logged as truncated (0 = unlimited)
+	MaxOutputBytes int64 `toml:"max_output_bytes"`
+	// ExecutableExtensions are the file name suffixes loaded as services, e.g.
+	// ".sh" and ".py"; "" loads any executable file
+	ExecutableExtensions []string `toml:"executable_extensions"`
+	// IncludeGlobs are file name patterns (filepath.Match) loaded as services; when
+	// set they replace executable_extensions (default "*.sh")
+	IncludeGlobs []string `toml:"include_globs"`
+	// ExcludeGlobs are file name patterns never loaded or probed, even when they
+	// match IncludeGlobs, e.g. "_*.sh" for helper libraries
+	ExcludeGlobs []string `toml:"exclude_globs"`
+	// MaxMetadataDepth flattens endpoint metadata nested deeper than this many
+	// levels into JSON strings (0 = unlimited)
+	MaxMetadataDepth int `toml:"max_metadata_depth"`
+	// DisabledServices are service names that are never registered, even when
+	// their scripts are present and valid
+	DisabledServices []string `toml:"disabled_services"`
+	// RequiredServices are service names that must load during startup discovery
+	RequiredServices []string `toml:"required_services"`
+	// RequiredServicesPolicy is what happens when a required service is missing:
+	// "fail" (default) aborts startup, "unhealthy" keeps running but reports unhealthy
+	RequiredServicesPolicy string `toml:"required_services_policy"`
+	// WarmupReply answers requests that arrive while a service is starting or
+	// restarting with a retriable 503 error instead of letting them time out
+	WarmupReply bool `toml:"warmup_reply"`
+	// RestartBufferSize, when positive, buffers up to that many requests arriving
+	// while a service (re)starts and replays them once its endpoints are registered,
+	// instead of dropping them (or answering "warming up")
+	RestartBufferSize int `toml:"restart_buffer_size"`
+	// RestartBufferTimeoutMs is how long a buffered request may wait for replay
+	// before it is answered with a retriable 503 instead
+	RestartBufferTimeoutMs int `toml:"restart_buffer_timeout_ms"`
+	// InfoConsistencyCheck compares a restarted service's fresh info probe against
+	// the cached definition and warns when it changed without a script modification
+	InfoConsistencyCheck bool `toml:"info_consistency_check"`
+	// RecreatePolicy controls a script removed and recreated within the debounce window:
+	// "restart" (default) restarts it gracefully, "recreate" removes and re-adds it
+	RecreatePolicy string `toml:"recreate_policy"`
+	// ServiceStopTimeoutMs bounds how long stopping a micro service may take on
+	// restart or shutdown before natshd moves on without it
+	ServiceStopTimeoutMs int `toml:"service_stop_timeout_ms"`
+	// RestartUnregisterTimeoutMs bounds how long a restart waits for the old micro
+	// service to stop answering before registering the new one
+	RestartUnregisterTimeoutMs int `toml:"restart_unregister_timeout_ms"`
+	// GroupVersionPolicy refuses to group scripts under one service name when their
+	// versions differ: "any" (default), "major", "minor", or "exact"
+	GroupVersionPolicy string `toml:"group_version_policy"`
+	// StrictGrouping fails a service whose grouped scripts declare the same
+	// endpoint subject, instead of warning and keeping the first script's
+	StrictGrouping bool `toml:"strict_grouping"`
+	// AllowWildcards lets endpoints subscribe to NATS wildcard subjects such as
+	// "metrics.*" or "events.>"; the script gets the concrete subject as $1
+	AllowWildcards bool `toml:"allow_wildcards"`
+	// SubjectConflictPolicy handles a service whose subjects overlap another
+	// service's, including through wildcards: "warn" (default) or "refuse"
+	SubjectConflictPolicy string `toml:"subject_conflict_policy"`
+	// PermissionPolling controls the scan for executable-bit changes: "auto"
+	// (default) polls only where fsnotify lacks chmod events, "on" or "off" force it
+	PermissionPolling string `toml:"permission_polling"`
+	// PermissionPollMs is how often that scan walks the scripts directory
+	// (default 5000, 0 = never)
+	PermissionPollMs int `toml:"permission_poll_ms"`
+	// PendingScriptWindowMs is how long a newly created script that is not yet
+	// executable is watched for its executable bit, so a create-then-chmod is
+	// picked up promptly instead of on the next permission poll
+	PendingScriptWindowMs int `toml:"pending_script_window_ms"`
+	// WrapResponses wraps every successful response in a {"data": ..., "meta": ...}
+	// envelope instead of passing the script's stdout through unchanged
+	WrapResponses bool `toml:"wrap_responses"`
+	// OutputFilter is a named post-processing step for successful script output:
+	// "strip_ansi" or "json" (empty = none)
+	OutputFilter string `toml:"output_filter"`
+	// OutputFilterCommand pipes successful script output through an external command,
+	// after OutputFilter, and responds with its stdout (empty = none)
+	OutputFilterCommand string `toml:"output_filter_command"`
+	// StartupSummarySubject, when set, is where the startup summary is published as
+	// JSON in addition to being logged
+	StartupSummarySubject string `toml:"startup_summary_subject"`
+	// HeartbeatIntervalMs publishes uptime, service count, in-flight requests, and
+	// connection status to <hostname>.natshd.heartbeat this often (0 = disabled)
+	HeartbeatIntervalMs int `toml:"heartbeat_interval_ms"`
+	// EventsSubject, when set, is where service added/removed/restarted events
+	// are published as JSON, with the hostname appended as the last token
+	EventsSubject string `toml:"events_subject"`
+	// AdminService registers a "natshd" micro service whose list endpoint, on
+	// <admin_subject_prefix>.<hostname>.list, describes the hosted services
+	AdminService bool `toml:"admin_service"`
+	// AdminSubjectPrefix is the first token of admin service subjects (default "natshd")
+	AdminSubjectPrefix string `toml:"admin_subject_prefix"`
+
+	// SubjectPrefixMode is the subject prefix of services that don't choose one:
+	// "hostname" (default), "none" for plain subjects, or a literal custom prefix
+	SubjectPrefixMode string `toml:"subject_prefix_mode"`
+	// SubjectSeparator joins the subject prefix to endpoint subjects (default ".");
+	// a multi-token separator like ".svc." inserts extra tokens after the prefix
+	SubjectSeparator string `toml:"subject_separator"`
+	// CollapseSubjectDots collapses runs of dots where the prefix and separator
+	// meet, so a prefix or separator ending in "." doesn't produce empty tokens
+	CollapseSubjectDots bool `toml:"collapse_subject_dots"`
+	// NamespaceSubjects places the endpoints of a service that declares a
+	// namespace under it, e.g. web01.storage.backup.run
+	NamespaceSubjects bool `toml:"namespace_subjects"`
+
+	// ServicePrefixes override the subject prefix of services by name: "host",
+	// "none", or a custom prefix, taking precedence over the service's own "prefix"
+	ServicePrefixes map[string]string `toml:"service_prefixes"`
+
+	// EndpointOverrides replace the endpoints a script declares in its info
+	// response, for remapping subjects of scripts that can't be edited
+	EndpointOverrides []EndpointOverride `toml:"endpoint_overrides"`
+}
+
+// EndpointOverride replaces the endpoints of one script, or of every script of a
+// service. A script match takes precedence over a service match.
+type EndpointOverride struct {
+	Script    string             `toml:"script"`
+	Service   string             `toml:"service"`
+	Endpoints []service.Endpoint `toml:"endpoints"`
 }
 
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() Config {
 	return Config{
-		NatsURL:     "nats://127.0.0.1:4222",
-		ScriptsPath: "./scripts",
-		LogLevel:    "info",
-		Hostname:    "auto",
+		NatsURL:                    "nats://127.0.0.1:4222",
+		ScriptsPath:                "./scripts",
+		LogLevel:                   "info",
+		LogFormat:                  "json",
+		Hostname:                   "auto",
+		SubjectPrefixMode:          "hostname",
+		SubjectSeparator:           ".",
+		ReconnectMax:               -1,
+		ReconnectWaitMs:            2000,
+		ReconnectBufferBytes:       8 * 1024 * 1024,
+		LogFlushIntervalMs:         1000,
+		LogMaxSizeMB:               100,
+		AccessLogFormat:            logging.DefaultAccessLogFormat,
+		MaxFileEventWorkers:        4,
+		MaxConcurrentRestarts:      2,
+		DebounceIntervalMs:         500,
+		DrainTimeoutMs:             5000,
+		ConcurrencyOverflow:        "queue",
+		ConcurrencyQueueSize:       100,
+		RequestTimeoutMs:           30000,
+		CircuitBreakerCooldownMs:   30000,
+		ProcessStartIntervalMs:     100,
+		RequiredServicesPolicy:     "fail",
+		RecreatePolicy:             "restart",
+		RestartUnregisterTimeoutMs: 2000,
+		ServiceStopTimeoutMs:       5000,
+		RestartBufferTimeoutMs:     5000,
+		RequestScheduling:          "fifo",
+		PermissionPolling:          "auto",
+		PermissionPollMs:           5000,
+		PendingScriptWindowMs:      2000,
+		GroupVersionPolicy:         "any",
+		SubjectConflictPolicy:      "warn",
+		AdminSubjectPrefix:         "natshd",
+		ExecutableExtensions:       []string{".sh"},
 	}
 }
 
@@ -39,14 +332,279 @@ func (c Config) ResolveHostname() (string, error) {
 	return c.Hostname, nil
 }
 
-// PrefixSubject prefixes a NATS subject with the resolved hostname
+// PrefixSubject prefixes a NATS subject according to subject_prefix_mode, with
+// the resolved hostname by default
 func (c Config) PrefixSubject(subject string) string {
-	hostname, err := c.ResolveHostname()
+	return c.PrefixSubjectWith("", subject)
+}
+
+// DefaultPrefixPolicy is the prefix policy of services that don't declare one,
+// from subject_prefix_mode: "host" for hostname, "none", or the custom prefix
+func (c Config) DefaultPrefixPolicy() string {
+	switch c.SubjectPrefixMode {
+	case "", "hostname":
+		return service.PrefixHost
+	default:
+		return c.SubjectPrefixMode
+	}
+}
+
+// ServicePrefix returns the prefix policy for a service: its service_prefixes entry
+// if configured, otherwise the policy the service declared
+func (c Config) ServicePrefix(serviceName, declared string) string {
+	if policy, ok := c.ServicePrefixes[serviceName]; ok {
+		return policy
+	}
+	return declared
+}
+
+// NamespaceSubject places a subject under a service's namespace when
+// namespace_subjects is set, before the subject prefix is applied
+func (c Config) NamespaceSubject(namespace, subject string) string {
+	if !c.NamespaceSubjects || namespace == "" {
+		return subject
+	}
+	return namespace + "." + subject
+}
+
+// StripNamespaceSubject removes the namespace NamespaceSubject adds, returning
+// subjects outside the namespace as-is
+func (c Config) StripNamespaceSubject(namespace, subject string) string {
+	if !c.NamespaceSubjects || namespace == "" {
+		return subject
+	}
+	return strings.TrimPrefix(subject, namespace+".")
+}
+
+// SubjectPrefix resolves a prefix policy to the literal prefix, empty for "none".
+// An empty policy follows subject_prefix_mode.
+func (c Config) SubjectPrefix(policy string) string {
+	if policy == "" {
+		policy = c.DefaultPrefixPolicy()
+	}
+
+	switch policy {
+	case service.PrefixHost:
+		hostname, err := c.ResolveHostname()
+		if err != nil {
+			// Fallback to "unknown" if hostname resolution fails
+			hostname = "unknown"
+		}
+		return hostname
+	case service.PrefixNone:
+		return ""
+	default:
+		return policy
+	}
+}
+
+// PrefixSubjectWith prefixes a NATS subject according to a prefix policy
+func (c Config) PrefixSubjectWith(policy, subject string) string {
+	prefix := c.subjectPrefixWithSeparator(policy)
+	if prefix == "" {
+		return subject
+	}
+	return prefix + subject
+}
+
+// StripSubjectPrefixWith removes the prefix PrefixSubjectWith adds for a policy,
+// returning subjects without that prefix as-is
+func (c Config) StripSubjectPrefixWith(policy, subject string) string {
+	prefix := c.subjectPrefixWithSeparator(policy)
+	if prefix == "" {
+		return subject
+	}
+	if len(subject) > len(prefix) && strings.HasPrefix(subject, prefix) {
+		return subject[len(prefix):]
+	}
+	return subject
+}
+
+// subjectPrefixWithSeparator returns the policy's prefix joined with the subject
+// separator, empty when the policy has no prefix
+func (c Config) subjectPrefixWithSeparator(policy string) string {
+	prefix := c.SubjectPrefix(policy)
+	if prefix == "" {
+		return ""
+	}
+
+	separator := c.SubjectSeparator
+	if separator == "" {
+		separator = "."
+	}
+
+	joined := prefix + separator
+	if c.CollapseSubjectDots {
+		for strings.Contains(joined, "..") {
+			joined = strings.ReplaceAll(joined, "..", ".")
+		}
+	}
+	return joined
+}
+
+// ScriptOwner resolves require_script_owner to the uid and gid scripts must
+// have; -1 means that id is not checked
+func (c Config) ScriptOwner() (int, int, error) {
+	uid, gid := -1, -1
+	if c.RequireScriptOwner == "" {
+		return uid, gid, nil
+	}
+
+	userName, groupName, hasGroup := strings.Cut(c.RequireScriptOwner, ":")
+	if userName == "" || (hasGroup && groupName == "") {
+		return uid, gid, fmt.Errorf("%q must be \"user\" or \"user:group\"", c.RequireScriptOwner)
+	}
+
+	uid, err := strconv.Atoi(userName)
 	if err != nil {
-		// Fallback to "unknown" if hostname resolution fails
-		hostname = "unknown"
+		u, lookupErr := user.Lookup(userName)
+		if lookupErr != nil {
+			return -1, -1, fmt.Errorf("unknown user %q: %w", userName, lookupErr)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+
+	if hasGroup {
+		gid, err = strconv.Atoi(groupName)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(groupName)
+			if lookupErr != nil {
+				return -1, -1, fmt.Errorf("unknown group %q: %w", groupName, lookupErr)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
 	}
-	return hostname + "." + subject
+
+	return uid, gid, nil
+}
+
+// MaxConcurrentFor returns the concurrent execution limit for a service: its
+// service_max_concurrent entry if configured, otherwise max_concurrent
+func (c Config) MaxConcurrentFor(serviceName string) int {
+	if limit, ok := c.ServiceMaxConcurrent[serviceName]; ok && serviceName != "" {
+		return limit
+	}
+	return c.MaxConcurrent
+}
+
+// ScriptWorkdirFor returns the working directory a script runs in
+func (c Config) ScriptWorkdirFor(scriptPath string) string {
+	switch {
+	case c.ScriptWorkdir == nil:
+		return c.ScriptsPath
+	case *c.ScriptWorkdir == "":
+		return filepath.Dir(scriptPath)
+	default:
+		return *c.ScriptWorkdir
+	}
+}
+
+// RlimitsFor returns the resource limits for a service's scripts: the global
+// rlimits with any service_rlimits entry for the service applied on top
+func (c Config) RlimitsFor(serviceName string) service.Rlimits {
+	limits := c.Rlimits
+	if override, ok := c.ServiceRlimits[serviceName]; ok && serviceName != "" {
+		limits = limits.Merge(override)
+	}
+	return limits
+}
+
+// RunnerOptions returns the options scripts are run with: the execution settings
+// of the config and the resource limits of the named service (empty before the
+// name is known)
+func (c Config) RunnerOptions(scriptPath, serviceName string) service.RunnerOptions {
+	return service.RunnerOptions{
+		CommandTemplate:      c.CommandTemplate,
+		StdinLineEndings:     c.StdinLineEndings,
+		StdinTrailingNewline: c.StdinTrailingNewline,
+		CleanEnv:             c.CleanEnv,
+		PassEnv:              c.PassEnv,
+		Env:                  c.ScriptEnv,
+		Dir:                  c.ScriptWorkdirFor(scriptPath),
+		Rlimits:              c.RlimitsFor(serviceName),
+		InfoFormat:           c.InfoFormat,
+		Interpreter:          c.Interpreter,
+		MaxOutputBytes:       c.MaxOutputBytes,
+		AllowWildcards:       c.AllowWildcards,
+	}
+}
+
+// ServiceDisabled reports whether a service is listed in disabled_services
+func (c Config) ServiceDisabled(serviceName string) bool {
+	for _, name := range c.DisabledServices {
+		if name == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceRequired reports whether a service is listed in required_services
+func (c Config) ServiceRequired(serviceName string) bool {
+	for _, name := range c.RequiredServices {
+		if name == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// LogLabels returns the static labels to attach to every log line
+func (c Config) LogLabels() map[string]string {
+	labels := make(map[string]string)
+	if c.Environment != "" {
+		labels["environment"] = c.Environment
+	}
+	if c.Region != "" {
+		labels["region"] = c.Region
+	}
+	return labels
+}
+
+// ScriptIncludeGlobs returns the file name patterns loaded as services:
+// include_globs if set, otherwise one pattern per executable_extensions entry
+func (c Config) ScriptIncludeGlobs() []string {
+	if len(c.IncludeGlobs) > 0 {
+		return c.IncludeGlobs
+	}
+
+	extensions := c.ExecutableExtensions
+	if len(extensions) == 0 {
+		extensions = []string{".sh"}
+	}
+	globs := make([]string, 0, len(extensions))
+	for _, extension := range extensions {
+		globs = append(globs, "*"+extension)
+	}
+	return globs
+}
+
+// EndpointOverrideFor returns the override endpoints for a script, if any
+func (c Config) EndpointOverrideFor(scriptPath, serviceName string) ([]service.Endpoint, bool) {
+	for _, override := range c.EndpointOverrides {
+		if override.Script != "" && sameFile(override.Script, scriptPath) {
+			return override.Endpoints, true
+		}
+	}
+
+	for _, override := range c.EndpointOverrides {
+		if override.Script == "" && override.Service != "" && override.Service == serviceName {
+			return override.Endpoints, true
+		}
+	}
+
+	return nil, false
+}
+
+// sameFile compares two paths after cleaning them and resolving them to absolute paths
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
 }
 
 // LoadConfig loads configuration from a TOML file
@@ -57,7 +615,8 @@ func LoadConfig(path string) (Config, error) {
 
 	// Start with an empty config to detect missing required fields
 	var config Config
-	if _, err := toml.DecodeFile(path, &config); err != nil {
+	metadata, err := toml.DecodeFile(path, &config)
+	if err != nil {
 		return Config{}, fmt.Errorf("failed to decode config file: %w", err)
 	}
 
@@ -66,10 +625,137 @@ func LoadConfig(path string) (Config, error) {
 		config.LogLevel = "info"
 	}
 
+	if config.LogFormat == "" {
+		config.LogFormat = "json"
+	}
+
 	if config.Hostname == "" {
 		config.Hostname = "auto"
 	}
 
+	if config.SubjectPrefixMode == "" {
+		config.SubjectPrefixMode = "hostname"
+	}
+
+	if config.SubjectSeparator == "" {
+		config.SubjectSeparator = "."
+	}
+
+	if config.AdminSubjectPrefix == "" {
+		config.AdminSubjectPrefix = "natshd"
+	}
+
+	// 0 disables reconnects, so only a missing setting gets the default
+	if !metadata.IsDefined("reconnect_max") {
+		config.ReconnectMax = -1
+	}
+
+	if config.ReconnectWaitMs == 0 {
+		config.ReconnectWaitMs = 2000
+	}
+
+	if config.ReconnectBufferBytes == 0 {
+		config.ReconnectBufferBytes = 8 * 1024 * 1024
+	}
+
+	if config.LogFlushIntervalMs == 0 {
+		config.LogFlushIntervalMs = 1000
+	}
+
+	if config.LogMaxSizeMB == 0 {
+		config.LogMaxSizeMB = 100
+	}
+
+	if config.AccessLogFormat == "" {
+		config.AccessLogFormat = logging.DefaultAccessLogFormat
+	}
+
+	if config.MaxFileEventWorkers == 0 {
+		config.MaxFileEventWorkers = 4
+	}
+
+	if len(config.ExecutableExtensions) == 0 {
+		config.ExecutableExtensions = []string{".sh"}
+	}
+
+	if config.MaxConcurrentRestarts == 0 {
+		config.MaxConcurrentRestarts = 2
+	}
+
+	if config.DebounceIntervalMs == 0 {
+		config.DebounceIntervalMs = 500
+	}
+
+	if config.DrainTimeoutMs == 0 {
+		config.DrainTimeoutMs = 5000
+	}
+
+	if config.ConcurrencyOverflow == "" {
+		config.ConcurrencyOverflow = "queue"
+	}
+
+	// 0 leaves no waiting room, so only a missing setting gets the default
+	if !metadata.IsDefined("concurrency_queue_size") {
+		config.ConcurrencyQueueSize = 100
+	}
+
+	if config.RequestTimeoutMs == 0 {
+		config.RequestTimeoutMs = 30000
+	}
+
+	if config.CircuitBreakerCooldownMs == 0 {
+		config.CircuitBreakerCooldownMs = 30000
+	}
+
+	if config.ProcessStartIntervalMs == 0 {
+		config.ProcessStartIntervalMs = 100
+	}
+
+	if config.RequiredServicesPolicy == "" {
+		config.RequiredServicesPolicy = "fail"
+	}
+
+	if config.RecreatePolicy == "" {
+		config.RecreatePolicy = "restart"
+	}
+
+	if config.RestartUnregisterTimeoutMs == 0 {
+		config.RestartUnregisterTimeoutMs = 2000
+	}
+
+	if config.ServiceStopTimeoutMs == 0 {
+		config.ServiceStopTimeoutMs = 5000
+	}
+
+	if config.RestartBufferTimeoutMs == 0 {
+		config.RestartBufferTimeoutMs = 5000
+	}
+
+	if config.PendingScriptWindowMs == 0 {
+		config.PendingScriptWindowMs = 2000
+	}
+
+	if config.RequestScheduling == "" {
+		config.RequestScheduling = "fifo"
+	}
+
+	if config.PermissionPolling == "" {
+		config.PermissionPolling = "auto"
+	}
+
+	// 0 turns the poller off, so only a missing setting gets the default
+	if !metadata.IsDefined("permission_poll_ms") {
+		config.PermissionPollMs = 5000
+	}
+
+	if config.GroupVersionPolicy == "" {
+		config.GroupVersionPolicy = "any"
+	}
+
+	if config.SubjectConflictPolicy == "" {
+		config.SubjectConflictPolicy = "warn"
+	}
+
 	if err := config.Validate(); err != nil {
 		return Config{}, fmt.Errorf("invalid configuration: %w", err)
 	}
@@ -83,6 +769,30 @@ func (c Config) Validate() error {
 		return fmt.Errorf("nats_url is required")
 	}
 
+	if (c.NatsUser == "") != (c.NatsPassword == "") {
+		return fmt.Errorf("nats_user and nats_password must be set together")
+	}
+
+	if c.NatsToken != "" && c.NatsUser != "" {
+		return fmt.Errorf("nats_token cannot be combined with nats_user and nats_password")
+	}
+
+	if c.ReconnectMax < -1 {
+		return fmt.Errorf("reconnect_max must be -1 (forever) or 0 or more attempts")
+	}
+
+	if c.ReconnectWaitMs < 0 {
+		return fmt.Errorf("reconnect_wait_ms cannot be negative")
+	}
+
+	if c.ReconnectBufferBytes < 0 {
+		return fmt.Errorf("reconnect_buffer_bytes cannot be negative")
+	}
+
+	if c.NatsCredsFile != "" && (c.NatsUser != "" || c.NatsToken != "") {
+		return fmt.Errorf("nats_creds_file cannot be combined with nats_user/nats_password or nats_token")
+	}
+
 	if c.ScriptsPath == "" {
 		return fmt.Errorf("scripts_path is required")
 	}
@@ -101,5 +811,331 @@ func (c Config) Validate() error {
 		return fmt.Errorf("invalid log level: %s, must be one of: trace, debug, info, warn, error, fatal, panic", c.LogLevel)
 	}
 
+	switch c.LogFormat {
+	case "", logging.FormatJSON, logging.FormatConsole:
+	default:
+		return fmt.Errorf("invalid log_format: %s, must be one of: json, console", c.LogFormat)
+	}
+
+	if c.LogBufferSize < 0 {
+		return fmt.Errorf("log_buffer_size cannot be negative")
+	}
+
+	if c.LogFlushIntervalMs < 0 {
+		return fmt.Errorf("log_flush_interval_ms cannot be negative")
+	}
+
+	if c.LogMaxSizeMB < 0 {
+		return fmt.Errorf("log_max_size_mb cannot be negative")
+	}
+
+	for i, key := range c.LogRedactKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("log_redact_keys[%d] cannot be empty", i)
+		}
+	}
+
+	if c.LogPayloadMaxBytes < 0 {
+		return fmt.Errorf("log_payload_max_bytes cannot be negative")
+	}
+
+	if c.LogSampleRate < 0 {
+		return fmt.Errorf("log_sample_rate cannot be negative")
+	}
+
+	if c.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddr); err != nil {
+			return fmt.Errorf("invalid statsd_addr: %w", err)
+		}
+	}
+
+	if err := logging.ValidateAccessLogFormat(c.AccessLogFormat); err != nil {
+		return fmt.Errorf("invalid access_log_format: %w", err)
+	}
+
+	if c.MaxFileEventWorkers < 0 {
+		return fmt.Errorf("max_file_event_workers cannot be negative")
+	}
+
+	if c.MaxConcurrentRestarts < 0 {
+		return fmt.Errorf("max_concurrent_restarts cannot be negative")
+	}
+
+	if c.HeartbeatIntervalMs < 0 {
+		return fmt.Errorf("heartbeat_interval_ms cannot be negative")
+	}
+
+	if c.DebounceIntervalMs < 0 {
+		return fmt.Errorf("debounce_interval_ms cannot be negative")
+	}
+
+	if c.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests cannot be negative")
+	}
+
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent cannot be negative")
+	}
+	for serviceName, limit := range c.ServiceMaxConcurrent {
+		if limit < 0 {
+			return fmt.Errorf("service_max_concurrent entry for %s cannot be negative", serviceName)
+		}
+	}
+
+	switch c.ConcurrencyOverflow {
+	case "", "queue", "reject":
+	default:
+		return fmt.Errorf("invalid concurrency_overflow: %s, must be one of: queue, reject", c.ConcurrencyOverflow)
+	}
+
+	if c.ConcurrencyQueueSize < 0 {
+		return fmt.Errorf("concurrency_queue_size cannot be negative")
+	}
+
+	if c.RestartUnregisterTimeoutMs < 0 {
+		return fmt.Errorf("restart_unregister_timeout_ms cannot be negative")
+	}
+
+	if c.ServiceStopTimeoutMs < 0 {
+		return fmt.Errorf("service_stop_timeout_ms cannot be negative")
+	}
+
+	if c.RestartBufferSize < 0 {
+		return fmt.Errorf("restart_buffer_size cannot be negative")
+	}
+
+	if c.RestartBufferTimeoutMs < 0 {
+		return fmt.Errorf("restart_buffer_timeout_ms cannot be negative")
+	}
+
+	if c.PendingScriptWindowMs < 0 {
+		return fmt.Errorf("pending_script_window_ms cannot be negative")
+	}
+
+	if c.MaxDiscoveryDepth < 0 {
+		return fmt.Errorf("max_discovery_depth cannot be negative")
+	}
+
+	if c.ProcessStartRate < 0 {
+		return fmt.Errorf("process_start_rate cannot be negative")
+	}
+
+	if c.ProcessStartIntervalMs < 0 {
+		return fmt.Errorf("process_start_interval_ms cannot be negative")
+	}
+
+	if c.RequestTimeoutMs < -1 {
+		return fmt.Errorf("request_timeout_ms must be -1 (no limit) or a positive number of milliseconds")
+	}
+
+	if c.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("circuit_breaker_threshold cannot be negative")
+	}
+
+	if c.CircuitBreakerThreshold > 0 && c.RequestTimeoutMs < 0 {
+		return fmt.Errorf("circuit_breaker_threshold requires request_timeout_ms")
+	}
+
+	if c.CircuitBreakerCooldownMs < 0 {
+		return fmt.Errorf("circuit_breaker_cooldown_ms cannot be negative")
+	}
+
+	if c.DrainTimeoutMs < 0 {
+		return fmt.Errorf("drain_timeout_ms cannot be negative")
+	}
+
+	if c.CommandTemplate != "" {
+		if err := service.ValidateCommandTemplate(c.CommandTemplate); err != nil {
+			return fmt.Errorf("invalid command_template: %w", err)
+		}
+	}
+
+	if c.Interpreter != "" && strings.TrimSpace(c.Interpreter) == "" {
+		return fmt.Errorf("interpreter cannot be blank")
+	}
+
+	if c.Interpreter != "" && c.CommandTemplate != "" {
+		return fmt.Errorf("interpreter cannot be combined with command_template, put the interpreter in the template instead")
+	}
+
+	if _, err := service.NewOutputFilter(c.OutputFilter, c.OutputFilterCommand); err != nil {
+		return fmt.Errorf("invalid output filter: %w", err)
+	}
+
+	for i, name := range c.RequiredServices {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("required_services[%d] cannot be empty", i)
+		}
+	}
+
+	for i, name := range c.DisabledServices {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("disabled_services[%d] cannot be empty", i)
+		}
+		if c.ServiceRequired(name) {
+			return fmt.Errorf("service %s cannot be both required and disabled", name)
+		}
+	}
+
+	switch c.RequiredServicesPolicy {
+	case "", "fail", "unhealthy":
+	default:
+		return fmt.Errorf("invalid required_services_policy: %s, must be one of: fail, unhealthy", c.RequiredServicesPolicy)
+	}
+
+	for i, name := range c.PassEnv {
+		if strings.TrimSpace(name) == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("pass_env[%d] is not a valid variable name: %q", i, name)
+		}
+	}
+
+	for name := range c.ScriptEnv {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "= \t\n\x00") {
+			return fmt.Errorf("script_env has an invalid variable name: %q", name)
+		}
+	}
+
+	switch c.StdinLineEndings {
+	case "", service.LineEndingsLF:
+	default:
+		return fmt.Errorf("invalid stdin_line_endings: %s, must be: %s", c.StdinLineEndings, service.LineEndingsLF)
+	}
+
+	switch c.InfoFormat {
+	case "", service.InfoFormatJSON, service.InfoFormatJSONC:
+	default:
+		return fmt.Errorf("invalid info_format: %s, must be one of: %s, %s", c.InfoFormat, service.InfoFormatJSON, service.InfoFormatJSONC)
+	}
+
+	switch c.RecreatePolicy {
+	case "", "restart", "recreate":
+	default:
+		return fmt.Errorf("invalid recreate_policy: %s, must be one of: restart, recreate", c.RecreatePolicy)
+	}
+
+	switch c.RequestScheduling {
+	case "", "fifo", "fair":
+	default:
+		return fmt.Errorf("invalid request_scheduling: %s, must be one of: fifo, fair", c.RequestScheduling)
+	}
+
+	switch c.PermissionPolling {
+	case "", "auto", "on", "off":
+	default:
+		return fmt.Errorf("invalid permission_polling: %s, must be one of: auto, on, off", c.PermissionPolling)
+	}
+
+	if c.PermissionPollMs < 0 {
+		return fmt.Errorf("permission_poll_ms cannot be negative")
+	}
+
+	if strings.ContainsAny(c.SubjectPrefixMode, " \t\r\n*>") || strings.HasPrefix(c.SubjectPrefixMode, ".") {
+		return fmt.Errorf("invalid subject_prefix_mode: %q, must be hostname, none, or a prefix without whitespace or wildcards", c.SubjectPrefixMode)
+	}
+
+	if strings.ContainsAny(c.SubjectSeparator, " \t\r\n*>") {
+		return fmt.Errorf("invalid subject_separator: %q, must not contain whitespace or wildcards", c.SubjectSeparator)
+	}
+
+	if strings.ContainsAny(c.EventsSubject, " \t\r\n*>") || strings.HasPrefix(c.EventsSubject, ".") || strings.HasSuffix(c.EventsSubject, ".") {
+		return fmt.Errorf("invalid events_subject: %q, must be a subject without whitespace or wildcards", c.EventsSubject)
+	}
+
+	if c.AdminService && (c.AdminSubjectPrefix == "" || strings.ContainsAny(c.AdminSubjectPrefix, " \t\r\n*>") || strings.HasPrefix(c.AdminSubjectPrefix, ".") || strings.HasSuffix(c.AdminSubjectPrefix, ".")) {
+		return fmt.Errorf("invalid admin_subject_prefix: %q, must be a subject without whitespace or wildcards", c.AdminSubjectPrefix)
+	}
+
+	if err := c.Rlimits.Validate(); err != nil {
+		return fmt.Errorf("invalid rlimits: %w", err)
+	}
+
+	if c.MaxScriptSizeBytes < 0 {
+		return fmt.Errorf("max_script_size_bytes cannot be negative")
+	}
+
+	if c.MaxOutputBytes < 0 {
+		return fmt.Errorf("max_output_bytes cannot be negative")
+	}
+
+	if c.MaxMetadataDepth < 0 {
+		return fmt.Errorf("max_metadata_depth cannot be negative")
+	}
+
+	for i, extension := range c.ExecutableExtensions {
+		if extension != "" && (!strings.HasPrefix(extension, ".") || strings.ContainsAny(extension, `/\`)) {
+			return fmt.Errorf("executable_extensions[%d] must be empty or start with a dot: %q", i, extension)
+		}
+	}
+
+	for i, glob := range c.IncludeGlobs {
+		if err := validateFileNameGlob(glob); err != nil {
+			return fmt.Errorf("include_globs[%d]: %w", i, err)
+		}
+	}
+	for i, glob := range c.ExcludeGlobs {
+		if err := validateFileNameGlob(glob); err != nil {
+			return fmt.Errorf("exclude_globs[%d]: %w", i, err)
+		}
+	}
+
+	if _, _, err := c.ScriptOwner(); err != nil {
+		return fmt.Errorf("invalid require_script_owner: %w", err)
+	}
+
+	for serviceName, limits := range c.ServiceRlimits {
+		if err := limits.Validate(); err != nil {
+			return fmt.Errorf("invalid service_rlimits entry for %s: %w", serviceName, err)
+		}
+	}
+
+	for serviceName, prefix := range c.ServicePrefixes {
+		if err := service.ValidatePrefix(prefix); err != nil {
+			return fmt.Errorf("invalid service_prefixes entry for %s: %w", serviceName, err)
+		}
+	}
+
+	for i, override := range c.EndpointOverrides {
+		if override.Script == "" && override.Service == "" {
+			return fmt.Errorf("endpoint_overrides[%d] must set script or service", i)
+		}
+
+		// Validate the endpoints as a definition so names and subjects must be unique
+		definition := service.ServiceDefinition{Name: "override", Endpoints: override.Endpoints}
+		validate := definition.Validate
+		if c.AllowWildcards {
+			validate = definition.ValidateAllowingWildcards
+		}
+		if err := validate(); err != nil {
+			return fmt.Errorf("endpoint_overrides[%d] is invalid: %w", i, err)
+		}
+	}
+
+	switch c.GroupVersionPolicy {
+	case "", service.VersionPolicyAny, service.VersionPolicyMajor, service.VersionPolicyMinor, service.VersionPolicyExact:
+	default:
+		return fmt.Errorf("invalid group_version_policy: %s, must be one of: any, major, minor, exact", c.GroupVersionPolicy)
+	}
+
+	switch c.SubjectConflictPolicy {
+	case "", "warn", "refuse":
+	default:
+		return fmt.Errorf("invalid subject_conflict_policy: %s, must be one of: warn, refuse", c.SubjectConflictPolicy)
+	}
+
+	return nil
+}
+
+// validateFileNameGlob checks a pattern matched against file names, which never
+// contain a path separator
+func validateFileNameGlob(glob string) error {
+	if glob == "" {
+		return fmt.Errorf("pattern cannot be empty")
+	}
+	if strings.Contains(glob, "/") {
+		return fmt.Errorf("pattern %q is matched against file names and cannot contain a path separator", glob)
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", glob, err)
+	}
 	return nil
 }
@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -24,6 +28,150 @@ func TestDefaultConfig(t *testing.T) {
 	if config.Hostname != "auto" {
 		t.Errorf("Expected default Hostname to be 'auto', got '%s'", config.Hostname)
 	}
+
+	if config.SubjectPrefixMode != "hostname" {
+		t.Errorf("Expected default SubjectPrefixMode to be 'hostname', got '%s'", config.SubjectPrefixMode)
+	}
+
+	if config.SubjectSeparator != "." {
+		t.Errorf("Expected default SubjectSeparator to be '.', got '%s'", config.SubjectSeparator)
+	}
+
+	if config.LogFlushIntervalMs != 1000 {
+		t.Errorf("Expected default LogFlushIntervalMs to be 1000, got %d", config.LogFlushIntervalMs)
+	}
+
+	if config.ReconnectMax != -1 {
+		t.Errorf("Expected default ReconnectMax to be -1, got %d", config.ReconnectMax)
+	}
+
+	if config.ReconnectWaitMs != 2000 {
+		t.Errorf("Expected default ReconnectWaitMs to be 2000, got %d", config.ReconnectWaitMs)
+	}
+
+	if config.ReconnectBufferBytes != 8*1024*1024 {
+		t.Errorf("Expected default ReconnectBufferBytes to be 8388608, got %d", config.ReconnectBufferBytes)
+	}
+
+	if config.RequestTimeoutMs != 30000 {
+		t.Errorf("Expected default RequestTimeoutMs to be 30000, got %d", config.RequestTimeoutMs)
+	}
+
+	if config.MaxScriptSizeBytes != 0 {
+		t.Errorf("Expected default MaxScriptSizeBytes to be 0 (unlimited), got %d", config.MaxScriptSizeBytes)
+	}
+
+	if config.AccessLog != "" {
+		t.Errorf("Expected default AccessLog to be empty, got '%s'", config.AccessLog)
+	}
+
+	if config.AccessLogFormat != logging.DefaultAccessLogFormat {
+		t.Errorf("Expected default AccessLogFormat to be '%s', got '%s'", logging.DefaultAccessLogFormat, config.AccessLogFormat)
+	}
+
+	if config.MaxFileEventWorkers != 4 {
+		t.Errorf("Expected default MaxFileEventWorkers to be 4, got %d", config.MaxFileEventWorkers)
+	}
+
+	if !reflect.DeepEqual(config.ExecutableExtensions, []string{".sh"}) {
+		t.Errorf("Expected default ExecutableExtensions to be [.sh], got %v", config.ExecutableExtensions)
+	}
+
+	if config.MaxConcurrentRestarts != 2 {
+		t.Errorf("Expected default MaxConcurrentRestarts to be 2, got %d", config.MaxConcurrentRestarts)
+	}
+
+	if config.RestartUnregisterTimeoutMs != 2000 {
+		t.Errorf("Expected default RestartUnregisterTimeoutMs to be 2000, got %d", config.RestartUnregisterTimeoutMs)
+	}
+
+	if config.ServiceStopTimeoutMs != 5000 {
+		t.Errorf("Expected default ServiceStopTimeoutMs to be 5000, got %d", config.ServiceStopTimeoutMs)
+	}
+
+	if config.RestartBufferSize != 0 {
+		t.Errorf("Expected default RestartBufferSize to be 0 (disabled), got %d", config.RestartBufferSize)
+	}
+
+	if config.RestartBufferTimeoutMs != 5000 {
+		t.Errorf("Expected default RestartBufferTimeoutMs to be 5000, got %d", config.RestartBufferTimeoutMs)
+	}
+
+	if config.MaxDiscoveryDepth != 0 {
+		t.Errorf("Expected default MaxDiscoveryDepth to be 0 (unlimited), got %d", config.MaxDiscoveryDepth)
+	}
+
+	if config.PendingScriptWindowMs != 2000 {
+		t.Errorf("Expected default PendingScriptWindowMs to be 2000, got %d", config.PendingScriptWindowMs)
+	}
+
+	if config.CircuitBreakerCooldownMs != 30000 {
+		t.Errorf("Expected default CircuitBreakerCooldownMs to be 30000, got %d", config.CircuitBreakerCooldownMs)
+	}
+
+	if config.RequiredServicesPolicy != "fail" {
+		t.Errorf("Expected default RequiredServicesPolicy to be 'fail', got '%s'", config.RequiredServicesPolicy)
+	}
+
+	if config.ProcessStartIntervalMs != 100 {
+		t.Errorf("Expected default ProcessStartIntervalMs to be 100, got %d", config.ProcessStartIntervalMs)
+	}
+
+	if config.DrainTimeoutMs != 5000 {
+		t.Errorf("Expected default DrainTimeoutMs to be 5000, got %d", config.DrainTimeoutMs)
+	}
+
+	if config.RequestScheduling != "fifo" {
+		t.Errorf("Expected default RequestScheduling to be 'fifo', got '%s'", config.RequestScheduling)
+	}
+
+	if config.PermissionPolling != "auto" {
+		t.Errorf("Expected default PermissionPolling to be 'auto', got '%s'", config.PermissionPolling)
+	}
+
+	if config.PermissionPollMs != 5000 {
+		t.Errorf("Expected default PermissionPollMs to be 5000, got %d", config.PermissionPollMs)
+	}
+
+	if config.LogMaxSizeMB != 100 {
+		t.Errorf("Expected default LogMaxSizeMB to be 100, got %d", config.LogMaxSizeMB)
+	}
+
+	if config.LogFormat != "json" {
+		t.Errorf("Expected default LogFormat to be 'json', got '%s'", config.LogFormat)
+	}
+
+	if config.ConcurrencyOverflow != "queue" {
+		t.Errorf("Expected default ConcurrencyOverflow to be 'queue', got '%s'", config.ConcurrencyOverflow)
+	}
+
+	if config.ConcurrencyQueueSize != 100 {
+		t.Errorf("Expected default ConcurrencyQueueSize to be 100, got %d", config.ConcurrencyQueueSize)
+	}
+
+	if config.GroupVersionPolicy != "any" {
+		t.Errorf("Expected default GroupVersionPolicy to be 'any', got '%s'", config.GroupVersionPolicy)
+	}
+
+	if config.SubjectConflictPolicy != "warn" {
+		t.Errorf("Expected default SubjectConflictPolicy to be 'warn', got '%s'", config.SubjectConflictPolicy)
+	}
+
+	if config.StrictGrouping {
+		t.Error("Expected strict grouping to be disabled by default")
+	}
+
+	if config.AllowWildcards {
+		t.Error("Expected wildcard subjects to be disallowed by default")
+	}
+
+	if config.AdminService {
+		t.Error("Expected admin service to be disabled by default")
+	}
+
+	if config.AdminSubjectPrefix != "natshd" {
+		t.Errorf("Expected default AdminSubjectPrefix to be 'natshd', got '%s'", config.AdminSubjectPrefix)
+	}
 }
 
 func TestResolveHostname_Auto(t *testing.T) {
@@ -137,6 +285,260 @@ func TestPrefixSubject(t *testing.T) {
 	}
 }
 
+func TestPrefixSubject_CustomSeparator(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostname  string
+		mode      string
+		separator string
+		collapse  bool
+		subject   string
+		expected  string
+	}{
+		{
+			name:      "underscore separator",
+			hostname:  "web01",
+			separator: "_",
+			subject:   "system.facts",
+			expected:  "web01_system.facts",
+		},
+		{
+			name:      "underscore separator with custom prefix mode",
+			hostname:  "web01",
+			mode:      "tenant1",
+			separator: "_",
+			subject:   "system.facts",
+			expected:  "tenant1_system.facts",
+		},
+		{
+			name:      "dash separator",
+			hostname:  "web01",
+			separator: "-",
+			subject:   "system.facts",
+			expected:  "web01-system.facts",
+		},
+		{
+			name:      "multi-token separator",
+			hostname:  "web01",
+			separator: ".svc.",
+			subject:   "system.facts",
+			expected:  "web01.svc.system.facts",
+		},
+		{
+			name:      "duplicate dots kept",
+			hostname:  "web01.",
+			separator: ".svc.",
+			subject:   "system.facts",
+			expected:  "web01..svc.system.facts",
+		},
+		{
+			name:      "duplicate dots collapsed",
+			hostname:  "web01.",
+			separator: ".svc.",
+			collapse:  true,
+			subject:   "system.facts",
+			expected:  "web01.svc.system.facts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Hostname: tt.hostname, SubjectPrefixMode: tt.mode, SubjectSeparator: tt.separator, CollapseSubjectDots: tt.collapse}
+			result := config.PrefixSubject(tt.subject)
+
+			if result != tt.expected {
+				t.Errorf("Expected PrefixSubject('%s') to return '%s', got '%s'", tt.subject, tt.expected, result)
+			}
+
+			stripped := config.StripSubjectPrefixWith("", result)
+			if stripped != tt.subject {
+				t.Errorf("Expected stripping '%s' to return '%s', got '%s'", result, tt.subject, stripped)
+			}
+		})
+	}
+}
+
+func TestPrefixSubject_PrefixMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		subject  string
+		expected string
+	}{
+		{name: "hostname", mode: "hostname", subject: "system.facts", expected: "web01.system.facts"},
+		{name: "none", mode: "none", subject: "system.facts", expected: "system.facts"},
+		{name: "custom prefix", mode: "tenant1", subject: "system.facts", expected: "tenant1.system.facts"},
+		{name: "multi-token custom prefix", mode: "dc1.east", subject: "system.facts", expected: "dc1.east.system.facts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Hostname: "web01", SubjectPrefixMode: tt.mode}
+			result := config.PrefixSubject(tt.subject)
+
+			if result != tt.expected {
+				t.Errorf("Expected PrefixSubject('%s') to return '%s', got '%s'", tt.subject, tt.expected, result)
+			}
+
+			stripped := config.StripSubjectPrefixWith("", result)
+			if stripped != tt.subject {
+				t.Errorf("Expected stripping '%s' to return '%s', got '%s'", result, tt.subject, stripped)
+			}
+
+			// Subjects that never had the prefix are left alone
+			if tt.mode != "none" {
+				if unprefixed := config.StripSubjectPrefixWith("", "other.system.facts"); unprefixed != "other.system.facts" {
+					t.Errorf("Expected unprefixed subject to be returned as-is, got '%s'", unprefixed)
+				}
+			}
+		})
+	}
+}
+
+func TestRlimitsFor(t *testing.T) {
+	config := Config{
+		Rlimits: service.Rlimits{NoFile: 1024, CPUSeconds: 60},
+		ServiceRlimits: map[string]service.Rlimits{
+			"ReportService": {NoFile: 4096},
+		},
+	}
+
+	tests := []struct {
+		serviceName string
+		expected    service.Rlimits
+	}{
+		{"ReportService", service.Rlimits{NoFile: 4096, CPUSeconds: 60}},
+		{"OtherService", service.Rlimits{NoFile: 1024, CPUSeconds: 60}},
+		{"", service.Rlimits{NoFile: 1024, CPUSeconds: 60}},
+	}
+
+	for _, tt := range tests {
+		if limits := config.RlimitsFor(tt.serviceName); limits != tt.expected {
+			t.Errorf("Expected RlimitsFor(%q) to return %+v, got %+v", tt.serviceName, tt.expected, limits)
+		}
+	}
+}
+
+func TestMaxConcurrentFor(t *testing.T) {
+	config := Config{
+		MaxConcurrent:        8,
+		ServiceMaxConcurrent: map[string]int{"ReportService": 2, "BatchService": 0},
+	}
+
+	tests := []struct {
+		serviceName string
+		expected    int
+	}{
+		{"ReportService", 2},
+		{"BatchService", 0},
+		{"OtherService", 8},
+		{"", 8},
+	}
+
+	for _, tt := range tests {
+		if limit := config.MaxConcurrentFor(tt.serviceName); limit != tt.expected {
+			t.Errorf("Expected MaxConcurrentFor(%q) to return %d, got %d", tt.serviceName, tt.expected, limit)
+		}
+	}
+}
+
+func TestScriptWorkdirFor(t *testing.T) {
+	scriptDir := ""
+	customDir := "/srv/data"
+
+	tests := []struct {
+		name          string
+		scriptWorkdir *string
+		expected      string
+	}{
+		{name: "unset runs in scripts_path", scriptWorkdir: nil, expected: "/opt/scripts"},
+		{name: "empty runs in the script's directory", scriptWorkdir: &scriptDir, expected: "/opt/scripts/reports"},
+		{name: "custom directory", scriptWorkdir: &customDir, expected: "/srv/data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{ScriptsPath: "/opt/scripts", ScriptWorkdir: tt.scriptWorkdir}
+			if dir := config.ScriptWorkdirFor("/opt/scripts/reports/daily.sh"); dir != tt.expected {
+				t.Errorf("Expected working directory %s, got %s", tt.expected, dir)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ScriptWorkdir(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  string
+		expected string
+	}{
+		{name: "default", setting: "", expected: "./scripts"},
+		{name: "script directory", setting: `script_workdir = ""`, expected: "scripts/reports"},
+		{name: "custom directory", setting: `script_workdir = "/srv/data"`, expected: "/srv/data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+` + tt.setting
+			configPath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dir := config.ScriptWorkdirFor("./scripts/reports/daily.sh"); dir != tt.expected {
+				t.Errorf("Expected working directory %s, got %s", tt.expected, dir)
+			}
+		})
+	}
+}
+
+func TestLogLabels(t *testing.T) {
+	config := Config{Environment: "prod", Region: "eu-west"}
+	labels := config.LogLabels()
+
+	if labels["environment"] != "prod" {
+		t.Errorf("Expected environment label 'prod', got '%s'", labels["environment"])
+	}
+
+	if labels["region"] != "eu-west" {
+		t.Errorf("Expected region label 'eu-west', got '%s'", labels["region"])
+	}
+
+	if len(Config{}.LogLabels()) != 0 {
+		t.Error("Expected no labels when environment and region are unset")
+	}
+}
+
+func TestScriptIncludeGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{name: "default", config: DefaultConfig(), expected: []string{"*.sh"}},
+		{name: "from extensions", config: Config{ExecutableExtensions: []string{".sh", ".py", ""}}, expected: []string{"*.sh", "*.py", "*"}},
+		{
+			name:     "include globs replace extensions",
+			config:   Config{ExecutableExtensions: []string{".py"}, IncludeGlobs: []string{"svc-*"}},
+			expected: []string{"svc-*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if globs := tt.config.ScriptIncludeGlobs(); !reflect.DeepEqual(globs, tt.expected) {
+				t.Errorf("Expected include globs %v, got %v", tt.expected, globs)
+			}
+		})
+	}
+}
+
 func TestLoadConfig(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -232,48 +634,279 @@ hostname = "auto"`,
 	}
 }
 
-func TestLoadConfigFileNotFound(t *testing.T) {
-	_, err := LoadConfig("nonexistent.toml")
-	if err == nil {
-		t.Error("Expected error for nonexistent config file")
+func TestLoadConfig_EndpointOverrides(t *testing.T) {
+	configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+log_level = "info"
+
+[[endpoint_overrides]]
+script = "./scripts/vendor.sh"
+
+  [[endpoint_overrides.endpoints]]
+  name = "Get"
+  subject = "inventory.get"
+  request_type = "application/json"
+
+[[endpoint_overrides]]
+service = "ReportService"
+
+  [[endpoint_overrides.endpoints]]
+  name = "Daily"
+  subject = "reports.daily"
+`
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	endpoints, ok := config.EndpointOverrideFor("scripts/vendor.sh", "VendorService")
+	if !ok || len(endpoints) != 1 {
+		t.Fatalf("Expected one override endpoint for the script, got %v", endpoints)
+	}
+	if endpoints[0].Subject != "inventory.get" || endpoints[0].RequestType != "application/json" {
+		t.Errorf("Expected inventory.get with a JSON request type, got %+v", endpoints[0])
+	}
+
+	endpoints, ok = config.EndpointOverrideFor("scripts/reports.sh", "ReportService")
+	if !ok || len(endpoints) != 1 || endpoints[0].Subject != "reports.daily" {
+		t.Errorf("Expected reports.daily override for the service, got %v", endpoints)
+	}
+
+	if _, ok := config.EndpointOverrideFor("scripts/other.sh", "OtherService"); ok {
+		t.Error("Expected no override for an unlisted script")
 	}
 }
 
-func TestValidateConfig(t *testing.T) {
+func TestLoadConfig_PermissionPollMs(t *testing.T) {
 	tests := []struct {
-		name        string
-		config      Config
-		expectError bool
+		name     string
+		setting  string
+		expected int
 	}{
-		{
-			name: "valid config",
-			config: Config{
-				NatsURL:     "nats://127.0.0.1:4222",
-				ScriptsPath: "./scripts",
-				LogLevel:    "info",
-				Hostname:    "test-server",
-			},
-			expectError: false,
-		},
-		{
-			name: "valid config with auto hostname",
-			config: Config{
-				NatsURL:     "nats://127.0.0.1:4222",
-				ScriptsPath: "./scripts",
-				LogLevel:    "info",
-				Hostname:    "auto",
-			},
-			expectError: false,
-		},
-		{
-			name: "empty nats_url",
-			config: Config{
-				NatsURL:     "",
-				ScriptsPath: "./scripts",
-				LogLevel:    "info",
-				Hostname:    "server",
-			},
-			expectError: true,
+		{name: "default", setting: "", expected: 5000},
+		{name: "custom interval", setting: "permission_poll_ms = 60000", expected: 60000},
+		{name: "disabled", setting: "permission_poll_ms = 0", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+` + tt.setting
+			configPath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.PermissionPollMs != tt.expected {
+				t.Errorf("Expected PermissionPollMs %d, got %d", tt.expected, config.PermissionPollMs)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ReconnectMax(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  string
+		expected int
+	}{
+		{name: "default", setting: "", expected: -1},
+		{name: "limited", setting: "reconnect_max = 10", expected: 10},
+		{name: "disabled", setting: "reconnect_max = 0", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+` + tt.setting
+			configPath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.ReconnectMax != tt.expected {
+				t.Errorf("Expected ReconnectMax %d, got %d", tt.expected, config.ReconnectMax)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ConcurrencyQueueSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  string
+		expected int
+	}{
+		{name: "default", setting: "", expected: 100},
+		{name: "custom size", setting: "concurrency_queue_size = 10", expected: 10},
+		{name: "no waiting room", setting: "concurrency_queue_size = 0", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+` + tt.setting
+			configPath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.ConcurrencyQueueSize != tt.expected {
+				t.Errorf("Expected ConcurrencyQueueSize %d, got %d", tt.expected, config.ConcurrencyQueueSize)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ScriptEnv(t *testing.T) {
+	configContent := `nats_url = "nats://127.0.0.1:4222"
+scripts_path = "./scripts"
+
+[script_env]
+ENVIRONMENT = "prod"
+REGION = "us-east"
+`
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.ScriptEnv["ENVIRONMENT"] != "prod" || config.ScriptEnv["REGION"] != "us-east" {
+		t.Errorf("Expected script_env ENVIRONMENT=prod and REGION=us-east, got %v", config.ScriptEnv)
+	}
+}
+
+func TestLoadConfigFileNotFound(t *testing.T) {
+	_, err := LoadConfig("nonexistent.toml")
+	if err == nil {
+		t.Error("Expected error for nonexistent config file")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{
+			name: "valid config",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				Hostname:    "test-server",
+			},
+			expectError: false,
+		},
+		{
+			name: "valid config with auto hostname",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				Hostname:    "auto",
+			},
+			expectError: false,
+		},
+		{
+			name: "nats user and password",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				NatsUser:     "natshd",
+				NatsPassword: "secret",
+			},
+			expectError: false,
+		},
+		{
+			name: "nats token",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				NatsToken:   "s3cr3t",
+			},
+			expectError: false,
+		},
+		{
+			name: "nats token with user and password",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				NatsUser:     "natshd",
+				NatsPassword: "secret",
+				NatsToken:    "s3cr3t",
+			},
+			expectError: true,
+		},
+		{
+			name: "nats creds file with token",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				NatsToken:     "s3cr3t",
+				NatsCredsFile: "/etc/natshd/natshd.creds",
+			},
+			expectError: true,
+		},
+		{
+			name: "nats user without password",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				NatsUser:    "natshd",
+			},
+			expectError: true,
+		},
+		{
+			name: "nats password without user",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				NatsPassword: "secret",
+			},
+			expectError: true,
+		},
+		{
+			name: "empty nats_url",
+			config: Config{
+				NatsURL:     "",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				Hostname:    "server",
+			},
+			expectError: true,
 		},
 		{
 			name: "empty scripts_path",
@@ -295,6 +928,778 @@ func TestValidateConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "valid command template",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				CommandTemplate: "firejail --quiet {{.Script}} {{.Arg}}",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid command template",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				CommandTemplate: "firejail {{.Script",
+			},
+			expectError: true,
+		},
+		{
+			name: "fair request scheduling",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				RequestScheduling: "fair",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid request scheduling",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				RequestScheduling: "priority",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid permission polling",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				PermissionPolling: "sometimes",
+			},
+			expectError: true,
+		},
+		{
+			name: "subject separator with wildcard",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				SubjectSeparator: ".*.",
+			},
+			expectError: true,
+		},
+		{
+			name: "multi-token subject separator",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				SubjectSeparator: ".svc.",
+			},
+			expectError: false,
+		},
+		{
+			name: "endpoint override without script or service",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				EndpointOverrides: []EndpointOverride{
+					{Endpoints: []service.Endpoint{{Name: "Get", Subject: "inventory.get"}}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "endpoint override with invalid subject",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				EndpointOverrides: []EndpointOverride{
+					{Script: "vendor.sh", Endpoints: []service.Endpoint{{Name: "Get", Subject: "inventory get"}}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "endpoint override with wildcard subject",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				EndpointOverrides: []EndpointOverride{
+					{Script: "vendor.sh", Endpoints: []service.Endpoint{{Name: "Get", Subject: "inventory.*"}}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "endpoint override with wildcard subject when allowed",
+			config: Config{
+				NatsURL:        "nats://127.0.0.1:4222",
+				ScriptsPath:    "./scripts",
+				LogLevel:       "info",
+				AllowWildcards: true,
+				EndpointOverrides: []EndpointOverride{
+					{Script: "vendor.sh", Endpoints: []service.Endpoint{{Name: "Get", Subject: "inventory.*"}}},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "valid service prefixes",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				ServicePrefixes: map[string]string{"Global": "none", "Regional": "dc1"},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid service prefix",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				ServicePrefixes: map[string]string{"Broken": "dc1..east"},
+			},
+			expectError: true,
+		},
+		{
+			name: "circuit breaker with request timeout",
+			config: Config{
+				NatsURL:                 "nats://127.0.0.1:4222",
+				ScriptsPath:             "./scripts",
+				LogLevel:                "info",
+				RequestTimeoutMs:        10000,
+				CircuitBreakerThreshold: 3,
+			},
+			expectError: false,
+		},
+		{
+			name: "circuit breaker without request timeout",
+			config: Config{
+				NatsURL:                 "nats://127.0.0.1:4222",
+				ScriptsPath:             "./scripts",
+				LogLevel:                "info",
+				RequestTimeoutMs:        -1,
+				CircuitBreakerThreshold: 3,
+			},
+			expectError: true,
+		},
+		{
+			name: "output filter",
+			config: Config{
+				NatsURL:             "nats://127.0.0.1:4222",
+				ScriptsPath:         "./scripts",
+				LogLevel:            "info",
+				OutputFilter:        "strip_ansi",
+				OutputFilterCommand: "jq -c .",
+			},
+			expectError: false,
+		},
+		{
+			name: "unknown output filter",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				OutputFilter: "uppercase",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid required services policy",
+			config: Config{
+				NatsURL:                "nats://127.0.0.1:4222",
+				ScriptsPath:            "./scripts",
+				LogLevel:               "info",
+				RequiredServices:       []string{"SystemService"},
+				RequiredServicesPolicy: "ignore",
+			},
+			expectError: true,
+		},
+		{
+			name: "empty required service name",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				RequiredServices: []string{" "},
+			},
+			expectError: true,
+		},
+		{
+			name: "empty disabled service name",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				DisabledServices: []string{""},
+			},
+			expectError: true,
+		},
+		{
+			name: "service both required and disabled",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				RequiredServices: []string{"SystemService"},
+				DisabledServices: []string{"SystemService"},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid stdin line endings",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				StdinLineEndings: "crlf",
+			},
+			expectError: true,
+		},
+		{
+			name: "jsonc info format",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				InfoFormat:  "jsonc",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid info format",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				InfoFormat:  "json5",
+			},
+			expectError: true,
+		},
+		{
+			name: "clean env with allowlist",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				CleanEnv:    true,
+				PassEnv:     []string{"PATH", "HOME"},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid pass_env entry",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				CleanEnv:    true,
+				PassEnv:     []string{"PATH=/bin"},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative process start rate",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				ProcessStartRate: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative rlimit",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				Rlimits:     service.Rlimits{NoFile: -1},
+			},
+			expectError: true,
+		},
+		{
+			name: "tiny address space service rlimit",
+			config: Config{
+				NatsURL:        "nats://127.0.0.1:4222",
+				ScriptsPath:    "./scripts",
+				LogLevel:       "info",
+				ServiceRlimits: map[string]service.Rlimits{"ReportService": {AS: 512}},
+			},
+			expectError: true,
+		},
+		{
+			name: "interpreter",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				Interpreter: "/bin/bash",
+			},
+			expectError: false,
+		},
+		{
+			name: "interpreter with command template",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				Interpreter:     "/bin/bash",
+				CommandTemplate: "firejail {{.Script}} {{.Arg}}",
+			},
+			expectError: true,
+		},
+		{
+			name: "executable extensions",
+			config: Config{
+				NatsURL:              "nats://127.0.0.1:4222",
+				ScriptsPath:          "./scripts",
+				LogLevel:             "info",
+				ExecutableExtensions: []string{".sh", ".py", ""},
+			},
+			expectError: false,
+		},
+		{
+			name: "executable extension without dot",
+			config: Config{
+				NatsURL:              "nats://127.0.0.1:4222",
+				ScriptsPath:          "./scripts",
+				LogLevel:             "info",
+				ExecutableExtensions: []string{"py"},
+			},
+			expectError: true,
+		},
+		{
+			name: "events subject",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				EventsSubject: "natshd.events",
+			},
+			expectError: false,
+		},
+		{
+			name: "wildcard events subject",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				EventsSubject: "natshd.>",
+			},
+			expectError: true,
+		},
+		{
+			name: "custom subject prefix mode",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				SubjectPrefixMode: "dc1.east",
+			},
+			expectError: false,
+		},
+		{
+			name: "wildcard subject prefix mode",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				SubjectPrefixMode: "tenant.*",
+			},
+			expectError: true,
+		},
+		{
+			name: "admin service",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				AdminService:       true,
+				AdminSubjectPrefix: "ops.natshd",
+			},
+			expectError: false,
+		},
+		{
+			name: "wildcard admin subject prefix",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				AdminService:       true,
+				AdminSubjectPrefix: "natshd.*",
+			},
+			expectError: true,
+		},
+		{
+			name: "include and exclude globs",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				IncludeGlobs: []string{"*.sh", "svc-[a-z]*"},
+				ExcludeGlobs: []string{"_*.sh"},
+			},
+			expectError: false,
+		},
+		{
+			name: "malformed include glob",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				IncludeGlobs: []string{"[a-"},
+			},
+			expectError: true,
+		},
+		{
+			name: "exclude glob with a path",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				ExcludeGlobs: []string{"lib/*.sh"},
+			},
+			expectError: true,
+		},
+		{
+			name: "empty exclude glob",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				ExcludeGlobs: []string{""},
+			},
+			expectError: true,
+		},
+		{
+			name: "console log format",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				LogFormat:   "console",
+			},
+			expectError: false,
+		},
+		{
+			name: "empty log redact key",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				LogRedactKeys: []string{"password", " "},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative log sample rate",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				LogSampleRate: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative log payload max bytes",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				LogPayloadMaxBytes: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative log max size",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				LogFile:      "/var/log/natshd.log",
+				LogMaxSizeMB: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid log format",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				LogFormat:   "pretty",
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max concurrent",
+			config: Config{
+				NatsURL:       "nats://127.0.0.1:4222",
+				ScriptsPath:   "./scripts",
+				LogLevel:      "info",
+				MaxConcurrent: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative service max concurrent",
+			config: Config{
+				NatsURL:              "nats://127.0.0.1:4222",
+				ScriptsPath:          "./scripts",
+				LogLevel:             "info",
+				ServiceMaxConcurrent: map[string]int{"ReportService": -1},
+			},
+			expectError: true,
+		},
+		{
+			name: "reject concurrency overflow",
+			config: Config{
+				NatsURL:             "nats://127.0.0.1:4222",
+				ScriptsPath:         "./scripts",
+				LogLevel:            "info",
+				MaxConcurrent:       4,
+				ConcurrencyOverflow: "reject",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid concurrency overflow",
+			config: Config{
+				NatsURL:             "nats://127.0.0.1:4222",
+				ScriptsPath:         "./scripts",
+				LogLevel:            "info",
+				ConcurrencyOverflow: "drop",
+			},
+			expectError: true,
+		},
+		{
+			name: "negative permission poll interval",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				PermissionPollMs: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max metadata depth",
+			config: Config{
+				NatsURL:          "nats://127.0.0.1:4222",
+				ScriptsPath:      "./scripts",
+				LogLevel:         "info",
+				MaxMetadataDepth: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative heartbeat interval",
+			config: Config{
+				NatsURL:             "nats://127.0.0.1:4222",
+				ScriptsPath:         "./scripts",
+				LogLevel:            "info",
+				HeartbeatIntervalMs: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max concurrent restarts",
+			config: Config{
+				NatsURL:               "nats://127.0.0.1:4222",
+				ScriptsPath:           "./scripts",
+				LogLevel:              "info",
+				MaxConcurrentRestarts: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative restart buffer size",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				RestartBufferSize: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative service stop timeout",
+			config: Config{
+				NatsURL:              "nats://127.0.0.1:4222",
+				ScriptsPath:          "./scripts",
+				LogLevel:             "info",
+				ServiceStopTimeoutMs: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative pending script window",
+			config: Config{
+				NatsURL:               "nats://127.0.0.1:4222",
+				ScriptsPath:           "./scripts",
+				LogLevel:              "info",
+				PendingScriptWindowMs: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max discovery depth",
+			config: Config{
+				NatsURL:           "nats://127.0.0.1:4222",
+				ScriptsPath:       "./scripts",
+				LogLevel:          "info",
+				MaxDiscoveryDepth: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid group version policy",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				GroupVersionPolicy: "patch",
+			},
+			expectError: true,
+		},
+		{
+			name: "reconnect max below -1",
+			config: Config{
+				NatsURL:      "nats://127.0.0.1:4222",
+				ScriptsPath:  "./scripts",
+				LogLevel:     "info",
+				ReconnectMax: -2,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative reconnect wait",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				ReconnectWaitMs: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative reconnect buffer",
+			config: Config{
+				NatsURL:              "nats://127.0.0.1:4222",
+				ScriptsPath:          "./scripts",
+				LogLevel:             "info",
+				ReconnectBufferBytes: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max script size",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				MaxScriptSizeBytes: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "script env",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				ScriptEnv:   map[string]string{"ENVIRONMENT": "prod", "REGION": "us-east"},
+			},
+			expectError: false,
+		},
+		{
+			name: "script env name with equals sign",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				ScriptEnv:   map[string]string{"A=B": "prod"},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative max output bytes",
+			config: Config{
+				NatsURL:        "nats://127.0.0.1:4222",
+				ScriptsPath:    "./scripts",
+				LogLevel:       "info",
+				MaxOutputBytes: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "numeric script owner",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				RequireScriptOwner: "0:0",
+			},
+			expectError: false,
+		},
+		{
+			name: "unknown script owner",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				RequireScriptOwner: "no-such-natshd-user",
+			},
+			expectError: true,
+		},
+		{
+			name: "script owner with empty group",
+			config: Config{
+				NatsURL:            "nats://127.0.0.1:4222",
+				ScriptsPath:        "./scripts",
+				LogLevel:           "info",
+				RequireScriptOwner: "root:",
+			},
+			expectError: true,
+		},
+		{
+			name: "statsd address without port",
+			config: Config{
+				NatsURL:     "nats://127.0.0.1:4222",
+				ScriptsPath: "./scripts",
+				LogLevel:    "info",
+				StatsdAddr:  "127.0.0.1",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid access log format",
+			config: Config{
+				NatsURL:         "nats://127.0.0.1:4222",
+				ScriptsPath:     "./scripts",
+				LogLevel:        "info",
+				AccessLogFormat: "{subject} {bytes}",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid subject conflict policy",
+			config: Config{
+				NatsURL:               "nats://127.0.0.1:4222",
+				ScriptsPath:           "./scripts",
+				LogLevel:              "info",
+				SubjectConflictPolicy: "ignore",
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
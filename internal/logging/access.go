@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAccessLogFormat mirrors the Common Log Format, with the service in the
+// host position, the subject as the request, and the request size and duration appended
+const DefaultAccessLogFormat = `{service} - - [{time}] "{subject}" {status} {response_bytes} {request_bytes} {duration_ms}`
+
+// accessLogTimeFormat is the Common Log Format timestamp
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogPlaceholder matches a {name} placeholder in an access log format
+var accessLogPlaceholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// accessLogFields are the placeholders an access log format may use
+var accessLogFields = map[string]bool{
+	"{time}":           true,
+	"{service}":        true,
+	"{subject}":        true,
+	"{status}":         true,
+	"{duration_ms}":    true,
+	"{request_bytes}":  true,
+	"{response_bytes}": true,
+}
+
+// AccessEntry describes one handled request
+type AccessEntry struct {
+	Time          time.Time
+	Service       string
+	Subject       string
+	Status        string
+	Duration      time.Duration
+	RequestBytes  int
+	ResponseBytes int
+}
+
+// AccessLog writes one formatted line per request, separate from the JSON log
+type AccessLog struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format string
+}
+
+// ValidateAccessLogFormat rejects formats using unknown placeholders
+func ValidateAccessLogFormat(format string) error {
+	for _, placeholder := range accessLogPlaceholder.FindAllString(format, -1) {
+		if !accessLogFields[placeholder] {
+			return fmt.Errorf("unknown access log placeholder %s", placeholder)
+		}
+	}
+	return nil
+}
+
+// NewAccessLog creates an access log writing to writer; an empty format uses
+// DefaultAccessLogFormat
+func NewAccessLog(writer io.Writer, format string) (*AccessLog, error) {
+	if format == "" {
+		format = DefaultAccessLogFormat
+	}
+	if err := ValidateAccessLogFormat(format); err != nil {
+		return nil, err
+	}
+	return &AccessLog{writer: writer, format: format}, nil
+}
+
+// Log writes the line for an entry. Empty values are written as "-" as in CLF.
+func (a *AccessLog) Log(entry AccessEntry) {
+	if a == nil {
+		return
+	}
+
+	line := strings.NewReplacer(
+		"{time}", entry.Time.Format(accessLogTimeFormat),
+		"{service}", accessLogValue(entry.Service),
+		"{subject}", accessLogValue(entry.Subject),
+		"{status}", accessLogValue(entry.Status),
+		"{duration_ms}", strconv.FormatInt(entry.Duration.Milliseconds(), 10),
+		"{request_bytes}", strconv.Itoa(entry.RequestBytes),
+		"{response_bytes}", strconv.Itoa(entry.ResponseBytes),
+	).Replace(a.format)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	io.WriteString(a.writer, line+"\n")
+}
+
+func accessLogValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
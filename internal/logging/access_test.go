@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAccessLog_FormatsEntries(t *testing.T) {
+	entry := AccessEntry{
+		Time:          time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC),
+		Service:       "EchoService",
+		Subject:       "web01.echo",
+		Status:        "200",
+		Duration:      42 * time.Millisecond,
+		RequestBytes:  16,
+		ResponseBytes: 11,
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		entry    AccessEntry
+		expected string
+	}{
+		{
+			name:     "default format",
+			format:   "",
+			entry:    entry,
+			expected: `EchoService - - [05/Mar/2024:14:07:09 +0000] "web01.echo" 200 11 16 42` + "\n",
+		},
+		{
+			name:     "custom format",
+			format:   "{subject} status={status} took={duration_ms}ms",
+			entry:    entry,
+			expected: "web01.echo status=200 took=42ms\n",
+		},
+		{
+			name:     "missing values",
+			format:   "{service} {status}",
+			entry:    AccessEntry{},
+			expected: "- -\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			accessLog, err := NewAccessLog(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("Failed to create access log: %v", err)
+			}
+
+			accessLog.Log(tt.entry)
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestNewAccessLog_RejectsUnknownPlaceholders(t *testing.T) {
+	if _, err := NewAccessLog(&bytes.Buffer{}, "{subject} {bytes}"); err == nil {
+		t.Error("Expected error for unknown placeholder but got none")
+	}
+}
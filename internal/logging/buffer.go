@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferedWriter batches log lines to cut per-line syscalls on busy deployments.
+// It flushes when the buffer fills, on every flush interval, and on Close.
+type BufferedWriter struct {
+	mutex     sync.Mutex
+	writer    *bufio.Writer
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    sync.WaitGroup
+}
+
+// NewBufferedWriter wraps a writer with a buffer of the given size in bytes,
+// flushed at least once per interval (no periodic flush if interval <= 0)
+func NewBufferedWriter(writer io.Writer, size int, interval time.Duration) *BufferedWriter {
+	bw := &BufferedWriter{
+		writer: bufio.NewWriterSize(writer, size),
+		done:   make(chan struct{}),
+	}
+
+	if interval > 0 {
+		bw.closed.Add(1)
+		go bw.flushPeriodically(interval)
+	}
+
+	return bw
+}
+
+// Write buffers p, writing through to the underlying writer once the buffer is full
+func (bw *BufferedWriter) Write(p []byte) (int, error) {
+	bw.mutex.Lock()
+	defer bw.mutex.Unlock()
+	return bw.writer.Write(p)
+}
+
+// Flush writes any buffered log lines to the underlying writer
+func (bw *BufferedWriter) Flush() error {
+	bw.mutex.Lock()
+	defer bw.mutex.Unlock()
+	return bw.writer.Flush()
+}
+
+// Close stops the periodic flush and flushes what is left so no logs are lost on shutdown
+func (bw *BufferedWriter) Close() error {
+	bw.closeOnce.Do(func() { close(bw.done) })
+	bw.closed.Wait()
+	return bw.Flush()
+}
+
+func (bw *BufferedWriter) flushPeriodically(interval time.Duration) {
+	defer bw.closed.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bw.done:
+			return
+		case <-ticker.C:
+			bw.Flush()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while the flush goroutine writes to it
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestBufferedWriter_FlushesOnClose(t *testing.T) {
+	var out lockedBuffer
+	writer := NewBufferedWriter(&out, 64*1024, time.Hour)
+	logger := SetupLoggerWithWriter(writer, "info")
+
+	logger.Info().Msg("buffered message")
+
+	if out.String() != "" {
+		t.Fatalf("Expected log line to stay buffered, got %q", out.String())
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "buffered message") {
+		t.Errorf("Expected log line to be flushed on Close, got %q", out.String())
+	}
+
+	// Closing twice is harmless
+	if err := writer.Close(); err != nil {
+		t.Errorf("Expected second Close to succeed, got %v", err)
+	}
+}
+
+func TestBufferedWriter_FlushesPeriodically(t *testing.T) {
+	var out lockedBuffer
+	writer := NewBufferedWriter(&out, 64*1024, 20*time.Millisecond)
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte("line\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for out.String() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected buffered line to be flushed by the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBufferedWriter_FlushesWhenFull(t *testing.T) {
+	var out lockedBuffer
+	writer := NewBufferedWriter(&out, 16, 0)
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte("more than sixteen bytes\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if out.String() == "" {
+		t.Error("Expected a write larger than the buffer to reach the underlying writer")
+	}
+}
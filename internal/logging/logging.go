@@ -2,14 +2,55 @@ package logging
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+// Static labels (e.g. environment, region) attached to every logger created by this package.
+// Like the global level, they are set once at startup by SetupLoggerWithLabels.
+var (
+	baseLabels      map[string]string
+	baseLabelsMutex sync.RWMutex
+)
+
+// Configure zerolog for production JSON output once, rather than on every setup,
+// since loggers already in use read the format without synchronization
+func init() {
+	zerolog.TimeFieldFormat = time.RFC3339
+}
+
+// Log output formats accepted by SetupLoggerWithFormat
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// The output format and log file configured at startup, applied to context loggers
+// created later. The log file always receives JSON.
+var (
+	logFormat      = FormatJSON
+	logFile        io.Writer
+	logFormatMutex sync.RWMutex
+)
+
+// The level configured at startup, restored by ResetLevel. Loggers created by this
+// package don't pin a level of their own (zerolog.New defaults to trace) and leave
+// filtering to zerolog's global level, so SetLevel reaches every logger, including
+// service loggers created before the change. A per-logger level would win over a
+// lowered global level and keep debug lines suppressed.
+var (
+	configuredLevel      = zerolog.InfoLevel
+	configuredLevelMutex sync.RWMutex
+)
+
 // SetupLogger configures and returns a structured JSON logger with the specified level
 func SetupLogger(level string) zerolog.Logger {
 	return SetupLoggerWithWriter(os.Stdout, level)
@@ -17,6 +58,25 @@ func SetupLogger(level string) zerolog.Logger {
 
 // SetupLoggerWithWriter configures a logger with a custom writer (useful for testing)
 func SetupLoggerWithWriter(writer io.Writer, level string) zerolog.Logger {
+	return SetupLoggerWithLabels(writer, level, nil)
+}
+
+// SetupLoggerWithLabels configures a logger that attaches the given static labels to
+// every log line, including lines from context loggers created later
+func SetupLoggerWithLabels(writer io.Writer, level string, labels map[string]string) zerolog.Logger {
+	return SetupLoggerWithFormat(writer, level, FormatJSON, labels)
+}
+
+// SetupLoggerWithFormat configures a logger like SetupLoggerWithLabels that writes
+// in the given format: FormatJSON (or empty) for one JSON object per line, or
+// FormatConsole for colorized, human-readable lines while developing
+func SetupLoggerWithFormat(writer io.Writer, level, format string, labels map[string]string) zerolog.Logger {
+	return SetupLoggerWithFile(writer, nil, level, format, labels)
+}
+
+// SetupLoggerWithFile configures a logger like SetupLoggerWithFormat that also
+// writes every line, as JSON, to file (nil = writer only)
+func SetupLoggerWithFile(writer, file io.Writer, level, format string, labels map[string]string) zerolog.Logger {
 	// Parse and set the log level
 	var logLevel zerolog.Level
 	var err error
@@ -31,21 +91,88 @@ func SetupLoggerWithWriter(writer io.Writer, level string) zerolog.Logger {
 		}
 	}
 
+	configuredLevelMutex.Lock()
+	configuredLevel = logLevel
+	configuredLevelMutex.Unlock()
+
 	zerolog.SetGlobalLevel(logLevel)
 
-	// Configure zerolog for production JSON output
-	zerolog.TimeFieldFormat = time.RFC3339
+	baseLabelsMutex.Lock()
+	baseLabels = labels
+	baseLabelsMutex.Unlock()
+
+	if format == "" {
+		format = FormatJSON
+	}
+	logFormatMutex.Lock()
+	logFormat = format
+	logFile = file
+	logFormatMutex.Unlock()
 
-	return zerolog.New(writer).
-		With().
+	return withBaseLabels(zerolog.New(formatWriter(writer)).With()).
 		Timestamp().
 		Logger()
 }
 
+// SetLevel changes the log level of every logger at runtime
+func SetLevel(level string) (zerolog.Level, error) {
+	logLevel, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(level)))
+	if err != nil {
+		return zerolog.NoLevel, err
+	}
+	if logLevel == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("log level cannot be empty")
+	}
+
+	zerolog.SetGlobalLevel(logLevel)
+	return logLevel, nil
+}
+
+// ResetLevel restores the log level configured at startup
+func ResetLevel() zerolog.Level {
+	configuredLevelMutex.RLock()
+	defer configuredLevelMutex.RUnlock()
+
+	zerolog.SetGlobalLevel(configuredLevel)
+	return configuredLevel
+}
+
+// withBaseLabels adds the configured static labels to a logger context in a stable order
+func withBaseLabels(ctx zerolog.Context) zerolog.Context {
+	baseLabelsMutex.RLock()
+	defer baseLabelsMutex.RUnlock()
+
+	keys := make([]string, 0, len(baseLabels))
+	for key := range baseLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ctx = ctx.Str(key, baseLabels[key])
+	}
+	return ctx
+}
+
+// formatWriter wraps a writer to render log lines in the configured format, and
+// to copy them to the configured log file
+func formatWriter(writer io.Writer) io.Writer {
+	logFormatMutex.RLock()
+	defer logFormatMutex.RUnlock()
+
+	if logFormat == FormatConsole {
+		writer = zerolog.ConsoleWriter{Out: writer, TimeFormat: time.RFC3339}
+	}
+	if logFile != nil {
+		return zerolog.MultiLevelWriter(writer, logFile)
+	}
+	return writer
+}
+
 // NewContextLogger creates a new logger with service and script context
 func NewContextLogger(writer io.Writer, level zerolog.Level, serviceName, scriptPath string) zerolog.Logger {
-	freshLogger := zerolog.New(writer).Level(level)
-	contextLogger := freshLogger.With().
+	freshLogger := zerolog.New(formatWriter(writer)).Level(level)
+	contextLogger := withBaseLabels(freshLogger.With()).
 		Timestamp().
 		Str("service", serviceName).
 		Str("script", scriptPath).
@@ -53,19 +180,57 @@ func NewContextLogger(writer io.Writer, level zerolog.Level, serviceName, script
 	return contextLogger
 }
 
+// Sampling of successful request logs, set once at startup by SetRequestLogSampling
+var (
+	requestLogSampleRate atomic.Uint64
+	requestLogCount      atomic.Uint64
+)
+
+// SetRequestLogSampling logs only 1 in every rate successful requests (0 or 1 logs
+// them all). Failed requests are always logged.
+func SetRequestLogSampling(rate int) {
+	if rate < 1 {
+		rate = 1
+	}
+	requestLogSampleRate.Store(uint64(rate))
+	requestLogCount.Store(0)
+}
+
+// sampleRequestLog reports whether this successful request should be logged
+func sampleRequestLog() bool {
+	rate := requestLogSampleRate.Load()
+	if rate <= 1 {
+		return true
+	}
+	return (requestLogCount.Add(1)-1)%rate == 0
+}
+
 // LogRequestResponse logs NATS request/response interactions
 func LogRequestResponse(logger zerolog.Logger, subject string, request, response []byte, err error) {
+	LogRequestResponseWithScript(logger, subject, "", request, response, err)
+}
+
+// LogRequestResponseWithScript logs a request along with the script that handled it,
+// which tells grouped services' scripts apart (omitted when scriptPath is empty)
+func LogRequestResponseWithScript(logger zerolog.Logger, subject, scriptPath string, request, response []byte, err error) {
 	event := logger.Debug()
 	if err != nil {
 		event = logger.Error().Err(err)
+	} else if !event.Enabled() || !sampleRequestLog() {
+		// Count only requests that would be logged, so sampling is 1 in N of them
+		return
 	}
 
 	event = event.
 		Str("subject", subject).
-		Str("request", string(request))
+		Str("request", loggedPayload(request))
+
+	if scriptPath != "" {
+		event = event.Str("handler_script", scriptPath)
+	}
 
 	if response != nil {
-		event = event.Str("response", string(response))
+		event = event.Str("response", loggedPayload(response))
 	}
 
 	event.Msg("NATS request processed")
@@ -127,10 +292,10 @@ func LogManagerOperation(logger zerolog.Logger, action string, data map[string]i
 	var event *zerolog.Event
 
 	switch action {
-	case "starting", "stopping", "discovery_completed":
+	case "starting", "stopping", "discovery_completed", "reload_completed":
 		// Info level for key operational milestones
 		event = logger.Info()
-	case "discovering", "file_watcher_setup", "adding", "removing", "restarting":
+	case "discovering", "reloading", "file_watcher_setup", "adding", "removing", "restarting":
 		// Debug level for internal operations
 		event = logger.Debug()
 	default:
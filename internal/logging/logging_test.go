@@ -3,6 +3,8 @@ package logging
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"strings"
 	"testing"
 
@@ -162,6 +164,92 @@ func TestNewContextLogger(t *testing.T) {
 	}
 }
 
+func TestSetupLoggerWithFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		expectJSON bool
+	}{
+		{name: "default", format: "", expectJSON: true},
+		{name: "json", format: FormatJSON, expectJSON: true},
+		{name: "console", format: FormatConsole, expectJSON: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := SetupLoggerWithFormat(&buf, "info", tt.format, nil)
+			// Leave later tests with the JSON logger they expect
+			defer SetupLoggerWithWriter(io.Discard, "info")
+
+			logger.Info().Str("subject", "greet.hello").Msg("test message")
+
+			var contextBuf bytes.Buffer
+			contextLogger := NewContextLogger(&contextBuf, zerolog.InfoLevel, "test-service", "script.sh")
+			contextLogger.Info().Msg("service message")
+
+			for name, output := range map[string]string{"logger": buf.String(), "context logger": contextBuf.String()} {
+				var logEntry map[string]interface{}
+				isJSON := json.Unmarshal([]byte(output), &logEntry) == nil
+				if isJSON != tt.expectJSON {
+					t.Errorf("Expected %s output JSON to be %v, got: %q", name, tt.expectJSON, output)
+				}
+			}
+
+			if !tt.expectJSON {
+				if !strings.Contains(buf.String(), "test message") || !strings.Contains(buf.String(), "subject=") {
+					t.Errorf("Expected readable message and fields, got: %q", buf.String())
+				}
+				if !strings.Contains(contextBuf.String(), "test-service") {
+					t.Errorf("Expected context fields in console output, got: %q", contextBuf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSetupLoggerWithLabels(t *testing.T) {
+	var rootBuf bytes.Buffer
+	rootLogger := SetupLoggerWithLabels(&rootBuf, "info", map[string]string{
+		"environment": "production",
+		"region":      "us-east",
+	})
+	t.Cleanup(func() { SetupLoggerWithWriter(&bytes.Buffer{}, "info") })
+
+	rootLogger.Info().Msg("root message")
+
+	var rootEntry map[string]interface{}
+	if err := json.Unmarshal(rootBuf.Bytes(), &rootEntry); err != nil {
+		t.Fatalf("Failed to parse root log as JSON: %v", err)
+	}
+
+	if rootEntry["environment"] != "production" || rootEntry["region"] != "us-east" {
+		t.Errorf("Expected labels on root logger, got %v", rootEntry)
+	}
+
+	// Context loggers created later should inherit the labels
+	var serviceBuf bytes.Buffer
+	serviceLogger := NewContextLogger(&serviceBuf, zerolog.InfoLevel, "test-service", "script.sh")
+	LogServiceLifecycle(serviceLogger, "added", "test-service", "script.sh")
+
+	var serviceEntry map[string]interface{}
+	if err := json.Unmarshal(serviceBuf.Bytes(), &serviceEntry); err != nil {
+		t.Fatalf("Failed to parse service log as JSON: %v, output was: %q", err, serviceBuf.String())
+	}
+
+	if serviceEntry["environment"] != "production" {
+		t.Errorf("Expected environment label on lifecycle log, got %v", serviceEntry["environment"])
+	}
+
+	if serviceEntry["region"] != "us-east" {
+		t.Errorf("Expected region label on lifecycle log, got %v", serviceEntry["region"])
+	}
+
+	if serviceEntry["action"] != "added" {
+		t.Errorf("Expected action 'added', got %v", serviceEntry["action"])
+	}
+}
+
 func TestLogRequestResponse(t *testing.T) {
 	var buf bytes.Buffer
 	logger := SetupLoggerWithWriter(&buf, "debug")
@@ -192,6 +280,41 @@ func TestLogRequestResponse(t *testing.T) {
 	}
 }
 
+func TestLogRequestResponse_Sampling(t *testing.T) {
+	SetRequestLogSampling(10)
+	t.Cleanup(func() { SetRequestLogSampling(0) })
+
+	var buf bytes.Buffer
+	logger := SetupLoggerWithWriter(&buf, "debug")
+
+	for i := 0; i < 100; i++ {
+		LogRequestResponse(logger, "busy.subject", []byte(`{}`), []byte(`{"ok":true}`), nil)
+	}
+	for i := 0; i < 20; i++ {
+		LogRequestResponse(logger, "busy.subject", []byte(`{}`), nil, errors.New("script failed"))
+	}
+
+	successes, failures := 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var logEntry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &logEntry); err != nil {
+			t.Fatalf("Failed to parse log as JSON: %v", err)
+		}
+		if logEntry["level"] == "error" {
+			failures++
+		} else {
+			successes++
+		}
+	}
+
+	if successes != 10 {
+		t.Errorf("Expected 1 in 10 of 100 successful requests logged, got %d", successes)
+	}
+	if failures != 20 {
+		t.Errorf("Expected every one of 20 failed requests logged, got %d", failures)
+	}
+}
+
 func TestLogRequestResponseWithError(t *testing.T) {
 	var buf bytes.Buffer
 	logger := SetupLoggerWithWriter(&buf, "info")
@@ -502,3 +625,36 @@ func TestLogFileWatchEvent(t *testing.T) {
 		t.Errorf("Expected message 'File system event', got %v", logEntry["message"])
 	}
 }
+
+func TestSetLevel_ReachesExistingContextLoggers(t *testing.T) {
+	var rootBuf, serviceBuf bytes.Buffer
+	root := SetupLoggerWithWriter(&rootBuf, "info")
+	defer ResetLevel()
+
+	// Service loggers inherit the root logger's level, created before the change
+	serviceLogger := NewContextLogger(&serviceBuf, root.GetLevel(), "test-service", "script.sh")
+
+	serviceLogger.Debug().Msg("before")
+	if serviceBuf.Len() != 0 {
+		t.Fatalf("Expected no debug output at info level, got %q", serviceBuf.String())
+	}
+
+	if _, err := SetLevel("debug"); err != nil {
+		t.Fatalf("Unexpected error setting level: %v", err)
+	}
+	serviceLogger.Debug().Msg("after")
+	root.Debug().Msg("after")
+	if !strings.Contains(serviceBuf.String(), "after") || !strings.Contains(rootBuf.String(), "after") {
+		t.Errorf("Expected debug output after SetLevel, got service %q, root %q", serviceBuf.String(), rootBuf.String())
+	}
+
+	if level := ResetLevel(); level != zerolog.InfoLevel {
+		t.Errorf("Expected ResetLevel to restore info, got %s", level)
+	}
+
+	for _, invalid := range []string{"", "verbose"} {
+		if _, err := SetLevel(invalid); err == nil {
+			t.Errorf("Expected error for level %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces the values of redacted payload keys in request logs
+const redactedValue = "***"
+
+// Payload redaction for request logs, set once at startup by SetPayloadRedaction
+var (
+	redactKeys      map[string]struct{} // lowercased
+	payloadMaxBytes int
+	redactMutex     sync.RWMutex
+)
+
+// SetPayloadRedaction makes request logs replace the values of the given top-level
+// JSON keys (matched case-insensitively) with "***", and cut logged payloads
+// longer than maxBytes (0 = log payloads whole)
+func SetPayloadRedaction(keys []string, maxBytes int) {
+	redactMutex.Lock()
+	defer redactMutex.Unlock()
+
+	redactKeys = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		redactKeys[strings.ToLower(key)] = struct{}{}
+	}
+	payloadMaxBytes = maxBytes
+}
+
+// loggedPayload returns a request or response payload as it should appear in the
+// log: redacted if it is a JSON object with redacted keys, and cut to the
+// configured size. Payloads that aren't JSON objects are only cut.
+func loggedPayload(payload []byte) string {
+	redactMutex.RLock()
+	defer redactMutex.RUnlock()
+
+	if len(redactKeys) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &fields); err == nil {
+			redacted := false
+			for key := range fields {
+				if _, ok := redactKeys[strings.ToLower(key)]; ok {
+					fields[key] = json.RawMessage(`"` + redactedValue + `"`)
+					redacted = true
+				}
+			}
+			if redacted {
+				if encoded, err := json.Marshal(fields); err == nil {
+					payload = encoded
+				}
+			}
+		}
+	}
+
+	if payloadMaxBytes > 0 && len(payload) > payloadMaxBytes {
+		return string(payload[:payloadMaxBytes]) + "...(truncated)"
+	}
+	return string(payload)
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogRequestResponse_RedactsConfiguredKeys(t *testing.T) {
+	SetPayloadRedaction([]string{"password", "Token"}, 0)
+	t.Cleanup(func() { SetPayloadRedaction(nil, 0) })
+
+	var buf bytes.Buffer
+	logger := SetupLoggerWithWriter(&buf, "debug")
+
+	LogRequestResponse(logger, "auth.login",
+		[]byte(`{"user": "alice", "password": "hunter2", "nested": {"password": "kept"}}`),
+		[]byte(`{"TOKEN": "abc123", "ok": true}`), nil)
+
+	var logEntry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+		t.Fatalf("Failed to parse log as JSON: %v", err)
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal([]byte(logEntry["request"].(string)), &request); err != nil {
+		t.Fatalf("Failed to parse logged request as JSON: %v (%v)", err, logEntry["request"])
+	}
+	if request["password"] != "***" {
+		t.Errorf("Expected password to be redacted, got %v", request["password"])
+	}
+	if request["user"] != "alice" {
+		t.Errorf("Expected user to be kept, got %v", request["user"])
+	}
+	// Only top-level keys are redacted
+	if nested, _ := request["nested"].(map[string]interface{}); nested["password"] != "kept" {
+		t.Errorf("Expected nested fields to be kept, got %v", request["nested"])
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(logEntry["response"].(string)), &response); err != nil {
+		t.Fatalf("Failed to parse logged response as JSON: %v (%v)", err, logEntry["response"])
+	}
+	if response["TOKEN"] != "***" || response["ok"] != true {
+		t.Errorf("Expected TOKEN redacted case-insensitively and ok kept, got %v", response)
+	}
+
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "abc123") {
+		t.Errorf("Expected secrets to stay out of the log, got: %s", buf.String())
+	}
+}
+
+func TestLoggedPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		maxBytes int
+		payload  string
+		expected string
+	}{
+		{name: "no redaction configured", payload: `{"password": "hunter2"}`, expected: `{"password": "hunter2"}`},
+		{name: "JSON without redacted keys is logged as sent", keys: []string{"password"}, payload: `{"b": 1, "a": 2}`, expected: `{"b": 1, "a": 2}`},
+		{name: "non-JSON is logged as-is", keys: []string{"password"}, payload: "password=hunter2", expected: "password=hunter2"},
+		{name: "non-JSON is truncated", maxBytes: 8, payload: "a very long plain text payload", expected: "a very l...(truncated)"},
+		{name: "short payload is not truncated", maxBytes: 64, payload: "short", expected: "short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPayloadRedaction(tt.keys, tt.maxBytes)
+			t.Cleanup(func() { SetPayloadRedaction(nil, 0) })
+
+			if logged := loggedPayload([]byte(tt.payload)); logged != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, logged)
+			}
+		})
+	}
+}
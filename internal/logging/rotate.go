@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatedLogFiles is how many rotated files RotatingFile keeps next to the
+// current one, as <path>.1 (newest) through <path>.3 (oldest)
+const rotatedLogFiles = 3
+
+// RotatingFile is a log file that rotates once it would grow past a size limit.
+// The current file is renamed to <path>.1, older rotations shift up by one and
+// the oldest is removed, so logs never take more than a few times the limit.
+type RotatingFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// NewRotatingFile opens (appending to) the log file at path, rotating it once it
+// would exceed maxSize bytes (no rotation if maxSize <= 0)
+func NewRotatingFile(path string, maxSize int64) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Write appends p to the current file, rotating first if p would push it past the
+// limit. A single write larger than the limit still lands whole in a fresh file.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", rf.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", rf.path, err)
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files up by one, moves the current file to <path>.1
+// and starts a new one
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", rf.path, err)
+	}
+	rf.file = nil
+
+	for i := rotatedLogFiles - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", rf.path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", rf.path, i+1)); err != nil {
+				return fmt.Errorf("failed to rotate log file %s: %w", older, err)
+			}
+		}
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", rf.path, err)
+	}
+
+	return rf.open()
+}
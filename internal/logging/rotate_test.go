@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRotatingFile_RotatesPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "natshd.log")
+	const maxSize = 1024
+
+	rf, err := NewRotatingFile(path, maxSize)
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer rf.Close()
+
+	// Enough 100-byte lines to fill the current file and every rotated one,
+	// and then some, so the oldest rotation is dropped
+	line := strings.Repeat("x", 99) + "\n"
+	for i := 0; i < (rotatedLogFiles+2)*maxSize/len(line); i++ {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", filepath.Base(name), err)
+		}
+		if info.Size() > maxSize {
+			t.Errorf("Expected %s to stay within %d bytes, got %d", filepath.Base(name), maxSize, info.Size())
+		}
+	}
+
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, rotatedLogFiles+1)); !os.IsNotExist(err) {
+		t.Errorf("Expected only %d rotated files to be kept", rotatedLogFiles)
+	}
+
+	// Rotation must not split lines
+	data, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("Failed to read rotated file: %v", err)
+	}
+	if len(data)%len(line) != 0 {
+		t.Errorf("Expected whole lines in the rotated file, got %d bytes", len(data))
+	}
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "natshd.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 900)), 0644); err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+
+	rf, err := NewRotatingFile(path, 1024)
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer rf.Close()
+
+	// The existing 900 bytes count toward the limit
+	if _, err := rf.Write([]byte(strings.Repeat("y", 200))); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("Expected the existing file to be rotated: %v", err)
+	}
+	if len(rotated) != 900 {
+		t.Errorf("Expected the rotated file to hold the original 900 bytes, got %d", len(rotated))
+	}
+}
+
+func TestSetupLoggerWithFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "natshd.log")
+	rf, err := NewRotatingFile(path, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer rf.Close()
+
+	var stdout bytes.Buffer
+	logger := SetupLoggerWithFile(&stdout, rf, "info", FormatConsole, nil)
+	// Leave later tests with the JSON logger they expect
+	defer SetupLoggerWithWriter(io.Discard, "info")
+
+	logger.Info().Msg("to both")
+	contextLogger := NewContextLogger(io.Discard, zerolog.InfoLevel, "test-service", "script.sh")
+	contextLogger.Info().Msg("from a service")
+
+	if !strings.Contains(stdout.String(), "to both") {
+		t.Errorf("Expected the line on stdout, got: %q", stdout.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines in the log file, got %d: %q", len(lines), data)
+	}
+
+	// The file stays JSON even when the console gets readable lines
+	for i, expected := range []string{"to both", "from a service"} {
+		var logEntry map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &logEntry); err != nil {
+			t.Fatalf("Failed to parse log file line as JSON: %v (%q)", err, lines[i])
+		}
+		if logEntry["message"] != expected {
+			t.Errorf("Expected message %q, got %v", expected, logEntry["message"])
+		}
+	}
+}
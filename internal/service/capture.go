@@ -0,0 +1,37 @@
+package service
+
+import "bytes"
+
+// cappedBuffer captures a script's output up to a limit and quietly discards the
+// rest, so a runaway script can't exhaust memory. Writes always report success:
+// failing them would break the script's pipe and change how it exits.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64 // 0 = unlimited
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+
+	if room := b.limit - int64(b.buf.Len()); int64(len(p)) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the captured output
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Truncated reports whether output past the limit was discarded
+func (b *cappedBuffer) Truncated() bool {
+	return b.truncated
+}
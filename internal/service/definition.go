@@ -12,18 +12,104 @@ type ServiceDefinition struct {
 	Version     string     `json:"version,omitempty"`
 	Description string     `json:"description,omitempty"`
 	Endpoints   []Endpoint `json:"endpoints"`
+	// SupportsInit asks natshd to run the script with "init" before serving it
+	SupportsInit bool `json:"supports_init,omitempty"`
+	// HealthCheck asks natshd to serve <service>.health, answered by running the
+	// script with "health"; a non-zero exit reports the service unhealthy
+	HealthCheck bool `json:"health_check,omitempty"`
+	// Prefix chooses the service's subject prefix: "host" (default), "none", or a custom prefix
+	Prefix string `json:"prefix,omitempty"`
+	// Namespace groups related services for introspection, e.g. "storage"
+	Namespace string `json:"namespace,omitempty"`
+	// Metadata is attached to the micro service and shown by `nats micro info`,
+	// e.g. team or docs_url
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Subject prefix policies; any other value is used as a literal prefix
+const (
+	PrefixHost = "host" // the resolved hostname, so the service is host-scoped
+	PrefixNone = "none" // no prefix, so the service is fleet-global
+)
+
+// ValidatePrefix checks that a prefix policy is "host", "none", or a usable subject prefix
+func ValidatePrefix(prefix string) error {
+	switch prefix {
+	case "", PrefixHost, PrefixNone:
+		return nil
+	}
+
+	validPrefix := regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+	if !validPrefix.MatchString(prefix) {
+		return fmt.Errorf("prefix '%s' is invalid, must be host, none, or dot-separated alphanumeric tokens", prefix)
+	}
+	return nil
 }
 
 // Endpoint represents a single NATS subject endpoint for a service
+// (also decoded from TOML for endpoint overrides in the config file)
 type Endpoint struct {
-	Name        string                 `json:"name"`
-	Subject     string                 `json:"subject"`
-	Description string                 `json:"description,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Name        string                 `json:"name" toml:"name"`
+	Subject     string                 `json:"subject" toml:"subject"`
+	Description string                 `json:"description,omitempty" toml:"description"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty" toml:"metadata"`
+	Transform   *InputTransform        `json:"transform,omitempty" toml:"transform"`
+	Cost        int                    `json:"cost,omitempty" toml:"cost"`                 // concurrency units per request, defaults to 1
+	Mode        string                 `json:"mode,omitempty" toml:"mode"`                 // request (default), event, or both
+	RequestType string                 `json:"request_type,omitempty" toml:"request_type"` // enforced request content type, if any
+	Async       bool                   `json:"async,omitempty" toml:"async"`               // ack with a job ID, publish the result later
+	QueueGroup  string                 `json:"queue_group,omitempty" toml:"queue_group"`   // NATS queue group to join, defaults to the micro framework's
+
+	ExitCodeHeader   bool     `json:"exit_code_header,omitempty" toml:"exit_code_header"`     // reply with the script's exit code in an Exit-Code header
+	SuccessExitCodes []int    `json:"success_exit_codes,omitempty" toml:"success_exit_codes"` // non-zero exit codes that still return stdout
+	RequiredHeaders  []string `json:"required_headers,omitempty" toml:"required_headers"`     // request headers that must be present, passed to the script env
+}
+
+// RequestTypeJSON requires request bodies to be valid JSON before the script runs
+const RequestTypeJSON = "application/json"
+
+// Endpoint modes control how messages on an endpoint's subject are handled
+const (
+	EndpointModeRequest = "request" // request/reply via the NATS micro framework
+	EndpointModeEvent   = "event"   // plain publishes, the script runs without replying
+	EndpointModeBoth    = "both"    // requests are answered, plain publishes are ingested
+)
+
+// AcceptsRequests reports whether the endpoint is registered with the micro framework
+func (e Endpoint) AcceptsRequests() bool {
+	return e.Mode != EndpointModeEvent
+}
+
+// AcceptsEvents reports whether the endpoint processes publishes that carry no reply subject
+func (e Endpoint) AcceptsEvents() bool {
+	return e.Mode == EndpointModeEvent || e.Mode == EndpointModeBoth
+}
+
+// SucceedsWith reports whether the endpoint treats a script exit code as success
+func (e Endpoint) SucceedsWith(exitCode int) bool {
+	if exitCode == 0 {
+		return true
+	}
+	for _, code := range e.SuccessExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
 }
 
 // Validate checks if the service definition is valid
 func (sd ServiceDefinition) Validate() error {
+	return sd.validate(false)
+}
+
+// ValidateAllowingWildcards checks the service definition like Validate, but
+// accepts the NATS wildcards "*" and a trailing ">" in endpoint subjects
+func (sd ServiceDefinition) ValidateAllowingWildcards() error {
+	return sd.validate(true)
+}
+
+func (sd ServiceDefinition) validate(wildcards bool) error {
 	if strings.TrimSpace(sd.Name) == "" {
 		return fmt.Errorf("service name cannot be empty")
 	}
@@ -32,12 +118,21 @@ func (sd ServiceDefinition) Validate() error {
 		return fmt.Errorf("service must have at least one endpoint")
 	}
 
+	if err := ValidatePrefix(sd.Prefix); err != nil {
+		return err
+	}
+
+	validNamespace := regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+	if sd.Namespace != "" && !validNamespace.MatchString(sd.Namespace) {
+		return fmt.Errorf("namespace '%s' is invalid, must be dot-separated alphanumeric tokens", sd.Namespace)
+	}
+
 	// Check for duplicate endpoint names and subjects
 	nameMap := make(map[string]bool)
 	subjectMap := make(map[string]bool)
 
 	for i, endpoint := range sd.Endpoints {
-		if err := endpoint.Validate(); err != nil {
+		if err := endpoint.validate(wildcards); err != nil {
 			return fmt.Errorf("endpoint %d is invalid: %w", i, err)
 		}
 
@@ -57,6 +152,16 @@ func (sd ServiceDefinition) Validate() error {
 
 // Validate checks if the endpoint is valid
 func (e Endpoint) Validate() error {
+	return e.validate(false)
+}
+
+// ValidateAllowingWildcards checks the endpoint like Validate, but accepts the
+// NATS wildcards "*" and a trailing ">" in its subject
+func (e Endpoint) ValidateAllowingWildcards() error {
+	return e.validate(true)
+}
+
+func (e Endpoint) validate(wildcards bool) error {
 	if strings.TrimSpace(e.Name) == "" {
 		return fmt.Errorf("endpoint name cannot be empty")
 	}
@@ -68,9 +173,83 @@ func (e Endpoint) Validate() error {
 	// NATS subjects should only contain alphanumeric characters, dots, dashes, and underscores
 	// and cannot contain spaces or other special characters
 	validSubject := regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
-	if !validSubject.MatchString(e.Subject) {
+	if wildcards {
+		if err := validateWildcardSubject(e.Subject); err != nil {
+			return err
+		}
+	} else if !validSubject.MatchString(e.Subject) {
 		return fmt.Errorf("endpoint subject '%s' contains invalid characters, only alphanumeric, dots, dashes, and underscores are allowed", e.Subject)
 	}
 
+	if e.QueueGroup != "" && !validSubject.MatchString(e.QueueGroup) {
+		return fmt.Errorf("endpoint queue_group '%s' contains invalid characters, only alphanumeric, dots, dashes, and underscores are allowed", e.QueueGroup)
+	}
+
+	switch e.Mode {
+	case "", EndpointModeRequest, EndpointModeEvent, EndpointModeBoth:
+	default:
+		return fmt.Errorf("endpoint mode '%s' is invalid, must be one of: request, event, both", e.Mode)
+	}
+
+	switch e.RequestType {
+	case "", RequestTypeJSON:
+	default:
+		return fmt.Errorf("endpoint request_type '%s' is not supported, must be: %s", e.RequestType, RequestTypeJSON)
+	}
+
+	if e.Async && !e.AcceptsRequests() {
+		return fmt.Errorf("endpoint async requires a mode that accepts requests")
+	}
+
+	if e.Cost < 0 {
+		return fmt.Errorf("endpoint cost cannot be negative")
+	}
+
+	validHeader := regexp.MustCompile(`^[!#$%&'*+.^_|~0-9A-Za-z-]+$`)
+	for _, header := range e.RequiredHeaders {
+		if !validHeader.MatchString(header) {
+			return fmt.Errorf("endpoint required_headers entry '%s' is not a valid header name", header)
+		}
+	}
+
+	for _, code := range e.SuccessExitCodes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("endpoint success_exit_codes must be between 0 and 255, got %d", code)
+		}
+	}
+
+	if e.Transform != nil {
+		if err := e.Transform.Validate(); err != nil {
+			return fmt.Errorf("endpoint transform is invalid: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// validateWildcardSubject checks a subject whose tokens may also be "*", matching
+// any one token, or a final ">", matching one or more trailing tokens
+func validateWildcardSubject(subject string) error {
+	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "*":
+		case token == ">" && i == len(tokens)-1:
+		case validToken.MatchString(token):
+		default:
+			return fmt.Errorf("endpoint subject '%s' is invalid, tokens must be alphanumeric with dashes and underscores, '*', or a trailing '>'", subject)
+		}
+	}
+	return nil
+}
+
+// IsWildcardSubject reports whether a subject contains a NATS wildcard token
+func IsWildcardSubject(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
@@ -259,6 +259,42 @@ func TestServiceDefinition_Validate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "custom prefix",
+			def: ServiceDefinition{
+				Name:      "RegionalService",
+				Prefix:    "dc1.east",
+				Endpoints: []Endpoint{{Name: "DoSomething", Subject: "test.do"}},
+			},
+			expectError: false,
+		},
+		{
+			name: "wildcard prefix",
+			def: ServiceDefinition{
+				Name:      "WildService",
+				Prefix:    "dc1.*",
+				Endpoints: []Endpoint{{Name: "DoSomething", Subject: "test.do"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "namespace",
+			def: ServiceDefinition{
+				Name:      "BackupService",
+				Namespace: "storage.backup",
+				Endpoints: []Endpoint{{Name: "DoSomething", Subject: "test.do"}},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid namespace",
+			def: ServiceDefinition{
+				Name:      "BackupService",
+				Namespace: "storage backup",
+				Endpoints: []Endpoint{{Name: "DoSomething", Subject: "test.do"}},
+			},
+			expectError: true,
+		},
 		{
 			name: "no endpoints",
 			def: ServiceDefinition{
@@ -380,6 +416,115 @@ func TestEndpoint_Validate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "event mode",
+			endpoint: Endpoint{
+				Name:    "ValidName",
+				Subject: "valid.subject",
+				Mode:    EndpointModeEvent,
+			},
+			expectError: false,
+		},
+		{
+			name: "JSON request type",
+			endpoint: Endpoint{
+				Name:        "ValidName",
+				Subject:     "valid.subject",
+				RequestType: RequestTypeJSON,
+			},
+			expectError: false,
+		},
+		{
+			name: "unsupported request type",
+			endpoint: Endpoint{
+				Name:        "ValidName",
+				Subject:     "valid.subject",
+				RequestType: "application/xml",
+			},
+			expectError: true,
+		},
+		{
+			name: "unknown mode",
+			endpoint: Endpoint{
+				Name:    "ValidName",
+				Subject: "valid.subject",
+				Mode:    "stream",
+			},
+			expectError: true,
+		},
+		{
+			name: "async request endpoint",
+			endpoint: Endpoint{
+				Name:    "ValidName",
+				Subject: "valid.subject",
+				Async:   true,
+			},
+			expectError: false,
+		},
+		{
+			name: "async event endpoint",
+			endpoint: Endpoint{
+				Name:    "ValidName",
+				Subject: "valid.subject",
+				Mode:    EndpointModeEvent,
+				Async:   true,
+			},
+			expectError: true,
+		},
+		{
+			name: "success exit codes",
+			endpoint: Endpoint{
+				Name:             "ValidName",
+				Subject:          "valid.subject",
+				SuccessExitCodes: []int{1, 3},
+			},
+			expectError: false,
+		},
+		{
+			name: "required headers",
+			endpoint: Endpoint{
+				Name:            "ValidName",
+				Subject:         "valid.subject",
+				RequiredHeaders: []string{"X-Tenant-ID", "Idempotency-Key"},
+			},
+			expectError: false,
+		},
+		{
+			name: "required header with a space",
+			endpoint: Endpoint{
+				Name:            "ValidName",
+				Subject:         "valid.subject",
+				RequiredHeaders: []string{"X Tenant"},
+			},
+			expectError: true,
+		},
+		{
+			name: "queue group",
+			endpoint: Endpoint{
+				Name:       "ValidName",
+				Subject:    "valid.subject",
+				QueueGroup: "workers.eu-1",
+			},
+			expectError: false,
+		},
+		{
+			name: "queue group with a wildcard",
+			endpoint: Endpoint{
+				Name:       "ValidName",
+				Subject:    "valid.subject",
+				QueueGroup: "workers.*",
+			},
+			expectError: true,
+		},
+		{
+			name: "success exit code out of range",
+			endpoint: Endpoint{
+				Name:             "ValidName",
+				Subject:          "valid.subject",
+				SuccessExitCodes: []int{256},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -396,3 +541,66 @@ func TestEndpoint_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpoint_ValidateAllowingWildcards(t *testing.T) {
+	tests := []struct {
+		subject       string
+		expectError   bool
+		expectLiteral bool // whether Validate alone accepts the subject
+	}{
+		{subject: "metrics.cpu", expectError: false, expectLiteral: true},
+		{subject: "metrics.*", expectError: false},
+		{subject: "*.cpu.load", expectError: false},
+		{subject: "events.>", expectError: false},
+		{subject: "metrics.*.>", expectError: false},
+		{subject: ">", expectError: false},
+		{subject: "events.>.created", expectError: true},
+		{subject: "metrics.cpu*", expectError: true},
+		{subject: "metrics cpu", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			endpoint := Endpoint{Name: "Metrics", Subject: tt.subject}
+
+			err := endpoint.ValidateAllowingWildcards()
+			if tt.expectError && err == nil {
+				t.Error("Expected validation error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected validation error: %v", err)
+			}
+
+			if literalErr := endpoint.Validate(); tt.expectLiteral != (literalErr == nil) {
+				t.Errorf("Expected Validate to accept %q: %v, got error %v", tt.subject, tt.expectLiteral, literalErr)
+			}
+		})
+	}
+}
+
+func TestEndpoint_Modes(t *testing.T) {
+	tests := []struct {
+		mode             string
+		expectedRequests bool
+		expectedEvents   bool
+	}{
+		{"", true, false},
+		{EndpointModeRequest, true, false},
+		{EndpointModeEvent, false, true},
+		{EndpointModeBoth, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			endpoint := Endpoint{Name: "Ingest", Subject: "ingest", Mode: tt.mode}
+
+			if endpoint.AcceptsRequests() != tt.expectedRequests {
+				t.Errorf("Expected AcceptsRequests %v, got %v", tt.expectedRequests, endpoint.AcceptsRequests())
+			}
+
+			if endpoint.AcceptsEvents() != tt.expectedEvents {
+				t.Errorf("Expected AcceptsEvents %v, got %v", tt.expectedEvents, endpoint.AcceptsEvents())
+			}
+		})
+	}
+}
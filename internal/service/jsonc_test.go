@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStripJSONC(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{
+			name:     "line comment",
+			input:    "{\"a\": 1 // one\n}",
+			expected: map[string]interface{}{"a": 1.0},
+		},
+		{
+			name:     "block comment",
+			input:    `{/* lead */ "a": /* inline */ 1}`,
+			expected: map[string]interface{}{"a": 1.0},
+		},
+		{
+			name:     "trailing commas",
+			input:    "{\"a\": [1, 2,],\n}",
+			expected: map[string]interface{}{"a": []interface{}{1.0, 2.0}},
+		},
+		{
+			name:     "trailing comma before comment",
+			input:    "[1, // last\n]",
+			expected: []interface{}{1.0},
+		},
+		{
+			name:     "comment markers inside strings",
+			input:    `{"url": "http://example.com/*", "note": "a, ]"}`,
+			expected: map[string]interface{}{"url": "http://example.com/*", "note": "a, ]"},
+		},
+		{
+			name:     "escaped quote in string",
+			input:    `{"q": "say \"hi\" // not a comment"}`,
+			expected: map[string]interface{}{"q": `say "hi" // not a comment`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := json.Unmarshal(stripJSONC([]byte(tt.input)), &got); err != nil {
+				t.Fatalf("Expected valid JSON after stripping, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
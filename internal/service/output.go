@@ -0,0 +1,86 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Named output filters built into natshd
+const (
+	OutputFilterStripANSI = "strip_ansi" // remove terminal color and cursor escape sequences
+	OutputFilterJSON      = "json"       // encode output that is not valid JSON as a JSON string
+)
+
+// ansiEscape matches CSI escape sequences such as color codes
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// OutputFilter post-processes successful script output before it becomes the
+// response: first the named filter, if any, then the external filter command,
+// which receives the output on stdin and replaces it with its stdout
+type OutputFilter struct {
+	name    string
+	command []string
+}
+
+// NewOutputFilter creates a filter from a named filter and/or a whitespace-separated
+// filter command. It returns nil when both are empty.
+func NewOutputFilter(name, command string) (*OutputFilter, error) {
+	switch name {
+	case "", OutputFilterStripANSI, OutputFilterJSON:
+	default:
+		return nil, fmt.Errorf("unknown output filter '%s', must be one of: %s, %s", name, OutputFilterStripANSI, OutputFilterJSON)
+	}
+
+	fields := strings.Fields(command)
+	if command != "" && len(fields) == 0 {
+		return nil, fmt.Errorf("output filter command is empty")
+	}
+
+	if name == "" && len(fields) == 0 {
+		return nil, nil
+	}
+	return &OutputFilter{name: name, command: fields}, nil
+}
+
+// Apply runs the output through the filter
+func (f *OutputFilter) Apply(ctx context.Context, output []byte) ([]byte, error) {
+	switch f.name {
+	case OutputFilterStripANSI:
+		output = ansiEscape.ReplaceAll(output, nil)
+	case OutputFilterJSON:
+		if trimmed := bytes.TrimSpace(output); len(trimmed) > 0 && json.Valid(trimmed) {
+			output = trimmed
+		} else {
+			encoded, err := json.Marshal(string(output))
+			if err != nil {
+				return nil, err
+			}
+			output = encoded
+		}
+	}
+
+	if len(f.command) == 0 {
+		return output, nil
+	}
+
+	cmd := exec.CommandContext(ctx, f.command[0], f.command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = waitDelay
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("filter command %s: %w: %s", f.command[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("filter command %s: %w", f.command[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
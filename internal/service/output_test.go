@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewOutputFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		filterName  string
+		command     string
+		expectNil   bool
+		expectError bool
+	}{
+		{name: "disabled", expectNil: true},
+		{name: "named filter", filterName: OutputFilterStripANSI},
+		{name: "filter command", command: "tr a-z A-Z"},
+		{name: "unknown named filter", filterName: "uppercase", expectError: true},
+		{name: "blank filter command", command: "   ", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewOutputFilter(tt.filterName, tt.command)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (filter == nil) != tt.expectNil {
+				t.Errorf("Expected nil filter=%v, got %v", tt.expectNil, filter)
+			}
+		})
+	}
+}
+
+func TestOutputFilter_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		filterName string
+		command    string
+		output     string
+		expected   string
+	}{
+		{
+			name:       "strip ansi colors",
+			filterName: OutputFilterStripANSI,
+			output:     "\x1b[32mok\x1b[0m done",
+			expected:   "ok done",
+		},
+		{
+			name:       "json passes valid JSON through",
+			filterName: OutputFilterJSON,
+			output:     "{\"ok\": true}\n",
+			expected:   `{"ok": true}`,
+		},
+		{
+			name:       "json encodes plain text",
+			filterName: OutputFilterJSON,
+			output:     "hello\n",
+			expected:   `"hello\n"`,
+		},
+		{
+			name:     "filter command",
+			command:  "tr a-z A-Z",
+			output:   "hello",
+			expected: "HELLO",
+		},
+		{
+			name:       "named filter runs before command",
+			filterName: OutputFilterStripANSI,
+			command:    "tr a-z A-Z",
+			output:     "\x1b[1mhello\x1b[0m",
+			expected:   "HELLO",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewOutputFilter(tt.filterName, tt.command)
+			if err != nil {
+				t.Fatalf("Failed to create filter: %v", err)
+			}
+
+			result, err := filter.Apply(context.Background(), []byte(tt.output))
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestOutputFilter_ApplyReportsFailingCommand(t *testing.T) {
+	filter, err := NewOutputFilter("", "false")
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	if _, err := filter.Apply(context.Background(), []byte("hello")); err == nil {
+		t.Error("Expected a failing filter command to return an error")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package service
+
+import "os/exec"
+
+// killProcessGroupOnCancel leaves the default of killing only the direct child
+// off Unix, where there are no process groups to signal
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
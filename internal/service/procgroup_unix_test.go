@@ -0,0 +1,72 @@
+//go:build unix
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestScriptRunner_TimeoutKillsBackgroundedChildren(t *testing.T) {
+	tempDir := t.TempDir()
+	pidFile := filepath.Join(tempDir, "child.pid")
+	scriptPath := filepath.Join(tempDir, "background.sh")
+
+	script := `#!/usr/bin/env bash
+sleep 30 &
+echo $! > "` + pidFile + `"
+wait
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	runner := NewScriptRunner(scriptPath)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	_, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read child pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse child pid: %v", err)
+	}
+
+	// The orphaned child is reaped by init, which may take a moment
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("Expected backgrounded child %d to be killed with the script", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether a process exists and isn't a zombie waiting to be reaped
+func processRunning(pid int) bool {
+	if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true // No procfs, trust kill
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
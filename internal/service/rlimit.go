@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rlimits caps the resources of a script process. Limits are set as both the soft
+// and hard limit before the script starts, so the script cannot raise them again.
+// Zero leaves a resource at the limit natshd itself runs with.
+type Rlimits struct {
+	NoFile     int64 `toml:"nofile"`      // maximum open file descriptors
+	AS         int64 `toml:"as"`          // maximum address space in bytes
+	CPUSeconds int64 `toml:"cpu_seconds"` // maximum CPU time in seconds
+}
+
+// IsZero reports whether no limit is set
+func (r Rlimits) IsZero() bool {
+	return r == Rlimits{}
+}
+
+// Merge returns the limits with every limit set in override replacing the current one
+func (r Rlimits) Merge(override Rlimits) Rlimits {
+	if override.NoFile != 0 {
+		r.NoFile = override.NoFile
+	}
+	if override.AS != 0 {
+		r.AS = override.AS
+	}
+	if override.CPUSeconds != 0 {
+		r.CPUSeconds = override.CPUSeconds
+	}
+	return r
+}
+
+// Validate checks that the limits are usable on this platform
+func (r Rlimits) Validate() error {
+	if r.NoFile < 0 || r.AS < 0 || r.CPUSeconds < 0 {
+		return fmt.Errorf("rlimits cannot be negative")
+	}
+	if r.AS != 0 && r.AS < 1024 {
+		return fmt.Errorf("rlimit as must be at least 1024 bytes, got %d", r.AS)
+	}
+	if !r.IsZero() && !rlimitsSupported {
+		return fmt.Errorf("rlimits are only supported on Unix systems")
+	}
+	return nil
+}
+
+// ulimitCommands returns one ulimit command per limit, since some shells (dash)
+// accept a single limit per invocation. Address space is converted to KiB.
+func (r Rlimits) ulimitCommands() []string {
+	var commands []string
+	if r.NoFile > 0 {
+		commands = append(commands, "ulimit -n "+strconv.FormatInt(r.NoFile, 10))
+	}
+	if r.AS > 0 {
+		commands = append(commands, "ulimit -v "+strconv.FormatInt(r.AS/1024, 10))
+	}
+	if r.CPUSeconds > 0 {
+		commands = append(commands, "ulimit -t "+strconv.FormatInt(r.CPUSeconds, 10))
+	}
+	return commands
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package service
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const rlimitsSupported = false
+
+// applyRlimits is unsupported off Unix; Rlimits.Validate rejects limits there
+func applyRlimits(cmd *exec.Cmd, limits Rlimits) error {
+	return fmt.Errorf("rlimits are only supported on Unix systems")
+}
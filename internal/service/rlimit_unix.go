@@ -0,0 +1,25 @@
+//go:build unix
+
+package service
+
+import (
+	"os/exec"
+	"strings"
+)
+
+const rlimitsSupported = true
+
+// applyRlimits runs the command through /bin/sh, which sets the limits with ulimit
+// and then execs the original command in its place. os/exec has no hook between
+// fork and exec, and setting the limits on natshd itself would affect every script.
+func applyRlimits(cmd *exec.Cmd, limits Rlimits) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	commands := append(limits.ulimitCommands(), `exec "$0" "$@"`)
+	script := strings.Join(commands, " && ")
+	cmd.Args = append([]string{"/bin/sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build unix
+
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptRunner_RlimitNoFile(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "fds.sh")
+
+	// Report the limit, then try to open a descriptor above it
+	script := `#!/usr/bin/env bash
+echo "limit=$(ulimit -n)"
+if exec 40</dev/null; then
+  echo "opened"
+else
+  echo "refused"
+fi
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{Rlimits: Rlimits{NoFile: 32}})
+	result, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := string(result.Stdout)
+	if !strings.Contains(output, "limit=32\n") {
+		t.Errorf("Expected the script to run with nofile 32, got %q", output)
+	}
+	if !strings.Contains(output, "refused") {
+		t.Errorf("Expected opening a descriptor above the limit to fail, got %q", output)
+	}
+
+	// Without limits the same script opens the descriptor
+	unlimited := NewScriptRunner(scriptPath)
+	result, err = unlimited.ExecuteRequest(ctx, "test.subject", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(result.Stdout), "opened") {
+		t.Errorf("Expected the unlimited script to open the descriptor, got %q", string(result.Stdout))
+	}
+}
+
+func TestScriptRunner_RlimitsPassArguments(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "args.sh")
+
+	script := `#!/usr/bin/env bash
+echo "$0 $1"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{Rlimits: Rlimits{NoFile: 64, AS: 1 << 30, CPUSeconds: 10}})
+	result, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := scriptPath + " test.subject\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(result.Stdout))
+	}
+}
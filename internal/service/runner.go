@@ -5,12 +5,68 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 )
 
+// waitDelay bounds how long a stopped script's leftover children may keep its output open
+const waitDelay = time.Second
+
 // ScriptRunner handles execution of shell scripts for service operations
 type ScriptRunner struct {
 	scriptPath string
+	options    RunnerOptions
+}
+
+// RunnerOptions customizes how a ScriptRunner executes its script
+type RunnerOptions struct {
+	// CommandTemplate wraps execution, e.g. "firejail --quiet {{.Script}} {{.Arg}}".
+	// The template is split on whitespace before substitution, so each field becomes
+	// one argument and paths containing spaces are passed intact. Empty runs the script directly.
+	CommandTemplate string
+	// StdinLineEndings set to "lf" converts CRLF and lone CR line endings in request
+	// payloads to LF before they reach the script. Empty passes payloads verbatim.
+	StdinLineEndings string
+	// StdinTrailingNewline appends a newline to request payloads that lack one
+	StdinTrailingNewline bool
+	// CleanEnv runs scripts with only the PassEnv variables from natshd's environment
+	// instead of inheriting all of it
+	CleanEnv bool
+	PassEnv  []string
+	// Env sets variables for the script on top of the environment it would
+	// otherwise get, overriding inherited values of the same name
+	Env map[string]string
+	// Rlimits caps the resources of the script process (Unix only)
+	Rlimits Rlimits
+	// InfoFormat set to "jsonc" accepts comments and trailing commas in the
+	// script's info output. Empty or "json" requires strict JSON.
+	InfoFormat string
+	// Interpreter runs scripts as "interpreter script arg", e.g. "/bin/bash", so
+	// they need no executable bit. It is split on whitespace. Empty executes the
+	// script directly, honoring its shebang.
+	Interpreter string
+	// Dir is the working directory the script runs in. Empty inherits natshd's.
+	Dir string
+	// MaxOutputBytes caps how much of a request's stdout and stderr (each) is
+	// captured; the rest is discarded and the result marked truncated. 0 is unlimited.
+	MaxOutputBytes int64
+	// AllowWildcards accepts the NATS wildcards "*" and a trailing ">" in the
+	// endpoint subjects of the script's info
+	AllowWildcards bool
+}
+
+// LineEndingsLF normalizes payload line endings to LF
+const LineEndingsLF = "lf"
+
+// commandTemplateData is substituted into RunnerOptions.CommandTemplate
+type commandTemplateData struct {
+	Script string
+	Arg    string
 }
 
 // ExecutionResult represents the result of executing a script
@@ -19,24 +75,218 @@ type ExecutionResult struct {
 	Stdout   []byte `json:"stdout,omitempty"`
 	Stderr   []byte `json:"stderr,omitempty"`
 	ExitCode int    `json:"exit_code"`
+	// Truncated is set when stdout or stderr exceeded RunnerOptions.MaxOutputBytes
+	// and was cut off at the limit
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // NewScriptRunner creates a new script runner for the given script path
 func NewScriptRunner(scriptPath string) *ScriptRunner {
+	return NewScriptRunnerWithOptions(scriptPath, RunnerOptions{})
+}
+
+// NewScriptRunnerWithOptions creates a script runner with custom execution options
+func NewScriptRunnerWithOptions(scriptPath string, options RunnerOptions) *ScriptRunner {
 	return &ScriptRunner{
 		scriptPath: scriptPath,
+		options:    options,
+	}
+}
+
+// ValidateCommandTemplate checks that a command template parses and produces a command
+func ValidateCommandTemplate(commandTemplate string) error {
+	_, err := buildCommandArgs(commandTemplate, commandTemplateData{Script: "script", Arg: "arg"})
+	return err
+}
+
+// buildCommandArgs expands a command template into an argument list
+func buildCommandArgs(commandTemplate string, data commandTemplateData) ([]string, error) {
+	fields := strings.Fields(commandTemplate)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("command template is empty")
+	}
+
+	args := make([]string, 0, len(fields))
+	for _, field := range fields {
+		tmpl, err := template.New("command").Option("missingkey=error").Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command template: %w", err)
+		}
+
+		var expanded bytes.Buffer
+		if err := tmpl.Execute(&expanded, data); err != nil {
+			return nil, fmt.Errorf("invalid command template: %w", err)
+		}
+		args = append(args, expanded.String())
+	}
+
+	return args, nil
+}
+
+// command builds the command that runs the script with the given argument
+func (sr *ScriptRunner) command(ctx context.Context, arg string) (*exec.Cmd, error) {
+	// A relative script path would resolve against the new working directory
+	scriptPath := sr.scriptPath
+	if sr.options.Dir != "" {
+		// os/exec reports a missing directory as if the script itself were missing
+		if info, err := os.Stat(sr.options.Dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("script working directory %s is not a directory", sr.options.Dir)
+		}
+		absPath, err := filepath.Abs(scriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve script path: %w", err)
+		}
+		scriptPath = absPath
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case sr.options.CommandTemplate != "":
+		args, err := buildCommandArgs(sr.options.CommandTemplate, commandTemplateData{Script: scriptPath, Arg: arg})
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	case strings.TrimSpace(sr.options.Interpreter) != "":
+		args := append(strings.Fields(sr.options.Interpreter), scriptPath, arg)
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	default:
+		cmd = exec.CommandContext(ctx, scriptPath, arg)
+	}
+	cmd.Dir = sr.options.Dir
+
+	// Children of a killed script (e.g. a running sleep) can hold its output open;
+	// don't let them delay returning once the context is done
+	cmd.WaitDelay = waitDelay
+	killProcessGroupOnCancel(cmd)
+
+	if sr.options.CleanEnv {
+		cmd.Env = allowedEnv(sr.options.PassEnv)
+	}
+
+	// Later entries win in os/exec, so configured variables override inherited
+	// ones and per-request variables override both
+	if len(sr.options.Env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, configuredEnv(sr.options.Env)...)
+	}
+
+	if env := requestEnv(ctx); len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+
+	if !sr.options.Rlimits.IsZero() {
+		if err := applyRlimits(cmd, sr.options.Rlimits); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// allowedEnv returns the variables of the current environment named in passEnv.
+// The result is never nil, since a nil Env would inherit the whole environment.
+func allowedEnv(passEnv []string) []string {
+	env := []string{}
+	for _, name := range passEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// configuredEnv returns the configured variables as "NAME=value", sorted by name
+// so scripts see a stable environment
+func configuredEnv(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+vars[name])
+	}
+	return env
+}
+
+// requestEnvKey carries per-request environment variables in a context
+type requestEnvKey struct{}
+
+// WithRequestEnv returns a context whose script executions get env ("NAME=value")
+// added to the environment they would otherwise run with, after any variables
+// added by earlier calls
+func WithRequestEnv(ctx context.Context, env []string) context.Context {
+	existing := requestEnv(ctx)
+	return context.WithValue(ctx, requestEnvKey{}, append(existing[:len(existing):len(existing)], env...))
+}
+
+// requestEnv returns the environment variables added with WithRequestEnv
+func requestEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(requestEnvKey{}).([]string)
+	return env
+}
+
+// requestSubjectKey carries the subjects of the NATS request being served
+type requestSubjectKey struct{}
+
+// requestSubjects are the subjects passed to a script as NATS_FULL_SUBJECT and NATS_REPLY
+type requestSubjects struct {
+	full  string
+	reply string
+}
+
+// WithRequestSubjects returns a context whose script executions are told the
+// fully-qualified subject the request arrived on and its reply subject
+func WithRequestSubjects(ctx context.Context, fullSubject, reply string) context.Context {
+	return context.WithValue(ctx, requestSubjectKey{}, requestSubjects{full: fullSubject, reply: reply})
+}
+
+// subjectEnv returns the NATS_* variables describing the request: the subject the
+// script is called with, the fully-qualified subject (the same unless set with
+// WithRequestSubjects) and the reply subject (empty for plain publishes)
+func subjectEnv(ctx context.Context, subject string) []string {
+	subjects, ok := ctx.Value(requestSubjectKey{}).(requestSubjects)
+	if !ok {
+		subjects.full = subject
+	}
+	return []string{
+		"NATS_SUBJECT=" + subject,
+		"NATS_FULL_SUBJECT=" + subjects.full,
+		"NATS_REPLY=" + subjects.reply,
 	}
 }
 
+// HeaderEnvName returns the environment variable a request header is passed to
+// scripts in, e.g. NATSHD_HEADER_X_TENANT_ID for X-Tenant-ID
+func HeaderEnvName(header string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(header))
+	return "NATSHD_HEADER_" + name
+}
+
 // GetServiceDefinition executes the script with "info" argument to get service definition
 func (sr *ScriptRunner) GetServiceDefinition(ctx context.Context) (ServiceDefinition, error) {
-	cmd := exec.CommandContext(ctx, sr.scriptPath, "info")
+	cmd, err := sr.command(ctx, "info")
+	if err != nil {
+		return ServiceDefinition{}, err
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		// Check if context was cancelled (timeout)
 		if ctx.Err() != nil {
@@ -50,34 +300,85 @@ func (sr *ScriptRunner) GetServiceDefinition(ctx context.Context) (ServiceDefini
 		return ServiceDefinition{}, fmt.Errorf("script execution failed: %w", err)
 	}
 
+	output := stdout.Bytes()
+	if sr.options.InfoFormat == InfoFormatJSONC {
+		output = stripJSONC(output)
+	}
+
 	var def ServiceDefinition
-	if err := json.Unmarshal(stdout.Bytes(), &def); err != nil {
+	if err := json.Unmarshal(output, &def); err != nil {
 		return ServiceDefinition{}, fmt.Errorf("failed to parse service definition JSON: %w", err)
 	}
 
-	if err := def.Validate(); err != nil {
+	validate := def.Validate
+	if sr.options.AllowWildcards {
+		validate = def.ValidateAllowingWildcards
+	}
+	if err := validate(); err != nil {
 		return ServiceDefinition{}, fmt.Errorf("invalid service definition: %w", err)
 	}
 
 	return def, nil
 }
 
+// RunInit executes the script with the "init" argument for one-time setup,
+// returning an error if it exits non-zero
+func (sr *ScriptRunner) RunInit(ctx context.Context) error {
+	cmd, err := sr.command(ctx, "init")
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// Check if context was cancelled (timeout)
+		if ctx.Err() != nil {
+			return fmt.Errorf("script init timeout: %w", ctx.Err())
+		}
+
+		stderrOutput := strings.TrimSpace(stderr.String())
+		if stderrOutput != "" {
+			return fmt.Errorf("script init failed: %w (stderr: %s)", err, stderrOutput)
+		}
+		return fmt.Errorf("script init failed: %w", err)
+	}
+
+	return nil
+}
+
 // ExecuteRequest executes the script with the given subject and payload
 func (sr *ScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (ExecutionResult, error) {
-	cmd := exec.CommandContext(ctx, sr.scriptPath, subject)
+	cmd, err := sr.command(ctx, subject)
+	if err != nil {
+		return ExecutionResult{}, err
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Stdin = bytes.NewReader(payload)
+	// The request's subjects come last so nothing inherited or configured can
+	// misreport where the request came from
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, subjectEnv(ctx, subject)...)
 
-	err := cmd.Run()
+	stdout := &cappedBuffer{limit: sr.options.MaxOutputBytes}
+	stderr := &cappedBuffer{limit: sr.options.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// os/exec copies the payload from a goroutine and drops the broken pipe error
+	// when a script exits without reading it, so a large payload can't block a
+	// script that ignores stdin
+	cmd.Stdin = bytes.NewReader(sr.normalizeStdin(payload))
+
+	err = cmd.Run()
 
 	result := ExecutionResult{
-		Success:  err == nil,
-		Stdout:   stdout.Bytes(),
-		Stderr:   stderr.Bytes(),
-		ExitCode: 0,
+		Success:   err == nil,
+		Stdout:    stdout.Bytes(),
+		Stderr:    stderr.Bytes(),
+		ExitCode:  0,
+		Truncated: stdout.Truncated() || stderr.Truncated(),
 	}
 
 	if err != nil {
@@ -97,6 +398,20 @@ func (sr *ScriptRunner) ExecuteRequest(ctx context.Context, subject string, payl
 	return result, nil
 }
 
+// normalizeStdin applies the configured line-ending options to a request payload
+func (sr *ScriptRunner) normalizeStdin(payload []byte) []byte {
+	if sr.options.StdinLineEndings == LineEndingsLF {
+		payload = bytes.ReplaceAll(payload, []byte("\r\n"), []byte("\n"))
+		payload = bytes.ReplaceAll(payload, []byte("\r"), []byte("\n"))
+	}
+
+	if sr.options.StdinTrailingNewline && !bytes.HasSuffix(payload, []byte("\n")) {
+		payload = append(payload[:len(payload):len(payload)], '\n')
+	}
+
+	return payload
+}
+
 // ToJSON converts the execution result to JSON format
 func (er ExecutionResult) ToJSON() ([]byte, error) {
 	// Create a simplified structure for JSON output
@@ -113,5 +428,9 @@ func (er ExecutionResult) ToJSON() ([]byte, error) {
 		jsonResult["stderr"] = string(er.Stderr)
 	}
 
+	if er.Truncated {
+		jsonResult["truncated"] = true
+	}
+
 	return json.Marshal(jsonResult)
 }
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -101,6 +102,66 @@ fi
 	}
 }
 
+func TestScriptRunner_GetServiceDefinition_CommentedJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "commented.sh")
+
+	commentedScript := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<'EOF'
+{
+  // Greets people by name
+  "name": "GreetingService",
+  "version": "1.0.0", /* bump on every release */
+  "endpoints": [
+    {"name": "Hello", "subject": "greeting.hello"},
+  ],
+}
+EOF
+  exit 0
+fi
+`
+
+	if err := os.WriteFile(scriptPath, []byte(commentedScript), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		infoFormat  string
+		expectError bool
+	}{
+		{name: "strict by default", infoFormat: "", expectError: true},
+		{name: "strict json", infoFormat: InfoFormatJSON, expectError: true},
+		{name: "jsonc", infoFormat: InfoFormatJSONC, expectError: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{InfoFormat: tt.infoFormat})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			def, err := runner.GetServiceDefinition(ctx)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error for commented JSON")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if def.Name != "GreetingService" || def.Version != "1.0.0" {
+				t.Errorf("Expected GreetingService 1.0.0, got %s %s", def.Name, def.Version)
+			}
+			if len(def.Endpoints) != 1 || def.Endpoints[0].Subject != "greeting.hello" {
+				t.Errorf("Expected one greeting.hello endpoint, got %+v", def.Endpoints)
+			}
+		})
+	}
+}
+
 func TestScriptRunner_GetServiceDefinition_ScriptError(t *testing.T) {
 	tempDir := t.TempDir()
 	scriptPath := filepath.Join(tempDir, "error_script.sh")
@@ -311,6 +372,137 @@ echo "Too slow"
 	}
 }
 
+func TestScriptRunner_ExecuteRequest_IgnoredStdin(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "ignores_stdin.sh")
+
+	// Never reads the payload, which is far larger than a pipe buffer
+	script := `#!/usr/bin/env bash
+sleep 0.1
+echo "done"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	runner := NewScriptRunner(scriptPath)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	payload := []byte(strings.Repeat("x", 8<<20))
+	start := time.Now()
+	result, err := runner.ExecuteRequest(ctx, "test.subject", payload)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success || strings.TrimSpace(string(result.Stdout)) != "done" {
+		t.Errorf("Expected successful output 'done', got %+v", result)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Expected the request to finish when the script exits, took %s", elapsed)
+	}
+}
+
+func TestScriptRunner_ExecuteRequest_MaxOutputBytes(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "chatty.sh")
+
+	// Prints far more than the cap on both streams, then exits normally
+	script := `#!/usr/bin/env bash
+yes o | head -c 1048576
+yes e | head -c 1048576 >&2
+echo "still running" >&2
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		maxOutputBytes    int64
+		expectedStdoutLen int
+		expectTruncated   bool
+	}{
+		{name: "capped", maxOutputBytes: 1024, expectedStdoutLen: 1024, expectTruncated: true},
+		{name: "unlimited", maxOutputBytes: 0, expectedStdoutLen: 1048576, expectTruncated: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{MaxOutputBytes: tt.maxOutputBytes})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			result, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Discarding output must not break the script's pipe and fail it
+			if !result.Success {
+				t.Errorf("Expected the script to succeed, got exit code %d", result.ExitCode)
+			}
+			if len(result.Stdout) != tt.expectedStdoutLen {
+				t.Errorf("Expected %d bytes of stdout, got %d", tt.expectedStdoutLen, len(result.Stdout))
+			}
+			if tt.maxOutputBytes > 0 && int64(len(result.Stderr)) != tt.maxOutputBytes {
+				t.Errorf("Expected %d bytes of stderr, got %d", tt.maxOutputBytes, len(result.Stderr))
+			}
+			if result.Truncated != tt.expectTruncated {
+				t.Errorf("Expected Truncated %v, got %v", tt.expectTruncated, result.Truncated)
+			}
+		})
+	}
+}
+
+func TestScriptRunner_RunInit(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		script      string
+		expectError bool
+	}{
+		{
+			name: "init succeeds",
+			script: `#!/usr/bin/env bash
+[[ "$1" == "init" ]] && exit 0
+exit 1
+`,
+			expectError: false,
+		},
+		{
+			name: "init fails",
+			script: `#!/usr/bin/env bash
+echo "setup failed" >&2
+exit 2
+`,
+			expectError: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptPath := filepath.Join(tempDir, fmt.Sprintf("init_%d.sh", i))
+			if err := os.WriteFile(scriptPath, []byte(tt.script), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			err := NewScriptRunner(scriptPath).RunInit(context.Background())
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestScriptRunner_FileNotExists(t *testing.T) {
 	runner := NewScriptRunner("/nonexistent/script.sh")
 	ctx := context.Background()
@@ -321,6 +513,389 @@ func TestScriptRunner_FileNotExists(t *testing.T) {
 	}
 }
 
+func TestScriptRunner_CommandTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "wrapped service.sh")
+
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo "{\"name\": \"Service${WRAPPED}\", \"endpoints\": [{\"name\": \"Test\", \"subject\": \"test.subject\"}]}"
+  exit 0
+fi
+echo "direct"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The wrapper runs the script through env so the info probe sees WRAPPED=1
+	runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{
+		CommandTemplate: "env WRAPPED=1 {{.Script}} {{.Arg}}",
+	})
+
+	def, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if def.Name != "Service1" {
+		t.Errorf("Expected wrapped info probe to return Service1, got %s", def.Name)
+	}
+
+	// A wrapper that prepends echo prints the command instead of running the script
+	echoRunner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{
+		CommandTemplate: "echo wrapped {{.Script}} {{.Arg}}",
+	})
+
+	result, err := echoRunner.ExecuteRequest(ctx, "test.subject", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "wrapped " + scriptPath + " test.subject\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(result.Stdout))
+	}
+}
+
+func TestScriptRunner_Interpreter(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "no_exec_bit.sh")
+
+	// No shebang and no executable bit: only an interpreter can run it
+	script := `echo "subject=$1"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		interpreter string
+		expectError bool
+	}{
+		{name: "executed directly", interpreter: "", expectError: true},
+		{name: "interpreter path", interpreter: "/bin/sh", expectError: false},
+		{name: "interpreter with arguments", interpreter: "/usr/bin/env bash", expectError: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{Interpreter: tt.interpreter})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error running a non-executable script directly")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.TrimSpace(string(result.Stdout)); got != "subject=test.subject" {
+				t.Errorf("Expected 'subject=test.subject', got %q", got)
+			}
+		})
+	}
+}
+
+func TestScriptRunner_StdinNormalization(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "echo.sh")
+
+	// Echo stdin back unchanged so the test sees exactly what the script received
+	script := `#!/usr/bin/env bash
+cat
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  RunnerOptions
+		payload  string
+		expected string
+	}{
+		{
+			name:     "verbatim by default",
+			payload:  "line1\r\nline2\rline3",
+			expected: "line1\r\nline2\rline3",
+		},
+		{
+			name:     "normalize to LF",
+			options:  RunnerOptions{StdinLineEndings: LineEndingsLF},
+			payload:  "line1\r\nline2\rline3\n",
+			expected: "line1\nline2\nline3\n",
+		},
+		{
+			name:     "add trailing newline",
+			options:  RunnerOptions{StdinTrailingNewline: true},
+			payload:  `{"name": "Alice"}`,
+			expected: "{\"name\": \"Alice\"}\n",
+		},
+		{
+			name:     "keep existing trailing newline",
+			options:  RunnerOptions{StdinTrailingNewline: true},
+			payload:  "done\n",
+			expected: "done\n",
+		},
+		{
+			name:     "normalize and add trailing newline",
+			options:  RunnerOptions{StdinLineEndings: LineEndingsLF, StdinTrailingNewline: true},
+			payload:  "a\r\nb",
+			expected: "a\nb\n",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewScriptRunnerWithOptions(scriptPath, tt.options)
+
+			result, err := runner.ExecuteRequest(ctx, "test.subject", []byte(tt.payload))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("Expected script to receive %q, got %q", tt.expected, string(result.Stdout))
+			}
+		})
+	}
+}
+
+func TestScriptRunner_CleanEnv(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "env.sh")
+
+	script := `#!/usr/bin/env bash
+echo "allowed=${NATSHD_TEST_ALLOWED:-unset} secret=${NATSHD_TEST_SECRET:-unset}"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	t.Setenv("NATSHD_TEST_ALLOWED", "visible")
+	t.Setenv("NATSHD_TEST_SECRET", "hunter2")
+
+	tests := []struct {
+		name     string
+		options  RunnerOptions
+		expected string
+	}{
+		{
+			name:     "inherits everything by default",
+			expected: "allowed=visible secret=hunter2\n",
+		},
+		{
+			name:     "clean env passes only allowlisted variables",
+			options:  RunnerOptions{CleanEnv: true, PassEnv: []string{"PATH", "NATSHD_TEST_ALLOWED"}},
+			expected: "allowed=visible secret=unset\n",
+		},
+		{
+			name:     "configured variables override inherited ones",
+			options:  RunnerOptions{Env: map[string]string{"NATSHD_TEST_SECRET": "redacted"}},
+			expected: "allowed=visible secret=redacted\n",
+		},
+		{
+			name: "configured variables are added to a clean env",
+			options: RunnerOptions{
+				CleanEnv: true,
+				PassEnv:  []string{"PATH"},
+				Env:      map[string]string{"NATSHD_TEST_ALLOWED": "configured"},
+			},
+			expected: "allowed=configured secret=unset\n",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewScriptRunnerWithOptions(scriptPath, tt.options)
+
+			result, err := runner.ExecuteRequest(ctx, "test.subject", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(result.Stdout))
+			}
+		})
+	}
+}
+
+func TestScriptRunner_ExecuteRequest_SubjectEnv(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "subjects.sh")
+
+	script := `#!/usr/bin/env bash
+echo "arg=$1 subject=$NATS_SUBJECT full=$NATS_FULL_SUBJECT reply=$NATS_REPLY"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "subject only",
+			ctx:      context.Background(),
+			expected: "arg=greet.hello subject=greet.hello full=greet.hello reply=\n",
+		},
+		{
+			name:     "with request subjects",
+			ctx:      WithRequestSubjects(context.Background(), "web-01.greet.hello", "_INBOX.abc123"),
+			expected: "arg=greet.hello subject=greet.hello full=web-01.greet.hello reply=_INBOX.abc123\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Inherited values must not leak through in place of the request's
+			t.Setenv("NATS_REPLY", "stale")
+
+			runner := NewScriptRunner(scriptPath)
+			ctx, cancel := context.WithTimeout(tt.ctx, 5*time.Second)
+			defer cancel()
+
+			result, err := runner.ExecuteRequest(ctx, "greet.hello", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(result.Stdout))
+			}
+		})
+	}
+}
+
+func TestScriptRunner_Dir(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatalf("Failed to create data dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "greeting.txt"), []byte("hello from data"), 0644); err != nil {
+		t.Fatalf("Failed to create data file: %v", err)
+	}
+
+	// Reads a data file by relative path, as scripts shipped with their data do
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo "{\"name\": \"DirService\", \"description\": \"$(cat greeting.txt)\", \"endpoints\": [{\"name\": \"Test\", \"subject\": \"dir.test\"}]}"
+  exit 0
+fi
+cat greeting.txt
+`
+	scriptPath := filepath.Join(tempDir, "reader.sh")
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	// A relative script path must still resolve once the working directory changes
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	runner := NewScriptRunnerWithOptions("reader.sh", RunnerOptions{Dir: dataDir})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	def, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if def.Description != "hello from data" {
+		t.Errorf("Expected info to read the data file, got description %q", def.Description)
+	}
+
+	result, err := runner.ExecuteRequest(ctx, "dir.test", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(result.Stdout) != "hello from data" {
+		t.Errorf("Expected request to read the data file, got %q", result.Stdout)
+	}
+
+	missing := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{Dir: filepath.Join(tempDir, "missing")})
+	if _, err := missing.ExecuteRequest(ctx, "dir.test", nil); err == nil || !strings.Contains(err.Error(), "working directory") {
+		t.Errorf("Expected a working directory error, got %v", err)
+	}
+}
+
+func TestScriptRunner_EnvVisibleToInfo(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "env_info.sh")
+
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo "{\"name\": \"EnvService\", \"description\": \"$ENVIRONMENT-$REGION\", \"endpoints\": [{\"name\": \"Test\", \"subject\": \"env.test\"}]}"
+fi
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	runner := NewScriptRunnerWithOptions(scriptPath, RunnerOptions{
+		Env: map[string]string{"ENVIRONMENT": "prod", "REGION": "us-east"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	def, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if def.Description != "prod-us-east" {
+		t.Errorf("Expected description 'prod-us-east', got %q", def.Description)
+	}
+}
+
+func TestValidateCommandTemplate(t *testing.T) {
+	tests := []struct {
+		template    string
+		expectError bool
+	}{
+		{"firejail --quiet {{.Script}} {{.Arg}}", false},
+		{"{{.Script}} {{.Arg}}", false},
+		{"", true},
+		{"wrapper {{.Script", true},
+		{"wrapper {{.Unknown}}", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateCommandTemplate(tt.template)
+		if tt.expectError && err == nil {
+			t.Errorf("Expected error for template %q", tt.template)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("Unexpected error for template %q: %v", tt.template, err)
+		}
+	}
+}
+
 func TestExecutionResult_ToJSON(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -344,6 +919,15 @@ func TestExecutionResult_ToJSON(t *testing.T) {
 				ExitCode: 1,
 			},
 		},
+		{
+			name: "truncated output",
+			result: ExecutionResult{
+				Success:   true,
+				Stdout:    []byte("partial"),
+				ExitCode:  0,
+				Truncated: true,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -366,6 +950,10 @@ func TestExecutionResult_ToJSON(t *testing.T) {
 			if int(parsed["exit_code"].(float64)) != tt.result.ExitCode {
 				t.Errorf("Expected exit_code %d, got %v", tt.result.ExitCode, parsed["exit_code"])
 			}
+
+			if truncated, _ := parsed["truncated"].(bool); truncated != tt.result.Truncated {
+				t.Errorf("Expected truncated %v, got %v", tt.result.Truncated, parsed["truncated"])
+			}
 		})
 	}
 }
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// InputTransform describes an optional reshaping of a JSON request body
+// before it is piped to the script's stdin
+type InputTransform struct {
+	// Rename maps a source key to a new top-level key. Source keys may use
+	// dot notation (e.g. "user.name") to copy a nested value to the top level.
+	Rename map[string]string `json:"rename,omitempty"`
+	// Defaults sets top-level keys that are missing from the request
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	// Drop removes top-level keys from the request
+	Drop []string `json:"drop,omitempty"`
+}
+
+// Validate checks if the transform is well formed
+func (t InputTransform) Validate() error {
+	for from, to := range t.Rename {
+		if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return fmt.Errorf("transform rename keys cannot be empty")
+		}
+	}
+
+	for _, key := range t.Drop {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("transform drop keys cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// Apply transforms the given JSON object payload and returns the re-encoded result
+func (t InputTransform) Apply(payload []byte) ([]byte, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, fmt.Errorf("transform requires a JSON object payload: %w", err)
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+
+	// Resolve every rename source before mutating so results don't depend on map order
+	renamed := make(map[string]interface{}, len(t.Rename))
+	for from, to := range t.Rename {
+		if value, ok := lookupPath(body, from); ok {
+			renamed[to] = value
+		}
+	}
+	for from := range t.Rename {
+		if !strings.Contains(from, ".") {
+			delete(body, from)
+		}
+	}
+	for key, value := range renamed {
+		body[key] = value
+	}
+
+	for _, key := range t.Drop {
+		delete(body, key)
+	}
+
+	for key, value := range t.Defaults {
+		if _, exists := body[key]; !exists {
+			body[key] = value
+		}
+	}
+
+	return json.Marshal(body)
+}
+
+// lookupPath resolves a dot-separated key path within a decoded JSON object
+func lookupPath(body map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = body
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInputTransform_Apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform InputTransform
+		payload   string
+		expected  map[string]interface{}
+		expectErr bool
+	}{
+		{
+			name:      "rename top-level field",
+			transform: InputTransform{Rename: map[string]string{"username": "name"}},
+			payload:   `{"username": "Alice", "greeting": "Hi"}`,
+			expected:  map[string]interface{}{"name": "Alice", "greeting": "Hi"},
+		},
+		{
+			name:      "copy nested field",
+			transform: InputTransform{Rename: map[string]string{"user.name": "name"}},
+			payload:   `{"user": {"name": "Bob"}}`,
+			expected:  map[string]interface{}{"name": "Bob", "user": map[string]interface{}{"name": "Bob"}},
+		},
+		{
+			name:      "swap fields",
+			transform: InputTransform{Rename: map[string]string{"a": "b", "b": "a"}},
+			payload:   `{"a": 1, "b": 2}`,
+			expected:  map[string]interface{}{"a": float64(2), "b": float64(1)},
+		},
+		{
+			name: "defaults and drop",
+			transform: InputTransform{
+				Defaults: map[string]interface{}{"greeting": "Hello", "name": "World"},
+				Drop:     []string{"debug"},
+			},
+			payload:  `{"name": "Carol", "debug": true}`,
+			expected: map[string]interface{}{"name": "Carol", "greeting": "Hello"},
+		},
+		{
+			name:      "non-object payload",
+			transform: InputTransform{Rename: map[string]string{"a": "b"}},
+			payload:   `not json`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.transform.Apply([]byte(tt.payload))
+
+			if tt.expectErr {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var actual map[string]interface{}
+			if err := json.Unmarshal(result, &actual); err != nil {
+				t.Fatalf("Failed to parse transformed payload: %v", err)
+			}
+
+			expectedJSON, _ := json.Marshal(tt.expected)
+			actualJSON, _ := json.Marshal(actual)
+			if string(expectedJSON) != string(actualJSON) {
+				t.Errorf("Expected %s, got %s", expectedJSON, actualJSON)
+			}
+		})
+	}
+}
+
+func TestInputTransform_Validate(t *testing.T) {
+	valid := InputTransform{Rename: map[string]string{"a": "b"}, Drop: []string{"c"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+	invalid := InputTransform{Rename: map[string]string{"a": ""}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected validation error for empty rename target")
+	}
+}
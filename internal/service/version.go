@@ -0,0 +1,42 @@
+package service
+
+import "strings"
+
+// Group version policies decide which script versions may share a service name
+const (
+	VersionPolicyAny   = "any"   // group regardless of version
+	VersionPolicyMajor = "major" // same major version, e.g. 1.2.0 and 1.4.1
+	VersionPolicyMinor = "minor" // same major and minor version, e.g. 1.2.0 and 1.2.3
+	VersionPolicyExact = "exact" // identical versions only
+)
+
+// VersionsCompatible reports whether a candidate script version may be grouped
+// with the service's pinned version under the given policy. Versions that are
+// not semver-like are only compatible when identical (except under "any").
+func VersionsCompatible(policy, pinned, candidate string) bool {
+	switch policy {
+	case "", VersionPolicyAny:
+		return true
+	case VersionPolicyMajor:
+		return versionPrefix(pinned, 1) == versionPrefix(candidate, 1)
+	case VersionPolicyMinor:
+		return versionPrefix(pinned, 2) == versionPrefix(candidate, 2)
+	default:
+		return pinned == candidate
+	}
+}
+
+// versionPrefix returns the first n numeric components of a version such as
+// "v1.2.3-rc1", or the whole version if it doesn't have that many components
+func versionPrefix(version string, n int) string {
+	core := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) < n {
+		return version
+	}
+	return strings.Join(parts[:n], ".")
+}
@@ -0,0 +1,32 @@
+package service
+
+import "testing"
+
+func TestVersionsCompatible(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		pinned    string
+		candidate string
+		expected  bool
+	}{
+		{"any policy ignores versions", VersionPolicyAny, "1.0.0", "2.0.0", true},
+		{"empty policy ignores versions", "", "1.0.0", "2.0.0", true},
+		{"major policy same major", VersionPolicyMajor, "1.2.0", "1.4.1", true},
+		{"major policy different major", VersionPolicyMajor, "1.2.0", "2.0.0", false},
+		{"major policy with v prefix", VersionPolicyMajor, "v1.2.0", "1.3.0", true},
+		{"minor policy same minor", VersionPolicyMinor, "1.2.0", "1.2.3-rc1", true},
+		{"minor policy different minor", VersionPolicyMinor, "1.2.0", "1.3.0", false},
+		{"exact policy identical", VersionPolicyExact, "1.2.3", "1.2.3", true},
+		{"exact policy different patch", VersionPolicyExact, "1.2.3", "1.2.4", false},
+		{"major policy missing version", VersionPolicyMajor, "1.0.0", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VersionsCompatible(tt.policy, tt.pinned, tt.candidate); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package supervisor
+
+import (
+	"time"
+
+	"github.com/hiway/natshd/internal/logging"
+)
+
+// recordedRequest records the status and size of the response sent to a request
+// for its access log line and metrics
+type recordedRequest struct {
+	Request
+	status        string
+	responseBytes int
+}
+
+func (r *recordedRequest) Respond(data []byte) error {
+	r.status = "200"
+	r.responseBytes = len(data)
+	return r.Request.Respond(data)
+}
+
+func (r *recordedRequest) RespondError(err error) error {
+	r.status, _ = errorCodeAndDescription(err)
+	return r.Request.RespondError(err)
+}
+
+// RespondWithHeaders keeps headers working for requests that support them
+func (r *recordedRequest) RespondWithHeaders(data []byte, headers map[string][]string) error {
+	responder, ok := r.Request.(HeaderResponder)
+	if !ok {
+		return r.Respond(data)
+	}
+	r.status = "200"
+	r.responseBytes = len(data)
+	return responder.RespondWithHeaders(data, headers)
+}
+
+// failed reports whether the request was answered with an error
+func (r *recordedRequest) failed() bool {
+	return r.status != "" && r.status != "200"
+}
+
+// recordRequest writes the access log line and metrics for a handled request
+func (ms *ManagedService) recordRequest(req *recordedRequest, start time.Time) {
+	duration := time.Since(start)
+
+	ms.accessLog.Log(logging.AccessEntry{
+		Time:          start,
+		Service:       ms.definition.Name,
+		Subject:       req.Subject(),
+		Status:        req.status,
+		Duration:      duration,
+		RequestBytes:  len(req.Data()),
+		ResponseBytes: req.responseBytes,
+	})
+	ms.statsd.Request(duration, req.failed())
+}
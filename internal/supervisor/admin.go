@@ -0,0 +1,123 @@
+package supervisor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// AdminServiceName is the micro service natshd registers for its own admin
+// endpoints when admin_service is enabled
+const AdminServiceName = "natshd"
+
+// adminServiceVersion is the version of the admin endpoints' reply format
+const adminServiceVersion = "1.0.0"
+
+// adminListEndpoint lists the services this host is serving, on
+// <admin_subject_prefix>.<hostname>.list
+const adminListEndpoint = "list"
+
+// ServiceList is the reply of the admin list endpoint
+type ServiceList struct {
+	Services []ServiceListing `json:"services"`
+}
+
+// ServiceListing is one hosted service in a ServiceList. Unlike a Topology it
+// reports subjects as registered and scripts by their full paths.
+type ServiceListing struct {
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	Scripts   []string          `json:"scripts"`
+	Endpoints []EndpointListing `json:"endpoints"`
+}
+
+// EndpointListing is one endpoint of a ServiceListing
+type EndpointListing struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Script  string `json:"script,omitempty"`
+}
+
+// ListServices describes every hosted service, sorted by service name, endpoint
+// subject and script path
+func (sm *ServiceManager) ListServices() ServiceList {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	list := ServiceList{Services: make([]ServiceListing, 0, len(sm.services))}
+	for _, managedService := range sm.services {
+		definition := managedService.definition
+
+		listing := ServiceListing{
+			Name:      definition.Name,
+			Version:   definition.Version,
+			Scripts:   []string{},
+			Endpoints: make([]EndpointListing, 0, len(definition.Endpoints)),
+		}
+		for scriptPath := range managedService.scriptRunners() {
+			listing.Scripts = append(listing.Scripts, scriptPath)
+		}
+		for _, endpoint := range definition.Endpoints {
+			endpointListing := EndpointListing{Name: endpoint.Name, Subject: endpoint.Subject}
+			if route, ok := managedService.route(endpoint.Subject); ok {
+				endpointListing.Script = route.scriptPath
+			}
+			listing.Endpoints = append(listing.Endpoints, endpointListing)
+		}
+
+		sort.Strings(listing.Scripts)
+		sort.Slice(listing.Endpoints, func(i, j int) bool {
+			return listing.Endpoints[i].Subject < listing.Endpoints[j].Subject
+		})
+		list.Services = append(list.Services, listing)
+	}
+
+	sort.Slice(list.Services, func(i, j int) bool {
+		return list.Services[i].Name < list.Services[j].Name
+	})
+	return list
+}
+
+// adminSubject is the subject of an admin service endpoint on this host
+func (sm *ServiceManager) adminSubject(endpoint string) string {
+	hostname, err := sm.config.ResolveHostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return sm.config.AdminSubjectPrefix + "." + hostname + "." + endpoint
+}
+
+// setupAdminService registers natshd's own micro service when admin_service is
+// enabled, so instances show up in micro discovery next to the services they host
+func (sm *ServiceManager) setupAdminService() error {
+	if sm.natsConn == nil || !sm.config.AdminService {
+		return nil
+	}
+
+	adminService, err := micro.AddService(sm.natsConn, micro.Config{
+		Name:        AdminServiceName,
+		Version:     adminServiceVersion,
+		Description: "natshd admin endpoints",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add admin service: %w", err)
+	}
+
+	subject := sm.adminSubject(adminListEndpoint)
+	if err := adminService.AddEndpoint(adminListEndpoint, micro.HandlerFunc(sm.handleListRequest), micro.WithEndpointSubject(subject)); err != nil {
+		adminService.Stop()
+		return fmt.Errorf("failed to add admin endpoint %s: %w", subject, err)
+	}
+
+	sm.adminService = adminService
+	return nil
+}
+
+// handleListRequest replies with the services this host is serving
+func (sm *ServiceManager) handleListRequest(req micro.Request) {
+	if err := req.RespondJSON(sm.ListServices()); err != nil {
+		logging.LogError(sm.logger, err, "failed to send service list")
+	}
+}
@@ -0,0 +1,71 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManager_HandleListRequest(t *testing.T) {
+	scriptsPath := t.TempDir()
+	manager := newTopologyTestManager(t, scriptsPath, "web01")
+
+	req := &FakeMicroRequest{subject: "natshd.web01.list"}
+	manager.handleListRequest(req)
+
+	if req.errorCode != "" {
+		t.Fatalf("Expected no error, got %s: %s", req.errorCode, req.errorDescription)
+	}
+
+	var list ServiceList
+	if err := json.Unmarshal(req.responseData, &list); err != nil {
+		t.Fatalf("Expected JSON response, got %q: %v", req.responseData, err)
+	}
+
+	expected := ServiceList{Services: []ServiceListing{
+		{
+			Name:    "BackupService",
+			Version: "2.1.0",
+			Scripts: []string{filepath.Join(scriptsPath, "backup/list.sh"), filepath.Join(scriptsPath, "backup/run.sh")},
+			Endpoints: []EndpointListing{
+				{Name: "List", Subject: "web01.backup.list", Script: filepath.Join(scriptsPath, "backup/list.sh")},
+				{Name: "Run", Subject: "web01.backup.run", Script: filepath.Join(scriptsPath, "backup/run.sh")},
+				{Name: "Status", Subject: "web01.backup.status", Script: filepath.Join(scriptsPath, "backup/list.sh")},
+			},
+		},
+		{
+			Name:    "ZoneService",
+			Version: "1.0.0",
+			Scripts: []string{filepath.Join(scriptsPath, "zone.sh")},
+			Endpoints: []EndpointListing{
+				{Name: "List", Subject: "zone.list", Script: filepath.Join(scriptsPath, "zone.sh")},
+			},
+		},
+	}}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, list)
+	}
+}
+
+func TestManager_AdminSubject(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		expected string
+	}{
+		{name: "default prefix", prefix: "natshd", expected: "natshd.web01.list"},
+		{name: "custom prefix", prefix: "ops.admin", expected: "ops.admin.web01.list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTopologyTestManager(t, t.TempDir(), "web01")
+			manager.config.AdminSubjectPrefix = tt.prefix
+
+			if subject := manager.adminSubject(adminListEndpoint); subject != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, subject)
+			}
+		})
+	}
+}
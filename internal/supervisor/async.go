@@ -0,0 +1,136 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nuid"
+)
+
+// AsyncResultSubjectPrefix is prepended to a job ID to form the subject an async
+// endpoint publishes its result on
+const AsyncResultSubjectPrefix = "natshd.jobs."
+
+// JobIDHeader carries the job ID on published async results
+const JobIDHeader = "Natshd-Job-Id"
+
+// ResultSubjectHeader lets a client choose the subject an async result is published
+// on, e.g. an inbox it subscribed to before sending the request. The result of a
+// script that finishes before the ack arrives would otherwise go unheard.
+const ResultSubjectHeader = "Natshd-Result-Subject"
+
+// asyncAck is the immediate reply to a request on an async endpoint
+type asyncAck struct {
+	JobID         string `json:"job_id"`
+	ResultSubject string `json:"result_subject"`
+}
+
+// asyncJobs tracks async endpoint jobs still running in the background
+type asyncJobs struct {
+	mutex   sync.Mutex
+	running map[string]string // jobID -> request subject
+}
+
+func (j *asyncJobs) add(jobID, subject string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.running == nil {
+		j.running = make(map[string]string)
+	}
+	j.running[jobID] = subject
+}
+
+func (j *asyncJobs) remove(jobID string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	delete(j.running, jobID)
+}
+
+func (j *asyncJobs) count() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.running)
+}
+
+// startAsyncJob acknowledges the request with a job ID and runs the script in the
+// background, publishing its result to the job's result subject. Jobs count as
+// in-flight requests, so stopping the service waits for them like any other request.
+func (ms *ManagedService) startAsyncJob(ctx context.Context, req Request, route scriptRoute, payload []byte) {
+	jobID := nuid.Next()
+	resultSubject := AsyncResultSubjectPrefix + jobID
+	if requested := headerValue(req.Headers(), ResultSubjectHeader); requested != "" {
+		if !validPublishSubject(requested) {
+			req.RespondError(&RequestError{Code: "400", Message: "invalid " + ResultSubjectHeader + " header: " + requested})
+			return
+		}
+		resultSubject = requested
+	}
+	requestSubject := req.Subject()
+	requestData := req.Data()
+
+	ack, err := json.Marshal(asyncAck{JobID: jobID, ResultSubject: resultSubject})
+	if err != nil {
+		req.RespondError(fmt.Errorf("failed to encode async acknowledgement: %w", err))
+		return
+	}
+
+	ms.inflight.begin()
+	ms.jobs.add(jobID, requestSubject)
+
+	if err := req.Respond(ack); err != nil {
+		logging.LogError(ms.logger, err, "failed to send async acknowledgement")
+	}
+
+	go func() {
+		defer ms.inflight.end()
+		defer ms.jobs.remove(jobID)
+
+		response, exitCode, err := ms.executeScript(ctx, route, requestSubject, requestData, payload)
+		ms.publishAsyncResult(resultSubject, jobID, response, exitCode, route.endpoint.ExitCodeHeader, err)
+	}()
+}
+
+// publishAsyncResult publishes a finished job's response, or its error using the same
+// headers as a micro error response
+func (ms *ManagedService) publishAsyncResult(resultSubject, jobID string, response []byte, exitCode int, exitCodeHeader bool, err error) {
+	if ms.natsConn == nil {
+		ms.logger.Warn().Str("job_id", jobID).Msg("No NATS connection to publish async result")
+		return
+	}
+
+	msg := nats.NewMsg(resultSubject)
+	msg.Header.Set(JobIDHeader, jobID)
+	if err != nil {
+		code, description := errorCodeAndDescription(err)
+		msg.Header.Set(micro.ErrorCodeHeader, code)
+		msg.Header.Set(micro.ErrorHeader, description)
+	} else {
+		msg.Data = response
+		if exitCodeHeader {
+			msg.Header.Set(ExitCodeHeader, strconv.Itoa(exitCode))
+		}
+	}
+
+	if err := ms.natsConn.PublishMsg(msg); err != nil {
+		logging.LogError(ms.logger, err, "failed to publish async result for job "+jobID)
+	}
+}
+
+// validPublishSubject reports whether a subject can be published to: dot-separated
+// non-empty tokens without whitespace or wildcards
+func validPublishSubject(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
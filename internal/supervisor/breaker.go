@@ -0,0 +1,122 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states for an endpoint
+const (
+	breakerClosed   = "closed"    // requests run normally
+	breakerOpen     = "open"      // requests fail fast until the cooldown ends
+	breakerHalfOpen = "half_open" // one trial request runs to test recovery
+)
+
+// CircuitBreakers trips per endpoint after repeated consecutive timeouts, failing
+// requests fast for a cooldown period before letting a single trial request through
+type CircuitBreakers struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	endpoints map[string]*endpointBreaker // subject -> breaker
+	now       func() time.Time
+}
+
+type endpointBreaker struct {
+	state               string
+	consecutiveTimeouts int
+	openUntil           time.Time
+	trialInFlight       bool
+}
+
+// NewCircuitBreakers creates breakers that open after threshold consecutive timeouts
+func NewCircuitBreakers(threshold int, cooldown time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		endpoints: make(map[string]*endpointBreaker),
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a request to the endpoint may run. When it may not, the
+// returned duration is how long until the breaker lets a trial request through.
+func (cb *CircuitBreakers) Allow(subject string) (bool, time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	breaker, exists := cb.endpoints[subject]
+	if !exists {
+		return true, 0
+	}
+
+	switch breaker.state {
+	case breakerOpen:
+		if remaining := breaker.openUntil.Sub(cb.now()); remaining > 0 {
+			return false, remaining
+		}
+		breaker.state = breakerHalfOpen
+		breaker.trialInFlight = true
+		return true, 0
+	case breakerHalfOpen:
+		if breaker.trialInFlight {
+			return false, 0
+		}
+		breaker.trialInFlight = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// Record reports the outcome of an allowed request and returns the resulting state.
+// A timeout counts toward opening the breaker, or reopens it after a failed trial;
+// any other outcome closes it again.
+func (cb *CircuitBreakers) Record(subject string, timedOut bool) string {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	breaker, exists := cb.endpoints[subject]
+	if !exists {
+		if !timedOut {
+			return breakerClosed
+		}
+		breaker = &endpointBreaker{state: breakerClosed}
+		cb.endpoints[subject] = breaker
+	}
+
+	if !timedOut {
+		delete(cb.endpoints, subject)
+		return breakerClosed
+	}
+
+	breaker.trialInFlight = false
+	breaker.consecutiveTimeouts++
+	if breaker.state == breakerHalfOpen || breaker.consecutiveTimeouts >= cb.threshold {
+		breaker.state = breakerOpen
+		breaker.openUntil = cb.now().Add(cb.cooldown)
+	}
+	return breaker.state
+}
+
+// Release hands back a trial request that was allowed but never ran, so the next
+// request to the half-open endpoint may try instead
+func (cb *CircuitBreakers) Release(subject string) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if breaker, exists := cb.endpoints[subject]; exists && breaker.state == breakerHalfOpen {
+		breaker.trialInFlight = false
+	}
+}
+
+// State returns the current state of the endpoint's breaker
+func (cb *CircuitBreakers) State(subject string) string {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if breaker, exists := cb.endpoints[subject]; exists {
+		return breaker.state
+	}
+	return breakerClosed
+}
@@ -0,0 +1,68 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakers_FailedTrialReopens(t *testing.T) {
+	now := time.Unix(0, 0)
+	breakers := NewCircuitBreakers(2, 30*time.Second)
+	breakers.now = func() time.Time { return now }
+
+	const subject = "host.reports.build"
+
+	// A success between timeouts resets the count
+	breakers.Record(subject, true)
+	breakers.Record(subject, false)
+	if state := breakers.Record(subject, true); state != breakerClosed {
+		t.Fatalf("Expected breaker to stay closed after non-consecutive timeouts, got %s", state)
+	}
+	if state := breakers.Record(subject, true); state != breakerOpen {
+		t.Fatalf("Expected breaker to open after consecutive timeouts, got %s", state)
+	}
+
+	if allowed, retryIn := breakers.Allow(subject); allowed || retryIn != 30*time.Second {
+		t.Errorf("Expected open breaker to refuse with 30s to go, got allowed=%v retryIn=%v", allowed, retryIn)
+	}
+
+	// After the cooldown exactly one trial runs at a time
+	now = now.Add(30 * time.Second)
+	if allowed, _ := breakers.Allow(subject); !allowed {
+		t.Fatal("Expected a trial request after the cooldown")
+	}
+	if allowed, _ := breakers.Allow(subject); allowed {
+		t.Error("Expected a second request to wait for the trial")
+	}
+
+	// A timed-out trial reopens the breaker for another full cooldown
+	if state := breakers.Record(subject, true); state != breakerOpen {
+		t.Fatalf("Expected failed trial to reopen the breaker, got %s", state)
+	}
+	if allowed, _ := breakers.Allow(subject); allowed {
+		t.Error("Expected reopened breaker to refuse requests")
+	}
+}
+
+func TestCircuitBreakers_ReleasedTrialLetsNextRequestTry(t *testing.T) {
+	now := time.Unix(0, 0)
+	breakers := NewCircuitBreakers(1, 30*time.Second)
+	breakers.now = func() time.Time { return now }
+
+	const subject = "host.reports.build"
+	breakers.Record(subject, true)
+
+	now = now.Add(30 * time.Second)
+	if allowed, _ := breakers.Allow(subject); !allowed {
+		t.Fatal("Expected a trial request after the cooldown")
+	}
+
+	// The trial never ran, e.g. it was rejected as too busy, so another may try
+	breakers.Release(subject)
+	if allowed, _ := breakers.Allow(subject); !allowed {
+		t.Error("Expected the next request to be the trial after a release")
+	}
+	if state := breakers.State(subject); state != breakerHalfOpen {
+		t.Errorf("Expected breaker to stay half-open until a trial finishes, got %s", state)
+	}
+}
@@ -0,0 +1,86 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+)
+
+// Overflow modes for requests arriving while a service is at max_concurrent
+const (
+	ConcurrencyOverflowQueue  = "queue"  // wait in a bounded queue for a free slot
+	ConcurrencyOverflowReject = "reject" // fail right away with "too busy"
+)
+
+// errTooBusy is returned when a service has no free slot and can't queue the request
+var errTooBusy = errors.New("too busy")
+
+// ConcurrencyLimit bounds the script executions of one service with a buffered
+// channel of slots. Requests over the limit wait in a bounded queue, or are
+// rejected right away in reject mode.
+type ConcurrencyLimit struct {
+	slots chan struct{}
+	queue chan struct{} // one entry per waiting request (nil = rejecting)
+}
+
+// NewConcurrencyLimit allows limit concurrent executions, with up to queueSize
+// more waiting for a slot unless overflow is ConcurrencyOverflowReject
+func NewConcurrencyLimit(limit, queueSize int, overflow string) *ConcurrencyLimit {
+	if limit < 1 {
+		limit = 1
+	}
+	cl := &ConcurrencyLimit{slots: make(chan struct{}, limit)}
+	if overflow != ConcurrencyOverflowReject && queueSize > 0 {
+		cl.queue = make(chan struct{}, queueSize)
+	}
+	return cl
+}
+
+// Acquire takes a slot, waiting in the queue when all are in use. It returns
+// errTooBusy when the queue is full or disabled, or the context's error.
+func (cl *ConcurrencyLimit) Acquire(ctx context.Context) error {
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if cl.queue == nil {
+		return errTooBusy
+	}
+	select {
+	case cl.queue <- struct{}{}:
+	default:
+		return errTooBusy
+	}
+	defer func() { <-cl.queue }()
+
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (cl *ConcurrencyLimit) Release() {
+	<-cl.slots
+}
+
+// Limit returns the number of concurrent executions allowed
+func (cl *ConcurrencyLimit) Limit() int {
+	return cap(cl.slots)
+}
+
+// Active returns the number of slots in use
+func (cl *ConcurrencyLimit) Active() int {
+	return len(cl.slots)
+}
+
+// Queued returns the number of requests waiting for a slot
+func (cl *ConcurrencyLimit) Queued() int {
+	if cl.queue == nil {
+		return 0
+	}
+	return len(cl.queue)
+}
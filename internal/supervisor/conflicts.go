@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"strings"
+
+	"github.com/hiway/natshd/internal/service"
+)
+
+// subjectConflict is an endpoint subject that overlaps another service's subject
+type subjectConflict struct {
+	Subject            string
+	ConflictingService string
+	ConflictingSubject string
+}
+
+// subjectConflicts finds subjects of a service definition that overlap, after
+// prefixing, the subjects of other loaded services. Callers hold sm.mutex.
+func (sm *ServiceManager) subjectConflicts(definition service.ServiceDefinition) []subjectConflict {
+	prefix := sm.config.ServicePrefix(definition.Name, definition.Prefix)
+
+	var conflicts []subjectConflict
+	for _, endpoint := range definition.Endpoints {
+		subject := sm.config.PrefixSubjectWith(prefix, sm.config.NamespaceSubject(definition.Namespace, endpoint.Subject))
+
+		for serviceName, other := range sm.services {
+			if serviceName == definition.Name {
+				continue // Grouped scripts are checked by Initialize
+			}
+			// Initialize stores loaded services' subjects already prefixed
+			for _, otherEndpoint := range other.definition.Endpoints {
+				otherSubject := otherEndpoint.Subject
+				if subjectsOverlap(subject, otherSubject) {
+					conflicts = append(conflicts, subjectConflict{
+						Subject:            subject,
+						ConflictingService: serviceName,
+						ConflictingSubject: otherSubject,
+					})
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// subjectsOverlap reports whether some subject would match both NATS subjects,
+// where either may contain "*" (one token) or a trailing ">" (one or more tokens)
+func subjectsOverlap(a, b string) bool {
+	aTokens := strings.Split(a, ".")
+	bTokens := strings.Split(b, ".")
+
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if aTokens[i] == ">" || bTokens[i] == ">" {
+			return true
+		}
+		if aTokens[i] != bTokens[i] && aTokens[i] != "*" && bTokens[i] != "*" {
+			return false
+		}
+	}
+	return len(aTokens) == len(bTokens)
+}
@@ -0,0 +1,189 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"host.files.read", "host.files.read", true},
+		{"host.files.read", "host.files.write", false},
+		{"host.files.>", "host.files.read", true},
+		{"host.files.>", "host.files.read.all", true},
+		{"host.files.>", "host.files", false},
+		{"host.files.*", "host.files.read", true},
+		{"host.files.*", "host.files.read.all", false},
+		{"host.*.read", "host.files.>", true},
+		{"host.files.read", "other.files.read", false},
+		{"host.files", "host.files.read", false},
+	}
+
+	for _, tt := range tests {
+		if got := subjectsOverlap(tt.a, tt.b); got != tt.expected {
+			t.Errorf("subjectsOverlap(%q, %q): expected %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+		if got := subjectsOverlap(tt.b, tt.a); got != tt.expected {
+			t.Errorf("subjectsOverlap(%q, %q): expected %v, got %v", tt.b, tt.a, tt.expected, got)
+		}
+	}
+}
+
+func TestManager_ReportsWildcardSubjectOverlap(t *testing.T) {
+	tests := []struct {
+		policy      string
+		expectError bool
+	}{
+		{policy: "warn", expectError: false},
+		{policy: "refuse", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			tempDir := t.TempDir()
+			var logOutput syncBuffer
+			logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.SubjectConflictPolicy = tt.policy
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			// Endpoint validation rejects wildcards, so place the wildcard service directly
+			wildcard := NewManagedService(filepath.Join(tempDir, "archive.sh"), natsConn, logger, cfg)
+			wildcard.definition = service.ServiceDefinition{
+				Name:      "ArchiveService",
+				Endpoints: []service.Endpoint{{Name: "All", Subject: cfg.PrefixSubject("files.>")}},
+			}
+			manager.services["ArchiveService"] = wildcard
+
+			scriptPath := filepath.Join(tempDir, "files.sh")
+			scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "FileService", "version": "1.0.0", "endpoints": [{"name": "Read", "subject": "files.read"}]}'
+  exit 0
+fi
+`
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			err := manager.AddService(scriptPath)
+			if tt.expectError && err == nil {
+				t.Error("Expected AddService to refuse the overlapping service")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected AddService to succeed, got %v", err)
+			}
+
+			_, registered := manager.services["FileService"]
+			if registered == tt.expectError {
+				t.Errorf("Expected FileService registered to be %v, got %v", !tt.expectError, registered)
+			}
+
+			output := logOutput.String()
+			if !strings.Contains(output, "Endpoint subject overlaps another service's subject") {
+				t.Errorf("Expected the overlap to be logged, got: %s", output)
+			}
+			if !strings.Contains(output, `"subject":"`+cfg.PrefixSubject("files.read")+`"`) ||
+				!strings.Contains(output, `"conflicting_subject":"`+cfg.PrefixSubject("files.>")+`"`) {
+				t.Errorf("Expected both prefixed subjects in the log, got: %s", output)
+			}
+		})
+	}
+}
+
+func TestManager_ReportsSubjectClashAcrossPrefixPolicies(t *testing.T) {
+	tempDir := t.TempDir()
+	var logOutput syncBuffer
+	logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.Hostname = "web1"
+	cfg.SubjectConflictPolicy = "refuse"
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// A host-scoped service and a global one spelling out the same subject
+	scripts := map[string]string{
+		"local.sh":  `{"name": "LocalService", "endpoints": [{"name": "Read", "subject": "files.read"}]}`,
+		"global.sh": `{"name": "GlobalService", "prefix": "none", "endpoints": [{"name": "Read", "subject": "web1.files.read"}]}`,
+	}
+	for _, name := range []string{"local.sh", "global.sh"} {
+		scriptPath := filepath.Join(tempDir, name)
+		scriptContent := "#!/usr/bin/env bash\nif [[ \"$1\" == \"info\" ]]; then\n  echo '" + scripts[name] + "'\n  exit 0\nfi\n"
+		if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+	}
+
+	if err := manager.AddService(filepath.Join(tempDir, "local.sh")); err != nil {
+		t.Fatalf("Expected first service to load, got %v", err)
+	}
+	if err := manager.AddService(filepath.Join(tempDir, "global.sh")); err == nil {
+		t.Error("Expected AddService to refuse the clashing service")
+	}
+	if !strings.Contains(logOutput.String(), `"conflicting_subject":"web1.files.read"`) {
+		t.Errorf("Expected the clash on web1.files.read to be logged, got: %s", logOutput.String())
+	}
+}
+
+func TestManager_SubjectConflictsUseEndpointOverrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		declared    string
+		override    string
+		expectError bool
+	}{
+		{name: "override creates overlap", declared: "inventory.count", override: "files.read", expectError: true},
+		{name: "override removes overlap", declared: "files.read", override: "inventory.count", expectError: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.SubjectConflictPolicy = "refuse"
+			cfg.EndpointOverrides = []config.EndpointOverride{{
+				Service:   "RemappedService",
+				Endpoints: []service.Endpoint{{Name: "Read", Subject: tt.override}},
+			}}
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			scripts := map[string]string{
+				"files.sh":    `{"name": "FileService", "endpoints": [{"name": "Read", "subject": "files.read"}]}`,
+				"remapped.sh": `{"name": "RemappedService", "endpoints": [{"name": "Read", "subject": "` + tt.declared + `"}]}`,
+			}
+			for name, info := range scripts {
+				scriptContent := "#!/usr/bin/env bash\nif [[ \"$1\" == \"info\" ]]; then\n  echo '" + info + "'\n  exit 0\nfi\n"
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte(scriptContent), 0755); err != nil {
+					t.Fatalf("Failed to create test script: %v", err)
+				}
+			}
+
+			if err := manager.AddService(filepath.Join(tempDir, "files.sh")); err != nil {
+				t.Fatalf("Expected first service to load, got %v", err)
+			}
+			err := manager.AddService(filepath.Join(tempDir, "remapped.sh"))
+			if tt.expectError && err == nil {
+				t.Error("Expected AddService to refuse the service its override makes overlap")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected the overridden service to load, got %v", err)
+			}
+		})
+	}
+}
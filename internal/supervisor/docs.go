@@ -0,0 +1,115 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+// DocsSubject is the admin subject (prefixed with the hostname) that answers with
+// documentation for every loaded service
+const DocsSubject = "natshd.docs"
+
+// Docs documents every loaded service and its endpoints
+type Docs struct {
+	Services []ServiceDocs `json:"services"`
+	// Namespaces lists service names by the namespace they declared
+	Namespaces map[string][]string `json:"namespaces,omitempty"`
+}
+
+// ServiceDocs documents one service
+type ServiceDocs struct {
+	Name        string         `json:"name"`
+	Version     string         `json:"version,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Namespace   string         `json:"namespace,omitempty"`
+	Endpoints   []EndpointDocs `json:"endpoints"`
+}
+
+// EndpointDocs documents one endpoint: its parameters from metadata.parameters,
+// and any other metadata the script declared
+type EndpointDocs struct {
+	Name        string                 `json:"name"`
+	Subject     string                 `json:"subject"`
+	Description string                 `json:"description,omitempty"`
+	Mode        string                 `json:"mode,omitempty"`
+	Parameters  interface{}            `json:"parameters,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Docs collects documentation for the loaded services, sorted by service and endpoint name
+func (sm *ServiceManager) Docs() Docs {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	docs := Docs{Services: make([]ServiceDocs, 0, len(sm.services))}
+	for _, managedService := range sm.services {
+		definition := managedService.definition
+		serviceDocs := ServiceDocs{
+			Name:        definition.Name,
+			Version:     definition.Version,
+			Description: definition.Description,
+			Namespace:   definition.Namespace,
+			Endpoints:   make([]EndpointDocs, 0, len(definition.Endpoints)),
+		}
+
+		for _, endpoint := range definition.Endpoints {
+			endpointDocs := EndpointDocs{
+				Name:        endpoint.Name,
+				Subject:     endpoint.Subject,
+				Description: endpoint.Description,
+				Mode:        endpoint.Mode,
+			}
+			for key, value := range endpoint.Metadata {
+				if key == "parameters" {
+					endpointDocs.Parameters = value
+					continue
+				}
+				if endpointDocs.Metadata == nil {
+					endpointDocs.Metadata = make(map[string]interface{})
+				}
+				endpointDocs.Metadata[key] = value
+			}
+			serviceDocs.Endpoints = append(serviceDocs.Endpoints, endpointDocs)
+		}
+
+		sort.Slice(serviceDocs.Endpoints, func(i, j int) bool {
+			return serviceDocs.Endpoints[i].Name < serviceDocs.Endpoints[j].Name
+		})
+		docs.Services = append(docs.Services, serviceDocs)
+	}
+
+	sort.Slice(docs.Services, func(i, j int) bool {
+		return docs.Services[i].Name < docs.Services[j].Name
+	})
+	docs.Namespaces = sm.namespaceGroups()
+	return docs
+}
+
+// setupDocsEndpoint answers requests on the hostname-prefixed docs subject
+func (sm *ServiceManager) setupDocsEndpoint() error {
+	if sm.natsConn == nil {
+		return nil
+	}
+
+	subject := sm.config.PrefixSubject(DocsSubject)
+	subscription, err := sm.natsConn.Subscribe(subject, func(msg *nats.Msg) {
+		data, err := json.Marshal(sm.Docs())
+		if err != nil {
+			logging.LogError(sm.logger, err, "failed to encode service docs")
+			return
+		}
+		if err := msg.Respond(data); err != nil {
+			logging.LogError(sm.logger, err, "failed to send service docs")
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	sm.docsSubscription = subscription
+	return nil
+}
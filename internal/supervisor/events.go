@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hiway/natshd/internal/logging"
+)
+
+// LifecycleEvent is published to <events_subject>.<hostname> whenever a service
+// is added, removed, or restarted
+type LifecycleEvent struct {
+	// Action is "added", "removed", "script_removed" (a script left a service
+	// group that keeps running) or "restarted"
+	Action    string    `json:"action"`
+	Service   string    `json:"service"`
+	Script    string    `json:"script"`
+	Timestamp time.Time `json:"timestamp"`
+	Host      string    `json:"host"`
+}
+
+// eventPublisher is the part of *nats.Conn lifecycle events are published with
+type eventPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// serviceLifecycle logs a service lifecycle change and publishes it as a
+// LifecycleEvent when events_subject is set
+func (sm *ServiceManager) serviceLifecycle(action, serviceName, scriptPath string) {
+	logging.LogServiceLifecycle(sm.logger, action, serviceName, scriptPath)
+
+	if sm.config.EventsSubject == "" || sm.eventPublisher == nil {
+		return
+	}
+
+	hostname, err := sm.config.ResolveHostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	event := LifecycleEvent{
+		Action:    action,
+		Service:   serviceName,
+		Script:    scriptPath,
+		Timestamp: time.Now().UTC(),
+		Host:      hostname,
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		sm.logger.Warn().Err(err).Msg("Failed to encode lifecycle event")
+		return
+	}
+	subject := sm.config.EventsSubject + "." + hostname
+	if err := sm.eventPublisher.Publish(subject, data); err != nil {
+		sm.logger.Warn().Err(err).Str("subject", subject).Msg("Failed to publish lifecycle event")
+	}
+}
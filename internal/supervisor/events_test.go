@@ -0,0 +1,105 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+// capturingPublisher records published messages in place of a NATS connection
+type capturingPublisher struct {
+	mutex    sync.Mutex
+	messages []*nats.Msg
+}
+
+func (p *capturingPublisher) Publish(subject string, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages = append(p.messages, &nats.Msg{Subject: subject, Data: data})
+	return nil
+}
+
+func (p *capturingPublisher) published() []*nats.Msg {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*nats.Msg(nil), p.messages...)
+}
+
+func TestManager_PublishesLifecycleEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventsSubject string
+		expected      []string
+	}{
+		{name: "disabled", eventsSubject: "", expected: nil},
+		{name: "enabled", eventsSubject: "natshd.events", expected: []string{"added", "restarted", "removed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			cfg.Hostname = "web01"
+			cfg.EventsSubject = tt.eventsSubject
+
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+			publisher := &capturingPublisher{}
+			manager.eventPublisher = publisher
+
+			scriptPath := filepath.Join(tempDir, "events.sh")
+			scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "EventsService", "endpoints": [{"name": "Run", "subject": "events.run"}]}'
+  exit 0
+fi
+`
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			before := time.Now().UTC()
+			if err := manager.AddService(scriptPath); err != nil {
+				t.Fatalf("AddService failed: %v", err)
+			}
+			if err := manager.RestartServiceGracefully(scriptPath); err != nil {
+				t.Fatalf("RestartServiceGracefully failed: %v", err)
+			}
+			if err := manager.RemoveService(scriptPath); err != nil {
+				t.Fatalf("RemoveService failed: %v", err)
+			}
+
+			messages := publisher.published()
+			if len(messages) != len(tt.expected) {
+				t.Fatalf("Expected %d events, got %d", len(tt.expected), len(messages))
+			}
+			for i, msg := range messages {
+				if msg.Subject != "natshd.events.web01" {
+					t.Errorf("Expected subject natshd.events.web01, got %s", msg.Subject)
+				}
+
+				var event LifecycleEvent
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					t.Fatalf("Failed to decode event %q: %v", msg.Data, err)
+				}
+				if event.Action != tt.expected[i] {
+					t.Errorf("Expected event %d to be %s, got %s", i, tt.expected[i], event.Action)
+				}
+				if event.Service != "EventsService" || event.Script != scriptPath || event.Host != "web01" {
+					t.Errorf("Expected EventsService from %s on web01, got %+v", scriptPath, event)
+				}
+				if event.Timestamp.Before(before) || event.Timestamp.After(time.Now().UTC()) {
+					t.Errorf("Expected a timestamp during the test, got %s", event.Timestamp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package supervisor
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+// ExitCodeCounts counts script exit codes per endpoint subject, to surface patterns
+// like one failure mode spiking that success/error totals hide
+type ExitCodeCounts struct {
+	mutex     sync.Mutex
+	endpoints map[string]map[int]int64 // subject -> exit code -> count
+}
+
+// Record counts one script run on the subject that exited with exitCode
+func (c *ExitCodeCounts) Record(subject string, exitCode int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.endpoints == nil {
+		c.endpoints = make(map[string]map[int]int64)
+	}
+	counts, exists := c.endpoints[subject]
+	if !exists {
+		counts = make(map[int]int64)
+		c.endpoints[subject] = counts
+	}
+	counts[exitCode]++
+}
+
+// Counts returns a copy of the subject's counts keyed by exit code
+func (c *ExitCodeCounts) Counts(subject string) map[int]int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := make(map[int]int64, len(c.endpoints[subject]))
+	for exitCode, count := range c.endpoints[subject] {
+		counts[exitCode] = count
+	}
+	return counts
+}
+
+// endpointStatsData is the custom data natshd adds to each endpoint in micro's
+// $SRV.STATS responses
+type endpointStatsData struct {
+	ExitCodes map[string]int64 `json:"exit_codes"`
+}
+
+// endpointStats is the micro StatsHandler reporting each endpoint's exit code counts
+func (ms *ManagedService) endpointStats(endpoint *micro.Endpoint) any {
+	counts := ms.exitCodes.Counts(endpoint.Subject)
+	data := endpointStatsData{ExitCodes: make(map[string]int64, len(counts))}
+	for exitCode, count := range counts {
+		data.ExitCodes[strconv.Itoa(exitCode)] = count
+	}
+	return data
+}
@@ -0,0 +1,129 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go/micro"
+)
+
+const (
+	// healthEndpointName is the micro endpoint serving a service's health checks
+	healthEndpointName = "health"
+	// healthCheckArg is the argument scripts are run with for a health check
+	healthCheckArg = "health"
+)
+
+// healthReply answers a health check that passed
+type healthReply struct {
+	Service string              `json:"service"`
+	Status  string              `json:"status"`
+	Checks  []healthCheckResult `json:"checks"`
+}
+
+// healthCheckResult is the outcome of one script's health check
+type healthCheckResult struct {
+	Script   string `json:"script"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output,omitempty"`
+}
+
+// healthSubject is the subject health checks are served on: "<service>.health",
+// namespaced and prefixed like the service's endpoints
+func (ms *ManagedService) healthSubject() string {
+	return ms.prefixSubject(ms.definition.Name + "." + healthEndpointName)
+}
+
+// servesHealthChecks reports whether any script of the service declared health_check
+func (ms *ManagedService) servesHealthChecks() bool {
+	ms.scriptsMutex.RLock()
+	defer ms.scriptsMutex.RUnlock()
+	return len(ms.healthChecks) > 0
+}
+
+// handleHealthCheck runs the health check of every script that declared one and
+// replies with their exit codes, or with an error if any of them failed
+func (ms *ManagedService) handleHealthCheck(req micro.Request) {
+	ms.inflight.begin()
+	defer ms.inflight.end()
+
+	ctx := context.Background()
+	if timeout := ms.requestTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	reply, err := ms.runHealthChecks(ctx)
+	data, encodeErr := json.Marshal(reply)
+	if encodeErr != nil {
+		logging.LogError(ms.logger, encodeErr, "failed to encode health check reply")
+		return
+	}
+
+	if err != nil {
+		ms.logger.Warn().Err(err).Msg("Health check failed")
+		code := "503"
+		if errors.Is(err, context.DeadlineExceeded) {
+			code = "504"
+		}
+		err = req.Error(code, err.Error(), data)
+	} else {
+		err = req.Respond(data)
+	}
+	if err != nil {
+		logging.LogError(ms.logger, err, "failed to send health check response")
+	}
+}
+
+// runHealthChecks runs each health check script with "health" in path order,
+// returning the first failure as the error
+func (ms *ManagedService) runHealthChecks(ctx context.Context) (healthReply, error) {
+	ms.scriptsMutex.RLock()
+	checks := make(map[string]ScriptRunner, len(ms.healthChecks))
+	for scriptPath, runner := range ms.healthChecks {
+		checks[scriptPath] = runner
+	}
+	ms.scriptsMutex.RUnlock()
+
+	scriptPaths := make([]string, 0, len(checks))
+	for scriptPath := range checks {
+		scriptPaths = append(scriptPaths, scriptPath)
+	}
+	sort.Strings(scriptPaths)
+
+	reply := healthReply{Service: ms.definition.Name, Status: "healthy", Checks: make([]healthCheckResult, 0, len(checks))}
+	var firstErr error
+	for _, scriptPath := range scriptPaths {
+		result, err := checks[scriptPath].ExecuteRequest(ctx, healthCheckArg, nil)
+		if err != nil {
+			reply.Status = "unhealthy"
+			if firstErr == nil {
+				firstErr = fmt.Errorf("health check of %s failed: %w", scriptPath, err)
+			}
+			continue
+		}
+
+		check := healthCheckResult{
+			Script:   scriptPath,
+			ExitCode: result.ExitCode,
+			Output:   strings.TrimSpace(string(result.Stdout)),
+		}
+		if !result.Success {
+			reply.Status = "unhealthy"
+			if stderr := strings.TrimSpace(string(result.Stderr)); stderr != "" {
+				check.Output = stderr
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("health check of %s exited with code %d", scriptPath, result.ExitCode)
+			}
+		}
+		reply.Checks = append(reply.Checks, check)
+	}
+	return reply, firstErr
+}
@@ -0,0 +1,103 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HeartbeatSubject is the admin subject (prefixed with the hostname) periodic
+// heartbeats are published on
+const HeartbeatSubject = "natshd.heartbeat"
+
+// Heartbeat is the status natshd publishes every heartbeat_interval_ms, so a
+// dashboard can spot instances that went silent without polling them
+type Heartbeat struct {
+	Hostname         string `json:"hostname"`
+	UptimeSeconds    int64  `json:"uptime_seconds"`
+	Services         int    `json:"services"`
+	InflightRequests int    `json:"inflight_requests"`
+	// Connection is the NATS connection status, e.g. "CONNECTED" or "RECONNECTING"
+	Connection string `json:"connection"`
+}
+
+// Heartbeat collects the current status of the manager
+func (sm *ServiceManager) Heartbeat() Heartbeat {
+	heartbeat := Heartbeat{
+		UptimeSeconds: int64(time.Since(sm.startedAt).Seconds()),
+		Connection:    "DISCONNECTED",
+	}
+
+	if hostname, err := sm.config.ResolveHostname(); err == nil {
+		heartbeat.Hostname = hostname
+	} else {
+		heartbeat.Hostname = "unknown"
+	}
+
+	if sm.natsConn != nil {
+		heartbeat.Connection = sm.natsConn.Status().String()
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	heartbeat.Services = len(sm.services)
+	for _, managedService := range sm.services {
+		heartbeat.InflightRequests += managedService.inflight.active()
+	}
+	return heartbeat
+}
+
+// startHeartbeat publishes a heartbeat right away and then every
+// heartbeat_interval_ms until stopHeartbeat is called
+func (sm *ServiceManager) startHeartbeat() {
+	interval := time.Duration(sm.config.HeartbeatIntervalMs) * time.Millisecond
+	if interval <= 0 || sm.natsConn == nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	sm.heartbeatStop = stop
+	sm.heartbeatDone = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		subject := sm.config.PrefixSubject(HeartbeatSubject)
+		for {
+			sm.publishHeartbeat(subject)
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops the heartbeat goroutine and waits for it to exit
+func (sm *ServiceManager) stopHeartbeat() {
+	if sm.heartbeatStop == nil {
+		return
+	}
+	close(sm.heartbeatStop)
+	<-sm.heartbeatDone
+	sm.heartbeatStop = nil
+	sm.heartbeatDone = nil
+}
+
+// publishHeartbeat sends one heartbeat, logging failures rather than stopping
+func (sm *ServiceManager) publishHeartbeat(subject string) {
+	data, err := json.Marshal(sm.Heartbeat())
+	if err != nil {
+		sm.logger.Warn().Err(err).Msg("Failed to encode heartbeat")
+		return
+	}
+	if err := sm.natsConn.Publish(subject, data); err != nil {
+		sm.logger.Warn().Err(err).Str("subject", subject).Msg("Failed to publish heartbeat")
+	}
+}
@@ -146,7 +146,7 @@ func TestServiceManager_WithHostnameConfig(t *testing.T) {
 	}
 }
 
-func TestManagedService_StripHostnamePrefix(t *testing.T) {
+func TestManagedService_StripSubjectPrefix(t *testing.T) {
 	testConfig := config.Config{
 		Hostname: "test-server",
 	}
@@ -183,11 +183,187 @@ func TestManagedService_StripHostnamePrefix(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := managedService.stripHostnamePrefix(tt.prefixedSubject)
+			result := managedService.stripSubjectPrefix(tt.prefixedSubject)
 			if result != tt.expectedResult {
-				t.Errorf("Expected stripHostnamePrefix('%s') to return '%s', got '%s'",
+				t.Errorf("Expected stripSubjectPrefix('%s') to return '%s', got '%s'",
 					tt.prefixedSubject, tt.expectedResult, result)
 			}
 		})
 	}
 }
+
+func TestManagedService_CustomSubjectSeparator(t *testing.T) {
+	testConfig := config.Config{
+		Hostname:         "test-server",
+		SubjectSeparator: ".svc.",
+	}
+
+	logger := zerolog.Nop()
+	managedService := NewManagedService("test.sh", nil, logger, testConfig)
+
+	mockRunner := &MockScriptRunner{
+		infoResponse: `{
+			"name": "GreetingService",
+			"endpoints": [{"name": "Hello", "subject": "greeting.hello"}]
+		}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{}`)},
+	}
+	managedService.scripts["test.sh"] = mockRunner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	prefixed := managedService.prefixSubject("greeting.hello")
+	if prefixed != "test-server.svc.greeting.hello" {
+		t.Fatalf("Expected prefixed subject 'test-server.svc.greeting.hello', got '%s'", prefixed)
+	}
+
+	if stripped := managedService.stripSubjectPrefix(prefixed); stripped != "greeting.hello" {
+		t.Errorf("Expected stripSubjectPrefix to return 'greeting.hello', got '%s'", stripped)
+	}
+
+	// Requests on the prefixed subject reach the script with its declared subject
+	request := &MockRequest{subject: prefixed, data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+	if mockRunner.lastSubject != "greeting.hello" {
+		t.Errorf("Expected script to receive 'greeting.hello', got '%s'", mockRunner.lastSubject)
+	}
+}
+
+func TestManagedService_SubjectPrefixMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		declared      string
+		expected      string
+		expectedAdmin string
+	}{
+		{name: "hostname", mode: "hostname", expected: "web01.greeting.hello", expectedAdmin: "web01.natshd.docs"},
+		{name: "unset means hostname", mode: "", expected: "web01.greeting.hello", expectedAdmin: "web01.natshd.docs"},
+		{name: "none", mode: "none", expected: "greeting.hello", expectedAdmin: "natshd.docs"},
+		{name: "custom prefix", mode: "tenant1", expected: "tenant1.greeting.hello", expectedAdmin: "tenant1.natshd.docs"},
+		{name: "declared prefix wins", mode: "none", declared: "host", expected: "web01.greeting.hello", expectedAdmin: "natshd.docs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConfig := config.Config{Hostname: "web01", SubjectPrefixMode: tt.mode}
+			managedService := NewManagedService("test.sh", nil, zerolog.Nop(), testConfig)
+
+			mockRunner := &MockScriptRunner{
+				infoResponse: `{
+					"name": "GreetingService",
+					"prefix": "` + tt.declared + `",
+					"endpoints": [{"name": "Hello", "subject": "greeting.hello"}]
+				}`,
+				executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{}`)},
+			}
+			managedService.scripts["test.sh"] = mockRunner
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			if subject := managedService.definition.Endpoints[0].Subject; subject != tt.expected {
+				t.Errorf("Expected endpoint subject '%s', got '%s'", tt.expected, subject)
+			}
+			if stripped := managedService.stripSubjectPrefix(tt.expected); stripped != "greeting.hello" {
+				t.Errorf("Expected stripSubjectPrefix('%s') to return 'greeting.hello', got '%s'", tt.expected, stripped)
+			}
+			if admin := testConfig.PrefixSubject(DocsSubject); admin != tt.expectedAdmin {
+				t.Errorf("Expected admin subject '%s', got '%s'", tt.expectedAdmin, admin)
+			}
+
+			// Requests on the served subject reach the script with its declared subject
+			request := &MockRequest{subject: tt.expected, data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+			if mockRunner.lastSubject != "greeting.hello" {
+				t.Errorf("Expected script to receive 'greeting.hello', got '%s'", mockRunner.lastSubject)
+			}
+		})
+	}
+}
+
+func TestManagedService_PerServicePrefixes(t *testing.T) {
+	testConfig := config.Config{
+		Hostname: "web01",
+		ServicePrefixes: map[string]string{
+			"PinnedService": "none", // config takes precedence over the declared "host"
+		},
+	}
+
+	tests := []struct {
+		name            string
+		serviceName     string
+		declaredPrefix  string
+		expectedSubject string
+	}{
+		{
+			name:            "default follows global hostname policy",
+			serviceName:     "HostService",
+			expectedSubject: "web01.jobs.run",
+		},
+		{
+			name:            "explicit host",
+			serviceName:     "ExplicitHostService",
+			declaredPrefix:  "host",
+			expectedSubject: "web01.jobs.run",
+		},
+		{
+			name:            "fleet-global",
+			serviceName:     "GlobalService",
+			declaredPrefix:  "none",
+			expectedSubject: "jobs.run",
+		},
+		{
+			name:            "custom prefix",
+			serviceName:     "RegionalService",
+			declaredPrefix:  "dc1.east",
+			expectedSubject: "dc1.east.jobs.run",
+		},
+		{
+			name:            "config override",
+			serviceName:     "PinnedService",
+			declaredPrefix:  "host",
+			expectedSubject: "jobs.run",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			managedService := NewManagedService("test.sh", nil, zerolog.Nop(), testConfig)
+			mockRunner := &MockScriptRunner{
+				infoResponse: `{"name": "` + tt.serviceName + `", "version": "1.0.0", "prefix": "` + tt.declaredPrefix + `",
+					"endpoints": [{"name": "Run", "subject": "jobs.run"}]}`,
+				executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{}`)},
+			}
+			managedService.scripts["test.sh"] = mockRunner
+
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Failed to initialize service: %v", err)
+			}
+
+			if got := managedService.definition.Endpoints[0].Subject; got != tt.expectedSubject {
+				t.Errorf("Expected endpoint subject '%s', got '%s'", tt.expectedSubject, got)
+			}
+
+			// Requests on the prefixed subject reach the script with the declared subject
+			req := &MockRequest{subject: tt.expectedSubject, data: []byte(`{}`)}
+			managedService.HandleRequest(req)
+
+			if req.responseError != nil {
+				t.Fatalf("Expected request to be routed, got error: %v", req.responseError)
+			}
+			if mockRunner.lastSubject != "jobs.run" {
+				t.Errorf("Expected script to receive subject 'jobs.run', got '%s'", mockRunner.lastSubject)
+			}
+		})
+	}
+}
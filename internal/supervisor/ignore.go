@@ -0,0 +1,114 @@
+package supervisor
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files listing paths to exclude from discovery
+const IgnoreFileName = ".natshdignore"
+
+// IgnoreRules holds the glob patterns from every .natshdignore file under the
+// scripts directory. A pattern applies to the directory holding its file and
+// everything below it. Patterns without a slash match a file or directory name
+// at any depth; patterns with a slash match the path relative to that directory.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	baseDir string
+	pattern string
+}
+
+// LoadIgnoreRules walks root and collects the patterns of all ignore files
+func LoadIgnoreRules(root string) (*IgnoreRules, error) {
+	rules := &IgnoreRules{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip paths we can't access
+		}
+		if info.IsDir() || info.Name() != IgnoreFileName {
+			return nil
+		}
+
+		patterns, err := readIgnoreFile(path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range patterns {
+			rules.rules = append(rules.rules, ignoreRule{baseDir: filepath.Dir(path), pattern: pattern})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// readIgnoreFile returns the patterns in an ignore file, skipping blank lines and # comments
+func readIgnoreFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// A trailing slash only documents that the pattern names a directory
+		patterns = append(patterns, strings.TrimSuffix(line, "/"))
+	}
+	return patterns, scanner.Err()
+}
+
+// Match reports whether the path, or any directory containing it, is ignored
+func (r *IgnoreRules) Match(path string) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, rule := range r.rules {
+		relative, err := filepath.Rel(rule.baseDir, path)
+		if err != nil || relative == "." || strings.HasPrefix(relative, "..") {
+			continue
+		}
+		if rule.matches(filepath.ToSlash(relative)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches checks a slash-separated path relative to the rule's directory
+func (rule ignoreRule) matches(relative string) bool {
+	parts := strings.Split(relative, "/")
+
+	if !strings.Contains(rule.pattern, "/") {
+		for _, part := range parts {
+			if matched, _ := filepath.Match(rule.pattern, part); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Anchored pattern: match the path itself or one of its parent directories
+	pattern := strings.TrimPrefix(rule.pattern, "/")
+	for i := len(parts); i > 0; i-- {
+		if matched, _ := filepath.Match(pattern, strings.Join(parts[:i], "/")); matched {
+			return true
+		}
+	}
+	return false
+}
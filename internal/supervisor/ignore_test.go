@@ -0,0 +1,52 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules_Match(t *testing.T) {
+	tempDir := t.TempDir()
+
+	rootIgnore := "# Disabled scripts\n*.disabled.sh\nexperimental/\n/drafts/*.sh\n"
+	if err := os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte(rootIgnore), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+
+	nestedDir := filepath.Join(tempDir, "system")
+	if err := os.MkdirAll(nestedDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(nestedDir, IgnoreFileName), []byte("hardware.sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to write nested ignore file: %v", err)
+	}
+
+	rules, err := LoadIgnoreRules(tempDir)
+	if err != nil {
+		t.Fatalf("LoadIgnoreRules failed: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"greeting.sh", false},
+		{"old.disabled.sh", true},
+		{"system/old.disabled.sh", true},
+		{"experimental/new.sh", true},
+		{"drafts/wip.sh", true},
+		{"system/drafts/wip.sh", false},
+		{"system/hardware.sh", true},
+		{"hardware.sh", false},
+		{"system/facts.sh", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := rules.Match(filepath.Join(tempDir, tt.path)); got != tt.expected {
+				t.Errorf("Expected Match(%s) to be %v, got %v", tt.path, tt.expected, got)
+			}
+		})
+	}
+}
@@ -2,14 +2,91 @@ package supervisor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hiway/natshd/internal/config"
 	"github.com/hiway/natshd/internal/logging"
 	"github.com/hiway/natshd/internal/service"
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 )
 
+// runTestNATSServer starts an embedded NATS server and returns a client connection to it
+func runTestNATSServer(t *testing.T) *nats.Conn {
+	t.Helper()
+	return runTestNATSServerWithOptions(t, server.Options{})
+}
+
+// runTestNATSServerWithOptions starts an embedded NATS server with custom options
+func runTestNATSServerWithOptions(t *testing.T, opts server.Options) *nats.Conn {
+	t.Helper()
+
+	opts.Host = "127.0.0.1"
+	opts.Port = -1
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	ns, err := server.NewServer(&opts)
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready for connections")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	natsConn, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS server: %v", err)
+	}
+	t.Cleanup(natsConn.Close)
+
+	return natsConn
+}
+
+// waitForService polls the NATS micro PING subject until the named service responds
+func waitForService(t *testing.T, natsConn *nats.Conn, serviceName string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := natsConn.Request("$SRV.PING."+serviceName, nil, 100*time.Millisecond); err == nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Service %s did not register in time", serviceName)
+}
+
+// serveInBackground runs Serve until the test ends, waiting for it to deregister the
+// micro service before the NATS connection registered earlier is closed
+func serveInBackground(t *testing.T, managedService *ManagedService) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		managedService.Serve(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
 func TestManagedService_IntegrationWithGreetingScript(t *testing.T) {
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing - we're testing parsing, not NATS integration
@@ -17,6 +94,7 @@ func TestManagedService_IntegrationWithGreetingScript(t *testing.T) {
 	// Use the actual greeting script
 	scriptPath := "../../scripts/greeting.sh"
 	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = filepath.Dir(scriptPath)
 	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
 	managedService.AddScript(scriptPath)
 
@@ -208,3 +286,1305 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestManagedService_OversizedResponse(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServerWithOptions(t, server.Options{MaxPayload: 1024})
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+
+	scriptPath := filepath.Join(tempDir, "big.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "BigService", "version": "1.0.0", "endpoints": [{"name": "Big", "subject": "big.response"}]}'
+  exit 0
+fi
+head -c 2048 /dev/zero | tr '\0' 'a'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+
+	waitForService(t, natsConn, "BigService")
+
+	msg, err := natsConn.Request(cfg.PrefixSubject("big.response"), []byte(`{}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if code := msg.Header.Get(micro.ErrorCodeHeader); code != "413" {
+		t.Errorf("Expected error code 413, got %q", code)
+	}
+
+	if errMsg := msg.Header.Get(micro.ErrorHeader); !strings.Contains(errMsg, "exceeds NATS max payload") {
+		t.Errorf("Expected max payload error message, got %q", errMsg)
+	}
+}
+
+func TestManagedService_ErrorResponsesUpdateMicroStats(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+
+	scriptPath := filepath.Join(tempDir, "failing.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "FailingService", "version": "1.0.0", "endpoints": [{"name": "Fail", "subject": "failing.request"}]}'
+  exit 0
+fi
+echo "first line of failure" >&2
+echo "second line of failure" >&2
+exit 3
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+
+	waitForService(t, natsConn, "FailingService")
+
+	msg, err := natsConn.Request(cfg.PrefixSubject("failing.request"), []byte(`{}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if code := msg.Header.Get(micro.ErrorCodeHeader); code != "500" {
+		t.Errorf("Expected error code 500, got %q", code)
+	}
+
+	statsMsg, err := natsConn.Request("$SRV.STATS.FailingService", nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Stats request failed: %v", err)
+	}
+
+	var stats micro.Stats
+	if err := json.Unmarshal(statsMsg.Data, &stats); err != nil {
+		t.Fatalf("Failed to parse stats: %v", err)
+	}
+
+	if len(stats.Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint in stats, got %d", len(stats.Endpoints))
+	}
+
+	endpointStats := stats.Endpoints[0]
+	if endpointStats.NumRequests != 1 {
+		t.Errorf("Expected 1 request in stats, got %d", endpointStats.NumRequests)
+	}
+
+	if endpointStats.NumErrors != 1 {
+		t.Errorf("Expected 1 error in stats, got %d", endpointStats.NumErrors)
+	}
+
+	if !strings.Contains(endpointStats.LastError, "exit code 3") {
+		t.Errorf("Expected last error to mention the exit code, got %q", endpointStats.LastError)
+	}
+}
+
+func TestManagedService_EventModeEndpointRunsWithoutReply(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+
+	markerPath := filepath.Join(tempDir, "ingested.json")
+	scriptPath := filepath.Join(tempDir, "ingest.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "IngestService", "version": "1.0.0", "endpoints": [{"name": "Ingest", "subject": "events.ingest", "mode": "event"}]}'
+  exit 0
+fi
+cat > "` + markerPath + `"
+echo '{"status": "ingested"}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+
+	waitForService(t, natsConn, "IngestService")
+
+	subject := cfg.PrefixSubject("events.ingest")
+	payload := []byte(`{"event": "signup"}`)
+
+	// The event subscription is added right after the service registers, so keep publishing until it lands
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := natsConn.Publish(subject, payload); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if _, err := os.Stat(markerPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Event-mode script was not executed")
+		}
+	}
+
+	ingested, err := os.ReadFile(markerPath)
+	if err != nil {
+		t.Fatalf("Failed to read marker file: %v", err)
+	}
+	if string(ingested) != string(payload) {
+		t.Errorf("Expected script to receive %s, got %s", payload, ingested)
+	}
+
+	// Event-mode endpoints receive messages but never reply
+	if _, err := natsConn.Request(subject, payload, 500*time.Millisecond); !errors.Is(err, nats.ErrTimeout) {
+		t.Errorf("Expected request to time out without a reply, got %v", err)
+	}
+}
+
+func TestManagedService_AsyncEndpointAcksThenPublishesResult(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+
+	releasePath := filepath.Join(tempDir, "release")
+	scriptPath := filepath.Join(tempDir, "report.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "ReportService", "version": "1.0.0", "endpoints": [{"name": "Build", "subject": "reports.build", "async": true}]}'
+  exit 0
+fi
+while [[ ! -f "` + releasePath + `" ]]; do sleep 0.05; done
+echo '{"report": "done"}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+
+	waitForService(t, natsConn, "ReportService")
+
+	results, err := natsConn.SubscribeSync(AsyncResultSubjectPrefix + ">")
+	if err != nil {
+		t.Fatalf("Failed to subscribe to results: %v", err)
+	}
+
+	// The script is still blocked, so the ack can only come from natshd itself
+	reply, err := natsConn.Request(cfg.PrefixSubject("reports.build"), []byte(`{}`), 2*time.Second)
+	if err != nil {
+		t.Fatalf("Expected an immediate ack, got %v", err)
+	}
+
+	var ack struct {
+		JobID         string `json:"job_id"`
+		ResultSubject string `json:"result_subject"`
+	}
+	if err := json.Unmarshal(reply.Data, &ack); err != nil {
+		t.Fatalf("Failed to decode ack %q: %v", reply.Data, err)
+	}
+	if ack.JobID == "" {
+		t.Fatal("Expected ack to include a job ID")
+	}
+	if ack.ResultSubject != AsyncResultSubjectPrefix+ack.JobID {
+		t.Errorf("Expected result subject %q, got %q", AsyncResultSubjectPrefix+ack.JobID, ack.ResultSubject)
+	}
+
+	if msg, err := results.NextMsg(200 * time.Millisecond); err == nil {
+		t.Fatalf("Expected no result before the script finishes, got %q", msg.Data)
+	}
+
+	if err := os.WriteFile(releasePath, nil, 0644); err != nil {
+		t.Fatalf("Failed to release script: %v", err)
+	}
+
+	result, err := results.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Expected result to be published: %v", err)
+	}
+	if result.Subject != ack.ResultSubject {
+		t.Errorf("Expected result on %q, got %q", ack.ResultSubject, result.Subject)
+	}
+	if got := result.Header.Get(JobIDHeader); got != ack.JobID {
+		t.Errorf("Expected job ID header %q, got %q", ack.JobID, got)
+	}
+	if strings.TrimSpace(string(result.Data)) != `{"report": "done"}` {
+		t.Errorf("Expected script output as result, got %q", result.Data)
+	}
+}
+
+func TestManagedService_AsyncEndpointPublishesToClientResultSubject(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+
+	// The script finishes at once, likely before the client has read the ack
+	scriptPath := filepath.Join(tempDir, "quick.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "QuickService", "version": "1.0.0", "endpoints": [{"name": "Build", "subject": "quick.build", "async": true}]}'
+  exit 0
+fi
+echo '{"report": "done"}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+
+	waitForService(t, natsConn, "QuickService")
+
+	// Subscribing before the request can't miss the result, however fast the script is
+	for i := 0; i < 5; i++ {
+		inbox := nats.NewInbox()
+		results, err := natsConn.SubscribeSync(inbox)
+		if err != nil {
+			t.Fatalf("Failed to subscribe to results: %v", err)
+		}
+
+		request := nats.NewMsg(cfg.PrefixSubject("quick.build"))
+		request.Header.Set(ResultSubjectHeader, inbox)
+		request.Data = []byte(`{}`)
+		reply, err := natsConn.RequestMsg(request, 2*time.Second)
+		if err != nil {
+			t.Fatalf("Expected an immediate ack, got %v", err)
+		}
+
+		var ack struct {
+			JobID         string `json:"job_id"`
+			ResultSubject string `json:"result_subject"`
+		}
+		if err := json.Unmarshal(reply.Data, &ack); err != nil {
+			t.Fatalf("Failed to decode ack %q: %v", reply.Data, err)
+		}
+		if ack.ResultSubject != inbox {
+			t.Errorf("Expected result subject %q, got %q", inbox, ack.ResultSubject)
+		}
+
+		result, err := results.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Expected result to be published: %v", err)
+		}
+		if got := result.Header.Get(JobIDHeader); got != ack.JobID {
+			t.Errorf("Expected job ID header %q, got %q", ack.JobID, got)
+		}
+		if strings.TrimSpace(string(result.Data)) != `{"report": "done"}` {
+			t.Errorf("Expected script output as result, got %q", result.Data)
+		}
+		results.Unsubscribe()
+	}
+
+	// A wildcard can't be published to, so it is refused before the script runs
+	request := nats.NewMsg(cfg.PrefixSubject("quick.build"))
+	request.Header.Set(ResultSubjectHeader, "results.>")
+	reply, err := natsConn.RequestMsg(request, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if code := reply.Header.Get(micro.ErrorCodeHeader); code != "400" {
+		t.Errorf("Expected a 400 for a wildcard result subject, got %q", code)
+	}
+}
+
+func TestManager_RemoveServiceDrainsInFlightRequest(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	clientConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+
+	// The manager gets its own connection so it can be closed right after shutdown, as main does
+	serviceConn, err := nats.Connect(clientConn.ConnectedUrl())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS server: %v", err)
+	}
+	defer serviceConn.Close()
+
+	startedPath := filepath.Join(tempDir, "started")
+	scriptPath := filepath.Join(tempDir, "slow.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SlowService", "version": "1.0.0", "endpoints": [{"name": "Slow", "subject": "slow.work"}]}'
+  exit 0
+fi
+touch "` + startedPath + `"
+sleep 1
+echo '{"status": "done"}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	manager := NewManager(tempDir, serviceConn, logger, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+
+	waitForService(t, clientConn, "SlowService")
+
+	type response struct {
+		msg *nats.Msg
+		err error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		msg, err := clientConn.Request(cfg.PrefixSubject("slow.work"), []byte(`{}`), 5*time.Second)
+		responses <- response{msg, err}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(startedPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Slow request never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Remove the service and shut down while the script is still running
+	if err := manager.RemoveService(scriptPath); err != nil {
+		t.Fatalf("RemoveService failed: %v", err)
+	}
+	cancel()
+	<-managerDone
+	serviceConn.Close()
+
+	resp := <-responses
+	if resp.err != nil {
+		t.Fatalf("Expected in-flight request to get a response, got error: %v", resp.err)
+	}
+
+	if !strings.Contains(string(resp.msg.Data), "done") {
+		t.Errorf("Expected script output in response, got %s", string(resp.msg.Data))
+	}
+}
+
+func TestManagedService_ShutdownDrainsInFlightRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		drainTimeoutMs int
+		expectResponse bool
+	}{
+		{name: "waits for the running script", drainTimeoutMs: 5000, expectResponse: true},
+		{name: "gives up after drain timeout", drainTimeoutMs: 100, expectResponse: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := runTestNATSServer(t)
+			cfg := config.DefaultConfig()
+			cfg.ScriptsPath = tempDir
+			cfg.DrainTimeoutMs = tt.drainTimeoutMs
+
+			startedPath := filepath.Join(tempDir, "started")
+			scriptPath := filepath.Join(tempDir, "slow.sh")
+			scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SlowService", "version": "1.0.0", "endpoints": [{"name": "Slow", "subject": "slow.work"}]}'
+  exit 0
+fi
+touch "` + startedPath + `"
+sleep 1
+echo '{"status": "done"}'
+`
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+			managedService.AddScript(scriptPath)
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			serveDone := make(chan struct{})
+			go func() {
+				managedService.Serve(ctx)
+				close(serveDone)
+			}()
+			waitForService(t, natsConn, "SlowService")
+
+			type response struct {
+				msg *nats.Msg
+				err error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				msg, err := natsConn.Request(cfg.PrefixSubject("slow.work"), []byte(`{}`), 5*time.Second)
+				responses <- response{msg, err}
+			}()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if _, err := os.Stat(startedPath); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("Slow request never started")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			// Shut down while the script is still running
+			shutdownStarted := time.Now()
+			cancel()
+			<-serveDone
+			shutdown := time.Since(shutdownStarted)
+
+			// New requests are no longer accepted once Serve has returned
+			if _, err := natsConn.Request(cfg.PrefixSubject("slow.work"), []byte(`{}`), 500*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+				t.Errorf("Expected no responders after shutdown, got %v", err)
+			}
+
+			if !tt.expectResponse {
+				if shutdown > 800*time.Millisecond {
+					t.Errorf("Expected shutdown bounded by the drain timeout, took %s", shutdown)
+				}
+				return
+			}
+
+			// Serve returned only after the script finished sleeping and answered
+			if shutdown < 500*time.Millisecond {
+				t.Errorf("Expected Serve to wait for the in-flight request, returned after %s", shutdown)
+			}
+			resp := <-responses
+			if resp.err != nil {
+				t.Fatalf("Expected in-flight request to get a response, got error: %v", resp.err)
+			}
+			if !strings.Contains(string(resp.msg.Data), "done") {
+				t.Errorf("Expected script output in response, got %s", string(resp.msg.Data))
+			}
+		})
+	}
+}
+
+func TestManagedService_EndpointOverrideRemapsSubject(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+
+	scriptPath := filepath.Join(tempDir, "vendor.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "VendorService", "version": "1.0.0", "endpoints": [{"name": "Get", "subject": "vendor.get"}]}'
+  exit 0
+fi
+echo "{\"handled\": \"$1\"}"
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	cfg.EndpointOverrides = []config.EndpointOverride{
+		{
+			Script:    scriptPath,
+			Endpoints: []service.Endpoint{{Name: "Get", Subject: "inventory.get"}},
+		},
+	}
+
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	serveInBackground(t, managedService)
+	waitForService(t, natsConn, "VendorService")
+
+	msg, err := natsConn.Request(cfg.PrefixSubject("inventory.get"), []byte(`{}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request on overridden subject failed: %v", err)
+	}
+
+	// The script still receives the subject it declared
+	if string(msg.Data) != `{"handled": "vendor.get"}`+"\n" {
+		t.Errorf("Expected script to handle vendor.get, got %s", string(msg.Data))
+	}
+
+	if _, err := natsConn.Request(cfg.PrefixSubject("vendor.get"), []byte(`{}`), 500*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Errorf("Expected no responders on the declared subject, got %v", err)
+	}
+}
+
+func TestManagedService_EndpointQueueGroup(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+
+	scriptPath := filepath.Join(tempDir, "worker.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "WorkerService", "version": "1.0.0", "endpoints": [{"name": "Run", "subject": "worker.run", "queue_group": "workers"}]}'
+  exit 0
+fi
+echo '{"ok": true}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	// Two instances stand in for natshd on two hosts sharing the queue group
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	for i := 0; i < 2; i++ {
+		managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+		managedService.AddScript(scriptPath)
+		if err := managedService.Initialize(context.Background()); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		serveInBackground(t, managedService)
+	}
+	waitForService(t, natsConn, "WorkerService")
+
+	msg, err := natsConn.Request("$SRV.INFO.WorkerService", nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Info request failed: %v", err)
+	}
+	var info micro.Info
+	if err := json.Unmarshal(msg.Data, &info); err != nil {
+		t.Fatalf("Failed to decode service info: %v", err)
+	}
+	if len(info.Endpoints) != 1 || info.Endpoints[0].QueueGroup != "workers" {
+		t.Fatalf("Expected endpoint in queue group 'workers', got %+v", info.Endpoints)
+	}
+
+	// Each request is answered by one member of the group only
+	inbox := nats.NewInbox()
+	replies, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Failed to subscribe to inbox: %v", err)
+	}
+	defer replies.Unsubscribe()
+
+	const requests = 5
+	for i := 0; i < requests; i++ {
+		if err := natsConn.PublishRequest(cfg.PrefixSubject("worker.run"), inbox, []byte(`{}`)); err != nil {
+			t.Fatalf("Failed to publish request: %v", err)
+		}
+	}
+
+	received := 0
+	for {
+		if _, err := replies.NextMsg(500 * time.Millisecond); err != nil {
+			break
+		}
+		received++
+	}
+	if received != requests {
+		t.Errorf("Expected %d replies, one per request, got %d", requests, received)
+	}
+}
+
+func TestManager_DocsEndpointListsEndpointParameters(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+
+	greeting, err := os.ReadFile("../../scripts/greeting.sh")
+	if err != nil {
+		t.Fatalf("Failed to read greeting script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "greeting.sh"), greeting, 0755); err != nil {
+		t.Fatalf("Failed to copy greeting script: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	waitForService(t, natsConn, "GreetingService")
+
+	reply, err := natsConn.Request(cfg.PrefixSubject(DocsSubject), nil, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Docs request failed: %v", err)
+	}
+
+	var docs Docs
+	if err := json.Unmarshal(reply.Data, &docs); err != nil {
+		t.Fatalf("Failed to decode docs %q: %v", reply.Data, err)
+	}
+
+	var greet *EndpointDocs
+	for _, serviceDocs := range docs.Services {
+		if serviceDocs.Name != "GreetingService" {
+			continue
+		}
+		for i := range serviceDocs.Endpoints {
+			if serviceDocs.Endpoints[i].Name == "Greet" {
+				greet = &serviceDocs.Endpoints[i]
+			}
+		}
+	}
+	if greet == nil {
+		t.Fatalf("Expected docs to include GreetingService Greet, got %s", reply.Data)
+	}
+
+	if greet.Description != "Generates a personalized greeting message" {
+		t.Errorf("Expected Greet description, got %q", greet.Description)
+	}
+	if greet.Subject != cfg.PrefixSubject("greeting.greet") {
+		t.Errorf("Expected subject %q, got %q", cfg.PrefixSubject("greeting.greet"), greet.Subject)
+	}
+
+	parameters, ok := greet.Parameters.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected Greet parameters object, got %v", greet.Parameters)
+	}
+	for _, name := range []string{"name", "greeting"} {
+		parameter, ok := parameters[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("Expected parameter %q in docs, got %v", name, parameters)
+			continue
+		}
+		if parameter["type"] != "string" {
+			t.Errorf("Expected parameter %q type string, got %v", name, parameter["type"])
+		}
+	}
+}
+
+func TestManager_WarmupReplyDuringInitWindow(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.WarmupReply = true
+
+	scriptPath := filepath.Join(tempDir, "slowstart.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SlowStartService", "version": "1.0.0", "endpoints": [{"name": "Get", "subject": "slowstart.get"}]}'
+  exit 0
+fi
+echo '{"ready": true}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// The service is added but the supervisor hasn't started serving it yet
+	if err := manager.AddService(scriptPath); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	subject := cfg.PrefixSubject("slowstart.get")
+	reply, err := natsConn.Request(subject, []byte(`{}`), 2*time.Second)
+	if err != nil {
+		t.Fatalf("Expected a warming up reply instead of a dropped request, got %v", err)
+	}
+	if code := reply.Header.Get(micro.ErrorCodeHeader); code != "503" {
+		t.Errorf("Expected retriable error code 503, got %q (data %q)", code, reply.Data)
+	}
+	if description := reply.Header.Get(micro.ErrorHeader); !strings.Contains(description, "warming up") {
+		t.Errorf("Expected warming up description, got %q", description)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	// Once Serve registers the endpoints the script answers instead of the placeholder
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reply, err := natsConn.Request(subject, []byte(`{}`), 2*time.Second)
+		if err == nil && reply.Header.Get(micro.ErrorCodeHeader) == "" {
+			if strings.TrimSpace(string(reply.Data)) != `{"ready": true}` {
+				t.Errorf("Expected script response, got %q", reply.Data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected script to take over from the placeholder, last reply %v err %v", reply, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestManager_RestartBufferReplaysRequestsOnceServing(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.RestartBufferSize = 10
+
+	scriptPath := filepath.Join(tempDir, "buffered.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "BufferedService", "version": "1.0.0", "endpoints": [{"name": "Get", "subject": "buffered.get"}]}'
+  exit 0
+fi
+echo '{"served": true}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// Added but not served yet: the same window a restart opens between the old
+	// endpoints going away and the new ones registering
+	if err := manager.AddService(scriptPath); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	subject := cfg.PrefixSubject("buffered.get")
+	type result struct {
+		reply *nats.Msg
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		reply, err := natsConn.Request(subject, []byte(`{}`), 5*time.Second)
+		results <- result{reply, err}
+	}()
+
+	// Let the request land in the buffer before the endpoints come up
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		manager.mutex.RLock()
+		managedService := manager.services["BufferedService"]
+		manager.mutex.RUnlock()
+
+		managedService.warmup.bufferMutex.Lock()
+		buffered := len(managedService.warmup.buffered)
+		managedService.warmup.bufferMutex.Unlock()
+		if buffered == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the request to be buffered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	r := <-results
+	if r.err != nil {
+		t.Fatalf("Expected the buffered request to be served, got %v", r.err)
+	}
+	if code := r.reply.Header.Get(micro.ErrorCodeHeader); code != "" {
+		t.Fatalf("Expected a script response, got error %s: %s", code, r.reply.Header.Get(micro.ErrorHeader))
+	}
+	if strings.TrimSpace(string(r.reply.Data)) != `{"served": true}` {
+		t.Errorf("Expected script response, got %q", r.reply.Data)
+	}
+}
+
+func TestManager_RestartWaitsForDeregistration(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+
+	scriptPath := filepath.Join(tempDir, "restart.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "RestartService", "version": "1.0.0", "endpoints": [{"name": "Work", "subject": "restart.work"}]}'
+  exit 0
+fi
+echo '{"ok": true}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	waitForService(t, natsConn, "RestartService")
+
+	// PING answers before every endpoint is registered, and with it the service published
+	manager.mutex.RLock()
+	managedService := manager.services["RestartService"]
+	manager.mutex.RUnlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for managedService.microService() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Service did not finish registering in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	oldID := managedService.microService().Info().ID
+
+	if err := manager.RestartServiceGracefully(scriptPath); err != nil {
+		t.Fatalf("RestartServiceGracefully failed: %v", err)
+	}
+
+	// The old instance must already be gone when the restart returns
+	if _, err := natsConn.Request("$SRV.PING.RestartService."+oldID, nil, 500*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Errorf("Expected old instance %s to be deregistered, got %v", oldID, err)
+	}
+
+	waitForService(t, natsConn, "RestartService")
+}
+
+func TestWaitForDeregistration_TimesOutWhileRegistered(t *testing.T) {
+	natsConn := runTestNATSServer(t)
+
+	svc, err := micro.AddService(natsConn, micro.Config{Name: "StillHere", Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("Failed to add micro service: %v", err)
+	}
+	defer svc.Stop()
+
+	start := time.Now()
+	if waitForDeregistration(natsConn, "StillHere", svc.Info().ID, 200*time.Millisecond) {
+		t.Error("Expected a registered instance not to be reported as deregistered")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected to wait for the full timeout, returned after %v", elapsed)
+	}
+
+	if err := svc.Stop(); err != nil {
+		t.Fatalf("Failed to stop micro service: %v", err)
+	}
+	if !waitForDeregistration(natsConn, "StillHere", svc.Info().ID, 2*time.Second) {
+		t.Error("Expected stopped instance to be reported as deregistered")
+	}
+}
+
+func TestManager_LogLevelEndpointEnablesDebugLogs(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuf syncBuffer
+	logger := logging.SetupLoggerWithWriter(&logBuf, "info")
+	defer logging.ResetLevel()
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+
+	greeting, err := os.ReadFile("../../scripts/greeting.sh")
+	if err != nil {
+		t.Fatalf("Failed to read greeting script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "greeting.sh"), greeting, 0755); err != nil {
+		t.Fatalf("Failed to copy greeting script: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	waitForService(t, natsConn, "GreetingService")
+
+	if strings.Contains(logBuf.String(), `"level":"debug"`) {
+		t.Fatalf("Expected no debug logs at info level, got %s", logBuf.String())
+	}
+
+	setLevel := func(level string) logLevelReply {
+		t.Helper()
+		reply, err := natsConn.Request(cfg.PrefixSubject(LogLevelSubject), []byte(level), 2*time.Second)
+		if err != nil {
+			t.Fatalf("Log level request failed: %v", err)
+		}
+		var result logLevelReply
+		if err := json.Unmarshal(reply.Data, &result); err != nil {
+			t.Fatalf("Failed to decode log level reply %q: %v", reply.Data, err)
+		}
+		return result
+	}
+
+	result := setLevel("debug")
+	if result.Level != "debug" || result.Previous != "info" {
+		t.Errorf("Expected level debug from info, got %+v", result)
+	}
+
+	// A file change after the switch produces debug logs from the running manager
+	if err := os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logBuf.String(), "File event received") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected debug logs after changing the level, got %s", logBuf.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	result = setLevel("reset")
+	if result.Level != "info" || result.Previous != "debug" {
+		t.Errorf("Expected level reset to info from debug, got %+v", result)
+	}
+
+	reply, err := natsConn.Request(cfg.PrefixSubject(LogLevelSubject), []byte("verbose"), 2*time.Second)
+	if err != nil {
+		t.Fatalf("Log level request failed: %v", err)
+	}
+	if code := reply.Header.Get(micro.ErrorCodeHeader); code != "400" {
+		t.Errorf("Expected error code 400 for an invalid level, got %q", code)
+	}
+}
+
+func TestManager_PublishesHeartbeats(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+	cfg := config.DefaultConfig()
+	cfg.HeartbeatIntervalMs = 100
+
+	greeting, err := os.ReadFile("../../scripts/greeting.sh")
+	if err != nil {
+		t.Fatalf("Failed to read greeting script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "greeting.sh"), greeting, 0755); err != nil {
+		t.Fatalf("Failed to copy greeting script: %v", err)
+	}
+
+	subscription, err := natsConn.SubscribeSync(cfg.PrefixSubject(HeartbeatSubject))
+	if err != nil {
+		t.Fatalf("Failed to subscribe to heartbeats: %v", err)
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		close(managerDone)
+	}()
+
+	const beats = 5
+	received := make([]time.Time, 0, beats)
+	for len(received) < beats {
+		msg, err := subscription.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Expected heartbeat %d, got %v", len(received)+1, err)
+		}
+		received = append(received, time.Now())
+
+		var heartbeat Heartbeat
+		if err := json.Unmarshal(msg.Data, &heartbeat); err != nil {
+			t.Fatalf("Failed to decode heartbeat %q: %v", msg.Data, err)
+		}
+		if heartbeat.Services != 1 || heartbeat.Connection != "CONNECTED" || heartbeat.Hostname == "" {
+			t.Errorf("Expected one service on a connected host, got %+v", heartbeat)
+		}
+	}
+
+	// Four intervals of 100ms separate five heartbeats
+	if elapsed := received[beats-1].Sub(received[0]); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected heartbeats about 100ms apart, %d took %s", beats, elapsed)
+	}
+
+	// Stopping the manager stops the heartbeats
+	cancel()
+	<-managerDone
+	for {
+		if _, err := subscription.NextMsg(300 * time.Millisecond); err != nil {
+			break // Drained heartbeats published before the stop
+		}
+	}
+	if msg, err := subscription.NextMsg(300 * time.Millisecond); err == nil {
+		t.Errorf("Expected no heartbeats after stop, got %q", msg.Data)
+	}
+}
+
+func TestManagedService_RetriesFlakyEndpointRegistration(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+
+	scriptPath := filepath.Join(tempDir, "flaky.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "FlakyService", "version": "1.0.0", "endpoints": [{"name": "Steady", "subject": "flaky.steady"}, {"name": "Flaky", "subject": "flaky.flaky"}]}'
+  exit 0
+fi
+echo "{\"handled\": \"$1\"}"
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// The Flaky endpoint fails to register once, then succeeds
+	var flakyAttempts atomic.Int32
+	managedService.addEndpoint = func(svc micro.Service, name string, handler micro.Handler, opts ...micro.EndpointOpt) error {
+		if name == "Flaky" {
+			if flakyAttempts.Add(1) == 1 {
+				return errors.New("subscription failed")
+			}
+		}
+		return svc.AddEndpoint(name, handler, opts...)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- managedService.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-serveErr
+	})
+
+	waitForService(t, natsConn, "FlakyService")
+
+	// PING answers as soon as the service exists; wait for the retried endpoint too
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var info micro.Info
+		if msg, err := natsConn.Request("$SRV.INFO.FlakyService", nil, 100*time.Millisecond); err == nil {
+			if err := json.Unmarshal(msg.Data, &info); err == nil && len(info.Endpoints) == 2 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected both endpoints to register, got %+v", info.Endpoints)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, subject := range []string{"flaky.steady", "flaky.flaky"} {
+		msg, err := natsConn.Request(cfg.PrefixSubject(subject), []byte(`{}`), 5*time.Second)
+		if err != nil {
+			t.Fatalf("Request on %s failed: %v", subject, err)
+		}
+		if expected := `{"handled": "` + subject + `"}` + "\n"; string(msg.Data) != expected {
+			t.Errorf("Expected %q, got %q", expected, string(msg.Data))
+		}
+	}
+
+	if attempts := flakyAttempts.Load(); attempts != 2 {
+		t.Errorf("Expected 2 registration attempts for Flaky, got %d", attempts)
+	}
+
+	select {
+	case err := <-serveErr:
+		t.Fatalf("Expected service to stay up, Serve returned %v", err)
+	default:
+	}
+}
+
+func TestManagedService_FailedRegistrationStopsPartialService(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+
+	scriptPath := filepath.Join(tempDir, "broken.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "BrokenService", "version": "1.0.0", "endpoints": [{"name": "Steady", "subject": "broken.steady"}, {"name": "Broken", "subject": "broken.broken"}]}'
+  exit 0
+fi
+echo '{}'
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// The Broken endpoint fails every attempt until the failure is cleared
+	var failing atomic.Bool
+	failing.Store(true)
+	managedService.addEndpoint = func(svc micro.Service, name string, handler micro.Handler, opts ...micro.EndpointOpt) error {
+		if name == "Broken" && failing.Load() {
+			return errors.New("subscription failed")
+		}
+		return svc.AddEndpoint(name, handler, opts...)
+	}
+
+	// Each failed Serve is what suture would restart
+	for i := 0; i < 2; i++ {
+		if err := managedService.Serve(context.Background()); err == nil {
+			t.Fatal("Expected Serve to fail while endpoint registration fails")
+		}
+	}
+
+	failing.Store(false)
+	serveInBackground(t, managedService)
+	waitForService(t, natsConn, "BrokenService")
+
+	// Count every instance answering discovery, not just the first reply
+	inbox := nats.NewInbox()
+	sub, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := natsConn.PublishRequest("$SRV.PING.BrokenService", inbox, nil); err != nil {
+		t.Fatalf("PING failed: %v", err)
+	}
+	instances := 0
+	for {
+		if _, err := sub.NextMsg(300 * time.Millisecond); err != nil {
+			break
+		}
+		instances++
+	}
+	if instances != 1 {
+		t.Errorf("Expected 1 instance to answer discovery, got %d", instances)
+	}
+}
+
+func TestManagedService_HealthCheckEndpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		healthExit   int
+		expectError  bool
+		expectStatus string
+	}{
+		{name: "healthy", healthExit: 0, expectStatus: "healthy"},
+		{name: "unhealthy", healthExit: 3, expectError: true, expectStatus: "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := runTestNATSServer(t)
+
+			scriptPath := filepath.Join(tempDir, "health.sh")
+			scriptContent := `#!/usr/bin/env bash
+case "$1" in
+  info)
+    echo '{"name": "HealthService", "version": "1.0.0", "health_check": true, "endpoints": [{"name": "Run", "subject": "health.run"}]}'
+    ;;
+  health)
+    echo "disk ok"
+    echo "database unreachable" >&2
+    exit ` + fmt.Sprint(tt.healthExit) + `
+    ;;
+esac
+`
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.ScriptsPath = tempDir
+			managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+			managedService.AddScript(scriptPath)
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			serveInBackground(t, managedService)
+			waitForService(t, natsConn, "HealthService")
+
+			msg, err := natsConn.Request(cfg.PrefixSubject("HealthService.health"), nil, 5*time.Second)
+			if err != nil {
+				t.Fatalf("Health request failed: %v", err)
+			}
+
+			errorCode := msg.Header.Get(micro.ErrorCodeHeader)
+			if tt.expectError && errorCode != "503" {
+				t.Errorf("Expected error code 503, got %q", errorCode)
+			}
+			if !tt.expectError && errorCode != "" {
+				t.Errorf("Expected no error, got %q: %s", errorCode, msg.Header.Get(micro.ErrorHeader))
+			}
+
+			var reply healthReply
+			if err := json.Unmarshal(msg.Data, &reply); err != nil {
+				t.Fatalf("Failed to decode health reply %q: %v", msg.Data, err)
+			}
+			if reply.Status != tt.expectStatus || len(reply.Checks) != 1 || reply.Checks[0].ExitCode != tt.healthExit {
+				t.Errorf("Expected %s with exit code %d, got %+v", tt.expectStatus, tt.healthExit, reply)
+			}
+		})
+	}
+}
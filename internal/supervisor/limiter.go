@@ -0,0 +1,179 @@
+package supervisor
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// WeightedSemaphore bounds a shared budget of concurrency units where each
+// acquisition may take more than one unit (e.g. a costly endpoint)
+type WeightedSemaphore struct {
+	mutex    sync.Mutex
+	capacity int64
+	used     int64
+	waiters  list.List // FIFO of *semaphoreWaiter so heavy requests aren't starved
+	// In fair mode queued waiters are granted round-robin across keys (services)
+	fair       bool
+	grants     uint64
+	lastServed map[string]uint64 // key -> sequence number of its most recent grant
+}
+
+type semaphoreWaiter struct {
+	key   string
+	units int64
+	ready chan struct{}
+}
+
+// NewWeightedSemaphore creates a semaphore with the given total capacity
+func NewWeightedSemaphore(capacity int64) *WeightedSemaphore {
+	return &WeightedSemaphore{capacity: capacity}
+}
+
+// NewFairWeightedSemaphore creates a semaphore that hands freed units to the
+// least recently served key, so one busy key cannot starve the others
+func NewFairWeightedSemaphore(capacity int64) *WeightedSemaphore {
+	return &WeightedSemaphore{capacity: capacity, fair: true, lastServed: make(map[string]uint64)}
+}
+
+// Capacity returns the total number of units
+func (s *WeightedSemaphore) Capacity() int64 {
+	return s.capacity
+}
+
+// Available returns the number of units not currently held
+func (s *WeightedSemaphore) Available() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.capacity - s.used
+}
+
+// Waiting returns the number of queued acquisitions
+func (s *WeightedSemaphore) Waiting() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.waiters.Len()
+}
+
+// clamp limits a request to the total capacity so oversized costs can still run alone
+func (s *WeightedSemaphore) clamp(units int64) int64 {
+	if units < 1 {
+		return 1
+	}
+	if units > s.capacity {
+		return s.capacity
+	}
+	return units
+}
+
+// Acquire blocks until the requested units are available or the context is done.
+// It returns the number of units actually held, which must be passed to Release.
+func (s *WeightedSemaphore) Acquire(ctx context.Context, units int64) (int64, error) {
+	return s.AcquireFor(ctx, "", units)
+}
+
+// AcquireFor is Acquire on behalf of a key (e.g. a service name) for fair scheduling
+func (s *WeightedSemaphore) AcquireFor(ctx context.Context, key string, units int64) (int64, error) {
+	units = s.clamp(units)
+
+	s.mutex.Lock()
+	if s.capacity-s.used >= units && s.waiters.Len() == 0 {
+		s.grant(key, units)
+		s.mutex.Unlock()
+		return units, nil
+	}
+
+	waiter := &semaphoreWaiter{key: key, units: units, ready: make(chan struct{})}
+	element := s.waiters.PushBack(waiter)
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return units, nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		select {
+		case <-waiter.ready:
+			// Acquired just as the context was cancelled; give the units back
+			s.used -= units
+			s.notifyWaiters()
+		default:
+			s.waiters.Remove(element)
+			s.notifyWaiters()
+		}
+		s.mutex.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// TryAcquire acquires the units without blocking, reporting whether it succeeded
+func (s *WeightedSemaphore) TryAcquire(units int64) (int64, bool) {
+	units = s.clamp(units)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.capacity-s.used >= units && s.waiters.Len() == 0 {
+		s.grant("", units)
+		return units, true
+	}
+	return 0, false
+}
+
+// Release returns units obtained from Acquire or TryAcquire
+func (s *WeightedSemaphore) Release(units int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.used -= units
+	if s.used < 0 {
+		s.used = 0
+	}
+	s.notifyWaiters()
+}
+
+// grant takes units for a key and records when the key was served (mutex must be held)
+func (s *WeightedSemaphore) grant(key string, units int64) {
+	s.used += units
+	if s.fair {
+		s.grants++
+		s.lastServed[key] = s.grants
+	}
+}
+
+// nextWaiter returns the waiter to serve next: the oldest one in FIFO mode, or the
+// oldest one of the least recently served key in fair mode (mutex must be held)
+func (s *WeightedSemaphore) nextWaiter() *list.Element {
+	if !s.fair {
+		return s.waiters.Front()
+	}
+
+	var next *list.Element
+	var nextServed uint64
+	for element := s.waiters.Front(); element != nil; element = element.Next() {
+		served := s.lastServed[element.Value.(*semaphoreWaiter).key]
+		if next == nil || served < nextServed {
+			next, nextServed = element, served
+		}
+	}
+	return next
+}
+
+// notifyWaiters wakes queued waiters in turn while their units fit (mutex must be held)
+func (s *WeightedSemaphore) notifyWaiters() {
+	for {
+		next := s.nextWaiter()
+		if next == nil {
+			return
+		}
+
+		waiter := next.Value.(*semaphoreWaiter)
+		if s.capacity-s.used < waiter.units {
+			return
+		}
+
+		s.grant(waiter.key, waiter.units)
+		s.waiters.Remove(next)
+		close(waiter.ready)
+	}
+}
@@ -0,0 +1,100 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedSemaphore_AcquireRelease(t *testing.T) {
+	sem := NewWeightedSemaphore(4)
+
+	held, err := sem.Acquire(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if held != 3 {
+		t.Errorf("Expected to hold 3 units, got %d", held)
+	}
+
+	if sem.Available() != 1 {
+		t.Errorf("Expected 1 unit available, got %d", sem.Available())
+	}
+
+	if _, ok := sem.TryAcquire(2); ok {
+		t.Error("Expected TryAcquire of 2 units to fail with only 1 available")
+	}
+
+	if _, ok := sem.TryAcquire(1); !ok {
+		t.Error("Expected TryAcquire of 1 unit to succeed")
+	}
+
+	sem.Release(held)
+	sem.Release(1)
+
+	if sem.Available() != 4 {
+		t.Errorf("Expected full capacity after release, got %d", sem.Available())
+	}
+}
+
+func TestWeightedSemaphore_ClampsOversizedCost(t *testing.T) {
+	sem := NewWeightedSemaphore(2)
+
+	held, err := sem.Acquire(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if held != 2 {
+		t.Errorf("Expected oversized cost to be clamped to capacity 2, got %d", held)
+	}
+
+	sem.Release(held)
+}
+
+func TestWeightedSemaphore_WaitsForCapacity(t *testing.T) {
+	sem := NewWeightedSemaphore(2)
+
+	held, _ := sem.Acquire(context.Background(), 2)
+
+	acquired := make(chan struct{})
+	go func() {
+		units, err := sem.Acquire(context.Background(), 1)
+		if err == nil {
+			close(acquired)
+			sem.Release(units)
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected Acquire to block while capacity is exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sem.Release(held)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Expected waiter to acquire after release")
+	}
+}
+
+func TestWeightedSemaphore_ContextCancellation(t *testing.T) {
+	sem := NewWeightedSemaphore(1)
+	held, _ := sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := sem.Acquire(ctx, 1); err == nil {
+		t.Error("Expected Acquire to fail when context expires")
+	}
+
+	sem.Release(held)
+	if sem.Available() != 1 {
+		t.Errorf("Expected cancelled waiter not to leak units, got %d available", sem.Available())
+	}
+}
@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog"
+)
+
+// LogLevelSubject is the admin subject (prefixed with the hostname) that changes the
+// log level at runtime. The payload is a level name, "reset" to restore the
+// configured level, or empty to report the current level.
+const LogLevelSubject = "natshd.loglevel"
+
+// logLevelReset restores the level from the configuration file
+const logLevelReset = "reset"
+
+// logLevelReply reports the log level after a change request
+type logLevelReply struct {
+	Level    string `json:"level"`
+	Previous string `json:"previous"`
+}
+
+// setupLogLevelEndpoint subscribes to the admin log level subject
+func (sm *ServiceManager) setupLogLevelEndpoint() error {
+	if sm.natsConn == nil {
+		return nil
+	}
+
+	subject := sm.config.PrefixSubject(LogLevelSubject)
+	subscription, err := sm.natsConn.Subscribe(subject, sm.handleLogLevelRequest)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	sm.logLevelSubscription = subscription
+	return nil
+}
+
+// handleLogLevelRequest applies the requested log level and replies with the result
+func (sm *ServiceManager) handleLogLevelRequest(msg *nats.Msg) {
+	previous := zerolog.GlobalLevel()
+	requested := strings.TrimSpace(string(msg.Data))
+
+	level := previous
+	switch requested {
+	case "":
+	case logLevelReset:
+		level = logging.ResetLevel()
+	default:
+		var err error
+		level, err = logging.SetLevel(requested)
+		if err != nil {
+			reply := nats.NewMsg(msg.Reply)
+			reply.Header.Set(micro.ErrorCodeHeader, "400")
+			reply.Header.Set(micro.ErrorHeader, fmt.Sprintf("invalid log level %q", requested))
+			if err := msg.RespondMsg(reply); err != nil {
+				logging.LogError(sm.logger, err, "failed to send log level reply")
+			}
+			return
+		}
+	}
+
+	if level != previous {
+		sm.logger.Info().
+			Str("level", level.String()).
+			Str("previous", previous.String()).
+			Msg("Log level changed")
+	}
+
+	data, err := json.Marshal(logLevelReply{Level: level.String(), Previous: previous.String()})
+	if err != nil {
+		logging.LogError(sm.logger, err, "failed to encode log level reply")
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		logging.LogError(sm.logger, err, "failed to send log level reply")
+	}
+}
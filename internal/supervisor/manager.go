@@ -2,9 +2,12 @@ package supervisor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +17,7 @@ import (
 	"github.com/hiway/natshd/internal/logging"
 	"github.com/hiway/natshd/internal/service"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 	"github.com/rs/zerolog"
 	"github.com/thejerf/suture/v4"
 )
@@ -21,6 +25,8 @@ import (
 // FileEventTracker tracks file events for debouncing
 type FileEventTracker struct {
 	lastEventTime time.Time
+	eventCount    int    // raw events coalesced into the pending action
+	eventType     string // action to run once the file settles
 	timer         *time.Timer
 	mutex         sync.Mutex
 }
@@ -42,6 +48,43 @@ type ServiceManager struct {
 	// Track file executable status for detecting permission changes
 	fileExecutableStatus  map[string]bool
 	permissionCheckTicker *time.Ticker
+	// Newly created scripts watched for an imminent chmod
+	pendingScripts map[string]struct{}
+	// Track running ManagedService.Serve calls so shutdown can wait for deregistration
+	serves serveTracker
+	// Bounds concurrent debounced file event actions
+	fileEventSlots   chan struct{}
+	fileEventHandler func(filePath, eventType string, coalesced int)
+	// Bounds concurrent service restarts triggered by file changes
+	restartSlots   chan struct{}
+	restartHandler func(scriptPath string) error
+	// Shared, cost-weighted budget for concurrent script executions (nil = unlimited)
+	requestLimiter *WeightedSemaphore
+	// Shared pacing of new script processes (nil = unpaced)
+	startPacer *StartPacer
+	// One line per handled request, separate from the JSON log (nil = disabled)
+	accessLog *logging.AccessLog
+	// Request metrics sent to statsd_addr (nil = disabled)
+	statsd *StatsD
+	// Patterns from .natshdignore files, reloaded when the root ignore file changes
+	ignoreRules *IgnoreRules
+	// Admin subscription answering documentation requests
+	docsSubscription *nats.Subscription
+	// Admin subscription changing the log level at runtime
+	logLevelSubscription *nats.Subscription
+	// Admin subscription answering topology exports
+	topologySubscription *nats.Subscription
+	// natshd's own micro service answering admin requests (nil = disabled)
+	adminService micro.Service
+	// One Reload at a time
+	reloadMutex sync.Mutex
+	// Reported as uptime in heartbeats
+	startedAt time.Time
+	// Publishes lifecycle events to events_subject (nil = no NATS connection)
+	eventPublisher eventPublisher
+	// Stop and completion of the heartbeat publisher (nil = not running)
+	heartbeatStop chan struct{}
+	heartbeatDone chan struct{}
 }
 
 // NewManager creates a new ServiceManager
@@ -50,7 +93,25 @@ func NewManager(scriptsPath string, natsConn *nats.Conn, logger zerolog.Logger,
 	// Create a supervisor for managing services
 	supervisor := suture.NewSimple("ServiceSupervisor")
 
-	return &ServiceManager{
+	maxFileEventWorkers := cfg.MaxFileEventWorkers
+	if maxFileEventWorkers <= 0 {
+		maxFileEventWorkers = 4
+	}
+
+	maxConcurrentRestarts := cfg.MaxConcurrentRestarts
+	if maxConcurrentRestarts <= 0 {
+		maxConcurrentRestarts = 2
+	}
+
+	debounceInterval := time.Duration(cfg.DebounceIntervalMs) * time.Millisecond
+	if debounceInterval <= 0 {
+		debounceInterval = 500 * time.Millisecond
+	}
+
+	// Scripts run in the directory they are discovered in unless script_workdir says otherwise
+	cfg.ScriptsPath = scriptsPath
+
+	sm := &ServiceManager{
 		scriptsPath:           scriptsPath,
 		natsConn:              natsConn,
 		logger:                logger.With().Str("component", "manager").Logger(),
@@ -59,11 +120,55 @@ func NewManager(scriptsPath string, natsConn *nats.Conn, logger zerolog.Logger,
 		serviceTokens:         make(map[string]suture.ServiceToken),
 		scriptToService:       make(map[string]string),
 		debounceTracker:       make(map[string]*FileEventTracker),
-		debounceInterval:      500 * time.Millisecond, // 500ms debounce
+		debounceInterval:      debounceInterval,
 		config:                &cfg,
 		fileExecutableStatus:  make(map[string]bool),
-		permissionCheckTicker: time.NewTicker(5 * time.Second), // Check every 5 seconds
+		pendingScripts:        make(map[string]struct{}),
+		permissionCheckTicker: newPermissionCheckTicker(cfg.PermissionPolling, cfg.PermissionPollMs),
+		fileEventSlots:        make(chan struct{}, maxFileEventWorkers),
+		restartSlots:          make(chan struct{}, maxConcurrentRestarts),
+		startedAt:             time.Now(),
+	}
+	sm.fileEventHandler = sm.executeFileEventAction
+	sm.restartHandler = sm.RestartServiceGracefully
+	if natsConn != nil {
+		sm.eventPublisher = natsConn
+	}
+
+	if cfg.MaxConcurrentRequests > 0 {
+		if cfg.RequestScheduling == "fair" {
+			sm.requestLimiter = NewFairWeightedSemaphore(int64(cfg.MaxConcurrentRequests))
+		} else {
+			sm.requestLimiter = NewWeightedSemaphore(int64(cfg.MaxConcurrentRequests))
+		}
+	}
+
+	if cfg.ProcessStartRate > 0 {
+		interval := time.Duration(cfg.ProcessStartIntervalMs) * time.Millisecond
+		if interval <= 0 {
+			interval = 100 * time.Millisecond
+		}
+		sm.startPacer = NewStartPacer(cfg.ProcessStartRate, interval)
 	}
+
+	if cfg.StatsdAddr != "" {
+		statsd, err := NewStatsD(cfg.StatsdAddr)
+		if err != nil {
+			sm.logger.Warn().Err(err).Msg("StatsD metrics disabled")
+		} else {
+			sm.statsd = statsd
+		}
+	}
+
+	return sm
+}
+
+// SetAccessLog enables access logging for services added afterwards; call it
+// before Start
+func (sm *ServiceManager) SetAccessLog(accessLog *logging.AccessLog) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.accessLog = accessLog
 }
 
 // Start begins the service manager, discovering services and watching for changes
@@ -77,19 +182,52 @@ func (sm *ServiceManager) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to discover services: %w", err)
 	}
 
+	// Deployments can insist that specific services are present before serving
+	if err := sm.checkRequiredServices(); err != nil {
+		return err
+	}
+
 	// Set up file watcher
 	if err := sm.setupFileWatcher(); err != nil {
 		return fmt.Errorf("failed to setup file watcher: %w", err)
 	}
 
 	// Start the supervisor
-	go sm.supervisor.Serve(ctx)
+	supervisorDone := sm.supervisor.ServeBackground(ctx)
+
+	// Serve endpoint documentation on the admin docs subject
+	if err := sm.setupDocsEndpoint(); err != nil {
+		return err
+	}
+
+	// Let operators change the log level without a restart
+	if err := sm.setupLogLevelEndpoint(); err != nil {
+		return err
+	}
+
+	// Export what this host serves so operators can diff hosts
+	if err := sm.setupTopologyEndpoint(); err != nil {
+		return err
+	}
+
+	// Let operators list what this host serves over micro discovery
+	if err := sm.setupAdminService(); err != nil {
+		return err
+	}
+
+	// One line operators can grep for to confirm a healthy boot
+	sm.emitStartupSummary()
+
+	// Periodic status for dashboards that detect silent instances
+	sm.startHeartbeat()
 
 	// Watch for file changes
 	go sm.watchFileChanges(ctx)
 
 	// Monitor file permission changes (for Linux where fsnotify doesn't support chmod)
-	go sm.watchPermissionChanges(ctx)
+	if sm.permissionCheckTicker != nil {
+		go sm.watchPermissionChanges(ctx)
+	}
 
 	// Block until context is cancelled
 	<-ctx.Done()
@@ -97,9 +235,57 @@ func (sm *ServiceManager) Start(ctx context.Context) error {
 	// Cleanup
 	sm.Stop()
 
+	// Wait for the supervisor to stop all services, then for every Serve call to
+	// finish deregistering its micro service so the caller can safely close NATS
+	<-supervisorDone
+	sm.Wait()
+
+	// Requests have finished, so no more metrics will be sent
+	sm.statsd.Close()
+
 	return ctx.Err()
 }
 
+// Wait blocks until every managed service's Serve call has returned. Serve calls
+// that start afterwards return without registering anything.
+func (sm *ServiceManager) Wait() {
+	sm.serves.wait()
+}
+
+// serveTracker counts running Serve calls. Suture starts Serve in its own
+// goroutine and may restart it, so a call can begin while shutdown is waiting;
+// the mutex orders every begin against wait, and begins after wait are refused.
+type serveTracker struct {
+	mutex   sync.Mutex
+	running sync.WaitGroup
+	closed  bool
+}
+
+// begin records a starting Serve call, reporting false once shutdown has begun
+func (t *serveTracker) begin() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return false
+	}
+	t.running.Add(1)
+	return true
+}
+
+func (t *serveTracker) end() {
+	t.running.Done()
+}
+
+// wait refuses further Serve calls and blocks until the running ones return
+func (t *serveTracker) wait() {
+	t.mutex.Lock()
+	t.closed = true
+	t.mutex.Unlock()
+
+	t.running.Wait()
+}
+
 // Stop gracefully stops the service manager
 func (sm *ServiceManager) Stop() {
 	logging.LogManagerOperation(sm.logger, "stopping", nil)
@@ -112,11 +298,51 @@ func (sm *ServiceManager) Stop() {
 		sm.permissionCheckTicker.Stop()
 	}
 
+	sm.stopHeartbeat()
+
+	if sm.docsSubscription != nil {
+		if err := sm.docsSubscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			sm.logger.Error().Err(err).Msg("Error unsubscribing docs endpoint")
+		}
+		sm.docsSubscription = nil
+	}
+
+	if sm.logLevelSubscription != nil {
+		if err := sm.logLevelSubscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			sm.logger.Error().Err(err).Msg("Error unsubscribing log level endpoint")
+		}
+		sm.logLevelSubscription = nil
+	}
+
+	if sm.topologySubscription != nil {
+		if err := sm.topologySubscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			sm.logger.Error().Err(err).Msg("Error unsubscribing topology endpoint")
+		}
+		sm.topologySubscription = nil
+	}
+
+	if sm.adminService != nil {
+		if err := sm.adminService.Stop(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			sm.logger.Error().Err(err).Msg("Error stopping admin service")
+		}
+		sm.adminService = nil
+	}
+
 	// Note: Suture supervisor is stopped by cancelling the context passed to Serve()
 }
 
 // DiscoverServices scans the scripts directory for valid shell scripts
 func (sm *ServiceManager) DiscoverServices() error {
+	_, err := sm.discoverServices()
+	return err
+}
+
+// discoverServices scans the scripts directory and adds a service for every valid
+// script. Scripts named like services that failed to load are returned; failing
+// to walk the directory is an error.
+func (sm *ServiceManager) discoverServices() ([]ScriptError, error) {
+	var scriptErrors []ScriptError
+
 	logging.LogManagerOperation(sm.logger, "discovering", map[string]interface{}{
 		"path": sm.scriptsPath,
 	})
@@ -126,9 +352,11 @@ func (sm *ServiceManager) DiscoverServices() error {
 		sm.logger.Warn().
 			Str("path", sm.scriptsPath).
 			Msg("Scripts directory does not exist")
-		return nil
+		return nil, nil
 	}
 
+	sm.loadIgnoreRules()
+
 	// Walk through the scripts directory
 	err := filepath.Walk(sm.scriptsPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -139,37 +367,70 @@ func (sm *ServiceManager) DiscoverServices() error {
 			return nil // Continue walking
 		}
 
-		// Skip directories
+		// Skip ignored paths, including whole ignored directories
+		if sm.isIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip directories, and don't descend below max_discovery_depth
 		if info.IsDir() {
+			if sm.exceedsDiscoveryDepth(path) {
+				sm.logger.Info().
+					Str("path", path).
+					Int("max_discovery_depth", sm.config.MaxDiscoveryDepth).
+					Msg("Not descending into directory beyond max discovery depth")
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
 		// Check if it's a valid script
-		if sm.IsValidScript(path) {
-			if err := sm.AddService(path); err != nil {
-				sm.logger.Error().
-					Err(err).
-					Str("script", path).
-					Msg("Failed to add discovered service")
+		definition, err := sm.validateAndLoad(path)
+		if err != nil {
+			if !errors.Is(err, errNotAScript) {
+				scriptErrors = append(scriptErrors, ScriptError{Script: path, Err: err})
 			}
+			return nil
+		}
+		if err := sm.addLoadedService(path, definition); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", path).
+				Msg("Failed to add discovered service")
+			scriptErrors = append(scriptErrors, ScriptError{Script: path, Err: err})
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to walk scripts directory: %w", err)
+		return scriptErrors, fmt.Errorf("failed to walk scripts directory: %w", err)
 	}
 
 	logging.LogManagerOperation(sm.logger, "discovery_completed", map[string]interface{}{
 		"count": len(sm.services),
 	})
 
-	return nil
+	return scriptErrors, nil
 }
 
 // AddService creates and starts a new managed service for the given script
 func (sm *ServiceManager) AddService(scriptPath string) error {
+	return sm.addService(scriptPath, nil)
+}
+
+// addLoadedService adds a script whose definition validateAndLoad already
+// probed, so the script's info isn't run a second time
+func (sm *ServiceManager) addLoadedService(scriptPath string, definition service.ServiceDefinition) error {
+	return sm.addService(scriptPath, &definition)
+}
+
+// addService adds a script's service; loaded is nil when the script hasn't been
+// probed for its definition yet
+func (sm *ServiceManager) addService(scriptPath string, loaded *service.ServiceDefinition) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
@@ -186,24 +447,89 @@ func (sm *ServiceManager) AddService(scriptPath string) error {
 		return nil
 	}
 
-	// Get service definition from script to determine service name
-	runner := service.NewScriptRunner(scriptPath)
-	ctx := context.Background()
-	definition, err := runner.GetServiceDefinition(ctx)
+	// A symlink (or hard link) to a loaded script would register its endpoints
+	// twice; the path loaded first, which is first in discovery order, wins
+	if existingPath, duplicate := sm.loadedScriptFor(scriptPath); duplicate {
+		sm.logger.Warn().
+			Str("script", scriptPath).
+			Str("loaded_script", existingPath).
+			Str("service", sm.scriptToService[existingPath]).
+			Msg("Skipping script that is the same file as an already loaded script")
+		return nil
+	}
+
+	definition, err := sm.loadDefinition(scriptPath, loaded)
 	if err != nil {
-		return fmt.Errorf("failed to get service definition: %w", err)
+		return err
 	}
+	ctx := context.Background()
 
 	serviceName := definition.Name
+	if err := validateServiceName(serviceName); err != nil {
+		sm.logger.Error().
+			Str("script", scriptPath).
+			Str("name", serviceName).
+			Msg("Rejecting script with empty service name")
+		return fmt.Errorf("script %s: %w", scriptPath, err)
+	}
+
+	// Operators can switch services off declaratively
+	if sm.config.ServiceDisabled(serviceName) {
+		sm.logger.Info().
+			Str("script", scriptPath).
+			Str("service", serviceName).
+			Msg("Skipping service disabled by configuration")
+		return nil
+	}
+
+	// Overlapping subjects would make both services receive the same requests;
+	// check the subjects the service will register, after endpoint_overrides
+	registered := definition
+	if endpoints, ok := sm.config.EndpointOverrideFor(scriptPath, definition.Name); ok {
+		registered.Endpoints = endpoints
+	}
+	if conflicts := sm.subjectConflicts(registered); len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			sm.logger.Warn().
+				Str("script", scriptPath).
+				Str("service", serviceName).
+				Str("subject", conflict.Subject).
+				Str("conflicting_service", conflict.ConflictingService).
+				Str("conflicting_subject", conflict.ConflictingSubject).
+				Str("policy", sm.config.SubjectConflictPolicy).
+				Msg("Endpoint subject overlaps another service's subject")
+		}
+		if sm.config.SubjectConflictPolicy == "refuse" {
+			return fmt.Errorf("script %s: subject %s overlaps %s of service %s",
+				scriptPath, conflicts[0].Subject, conflicts[0].ConflictingSubject, conflicts[0].ConflictingService)
+		}
+	}
 
 	// Check if a service with this name already exists
 	if existingService, exists := sm.services[serviceName]; exists {
+		// Refuse to group scripts whose versions drifted beyond the configured policy
+		pinnedVersion := existingService.definition.Version
+		if !service.VersionsCompatible(sm.config.GroupVersionPolicy, pinnedVersion, definition.Version) {
+			sm.logger.Error().
+				Str("script", scriptPath).
+				Str("service", serviceName).
+				Str("service_version", pinnedVersion).
+				Str("script_version", definition.Version).
+				Str("policy", sm.config.GroupVersionPolicy).
+				Msg("Refusing to group script with incompatible version")
+			return fmt.Errorf("script %s version %q is incompatible with service %s version %q under group_version_policy %q",
+				scriptPath, definition.Version, serviceName, pinnedVersion, sm.config.GroupVersionPolicy)
+		}
+
 		// Add this script to the existing service
 		existingService.AddScript(scriptPath)
 		sm.scriptToService[scriptPath] = serviceName
 
-		// Re-initialize the service to pick up the new endpoints
-		if err := existingService.Initialize(ctx); err != nil {
+		// Re-initialize the service to pick up the new endpoints; a failed
+		// Initialize leaves the service as it was, so only the script is undone
+		if err := existingService.initializeWith(ctx, scriptPath, definition); err != nil {
+			existingService.RemoveScript(scriptPath)
+			delete(sm.scriptToService, scriptPath)
 			return fmt.Errorf("failed to re-initialize grouped service: %w", err)
 		}
 
@@ -212,19 +538,34 @@ func (sm *ServiceManager) AddService(scriptPath string) error {
 			Str("service", serviceName).
 			Msg("Added script to existing service group")
 
-		logging.LogServiceLifecycle(sm.logger, "added", serviceName, scriptPath)
+		sm.serviceLifecycle("added", serviceName, scriptPath)
 		return nil
 	}
 
 	// Create new managed service with config
 	managedService := NewManagedService(scriptPath, sm.natsConn, sm.logger, *sm.config)
+	managedService.serves = &sm.serves
+	managedService.requestLimiter = sm.requestLimiter
+	managedService.startPacer = sm.startPacer
+	managedService.accessLog = sm.accessLog
+	managedService.statsd = sm.statsd
+	if limit := sm.config.MaxConcurrentFor(serviceName); limit > 0 {
+		managedService.concurrencyLimit = NewConcurrencyLimit(limit, sm.config.ConcurrencyQueueSize, sm.config.ConcurrencyOverflow)
+	}
+	// Known from the probe above, so the script runs with the service's rlimits
+	managedService.definition.Name = serviceName
 	managedService.AddScript(scriptPath)
 
-	// Initialize the service
-	if err := managedService.Initialize(ctx); err != nil {
+	// Initialize the service with the definition already probed above
+	if err := managedService.initializeWith(ctx, scriptPath, definition); err != nil {
 		return fmt.Errorf("failed to initialize service: %w", err)
 	}
 
+	// Answer "warming up" until Serve has registered the endpoints
+	if err := managedService.startWarmup(); err != nil {
+		sm.logger.Warn().Err(err).Str("service", serviceName).Msg("Failed to start warmup placeholder")
+	}
+
 	// Add to services map
 	sm.services[serviceName] = managedService
 	sm.scriptToService[scriptPath] = serviceName
@@ -234,7 +575,7 @@ func (sm *ServiceManager) AddService(scriptPath string) error {
 	sm.serviceTokens[serviceName] = token
 	managedService.serviceToken = token
 
-	logging.LogServiceLifecycle(sm.logger, "added", serviceName, scriptPath)
+	sm.serviceLifecycle("added", serviceName, scriptPath)
 
 	return nil
 }
@@ -269,22 +610,27 @@ func (sm *ServiceManager) RemoveService(scriptPath string) error {
 		return nil
 	}
 
-	// Remove script from service
-	delete(managedService.scripts, scriptPath)
+	// Remove script from service; in-flight requests hold their own runner and are
+	// drained by Serve before the service's NATS subscriptions are gone
+	remainingScripts := managedService.RemoveScript(scriptPath)
 	delete(sm.scriptToService, scriptPath)
 
 	// If no scripts left in service, remove the entire service
-	if len(managedService.scripts) == 0 {
+	if remainingScripts == 0 {
 		// Remove from supervisor
 		if token, exists := sm.serviceTokens[serviceName]; exists {
 			sm.supervisor.Remove(token)
 			delete(sm.serviceTokens, serviceName)
 		}
 
+		// Serve may never have run to clear the placeholder
+		managedService.stopWarmup()
+		managedService.rejectBufferedRequests()
+
 		// Remove from services map
 		delete(sm.services, serviceName)
 
-		logging.LogServiceLifecycle(sm.logger, "removed", serviceName, scriptPath)
+		sm.serviceLifecycle("removed", serviceName, scriptPath)
 	} else {
 		// Re-initialize the service to update endpoints
 		ctx := context.Background()
@@ -298,10 +644,10 @@ func (sm *ServiceManager) RemoveService(scriptPath string) error {
 		sm.logger.Info().
 			Str("script", scriptPath).
 			Str("service", serviceName).
-			Int("remaining_scripts", len(managedService.scripts)).
+			Int("remaining_scripts", remainingScripts).
 			Msg("Removed script from service group")
 
-		logging.LogServiceLifecycle(sm.logger, "script_removed", serviceName, scriptPath)
+		sm.serviceLifecycle("script_removed", serviceName, scriptPath)
 	}
 
 	return nil
@@ -312,27 +658,27 @@ func (sm *ServiceManager) RestartService(scriptPath string) error {
 	return sm.RestartServiceGracefully(scriptPath)
 }
 
-// RestartServiceGracefully restarts a managed service with proper shutdown
+// RestartServiceGracefully restarts a managed service with proper shutdown.
+// Stopping the old NATS service can take seconds, so it runs without holding the
+// manager lock; the service's own restart lock keeps its restarts in order.
 func (sm *ServiceManager) RestartServiceGracefully(scriptPath string) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
 	logging.LogManagerOperation(sm.logger, "restarting", map[string]interface{}{
 		"script": scriptPath,
 	})
 
 	// Find which service this script belongs to
+	sm.mutex.RLock()
 	serviceName, exists := sm.scriptToService[scriptPath]
+	managedService, serviceExists := sm.services[serviceName]
+	sm.mutex.RUnlock()
+
 	if !exists {
 		sm.logger.Warn().
 			Str("script", scriptPath).
 			Msg("Script not tracked by any service, cannot restart")
 		return nil
 	}
-
-	// Get the managed service
-	managedService, exists := sm.services[serviceName]
-	if !exists {
+	if !serviceExists {
 		sm.logger.Warn().
 			Str("script", scriptPath).
 			Str("service", serviceName).
@@ -340,14 +686,30 @@ func (sm *ServiceManager) RestartServiceGracefully(scriptPath string) error {
 		return nil
 	}
 
+	managedService.restartMutex.Lock()
+	defer managedService.restartMutex.Unlock()
+
+	// Answer "warming up" from before the old endpoints go away until the new ones are registered
+	if err := managedService.startWarmup(); err != nil {
+		sm.logger.Warn().Err(err).Str("service", serviceName).Msg("Failed to start warmup placeholder")
+	}
+
 	// Step 1: Gracefully stop the old NATS service
-	if managedService.natsService != nil {
+	if oldService := managedService.microService(); oldService != nil {
 		sm.logger.Debug().
 			Str("script", scriptPath).
 			Str("service", serviceName).
 			Msg("Stopping old NATS service")
 
-		if err := managedService.natsService.Stop(); err != nil {
+		oldInstance := oldService.Info()
+		stopTimeout := managedService.serviceStopTimeout()
+		if stopped, err := stopMicroService(oldService, stopTimeout); !stopped {
+			sm.logger.Warn().
+				Str("script", scriptPath).
+				Str("service", serviceName).
+				Dur("stop_timeout", stopTimeout).
+				Msg("Timed out stopping old NATS service")
+		} else if err != nil {
 			sm.logger.Error().
 				Err(err).
 				Str("script", scriptPath).
@@ -355,8 +717,32 @@ func (sm *ServiceManager) RestartServiceGracefully(scriptPath string) error {
 				Msg("Error stopping old NATS service")
 		}
 
-		// Give some time for the service to properly unregister
-		time.Sleep(100 * time.Millisecond)
+		// Wait until the old instance stops answering so the new registration can't collide with it
+		timeout := time.Duration(sm.config.RestartUnregisterTimeoutMs) * time.Millisecond
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		if !waitForDeregistration(sm.natsConn, oldInstance.Name, oldInstance.ID, timeout) {
+			sm.logger.Warn().
+				Str("script", scriptPath).
+				Str("service", serviceName).
+				Str("instance_id", oldInstance.ID).
+				Dur("timeout", timeout).
+				Msg("Old NATS service still answering after timeout, restarting anyway")
+		}
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	// The service may have been removed while it was stopping
+	if current, exists := sm.services[serviceName]; !exists || current != managedService {
+		managedService.stopWarmup()
+		sm.logger.Warn().
+			Str("script", scriptPath).
+			Str("service", serviceName).
+			Msg("Service removed while restarting, not starting it again")
+		return nil
 	}
 
 	// Step 2: Remove old service from supervisor
@@ -369,44 +755,315 @@ func (sm *ServiceManager) RestartServiceGracefully(scriptPath string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	cachedDefinition := managedService.definition
+	cachedModTimes := managedService.scriptModTimes
+
 	if err := managedService.Initialize(ctx); err != nil {
 		return fmt.Errorf("failed to re-initialize service after restart: %w", err)
 	}
 
+	if sm.config.InfoConsistencyCheck && !managedService.scriptsModifiedSince(cachedModTimes) {
+		sm.warnOnDefinitionDrift(scriptPath, cachedDefinition, managedService.definition)
+	}
+
+	// The subjects may have changed, so move the placeholder to the new definition
+	if err := managedService.startWarmup(); err != nil {
+		sm.logger.Warn().Err(err).Str("service", serviceName).Msg("Failed to start warmup placeholder")
+	}
+
 	// Step 4: Add service back to supervisor
 	token := sm.supervisor.Add(managedService)
 	sm.serviceTokens[serviceName] = token
 	managedService.serviceToken = token
 
-	logging.LogServiceLifecycle(sm.logger, "restarted", serviceName, scriptPath)
+	sm.serviceLifecycle("restarted", serviceName, scriptPath)
 
 	return nil
 }
 
-// IsValidScript checks if a file is a valid executable shell script
-func (sm *ServiceManager) IsValidScript(filePath string) bool {
-	// Check file extension
-	if !strings.HasSuffix(filePath, ".sh") {
+// warnOnDefinitionDrift warns when a fresh info probe disagrees with the cached
+// definition about the service name or endpoint subjects even though no script
+// was modified, which points at a script with non-deterministic info output
+func (sm *ServiceManager) warnOnDefinitionDrift(scriptPath string, cached, fresh service.ServiceDefinition) {
+	cachedSubjects := make(map[string]bool, len(cached.Endpoints))
+	for _, endpoint := range cached.Endpoints {
+		cachedSubjects[endpoint.Subject] = true
+	}
+
+	var added, removed []string
+	for _, endpoint := range fresh.Endpoints {
+		if !cachedSubjects[endpoint.Subject] {
+			added = append(added, endpoint.Subject)
+		}
+		delete(cachedSubjects, endpoint.Subject)
+	}
+	for subject := range cachedSubjects {
+		removed = append(removed, subject)
+	}
+
+	if cached.Name == fresh.Name && len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sm.logger.Warn().
+		Str("script", scriptPath).
+		Str("cached_name", cached.Name).
+		Str("fresh_name", fresh.Name).
+		Strs("added_subjects", added).
+		Strs("removed_subjects", removed).
+		Msg("Script info output changed between probes without a file modification")
+}
+
+// waitForDeregistration polls the micro PING subject of a specific service instance
+// until NATS reports no responders, returning false if it still answers after timeout
+func waitForDeregistration(natsConn *nats.Conn, serviceName, instanceID string, timeout time.Duration) bool {
+	if natsConn == nil {
+		return true
+	}
+
+	pingSubject := "$SRV.PING." + serviceName + "." + instanceID
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := natsConn.Request(pingSubject, nil, 50*time.Millisecond)
+		if errors.Is(err, nats.ErrNoResponders) {
+			return true
+		}
+		if !natsConn.IsConnected() {
+			return true // A disconnected instance can't collide with the new registration
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// MissingServices returns the required services that are not currently loaded
+func (sm *ServiceManager) MissingServices() []string {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	var missing []string
+	for _, name := range sm.config.RequiredServices {
+		if _, exists := sm.services[name]; !exists {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Healthy reports whether every required service is loaded
+func (sm *ServiceManager) Healthy() bool {
+	return len(sm.MissingServices()) == 0
+}
+
+// checkRequiredServices logs required services that failed to load and, unless the
+// policy is "unhealthy", fails startup
+func (sm *ServiceManager) checkRequiredServices() error {
+	missing := sm.MissingServices()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sm.logger.Error().
+		Strs("missing_services", missing).
+		Str("policy", sm.config.RequiredServicesPolicy).
+		Msg("Required services did not load")
+
+	if sm.config.RequiredServicesPolicy == "unhealthy" {
+		return nil
+	}
+	return fmt.Errorf("required services not loaded: %s", strings.Join(missing, ", "))
+}
+
+// exceedsDiscoveryDepth reports whether scripts inside dir would lie deeper below
+// scripts_path than max_discovery_depth allows
+func (sm *ServiceManager) exceedsDiscoveryDepth(dir string) bool {
+	if sm.config.MaxDiscoveryDepth <= 0 {
 		return false
 	}
 
-	// Check if file is executable
-	info, err := os.Stat(filePath)
-	if err != nil {
+	rel, err := filepath.Rel(sm.scriptsPath, dir)
+	if err != nil || rel == "." {
 		return false
 	}
 
-	if info.Mode()&0111 == 0 {
-		return false // Not executable
+	// Scripts directly in scripts_path are at depth 1, those in a subdirectory at 2
+	depth := len(strings.Split(rel, string(filepath.Separator)))
+	return depth >= sm.config.MaxDiscoveryDepth
+}
+
+// loadDefinition returns the definition validation already loaded, or probes
+// the script for it
+func (sm *ServiceManager) loadDefinition(scriptPath string, loaded *service.ServiceDefinition) (service.ServiceDefinition, error) {
+	if loaded != nil {
+		return *loaded, nil
+	}
+
+	// Refuse to run scripts with an untrusted owner, even to probe them
+	if sm.config.RequireScriptOwner != "" {
+		info, err := os.Stat(scriptPath)
+		if err != nil {
+			return service.ServiceDefinition{}, fmt.Errorf("failed to stat script: %w", err)
+		}
+		if err := sm.checkScriptOwner(info); err != nil {
+			sm.logger.Warn().
+				Err(err).
+				Str("script", scriptPath).
+				Msg("Skipping script with untrusted owner")
+			return service.ServiceDefinition{}, fmt.Errorf("script %s: %w", scriptPath, err)
+		}
+	}
+
+	// Get service definition from script to determine service name
+	runner := newScriptRunner(*sm.config, scriptPath, "")
+	definition, err := runner.GetServiceDefinition(context.Background())
+	if err != nil {
+		return service.ServiceDefinition{}, fmt.Errorf("failed to get service definition: %w", err)
+	}
+	return definition, nil
+}
+
+// IsValidScript checks if a file is a valid executable shell script
+func (sm *ServiceManager) IsValidScript(filePath string) bool {
+	_, err := sm.validateAndLoad(filePath)
+	return err == nil
+}
+
+// errNotAScript marks files that are not service scripts at all, as opposed to
+// scripts that failed validation
+var errNotAScript = errors.New("not a service script")
+
+// validateAndLoad returns the definition of a valid executable shell script, or
+// why it is not one: errNotAScript for files natshd doesn't consider, or the
+// validation failure. The definition can be handed to addLoadedService.
+func (sm *ServiceManager) validateAndLoad(filePath string) (service.ServiceDefinition, error) {
+	if err := sm.checkScriptFile(filePath); err != nil {
+		return service.ServiceDefinition{}, err
 	}
 
 	// Try to get service definition to validate it's a proper service script
-	runner := service.NewScriptRunner(filePath)
+	runner := newScriptRunner(*sm.config, filePath, "")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // 5 second timeout
 	defer cancel()
 
-	_, err = runner.GetServiceDefinition(ctx)
-	return err == nil
+	definition, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		return service.ServiceDefinition{}, fmt.Errorf("failed to get service definition: %w", err)
+	}
+	return definition, nil
+}
+
+// checkScriptFile runs the checks of validateAndLoad that don't run the script
+func (sm *ServiceManager) checkScriptFile(filePath string) error {
+	// Check file name against include_globs and exclude_globs
+	if !sm.isScriptName(filePath) {
+		return errNotAScript
+	}
+
+	// Check if file is executable
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return errNotAScript
+	}
+
+	if !sm.runnable(info) {
+		return errNotAScript // Not executable
+	}
+
+	if limit := sm.config.MaxScriptSizeBytes; limit > 0 && info.Size() > limit {
+		sm.logger.Warn().
+			Str("script", filePath).
+			Int64("size_bytes", info.Size()).
+			Int64("max_script_size_bytes", limit).
+			Msg("Skipping script larger than max_script_size_bytes")
+		return fmt.Errorf("script is %d bytes, larger than max_script_size_bytes %d", info.Size(), limit)
+	}
+
+	// Checked before the script runs at all
+	if err := sm.checkScriptOwner(info); err != nil {
+		sm.logger.Warn().
+			Err(err).
+			Str("script", filePath).
+			Msg("Skipping script with untrusted owner")
+		return err
+	}
+	return nil
+}
+
+// runnable reports whether a script file can be run: it is executable, or an
+// interpreter is configured to run it regardless of its mode
+func (sm *ServiceManager) runnable(info os.FileInfo) bool {
+	return sm.config.Interpreter != "" || info.Mode()&0111 != 0
+}
+
+// isScriptName reports whether a file name matches one of the include globs
+// ("*.sh" unless configured, see Config.ScriptIncludeGlobs) and none of the
+// exclude_globs. Excluded files are never probed with info.
+func (sm *ServiceManager) isScriptName(path string) bool {
+	name := filepath.Base(path)
+
+	for _, glob := range sm.config.ExcludeGlobs {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return false
+		}
+	}
+
+	for _, glob := range sm.config.ScriptIncludeGlobs() {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// loadedScriptFor returns the tracked script path that refers to the same file
+// as scriptPath through a symlink or hard link, if any
+func (sm *ServiceManager) loadedScriptFor(scriptPath string) (string, bool) {
+	info, err := os.Stat(scriptPath)
+	if err != nil {
+		return "", false
+	}
+
+	var matches []string
+	for trackedPath := range sm.scriptToService {
+		trackedInfo, err := os.Stat(trackedPath)
+		if err == nil && os.SameFile(info, trackedInfo) {
+			matches = append(matches, trackedPath)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Strings(matches)
+	return matches[0], true
+}
+
+// checkScriptOwner rejects scripts not owned by require_script_owner, so an
+// account that can write to the scripts directory cannot inject a service
+func (sm *ServiceManager) checkScriptOwner(info os.FileInfo) error {
+	if sm.config.RequireScriptOwner == "" {
+		return nil
+	}
+
+	uid, gid, err := sm.config.ScriptOwner()
+	if err != nil {
+		return fmt.Errorf("require_script_owner: %w", err)
+	}
+
+	fileUID, fileGID, ok := fileOwner(info)
+	if !ok {
+		return fmt.Errorf("file owner is unavailable on this platform")
+	}
+	if uid >= 0 && fileUID != uid {
+		return fmt.Errorf("owned by uid %d, require_script_owner %q needs uid %d", fileUID, sm.config.RequireScriptOwner, uid)
+	}
+	if gid >= 0 && fileGID != gid {
+		return fmt.Errorf("owned by gid %d, require_script_owner %q needs gid %d", fileGID, sm.config.RequireScriptOwner, gid)
+	}
+	return nil
 }
 
 // setupFileWatcher creates a file system watcher for the scripts directory
@@ -463,28 +1120,43 @@ func (sm *ServiceManager) handleFileEvent(event fsnotify.Event) {
 		Str("operation", event.Op.String()).
 		Msg("File event received")
 
-	// Only process shell scripts
-	if !strings.HasSuffix(event.Name, ".sh") {
+	// Changing the ignore file may add or remove services
+	if filepath.Base(event.Name) == IgnoreFileName {
+		sm.handleFileEventDebounced(event.Name, "reconcile")
+		return
+	}
+
+	// Only process files named like service scripts
+	if !sm.isScriptName(event.Name) {
+		return
+	}
+
+	// Ignored scripts are left alone; ReconcileIgnoreRules handles newly ignored ones
+	if sm.isIgnored(event.Name) {
 		return
 	}
 
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
-		// New file created
-		if sm.IsValidScript(event.Name) {
-			if err := sm.AddService(event.Name); err != nil {
-				sm.logger.Error().
-					Err(err).
-					Str("script", event.Name).
-					Msg("Failed to add service for created file")
-			}
+		// A create shortly after a deferred removal is an atomic save; restart instead
+		if sm.hasPendingFileEvent(event.Name) {
+			sm.handleFileEventDebounced(event.Name, "write")
+			return
 		}
 
+		// New file created - writes usually follow while content is still being
+		// copied in, so only probe it once it settles
+		sm.handleFileEventDebounced(event.Name, "create")
+
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		// File modified - use debouncing to handle multiple rapid events
 		sm.handleFileEventDebounced(event.Name, "write")
 
 	case event.Op&fsnotify.Remove == fsnotify.Remove:
+		if sm.deferRemoval(event.Name) {
+			return
+		}
+
 		// File deleted
 		if err := sm.RemoveService(event.Name); err != nil {
 			sm.logger.Error().
@@ -494,6 +1166,14 @@ func (sm *ServiceManager) handleFileEvent(event fsnotify.Event) {
 		}
 
 	case event.Op&fsnotify.Rename == fsnotify.Rename:
+		// fsnotify reports only the old name; the new one may or may not follow as
+		// a Create, so reconcile the directory once the rename settles
+		sm.handleFileEventDebounced(filepath.Dir(event.Name), "rescan")
+
+		if sm.deferRemoval(event.Name) {
+			return
+		}
+
 		// File renamed (treated as deletion)
 		if err := sm.RemoveService(event.Name); err != nil {
 			sm.logger.Error().
@@ -501,9 +1181,144 @@ func (sm *ServiceManager) handleFileEvent(event fsnotify.Event) {
 				Str("script", event.Name).
 				Msg("Failed to remove service for renamed file")
 		}
+
+	case event.Op&fsnotify.Chmod == fsnotify.Chmod:
+		// Permissions changed - add or remove the service if the executable bit flipped
+		sm.handleChmodEvent(event.Name)
+	}
+}
+
+// handleChmodEvent applies executable-bit transitions reported by fsnotify, which
+// is what replaces the permission poller on platforms with native chmod events
+func (sm *ServiceManager) handleChmodEvent(filePath string) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return // Removal is handled by its own event
+	}
+	isExecutable := sm.runnable(info)
+
+	sm.mutex.Lock()
+	sm.fileExecutableStatus[filePath] = isExecutable
+	_, tracked := sm.scriptToService[filePath]
+	sm.mutex.Unlock()
+
+	switch {
+	case isExecutable && !tracked:
+		definition, err := sm.validateAndLoad(filePath)
+		if err != nil {
+			return // Not a valid service script
+		}
+
+		sm.logger.Info().
+			Str("script", filePath).
+			Msg("Script became executable - adding service")
+
+		if err := sm.addLoadedService(filePath, definition); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", filePath).
+				Msg("Failed to add service for newly executable script")
+		}
+
+	case !isExecutable && tracked:
+		sm.logger.Info().
+			Str("script", filePath).
+			Msg("Script became non-executable - removing service")
+
+		if err := sm.RemoveService(filePath); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", filePath).
+				Msg("Failed to remove service for non-executable script")
+		}
 	}
 }
 
+// pendingScriptPollInterval is how often a pending script's executable bit is checked
+const pendingScriptPollInterval = 100 * time.Millisecond
+
+// trackPendingScript records a newly created script that is not executable yet, so
+// the permission poller sees its transition, and watches it for a short window so a
+// create-then-chmod loads it promptly
+func (sm *ServiceManager) trackPendingScript(filePath string) {
+	info, err := os.Stat(filePath)
+	if err != nil || sm.runnable(info) {
+		return // Gone, or executable but not a valid service script
+	}
+
+	sm.mutex.Lock()
+	sm.fileExecutableStatus[filePath] = false
+	_, watching := sm.pendingScripts[filePath]
+	if !watching {
+		sm.pendingScripts[filePath] = struct{}{}
+	}
+	sm.mutex.Unlock()
+
+	window := time.Duration(sm.config.PendingScriptWindowMs) * time.Millisecond
+	if watching || window <= 0 {
+		return
+	}
+
+	go func() {
+		defer func() {
+			sm.mutex.Lock()
+			delete(sm.pendingScripts, filePath)
+			sm.mutex.Unlock()
+		}()
+
+		ticker := time.NewTicker(pendingScriptPollInterval)
+		defer ticker.Stop()
+		deadline := time.Now().Add(window)
+
+		for time.Now().Before(deadline) {
+			<-ticker.C
+
+			info, err := os.Stat(filePath)
+			if err != nil {
+				return
+			}
+			if sm.runnable(info) {
+				sm.handleChmodEvent(filePath)
+				return
+			}
+		}
+	}()
+}
+
+// deferRemoval debounces the removal of a tracked script when recreate_policy is "restart",
+// so editors that save atomically (remove then create) trigger a graceful restart instead
+// of dropping the endpoint. Returns true if the removal was deferred.
+func (sm *ServiceManager) deferRemoval(filePath string) bool {
+	if sm.config.RecreatePolicy == "recreate" {
+		return false
+	}
+
+	sm.mutex.RLock()
+	_, tracked := sm.scriptToService[filePath]
+	sm.mutex.RUnlock()
+	if !tracked {
+		return false
+	}
+
+	sm.handleFileEventDebounced(filePath, "remove")
+	return true
+}
+
+// hasPendingFileEvent reports whether a debounced action is waiting for the file
+func (sm *ServiceManager) hasPendingFileEvent(filePath string) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	_, pending := sm.debounceTracker[filePath]
+	return pending
+}
+
+// pendingFileEvents returns how many files have a debounced action waiting or running
+func (sm *ServiceManager) pendingFileEvents() int {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return len(sm.debounceTracker)
+}
+
 // handleFileEventDebounced handles file events with debouncing to prevent rapid restarts
 func (sm *ServiceManager) handleFileEventDebounced(filePath, eventType string) {
 	sm.mutex.Lock()
@@ -519,8 +1334,14 @@ func (sm *ServiceManager) handleFileEventDebounced(filePath, eventType string) {
 	tracker.mutex.Lock()
 	defer tracker.mutex.Unlock()
 
-	// Update last event time
+	// Update last event time and count the event toward this debounce window
 	tracker.lastEventTime = time.Now()
+	tracker.eventCount++
+
+	// Writes following a create are part of creating the file
+	if tracker.eventType != "create" || eventType != "write" {
+		tracker.eventType = eventType
+	}
 
 	// Cancel existing timer if it exists
 	if tracker.timer != nil {
@@ -529,46 +1350,96 @@ func (sm *ServiceManager) handleFileEventDebounced(filePath, eventType string) {
 
 	// Create new timer for debounced action
 	tracker.timer = time.AfterFunc(sm.debounceInterval, func() {
-		sm.executeFileEventAction(filePath, eventType)
+		tracker.mutex.Lock()
+		coalesced := tracker.eventCount
+		settledType := tracker.eventType
+		tracker.eventCount = 0
+		tracker.mutex.Unlock()
+
+		sm.runFileEventAction(filePath, settledType, coalesced)
 
-		// Clean up tracker after execution
+		// Clean up tracker after execution, unless an event arrived while the action
+		// ran: its timer is pending on this tracker and will clean up after itself
 		sm.mutex.Lock()
-		delete(sm.debounceTracker, filePath)
+		tracker.mutex.Lock()
+		if current := sm.debounceTracker[filePath]; current == tracker && tracker.eventCount == 0 {
+			delete(sm.debounceTracker, filePath)
+		}
+		tracker.mutex.Unlock()
 		sm.mutex.Unlock()
 	})
 }
 
+// runFileEventAction runs a debounced file event action once a worker slot is free,
+// so a storm of events across many files can't launch unbounded concurrent probes
+func (sm *ServiceManager) runFileEventAction(filePath, eventType string, coalesced int) {
+	sm.fileEventSlots <- struct{}{}
+	defer func() { <-sm.fileEventSlots }()
+
+	sm.fileEventHandler(filePath, eventType, coalesced)
+}
+
+// restartWhenSlotFree restarts a script's service once a restart slot is free,
+// so a mass edit restarts services in waves of max_concurrent_restarts
+func (sm *ServiceManager) restartWhenSlotFree(scriptPath string) error {
+	select {
+	case sm.restartSlots <- struct{}{}:
+	default:
+		sm.logger.Info().
+			Str("script", scriptPath).
+			Int("max_concurrent_restarts", cap(sm.restartSlots)).
+			Msg("Restart queued until a restart slot is free")
+		sm.restartSlots <- struct{}{}
+	}
+	defer func() { <-sm.restartSlots }()
+
+	return sm.restartHandler(scriptPath)
+}
+
 // executeFileEventAction performs the actual file event action after debounce
-func (sm *ServiceManager) executeFileEventAction(filePath, eventType string) {
+// coalesced is the number of raw events folded into this action, useful for tuning debounce_interval_ms
+func (sm *ServiceManager) executeFileEventAction(filePath, eventType string, coalesced int) {
 	sm.logger.Debug().
 		Str("file", filePath).
 		Str("event", eventType).
+		Int("coalesced_events", coalesced).
+		Dur("debounce_interval", sm.debounceInterval).
 		Msg("Executing debounced file event action")
 
 	switch eventType {
-	case "write":
-		// Check if file is still valid after modification
-		if sm.IsValidScript(filePath) {
-			// Check if script is already tracked
-			sm.mutex.RLock()
-			_, exists := sm.scriptToService[filePath]
-			sm.mutex.RUnlock()
+	case "reconcile":
+		sm.ReconcileIgnoreRules()
 
+	case "rescan":
+		sm.reconcileDirectory(filePath)
+
+	case "create", "write", "remove":
+		// A deferred removal is reconciled like a write: if the file came back it is
+		// restarted, otherwise its service is removed
+		sm.mutex.RLock()
+		_, exists := sm.scriptToService[filePath]
+		sm.mutex.RUnlock()
+
+		// Check if file is still valid after modification
+		if definition, err := sm.validateAndLoad(filePath); err == nil {
 			if exists {
-				if err := sm.RestartServiceGracefully(filePath); err != nil {
+				if err := sm.restartWhenSlotFree(filePath); err != nil {
 					sm.logger.Error().
 						Err(err).
 						Str("script", filePath).
 						Msg("Failed to restart service for modified file")
 				}
 			} else {
-				if err := sm.AddService(filePath); err != nil {
+				if err := sm.addLoadedService(filePath, definition); err != nil {
 					sm.logger.Error().
 						Err(err).
 						Str("script", filePath).
 						Msg("Failed to add service for modified file")
 				}
 			}
+		} else if eventType == "create" && !exists {
+			// Not executable yet, most likely about to be chmod'ed
+			sm.trackPendingScript(filePath)
 		} else {
 			// File is no longer valid, remove service if it exists
 			if err := sm.RemoveService(filePath); err != nil {
@@ -581,6 +1452,197 @@ func (sm *ServiceManager) executeFileEventAction(filePath, eventType string) {
 	}
 }
 
+// newPermissionCheckTicker returns the permission poller's ticker, or nil when
+// polling is disabled for this platform or by config
+func newPermissionCheckTicker(mode string, intervalMs int) *time.Ticker {
+	if intervalMs <= 0 || !permissionPollingEnabled(mode, runtime.GOOS) {
+		return nil
+	}
+	return time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
+}
+
+// loadIgnoreRules reads the .natshdignore files under the scripts directory,
+// keeping the previous rules if they can't be read
+func (sm *ServiceManager) loadIgnoreRules() {
+	rules, err := LoadIgnoreRules(sm.scriptsPath)
+	if err != nil {
+		sm.logger.Error().
+			Err(err).
+			Str("path", sm.scriptsPath).
+			Msg("Failed to load ignore files")
+		return
+	}
+
+	sm.mutex.Lock()
+	sm.ignoreRules = rules
+	sm.mutex.Unlock()
+}
+
+// isIgnored reports whether a path matches the loaded ignore patterns
+func (sm *ServiceManager) isIgnored(path string) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.ignoreRules.Match(path)
+}
+
+// ReconcileIgnoreRules reloads the ignore files, removes services for scripts that
+// are now ignored, and adds valid scripts that are no longer ignored
+func (sm *ServiceManager) ReconcileIgnoreRules() {
+	sm.loadIgnoreRules()
+
+	sm.mutex.RLock()
+	var ignoredScripts []string
+	tracked := make(map[string]bool, len(sm.scriptToService))
+	for scriptPath := range sm.scriptToService {
+		tracked[scriptPath] = true
+		if sm.ignoreRules.Match(scriptPath) {
+			ignoredScripts = append(ignoredScripts, scriptPath)
+		}
+	}
+	sm.mutex.RUnlock()
+
+	for _, scriptPath := range ignoredScripts {
+		sm.logger.Info().
+			Str("script", scriptPath).
+			Msg("Script is now ignored - removing service")
+
+		if err := sm.RemoveService(scriptPath); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", scriptPath).
+				Msg("Failed to remove service for ignored script")
+		}
+	}
+
+	err := filepath.Walk(sm.scriptsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip files we can't access
+		}
+
+		if sm.isIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() && sm.exceedsDiscoveryDepth(path) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || tracked[path] {
+			return nil
+		}
+
+		definition, err := sm.validateAndLoad(path)
+		if err != nil {
+			return nil
+		}
+
+		sm.logger.Info().
+			Str("script", path).
+			Msg("Script is no longer ignored - adding service")
+
+		if err := sm.addLoadedService(path, definition); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", path).
+				Msg("Failed to add service for unignored script")
+		}
+		return nil
+	})
+
+	if err != nil {
+		sm.logger.Error().
+			Err(err).
+			Msg("Failed to reconcile ignore rules")
+	}
+}
+
+// reconcileDirectory brings the services for one directory's scripts in line with
+// the files there: services whose scripts vanished are removed and valid scripts
+// not loaded yet are added. Renames leave both to be found here.
+func (sm *ServiceManager) reconcileDirectory(dir string) {
+	sm.mutex.RLock()
+	var vanished []string
+	tracked := make(map[string]bool)
+	for scriptPath := range sm.scriptToService {
+		if filepath.Dir(scriptPath) != dir {
+			continue
+		}
+		tracked[scriptPath] = true
+		if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
+			vanished = append(vanished, scriptPath)
+		}
+	}
+	sm.mutex.RUnlock()
+
+	for _, scriptPath := range vanished {
+		sm.logger.Info().
+			Str("script", scriptPath).
+			Msg("Script is gone - removing service")
+
+		if err := sm.RemoveService(scriptPath); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", scriptPath).
+				Msg("Failed to remove service for vanished script")
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			sm.logger.Error().
+				Err(err).
+				Str("path", dir).
+				Msg("Failed to rescan scripts directory")
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || tracked[path] || sm.isIgnored(path) {
+			continue
+		}
+
+		definition, err := sm.validateAndLoad(path)
+		if err != nil {
+			continue
+		}
+
+		sm.logger.Info().
+			Str("script", path).
+			Msg("Script appeared - adding service")
+
+		if err := sm.addLoadedService(path, definition); err != nil {
+			sm.logger.Error().
+				Err(err).
+				Str("script", path).
+				Msg("Failed to add service for appeared script")
+		}
+	}
+}
+
+// permissionPollingEnabled decides whether to run the permission poller. In "auto"
+// mode it is skipped on macOS and the BSDs, where kqueue reports chmod events.
+func permissionPollingEnabled(mode, goos string) bool {
+	switch mode {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+
+	switch goos {
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		return false
+	default:
+		return true
+	}
+}
+
 // watchPermissionChanges monitors file executable status changes to detect
 // when scripts become executable (for Linux where fsnotify doesn't support chmod events)
 func (sm *ServiceManager) watchPermissionChanges(ctx context.Context) {
@@ -605,18 +1667,21 @@ func (sm *ServiceManager) checkExecutableStatusChanges() {
 			return nil // Skip files we can't access
 		}
 
-		// Skip directories
+		// Skip directories, and don't descend below max_discovery_depth
 		if info.IsDir() {
+			if sm.exceedsDiscoveryDepth(path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
 		// Check if this is a script file
-		if !strings.HasSuffix(path, ".sh") {
+		if !sm.isScriptName(path) || sm.isIgnored(path) {
 			return nil
 		}
 
 		// Check current executable status
-		isExecutable := info.Mode()&0111 != 0
+		isExecutable := sm.runnable(info)
 
 		sm.mutex.Lock()
 		previousStatus, existed := sm.fileExecutableStatus[path]
@@ -629,7 +1694,16 @@ func (sm *ServiceManager) checkExecutableStatusChanges() {
 				Str("script", path).
 				Msg("Script became executable - adding service")
 
-			if err := sm.AddService(path); err != nil {
+			// Checked like any discovered script, so size and owner limits still hold
+			definition, err := sm.validateAndLoad(path)
+			if err != nil {
+				sm.logger.Warn().
+					Err(err).
+					Str("script", path).
+					Msg("Newly executable script is not a valid service script")
+				return nil
+			}
+			if err := sm.addLoadedService(path, definition); err != nil {
 				sm.logger.Error().
 					Err(err).
 					Str("script", path).
@@ -1,15 +1,27 @@
 package supervisor
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/hiway/natshd/internal/config"
 	"github.com/hiway/natshd/internal/logging"
 	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/thejerf/suture/v4"
 )
 
 func TestNewManager(t *testing.T) {
@@ -165,6 +177,73 @@ echo "hardware response"
 	}
 }
 
+func TestManager_GroupVersionPolicyRejectsIncompatibleScripts(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.GroupVersionPolicy = "major"
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	scripts := map[string]string{
+		"facts_v1.sh": `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SystemService", "version": "1.2.0", "endpoints": [{"name": "Facts", "subject": "system.facts"}]}'
+  exit 0
+fi
+`,
+		"hardware_v1.sh": `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SystemService", "version": "1.4.0", "endpoints": [{"name": "Hardware", "subject": "system.hardware"}]}'
+  exit 0
+fi
+`,
+		"disk_v2.sh": `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SystemService", "version": "2.0.0", "endpoints": [{"name": "Disk", "subject": "system.disk"}]}'
+  exit 0
+fi
+`,
+	}
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to create script %s: %v", name, err)
+		}
+	}
+
+	if err := manager.AddService(filepath.Join(tempDir, "facts_v1.sh")); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	if err := manager.AddService(filepath.Join(tempDir, "hardware_v1.sh")); err != nil {
+		t.Errorf("Expected same-major script to be grouped, got: %v", err)
+	}
+
+	err := manager.AddService(filepath.Join(tempDir, "disk_v2.sh"))
+	if err == nil || !strings.Contains(err.Error(), "incompatible") {
+		t.Errorf("Expected incompatible version error, got: %v", err)
+	}
+
+	if _, exists := manager.scriptToService[filepath.Join(tempDir, "disk_v2.sh")]; exists {
+		t.Error("Expected incompatible script not to be tracked")
+	}
+
+	managedService := manager.services["SystemService"]
+	if len(managedService.scripts) != 2 {
+		t.Errorf("Expected 2 grouped scripts, got %d", len(managedService.scripts))
+	}
+
+	for _, endpoint := range managedService.definition.Endpoints {
+		if endpoint.Name == "Disk" {
+			t.Error("Expected endpoint from the incompatible script not to be merged")
+		}
+	}
+	if len(managedService.definition.Endpoints) != 2 {
+		t.Errorf("Expected 2 endpoints, got %d", len(managedService.definition.Endpoints))
+	}
+}
+
 func TestManager_Start(t *testing.T) {
 	// Create temporary directory for test scripts
 	tempDir := t.TempDir()
@@ -216,6 +295,62 @@ echo "test response"
 	}
 }
 
+func TestManager_StartWaitsForServicesToDeregister(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := runTestNATSServer(t)
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<EOF
+{
+  "name": "TestService",
+  "version": "1.0.0",
+  "endpoints": [
+    {
+      "name": "TestEndpoint",
+      "subject": "test.endpoint"
+    }
+  ]
+}
+EOF
+  exit 0
+fi
+echo "test response"
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.Start(ctx)
+	}()
+
+	waitForService(t, natsConn, "TestService")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("Start did not return after context cancellation")
+	}
+
+	// The connection is still open, so any lingering registration would still answer
+	if !natsConn.IsConnected() {
+		t.Fatal("Expected NATS connection to remain open after Start returns")
+	}
+
+	_, err := natsConn.Request("$SRV.PING.TestService", nil, 200*time.Millisecond)
+	if err == nil {
+		t.Error("Expected service to be deregistered before Start returned")
+	}
+}
+
 func TestManager_RestartServiceWithGracefulShutdown(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := logging.SetupLogger("info")
@@ -315,7 +450,7 @@ echo "test response"
 	}
 
 	// Test that multiple rapid events within debounce period create only one tracker
-	initialTrackerCount := len(manager.debounceTracker)
+	initialTrackerCount := manager.pendingFileEvents()
 
 	// Simulate rapid file events
 	for i := 0; i < 5; i++ {
@@ -324,7 +459,7 @@ echo "test response"
 	}
 
 	// Check that only one tracker was created
-	trackerCount := len(manager.debounceTracker)
+	trackerCount := manager.pendingFileEvents()
 	if trackerCount != initialTrackerCount+1 {
 		t.Errorf("Expected %d trackers, got %d", initialTrackerCount+1, trackerCount)
 	}
@@ -333,12 +468,158 @@ echo "test response"
 	time.Sleep(550 * time.Millisecond)
 
 	// Tracker should be cleaned up after execution
-	finalTrackerCount := len(manager.debounceTracker)
+	finalTrackerCount := manager.pendingFileEvents()
 	if finalTrackerCount != initialTrackerCount {
 		t.Errorf("Expected %d trackers after cleanup, got %d", initialTrackerCount, finalTrackerCount)
 	}
 }
 
+func TestManager_FileEventConcurrencyIsBounded(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.MaxFileEventWorkers = 2
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	manager.debounceInterval = 10 * time.Millisecond
+
+	var running, maxRunning, processed int32
+	manager.fileEventHandler = func(filePath, eventType string, coalesced int) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			previous := atomic.LoadInt32(&maxRunning)
+			if current <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, current) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&processed, 1)
+	}
+
+	// Simulate an event storm across many distinct files
+	const fileCount = 10
+	for i := 0; i < fileCount; i++ {
+		manager.handleFileEventDebounced(filepath.Join(tempDir, fmt.Sprintf("script-%d.sh", i)), "write")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&processed) < fileCount && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&processed); got != fileCount {
+		t.Fatalf("Expected %d events to be processed, got %d", fileCount, got)
+	}
+
+	if got := atomic.LoadInt32(&maxRunning); got > 2 {
+		t.Errorf("Expected at most 2 concurrent file event actions, got %d", got)
+	}
+}
+
+func TestManager_RestartsAreThrottled(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.MaxFileEventWorkers = 8
+	cfg.MaxConcurrentRestarts = 2
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	manager.debounceInterval = 10 * time.Millisecond
+
+	const scriptCount = 8
+	scriptPaths := make([]string, scriptCount)
+	for i := range scriptPaths {
+		scriptPaths[i] = filepath.Join(tempDir, fmt.Sprintf("service-%d.sh", i))
+		scriptContent := fmt.Sprintf(`#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "Service%d", "endpoints": [{"name": "Run", "subject": "service%d.run"}]}'
+  exit 0
+fi
+`, i, i)
+		if err := os.WriteFile(scriptPaths[i], []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+		if err := manager.AddService(scriptPaths[i]); err != nil {
+			t.Fatalf("AddService failed: %v", err)
+		}
+	}
+
+	var running, maxRunning, restarted int32
+	manager.restartHandler = func(scriptPath string) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			previous := atomic.LoadInt32(&maxRunning)
+			if current <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&restarted, 1)
+		return nil
+	}
+
+	// A deploy edits every script at once
+	for _, scriptPath := range scriptPaths {
+		manager.handleFileEventDebounced(scriptPath, "write")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&restarted) < scriptCount && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&restarted); got != scriptCount {
+		t.Fatalf("Expected %d restarts, got %d", scriptCount, got)
+	}
+	if got := atomic.LoadInt32(&maxRunning); got != 2 {
+		t.Errorf("Expected restarts to run 2 at a time, got at most %d", got)
+	}
+}
+
+func TestManager_FileEventDebounceLogsCoalescedCount(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuf syncBuffer
+	logger := newTestLogger(t, &logBuf, zerolog.DebugLevel)
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 50 * time.Millisecond
+
+	// The file doesn't exist, so the action only logs and attempts a no-op removal
+	scriptPath := filepath.Join(tempDir, "missing.sh")
+	for i := 0; i < 4; i++ {
+		manager.handleFileEventDebounced(scriptPath, "write")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logBuf.String(), "Executing debounced file event action") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var entry map[string]interface{}
+	for _, line := range strings.Split(logBuf.String(), "\n") {
+		if strings.Contains(line, "Executing debounced file event action") {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("Failed to parse log line: %v", err)
+			}
+			break
+		}
+	}
+
+	if entry == nil {
+		t.Fatal("Expected debounced action to be logged")
+	}
+
+	if entry["coalesced_events"] != float64(4) {
+		t.Errorf("Expected 4 coalesced events, got %v", entry["coalesced_events"])
+	}
+}
+
 func TestManager_DiscoverServices(t *testing.T) {
 	// Create temporary directory for test scripts
 	tempDir := t.TempDir()
@@ -428,138 +709,937 @@ echo "not executable"
 	}
 }
 
-func TestManager_AddService(t *testing.T) {
-	tempDir := t.TempDir()
+func TestManager_DiscoveryReusesValidatedDefinition(t *testing.T) {
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
 
-	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
-
-	scriptPath := filepath.Join(tempDir, "test.sh")
-	scriptContent := `#!/usr/bin/env bash
+	// countInfoProbes loads a script that records each info run, and returns how
+	// many times info ran
+	countInfoProbes := func(load func(*ServiceManager, string) error) int {
+		tempDir := t.TempDir()
+		probeLog := filepath.Join(t.TempDir(), "probes")
+		scriptPath := filepath.Join(tempDir, "test.sh")
+		scriptContent := `#!/usr/bin/env bash
 if [[ "$1" == "info" ]]; then
-  cat <<EOF
-{
-  "name": "TestService",
-  "version": "1.0.0",
-  "description": "A test service",
-  "endpoints": [
-    {
-      "name": "TestEndpoint",
-      "subject": "test.endpoint"
-    }
-  ]
-}
-EOF
+  echo probe >> "` + probeLog + `"
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
   exit 0
 fi
-echo "test response"
 `
-	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-	if err != nil {
-		t.Fatalf("Failed to create test script: %v", err)
-	}
+		if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
 
-	err = manager.AddService(scriptPath)
-	if err != nil {
-		t.Fatalf("AddService failed: %v", err)
-	}
+		manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+		if err := load(manager, scriptPath); err != nil {
+			t.Fatalf("Failed to load script: %v", err)
+		}
+		if _, exists := manager.services["TestService"]; !exists {
+			t.Fatal("Expected TestService to be registered")
+		}
 
-	// Check that service was added (services are now tracked by name, not path)
-	if _, exists := manager.services["TestService"]; !exists {
-		t.Error("Expected service to be added to services map")
+		data, err := os.ReadFile(probeLog)
+		if err != nil {
+			t.Fatalf("Failed to read probe log: %v", err)
+		}
+		return strings.Count(string(data), "probe")
 	}
 
-	// Check that service token was stored (tokens are now tracked by service name)
-	if _, exists := manager.serviceTokens["TestService"]; !exists {
-		t.Error("Expected service token to be stored")
+	added := countInfoProbes(func(m *ServiceManager, path string) error {
+		return m.AddService(path)
+	})
+	discovered := countInfoProbes(func(m *ServiceManager, _ string) error {
+		return m.DiscoverServices()
+	})
+
+	// The definition probed to validate or name the script is the one the
+	// service is initialized with, so a script's info runs once
+	if added != 1 {
+		t.Errorf("Expected AddService to run info once, got %d", added)
 	}
-
-	// Check that script-to-service mapping was created
-	if serviceName, exists := manager.scriptToService[scriptPath]; !exists || serviceName != "TestService" {
-		t.Error("Expected script-to-service mapping to be created")
+	if discovered != 1 {
+		t.Errorf("Expected discovery to run info once, got %d", discovered)
 	}
 }
 
-func TestManager_RemoveService(t *testing.T) {
+func TestManager_StrictGroupingRefusesCollidingScript(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.StrictGrouping = true
 
-	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
-
-	scriptPath := filepath.Join(tempDir, "test.sh")
+	manager := NewManager(tempDir, natsConn, logger, cfg)
 
-	// Create and add a service first
-	scriptContent := `#!/usr/bin/env bash
+	scriptContent := func(endpoint string) string {
+		return `#!/usr/bin/env bash
 if [[ "$1" == "info" ]]; then
-  cat <<EOF
-{
-  "name": "TestService",
-  "version": "1.0.0",
-  "description": "A test service",
-  "endpoints": [
-    {
-      "name": "TestEndpoint",
-      "subject": "test.endpoint"
-    }
-  ]
-}
-EOF
+  echo '{"name": "SharedService", "version": "1.0.0", "endpoints": [{"name": "` + endpoint + `", "subject": "shared.get"}]}'
   exit 0
 fi
-echo "test response"
 `
-	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-	if err != nil {
+	}
+	firstPath := filepath.Join(tempDir, "a.sh")
+	secondPath := filepath.Join(tempDir, "b.sh")
+	if err := os.WriteFile(firstPath, []byte(scriptContent("GetA")), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	if err := os.WriteFile(secondPath, []byte(scriptContent("GetB")), 0755); err != nil {
 		t.Fatalf("Failed to create test script: %v", err)
 	}
 
-	err = manager.AddService(scriptPath)
-	if err != nil {
+	if err := manager.AddService(firstPath); err != nil {
 		t.Fatalf("AddService failed: %v", err)
 	}
-
-	// Verify service was added (services are now tracked by name, not path)
-	if _, exists := manager.services["TestService"]; !exists {
-		t.Fatal("Service was not added")
+	if err := manager.AddService(secondPath); err == nil {
+		t.Fatal("Expected the colliding script to be refused")
 	}
 
-	// Remove the service
-	err = manager.RemoveService(scriptPath)
-	if err != nil {
-		t.Fatalf("RemoveService failed: %v", err)
+	// The refused script is not left behind in the group
+	if _, tracked := manager.scriptToService[secondPath]; tracked {
+		t.Error("Expected the refused script not to be tracked")
 	}
+	managedService := manager.services["SharedService"]
+	if scripts := managedService.scriptRunners(); len(scripts) != 1 {
+		t.Errorf("Expected 1 script in the service, got %d", len(scripts))
+	}
+	if route, ok := managedService.route(cfg.PrefixSubject("shared.get")); !ok || route.scriptPath != firstPath {
+		t.Errorf("Expected shared.get to stay with %s, got %q", firstPath, route.scriptPath)
+	}
+}
 
-	// Check that service was removed (since this was the only script, the service should be removed)
-	if _, exists := manager.services["TestService"]; exists {
-		t.Error("Expected service to be removed from services map")
+func TestManager_RestartWarnsWhenInfoChangesWithoutModification(t *testing.T) {
+	tests := []struct {
+		name         string
+		modifyScript bool
+		expectWarn   bool
+	}{
+		{name: "flip-flopping script", modifyScript: false, expectWarn: true},
+		{name: "edited script", modifyScript: true, expectWarn: false},
 	}
 
-	// Check that script-to-service mapping was removed
-	if _, exists := manager.scriptToService[scriptPath]; exists {
-		t.Error("Expected script-to-service mapping to be removed")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			var logBuffer bytes.Buffer
+			logger := logging.SetupLoggerWithWriter(&logBuffer, "info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.InfoConsistencyCheck = true
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			// The advertised subject depends on state outside the script file
+			modePath := filepath.Join(tempDir, "mode")
+			scriptPath := filepath.Join(tempDir, "flaky.sh")
+			scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  mode=$(cat "` + modePath + `")
+  echo '{"name": "FlakyService", "version": "1.0.0", "endpoints": [{"name": "Get", "subject": "flaky.'"$mode"'"}]}'
+  exit 0
+fi
+`
+			if err := os.WriteFile(modePath, []byte("a"), 0644); err != nil {
+				t.Fatalf("Failed to write mode file: %v", err)
+			}
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			if err := manager.AddService(scriptPath); err != nil {
+				t.Fatalf("AddService failed: %v", err)
+			}
+
+			if err := os.WriteFile(modePath, []byte("b"), 0644); err != nil {
+				t.Fatalf("Failed to write mode file: %v", err)
+			}
+			if tt.modifyScript {
+				later := time.Now().Add(time.Minute)
+				if err := os.Chtimes(scriptPath, later, later); err != nil {
+					t.Fatalf("Failed to touch script: %v", err)
+				}
+			}
+
+			logBuffer.Reset()
+			if err := manager.RestartServiceGracefully(scriptPath); err != nil {
+				t.Fatalf("RestartServiceGracefully failed: %v", err)
+			}
+
+			warned := strings.Contains(logBuffer.String(), "changed between probes without a file modification")
+			if warned != tt.expectWarn {
+				t.Errorf("Expected inconsistency warning=%v, got logs: %s", tt.expectWarn, logBuffer.String())
+			}
+			if warned && !strings.Contains(logBuffer.String(), "flaky.b") {
+				t.Errorf("Expected warning to name the new subject, got logs: %s", logBuffer.String())
+			}
+		})
 	}
 }
 
-func TestManager_RestartService(t *testing.T) {
+func TestManager_DisabledServicesAreNotRegistered(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
 
-	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
-
-	scriptPath := filepath.Join(tempDir, "test.sh")
+	cfg := config.DefaultConfig()
+	cfg.DisabledServices = []string{"LegacyService"}
+	manager := NewManager(tempDir, natsConn, logger, cfg)
 
-	// Create and add a service first
-	scriptContent := `#!/usr/bin/env bash
+	scripts := map[string]string{
+		"greeting.sh": "GreetingService",
+		"legacy.sh":   "LegacyService",
+	}
+	for fileName, serviceName := range scripts {
+		scriptContent := `#!/usr/bin/env bash
 if [[ "$1" == "info" ]]; then
-  cat <<EOF
-{
-  "name": "TestService",
-  "version": "1.0.0",
-  "description": "A test service",
-  "endpoints": [
+  echo '{"name": "` + serviceName + `", "version": "1.0.0", "endpoints": [{"name": "Run", "subject": "` + fileName + `.run"}]}'
+  exit 0
+fi
+`
+		if err := os.WriteFile(filepath.Join(tempDir, fileName), []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+	}
+
+	if err := manager.DiscoverServices(); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+
+	if _, exists := manager.services["GreetingService"]; !exists {
+		t.Error("Expected GreetingService to be registered")
+	}
+	if _, exists := manager.services["LegacyService"]; exists {
+		t.Error("Expected disabled LegacyService not to be registered")
+	}
+	if _, tracked := manager.scriptToService[filepath.Join(tempDir, "legacy.sh")]; tracked {
+		t.Error("Expected the disabled service's script not to be tracked")
+	}
+}
+
+func TestManager_SameScriptInTwoDirectoriesRegistersOnce(t *testing.T) {
+	tempDir := t.TempDir()
+	var logOutput syncBuffer
+	logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	primaryDir := filepath.Join(tempDir, "a-primary")
+	secondaryDir := filepath.Join(tempDir, "b-secondary")
+	for _, dir := range []string{primaryDir, secondaryDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	primaryPath := filepath.Join(primaryDir, "greeting.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "GreetingService", "version": "1.0.0", "endpoints": [{"name": "Hello", "subject": "greeting.hello"}]}'
+  exit 0
+fi
+`
+	if err := os.WriteFile(primaryPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	secondaryPath := filepath.Join(secondaryDir, "greeting.sh")
+	if err := os.Symlink(primaryPath, secondaryPath); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := manager.DiscoverServices(); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+
+	if len(manager.scriptToService) != 1 {
+		t.Fatalf("Expected 1 tracked script, got %d: %v", len(manager.scriptToService), manager.scriptToService)
+	}
+	if _, tracked := manager.scriptToService[primaryPath]; !tracked {
+		t.Errorf("Expected the earlier path %s to win, got %v", primaryPath, manager.scriptToService)
+	}
+	if scripts := manager.services["GreetingService"].scriptRunners(); len(scripts) != 1 {
+		t.Errorf("Expected GreetingService to have 1 script, got %d", len(scripts))
+	}
+	if !strings.Contains(logOutput.String(), "Skipping script that is the same file as an already loaded script") {
+		t.Errorf("Expected a duplicate warning, got: %s", logOutput.String())
+	}
+}
+
+func TestManager_RequiredServices(t *testing.T) {
+	tests := []struct {
+		name          string
+		required      []string
+		policy        string
+		expectError   bool
+		expectHealthy bool
+	}{
+		{name: "all required present", required: []string{"GreetingService"}, policy: "fail", expectHealthy: true},
+		{name: "missing fails startup", required: []string{"GreetingService", "SystemService"}, policy: "fail", expectError: true},
+		{name: "missing marks unhealthy", required: []string{"SystemService"}, policy: "unhealthy", expectHealthy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.RequiredServices = tt.required
+			cfg.RequiredServicesPolicy = tt.policy
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "GreetingService", "version": "1.0.0", "endpoints": [{"name": "Hello", "subject": "greeting.hello"}]}'
+  exit 0
+fi
+`
+			if err := os.WriteFile(filepath.Join(tempDir, "greeting.sh"), []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			if tt.expectError {
+				// Startup fails right after discovery, before anything is served
+				err := manager.Start(context.Background())
+				if err == nil || !strings.Contains(err.Error(), "SystemService") {
+					t.Fatalf("Expected startup to fail naming SystemService, got %v", err)
+				}
+				if strings.Contains(err.Error(), "GreetingService") {
+					t.Errorf("Expected only missing services in the error, got %v", err)
+				}
+				return
+			}
+
+			if err := manager.DiscoverServices(); err != nil {
+				t.Fatalf("DiscoverServices failed: %v", err)
+			}
+			if err := manager.checkRequiredServices(); err != nil {
+				t.Fatalf("Expected startup to continue, got %v", err)
+			}
+			if manager.Healthy() != tt.expectHealthy {
+				t.Errorf("Expected healthy=%v, got %v (missing %v)", tt.expectHealthy, manager.Healthy(), manager.MissingServices())
+			}
+			if summary := manager.StartupSummary(); summary.Healthy != tt.expectHealthy {
+				t.Errorf("Expected startup summary healthy=%v, got %v", tt.expectHealthy, summary.Healthy)
+			}
+		})
+	}
+}
+
+func TestManager_DiscoverServicesHonorsMaxDepth(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.MaxDiscoveryDepth = 2
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// One script per level: scripts_path, then a, a/b, and a/b/c below it
+	levels := map[string]string{
+		"root":  tempDir,
+		"one":   filepath.Join(tempDir, "a"),
+		"two":   filepath.Join(tempDir, "a", "b"),
+		"three": filepath.Join(tempDir, "a", "b", "c"),
+	}
+	for name, dir := range levels {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "` + name + `Service", "version": "1.0.0", "endpoints": [{"name": "Handle", "subject": "` + name + `.handle"}]}'
+  exit 0
+fi
+`
+		if err := os.WriteFile(filepath.Join(dir, name+".sh"), []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+	}
+
+	if err := manager.DiscoverServices(); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+
+	tests := []struct {
+		service  string
+		expected bool
+	}{
+		{"rootService", true},
+		{"oneService", true},
+		{"twoService", false},
+		{"threeService", false},
+	}
+	for _, tt := range tests {
+		if _, exists := manager.services[tt.service]; exists != tt.expected {
+			t.Errorf("Expected %s registered=%v, got %v", tt.service, tt.expected, exists)
+		}
+	}
+}
+
+func TestManager_ExecutableExtensions(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		expected   map[string]bool
+	}{
+		{
+			name:       "shell scripts by default",
+			extensions: nil,
+			expected:   map[string]bool{"ShellService": true, "PythonService": false, "BinaryService": false},
+		},
+		{
+			name:       "listed extensions",
+			extensions: []string{".sh", ".py"},
+			expected:   map[string]bool{"ShellService": true, "PythonService": true, "BinaryService": false},
+		},
+		{
+			name:       "any executable",
+			extensions: []string{""},
+			expected:   map[string]bool{"ShellService": true, "PythonService": true, "BinaryService": true},
+		},
+	}
+
+	files := map[string]string{
+		"shell.sh":  "ShellService",
+		"python.py": "PythonService",
+		"binary":    "BinaryService",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			if tt.extensions != nil {
+				cfg.ExecutableExtensions = tt.extensions
+			}
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			for fileName, serviceName := range files {
+				scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "` + serviceName + `", "endpoints": [{"name": "Run", "subject": "` + strings.ToLower(serviceName) + `.run"}]}'
+  exit 0
+fi
+`
+				if err := os.WriteFile(filepath.Join(tempDir, fileName), []byte(scriptContent), 0755); err != nil {
+					t.Fatalf("Failed to create test script: %v", err)
+				}
+			}
+
+			if err := manager.DiscoverServices(); err != nil {
+				t.Fatalf("DiscoverServices failed: %v", err)
+			}
+			for serviceName, expected := range tt.expected {
+				if _, exists := manager.services[serviceName]; exists != expected {
+					t.Errorf("Expected %s registered=%v after discovery, got %v", serviceName, expected, exists)
+				}
+			}
+
+			// The file watcher uses the same filter: a fresh manager sees creates
+			watched := NewManager(tempDir, natsConn, logger, cfg)
+			watched.debounceInterval = 10 * time.Millisecond
+			for fileName := range files {
+				watched.handleFileEvent(fsnotify.Event{Name: filepath.Join(tempDir, fileName), Op: fsnotify.Create})
+			}
+			waitForFileEvents(t, watched)
+			for serviceName, expected := range tt.expected {
+				if _, exists := watched.services[serviceName]; exists != expected {
+					t.Errorf("Expected %s registered=%v after create event, got %v", serviceName, expected, exists)
+				}
+			}
+		})
+	}
+}
+
+// waitForFileEvents waits until every debounced file event action has run
+func waitForFileEvents(t *testing.T, manager *ServiceManager) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if manager.pendingFileEvents() == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for debounced file events")
+}
+
+func TestManager_IncludeExcludeGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected map[string]bool
+	}{
+		{
+			name:     "shell scripts by default",
+			expected: map[string]bool{"GreetingService": true, "CommonService": true, "ToolService": false},
+		},
+		{
+			name:     "helper libraries excluded",
+			exclude:  []string{"_*.sh"},
+			expected: map[string]bool{"GreetingService": true, "CommonService": false, "ToolService": false},
+		},
+		{
+			name:     "include replaces the default",
+			include:  []string{"*.sh", "*.py"},
+			exclude:  []string{"_*"},
+			expected: map[string]bool{"GreetingService": true, "CommonService": false, "ToolService": true},
+		},
+	}
+
+	files := map[string]string{
+		"greeting.sh": "GreetingService",
+		"_common.sh":  "CommonService",
+		"tool.py":     "ToolService",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			probedDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.IncludeGlobs = tt.include
+			cfg.ExcludeGlobs = tt.exclude
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			// Each script records that it was probed with info
+			for fileName, serviceName := range files {
+				scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  touch "` + filepath.Join(probedDir, serviceName) + `"
+  echo '{"name": "` + serviceName + `", "endpoints": [{"name": "Run", "subject": "` + strings.ToLower(serviceName) + `.run"}]}'
+  exit 0
+fi
+`
+				if err := os.WriteFile(filepath.Join(tempDir, fileName), []byte(scriptContent), 0755); err != nil {
+					t.Fatalf("Failed to create test script: %v", err)
+				}
+			}
+
+			if err := manager.DiscoverServices(); err != nil {
+				t.Fatalf("DiscoverServices failed: %v", err)
+			}
+
+			// The file watcher and permission poller use the same filter
+			watched := NewManager(tempDir, natsConn, logger, cfg)
+			watched.debounceInterval = 10 * time.Millisecond
+			for fileName := range files {
+				watched.handleFileEvent(fsnotify.Event{Name: filepath.Join(tempDir, fileName), Op: fsnotify.Create})
+			}
+			waitForFileEvents(t, watched)
+			manager.checkExecutableStatusChanges()
+
+			for serviceName, expected := range tt.expected {
+				if _, exists := manager.services[serviceName]; exists != expected {
+					t.Errorf("Expected %s registered=%v after discovery, got %v", serviceName, expected, exists)
+				}
+				if _, exists := watched.services[serviceName]; exists != expected {
+					t.Errorf("Expected %s registered=%v after create event, got %v", serviceName, expected, exists)
+				}
+				if _, err := os.Stat(filepath.Join(probedDir, serviceName)); (err == nil) != expected {
+					t.Errorf("Expected %s probed=%v, got %v", serviceName, expected, err == nil)
+				}
+			}
+
+			for fileName, serviceName := range files {
+				_, polled := manager.fileExecutableStatus[filepath.Join(tempDir, fileName)]
+				if polled != tt.expected[serviceName] {
+					t.Errorf("Expected %s polled=%v, got %v", fileName, tt.expected[serviceName], polled)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_DiscoverServicesHonorsIgnoreFile(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 20 * time.Millisecond
+
+	for _, name := range []string{"greeting", "draft"} {
+		scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "` + name + `Service", "version": "1.0.0", "endpoints": [{"name": "Handle", "subject": "` + name + `.handle"}]}'
+  exit 0
+fi
+`
+		if err := os.WriteFile(filepath.Join(tempDir, name+".sh"), []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+	}
+
+	ignorePath := filepath.Join(tempDir, IgnoreFileName)
+	if err := os.WriteFile(ignorePath, []byte("draft*.sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+
+	if err := manager.DiscoverServices(); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+
+	if _, exists := manager.services["draftService"]; exists {
+		t.Error("Expected ignored script not to be registered")
+	}
+	if _, exists := manager.services["greetingService"]; !exists {
+		t.Error("Expected non-ignored script to be registered")
+	}
+
+	// Changing the ignore file reconciles: greeting is now ignored, draft is not
+	if err := os.WriteFile(ignorePath, []byte("greeting.sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: ignorePath, Op: fsnotify.Write})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		manager.mutex.RLock()
+		_, hasGreeting := manager.services["greetingService"]
+		_, hasDraft := manager.services["draftService"]
+		manager.mutex.RUnlock()
+
+		if !hasGreeting && hasDraft {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected reconciliation to swap services, got greeting=%v draft=%v", hasGreeting, hasDraft)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManager_AddService(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<EOF
+{
+  "name": "TestService",
+  "version": "1.0.0",
+  "description": "A test service",
+  "endpoints": [
+    {
+      "name": "TestEndpoint",
+      "subject": "test.endpoint"
+    }
+  ]
+}
+EOF
+  exit 0
+fi
+echo "test response"
+`
+	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	err = manager.AddService(scriptPath)
+	if err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	// Check that service was added (services are now tracked by name, not path)
+	if _, exists := manager.services["TestService"]; !exists {
+		t.Error("Expected service to be added to services map")
+	}
+
+	// Check that service token was stored (tokens are now tracked by service name)
+	if _, exists := manager.serviceTokens["TestService"]; !exists {
+		t.Error("Expected service token to be stored")
+	}
+
+	// Check that script-to-service mapping was created
+	if serviceName, exists := manager.scriptToService[scriptPath]; !exists || serviceName != "TestService" {
+		t.Error("Expected script-to-service mapping to be created")
+	}
+}
+
+func TestManager_StartupSummaryCountsServicesAndEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuffer bytes.Buffer
+	logger := logging.SetupLoggerWithWriter(&logBuffer, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.Hostname = "edge1"
+	cfg.NatsURL = "nats://summary.example:4222"
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	scripts := map[string]string{
+		"users.sh":  `{"name": "UserService", "version": "1.0.0", "endpoints": [{"name": "Get", "subject": "users.get"}, {"name": "List", "subject": "users.list"}]}`,
+		"health.sh": `{"name": "HealthService", "version": "1.0.0", "endpoints": [{"name": "Ping", "subject": "health.ping"}]}`,
+	}
+	for name, info := range scripts {
+		scriptPath := filepath.Join(tempDir, name)
+		scriptContent := "#!/usr/bin/env bash\necho '" + info + "'\n"
+		if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+		if err := manager.AddService(scriptPath); err != nil {
+			t.Fatalf("AddService failed: %v", err)
+		}
+	}
+
+	logBuffer.Reset()
+	manager.emitStartupSummary()
+
+	var entry struct {
+		Action         string   `json:"action"`
+		Services       int      `json:"services"`
+		Endpoints      int      `json:"endpoints"`
+		Subjects       []string `json:"subjects"`
+		NatsURL        string   `json:"nats_url"`
+		HostnamePrefix string   `json:"hostname_prefix"`
+	}
+	if err := json.Unmarshal(logBuffer.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON summary line, got %q: %v", logBuffer.String(), err)
+	}
+
+	if entry.Action != "startup_summary" {
+		t.Errorf("Expected action startup_summary, got %q", entry.Action)
+	}
+	if entry.Services != 2 {
+		t.Errorf("Expected 2 services, got %d", entry.Services)
+	}
+	if entry.Endpoints != 3 {
+		t.Errorf("Expected 3 endpoints, got %d", entry.Endpoints)
+	}
+	expectedSubjects := []string{"edge1.health.ping", "edge1.users.get", "edge1.users.list"}
+	if strings.Join(entry.Subjects, ",") != strings.Join(expectedSubjects, ",") {
+		t.Errorf("Expected subjects %v, got %v", expectedSubjects, entry.Subjects)
+	}
+	if entry.NatsURL != cfg.NatsURL {
+		t.Errorf("Expected nats_url %q, got %q", cfg.NatsURL, entry.NatsURL)
+	}
+	if entry.HostnamePrefix != "edge1" {
+		t.Errorf("Expected hostname_prefix edge1, got %q", entry.HostnamePrefix)
+	}
+}
+
+func TestManager_AddServiceRunsScriptInit(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	markerPath := filepath.Join(tempDir, "workdir", "ready")
+	scriptPath := filepath.Join(tempDir, "cache.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "CacheService", "version": "1.0.0", "supports_init": true, "endpoints": [{"name": "Get", "subject": "cache.get"}]}'
+  exit 0
+fi
+if [[ "$1" == "init" ]]; then
+  mkdir -p "` + filepath.Dir(markerPath) + `" && touch "` + markerPath + `"
+  exit 0
+fi
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	if err := manager.AddService(scriptPath); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	// Initialize runs before the service is handed to the supervisor to serve
+	if _, err := os.Stat(markerPath); err != nil {
+		t.Errorf("Expected init to create marker file before serving: %v", err)
+	}
+
+	if _, exists := manager.services["CacheService"]; !exists {
+		t.Error("Expected service to be registered after successful init")
+	}
+}
+
+func TestManager_AddServiceFailsWhenScriptInitFails(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "broken.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "BrokenService", "version": "1.0.0", "supports_init": true, "endpoints": [{"name": "Get", "subject": "broken.get"}]}'
+  exit 0
+fi
+if [[ "$1" == "init" ]]; then
+  echo "cannot create work dir" >&2
+  exit 1
+fi
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	err := manager.AddService(scriptPath)
+	if err == nil || !strings.Contains(err.Error(), "cannot create work dir") {
+		t.Errorf("Expected init failure with stderr, got: %v", err)
+	}
+
+	if _, exists := manager.services["BrokenService"]; exists {
+		t.Error("Expected service not to be registered when init fails")
+	}
+}
+
+func TestManager_RemoveService(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+
+	// Create and add a service first
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<EOF
+{
+  "name": "TestService",
+  "version": "1.0.0",
+  "description": "A test service",
+  "endpoints": [
+    {
+      "name": "TestEndpoint",
+      "subject": "test.endpoint"
+    }
+  ]
+}
+EOF
+  exit 0
+fi
+echo "test response"
+`
+	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	err = manager.AddService(scriptPath)
+	if err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	// Verify service was added (services are now tracked by name, not path)
+	if _, exists := manager.services["TestService"]; !exists {
+		t.Fatal("Service was not added")
+	}
+
+	// Remove the service
+	err = manager.RemoveService(scriptPath)
+	if err != nil {
+		t.Fatalf("RemoveService failed: %v", err)
+	}
+
+	// Check that service was removed (since this was the only script, the service should be removed)
+	if _, exists := manager.services["TestService"]; exists {
+		t.Error("Expected service to be removed from services map")
+	}
+
+	// Check that script-to-service mapping was removed
+	if _, exists := manager.scriptToService[scriptPath]; exists {
+		t.Error("Expected script-to-service mapping to be removed")
+	}
+}
+
+func TestManager_RestartService(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+
+	// Create and add a service first
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<EOF
+{
+  "name": "TestService",
+  "version": "1.0.0",
+  "description": "A test service",
+  "endpoints": [
+    {
+      "name": "TestEndpoint",
+      "subject": "test.endpoint"
+    }
+  ]
+}
+EOF
+  exit 0
+fi
+echo "test response"
+`
+	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	err = manager.AddService(scriptPath)
+	if err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	// Get original service (services are now tracked by name, not path)
+	originalService := manager.services["TestService"]
+
+	// Restart the service
+	err = manager.RestartService(scriptPath)
+	if err != nil {
+		t.Fatalf("RestartService failed: %v", err)
+	}
+
+	// Check that the same service instance was reused (new behavior with service grouping)
+	newService := manager.services["TestService"]
+	if originalService != newService {
+		t.Error("Expected service instance to be reused after restart (service grouping behavior)")
+	}
+
+	// Verify service is still properly initialized
+	if newService.definition.Name != "TestService" {
+		t.Error("Expected service to be properly reinitialized after restart")
+	}
+}
+
+func TestManager_HandleFileEvent(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  cat <<EOF
+{
+  "name": "TestService",
+  "version": "1.0.0",
+  "description": "A test service",
+  "endpoints": [
     {
       "name": "TestEndpoint",
       "subject": "test.endpoint"
@@ -569,155 +1649,502 @@ if [[ "$1" == "info" ]]; then
 EOF
   exit 0
 fi
-echo "test response"
+echo "test response"
+`
+
+	tests := []struct {
+		name      string
+		eventType string
+		setup     func() error
+		verify    func() bool
+	}{
+		{
+			name:      "create event",
+			eventType: "create",
+			setup: func() error {
+				return os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+			},
+			verify: func() bool {
+				_, exists := manager.services["TestService"]
+				return exists
+			},
+		},
+		{
+			name:      "modify event",
+			eventType: "write",
+			setup: func() error {
+				// First create the service
+				err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+				if err != nil {
+					return err
+				}
+				err = manager.AddService(scriptPath)
+				if err != nil {
+					return err
+				}
+				// Then modify it
+				return os.WriteFile(scriptPath, []byte(scriptContent+"# modified"), 0755)
+			},
+			verify: func() bool {
+				_, exists := manager.services["TestService"]
+				return exists
+			},
+		},
+		{
+			name:      "remove event",
+			eventType: "remove",
+			setup: func() error {
+				// First create and add the service
+				err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
+				if err != nil {
+					return err
+				}
+				err = manager.AddService(scriptPath)
+				if err != nil {
+					return err
+				}
+				// Then remove the file
+				return os.Remove(scriptPath)
+			},
+			verify: func() bool {
+				_, exists := manager.services["TestService"]
+				return !exists // Should not exist after removal
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clean up services map before each test
+			manager.services = make(map[string]*ManagedService)
+			manager.scriptToService = make(map[string]string)
+
+			err := tt.setup()
+			if err != nil {
+				t.Fatalf("Setup failed: %v", err)
+			}
+
+			// Simulate file event by calling the appropriate method
+			switch tt.eventType {
+			case "create":
+				err = manager.AddService(scriptPath)
+			case "write":
+				err = manager.RestartService(scriptPath)
+			case "remove":
+				err = manager.RemoveService(scriptPath)
+			}
+
+			if err != nil {
+				t.Fatalf("HandleFileEvent failed: %v", err)
+			}
+
+			if !tt.verify() {
+				t.Errorf("Event %s did not have expected effect", tt.eventType)
+			}
+		})
+	}
+}
+
+func TestManager_RemoveThenCreateRestartsGracefully(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuf syncBuffer
+	logger := newTestLogger(t, &logBuf, zerolog.InfoLevel)
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 50 * time.Millisecond
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
+  exit 0
+fi
+echo "test response"
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	if err := manager.AddService(scriptPath); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+	originalService := manager.services["TestService"]
+
+	// Simulate an editor's atomic save: remove followed quickly by create
+	if err := os.Remove(scriptPath); err != nil {
+		t.Fatalf("Failed to remove script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Remove})
+
+	if err := os.WriteFile(scriptPath, []byte(scriptContent+"# saved\n"), 0755); err != nil {
+		t.Fatalf("Failed to recreate script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Create})
+
+	// The service must never have been removed in between
+	manager.mutex.RLock()
+	_, stillRegistered := manager.services["TestService"]
+	manager.mutex.RUnlock()
+	if !stillRegistered {
+		t.Fatal("Expected service to remain registered while removal is deferred")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logBuf.String(), `"action":"restarted"`) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	output := logBuf.String()
+	if count := strings.Count(output, `"action":"restarted"`); count != 1 {
+		t.Errorf("Expected exactly one graceful restart, got %d", count)
+	}
+
+	if strings.Contains(output, `"action":"removed"`) {
+		t.Error("Expected no removal for a remove+create of the same script")
+	}
+
+	manager.mutex.RLock()
+	currentService := manager.services["TestService"]
+	manager.mutex.RUnlock()
+	if currentService != originalService {
+		t.Error("Expected the existing service to be restarted rather than recreated")
+	}
+}
+
+func TestManager_RenameFollowsScript(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 50 * time.Millisecond
+
+	oldPath := filepath.Join(tempDir, "old.sh")
+	newPath := filepath.Join(tempDir, "new.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
+  exit 0
+fi
+echo "test response"
+`
+	if err := os.WriteFile(oldPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	if err := manager.AddService(oldPath); err != nil {
+		t.Fatalf("AddService failed: %v", err)
+	}
+
+	// Only the rename of the old name is reported, with no Create for the new one
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("Failed to rename script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: oldPath, Op: fsnotify.Rename})
+
+	followed := func() bool {
+		manager.mutex.RLock()
+		defer manager.mutex.RUnlock()
+		_, hasOld := manager.scriptToService[oldPath]
+		_, hasNew := manager.scriptToService[newPath]
+		return !hasOld && hasNew
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !followed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !followed() {
+		t.Fatal("Expected the service to follow the script to its new name")
+	}
+
+	manager.mutex.RLock()
+	serviceName := manager.scriptToService[newPath]
+	_, registered := manager.services["TestService"]
+	manager.mutex.RUnlock()
+	if serviceName != "TestService" {
+		t.Errorf("Expected script to belong to TestService, got %s", serviceName)
+	}
+	if !registered {
+		t.Error("Expected TestService to be registered after the rename")
+	}
+}
+
+func TestManager_CreateThenWriteBurstProbesOnce(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuf syncBuffer
+	logger := newTestLogger(t, &logBuf, zerolog.DebugLevel)
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 50 * time.Millisecond
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	chunks := []string{
+		"#!/usr/bin/env bash\n",
+		"if [[ \"$1\" == \"info\" ]]; then\n",
+		`  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'` + "\n",
+		"  exit 0\nfi\n",
+	}
+
+	// Like cp: the file is created empty, then filled in by several writes
+	if err := os.WriteFile(scriptPath, nil, 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Create})
+
+	for _, chunk := range chunks {
+		f, err := os.OpenFile(scriptPath, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open test script: %v", err)
+		}
+		if _, err := f.WriteString(chunk); err != nil {
+			t.Fatalf("Failed to write test script: %v", err)
+		}
+		f.Close()
+		manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Write})
+	}
+
+	// Nothing is probed while the file is still being written
+	manager.mutex.RLock()
+	_, registered := manager.services["TestService"]
+	manager.mutex.RUnlock()
+	if registered {
+		t.Fatal("Expected no service before the file settles")
+	}
+
+	waitForFileEvents(t, manager)
+
+	manager.mutex.RLock()
+	_, registered = manager.services["TestService"]
+	manager.mutex.RUnlock()
+	if !registered {
+		t.Fatal("Expected the service to be added once the file settled")
+	}
+
+	output := logBuf.String()
+	if count := strings.Count(output, `"action":"added"`); count != 1 {
+		t.Errorf("Expected the service to be added once, got %d", count)
+	}
+	if strings.Contains(output, `"action":"restarted"`) {
+		t.Error("Expected a new script to be added rather than restarted")
+	}
+	if !strings.Contains(output, `"event":"create","coalesced_events":5`) {
+		t.Error("Expected the create and writes to be coalesced into one create action")
+	}
+}
+
+func TestManager_DeferredRemovalWithoutRecreate(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager.debounceInterval = 20 * time.Millisecond
+
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
+  exit 0
+fi
 `
-	err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-	if err != nil {
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
 		t.Fatalf("Failed to create test script: %v", err)
 	}
 
-	err = manager.AddService(scriptPath)
-	if err != nil {
+	if err := manager.AddService(scriptPath); err != nil {
 		t.Fatalf("AddService failed: %v", err)
 	}
 
-	// Get original service (services are now tracked by name, not path)
-	originalService := manager.services["TestService"]
+	if err := os.Remove(scriptPath); err != nil {
+		t.Fatalf("Failed to remove script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Remove})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		manager.mutex.RLock()
+		_, exists := manager.services["TestService"]
+		manager.mutex.RUnlock()
+		if !exists {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected service to be removed once the debounce window passed without a recreate")
+}
 
-	// Restart the service
-	err = manager.RestartService(scriptPath)
-	if err != nil {
-		t.Fatalf("RestartService failed: %v", err)
+func TestManager_ChmodEventAddsServiceWithoutPolling(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.PermissionPolling = "off"
+
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	if manager.permissionCheckTicker != nil {
+		t.Fatal("Expected no permission poller when permission_polling is off")
 	}
 
-	// Check that the same service instance was reused (new behavior with service grouping)
-	newService := manager.services["TestService"]
-	if originalService != newService {
-		t.Error("Expected service instance to be reused after restart (service grouping behavior)")
+	scriptPath := filepath.Join(tempDir, "test.sh")
+	scriptContent := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
+  exit 0
+fi
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
 	}
 
-	// Verify service is still properly initialized
-	if newService.definition.Name != "TestService" {
-		t.Error("Expected service to be properly reinitialized after restart")
+	// Not executable yet, so the chmod event is ignored
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Chmod})
+	if _, exists := manager.services["TestService"]; exists {
+		t.Fatal("Expected non-executable script to be ignored")
+	}
+
+	if err := os.Chmod(scriptPath, 0755); err != nil {
+		t.Fatalf("Failed to chmod script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Chmod})
+	if _, exists := manager.services["TestService"]; !exists {
+		t.Fatal("Expected chmod +x event to add the service")
+	}
+
+	if err := os.Chmod(scriptPath, 0644); err != nil {
+		t.Fatalf("Failed to chmod script: %v", err)
+	}
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Chmod})
+	if _, exists := manager.services["TestService"]; exists {
+		t.Error("Expected chmod -x event to remove the service")
 	}
 }
 
-func TestManager_HandleFileEvent(t *testing.T) {
+func TestManager_CreateThenChmodAddsServicePromptly(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.PermissionPolling = "off"
 
-	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+	manager.debounceInterval = 10 * time.Millisecond
 
 	scriptPath := filepath.Join(tempDir, "test.sh")
 	scriptContent := `#!/usr/bin/env bash
 if [[ "$1" == "info" ]]; then
-  cat <<EOF
-{
-  "name": "TestService",
-  "version": "1.0.0",
-  "description": "A test service",
-  "endpoints": [
-    {
-      "name": "TestEndpoint",
-      "subject": "test.endpoint"
-    }
-  ]
-}
-EOF
+  echo '{"name": "TestService", "version": "1.0.0", "endpoints": [{"name": "TestEndpoint", "subject": "test.endpoint"}]}'
   exit 0
 fi
-echo "test response"
 `
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	// Created before it is executable, as deploy tools that chmod afterwards do
+	manager.handleFileEvent(fsnotify.Event{Name: scriptPath, Op: fsnotify.Create})
+	waitForFileEvents(t, manager)
+
+	manager.mutex.RLock()
+	executable, recorded := manager.fileExecutableStatus[scriptPath]
+	manager.mutex.RUnlock()
+	if !recorded || executable {
+		t.Fatal("Expected the created script to be recorded as not executable")
+	}
+
+	// No chmod event is delivered and polling is off, so only the pending watch can see it
+	if err := os.Chmod(scriptPath, 0755); err != nil {
+		t.Fatalf("Failed to chmod script: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Duration(cfg.PendingScriptWindowMs) * time.Millisecond)
+	for time.Now().Before(deadline) {
+		manager.mutex.RLock()
+		_, exists := manager.services["TestService"]
+		manager.mutex.RUnlock()
+		if exists {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the service to be added within the pending script window")
+}
 
+func TestManager_PermissionPollMs(t *testing.T) {
 	tests := []struct {
-		name      string
-		eventType string
-		setup     func() error
-		verify    func() bool
+		name          string
+		pollMs        int
+		expectPolling bool
 	}{
-		{
-			name:      "create event",
-			eventType: "create",
-			setup: func() error {
-				return os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-			},
-			verify: func() bool {
-				_, exists := manager.services["TestService"]
-				return exists
-			},
-		},
-		{
-			name:      "modify event",
-			eventType: "write",
-			setup: func() error {
-				// First create the service
-				err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-				if err != nil {
-					return err
-				}
-				err = manager.AddService(scriptPath)
-				if err != nil {
-					return err
-				}
-				// Then modify it
-				return os.WriteFile(scriptPath, []byte(scriptContent+"# modified"), 0755)
-			},
-			verify: func() bool {
-				_, exists := manager.services["TestService"]
-				return exists
-			},
-		},
-		{
-			name:      "remove event",
-			eventType: "remove",
-			setup: func() error {
-				// First create and add the service
-				err := os.WriteFile(scriptPath, []byte(scriptContent), 0755)
-				if err != nil {
-					return err
-				}
-				err = manager.AddService(scriptPath)
-				if err != nil {
-					return err
-				}
-				// Then remove the file
-				return os.Remove(scriptPath)
-			},
-			verify: func() bool {
-				_, exists := manager.services["TestService"]
-				return !exists // Should not exist after removal
-			},
-		},
+		{name: "disabled", pollMs: 0, expectPolling: false},
+		{name: "enabled", pollMs: 50, expectPolling: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Clean up services map before each test
-			manager.services = make(map[string]*ManagedService)
-			manager.scriptToService = make(map[string]string)
-
-			err := tt.setup()
-			if err != nil {
-				t.Fatalf("Setup failed: %v", err)
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			cfg.PermissionPolling = "on"
+			cfg.PermissionPollMs = tt.pollMs
+
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+			if (manager.permissionCheckTicker != nil) != tt.expectPolling {
+				t.Fatalf("Expected ticker=%v, got %v", tt.expectPolling, manager.permissionCheckTicker != nil)
 			}
 
-			// Simulate file event by calling the appropriate method
-			switch tt.eventType {
-			case "create":
-				err = manager.AddService(scriptPath)
-			case "write":
-				err = manager.RestartService(scriptPath)
-			case "remove":
-				err = manager.RemoveService(scriptPath)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				manager.Start(ctx)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			// Look for the poller among the running goroutines once Start is underway
+			var polling bool
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				stacks := make([]byte, 1<<20)
+				stacks = stacks[:runtime.Stack(stacks, true)]
+				polling = bytes.Contains(stacks, []byte("watchPermissionChanges"))
+				if polling || !tt.expectPolling && bytes.Contains(stacks, []byte("watchFileChanges")) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
 			}
-
-			if err != nil {
-				t.Fatalf("HandleFileEvent failed: %v", err)
+			if polling != tt.expectPolling {
+				t.Errorf("Expected permission poller running=%v, got %v", tt.expectPolling, polling)
 			}
+		})
+	}
+}
 
-			if !tt.verify() {
-				t.Errorf("Event %s did not have expected effect", tt.eventType)
+func TestPermissionPollingEnabled(t *testing.T) {
+	tests := []struct {
+		mode     string
+		goos     string
+		expected bool
+	}{
+		{"auto", "linux", true},
+		{"auto", "darwin", false},
+		{"auto", "freebsd", false},
+		{"", "linux", true},
+		{"on", "darwin", true},
+		{"off", "linux", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.goos, func(t *testing.T) {
+			if got := permissionPollingEnabled(tt.mode, tt.goos); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
 			}
 		})
 	}
@@ -797,6 +2224,141 @@ echo "response"
 	}
 }
 
+func TestManager_IsValidScriptWithInterpreter(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	// Without the executable bit, as on a read-only filesystem mounted noexec
+	scriptPath := filepath.Join(tempDir, "plain.sh")
+	scriptContent := `if [[ "$1" == "info" ]]; then
+  echo '{"name": "PlainService", "endpoints": [{"name": "Run", "subject": "plain.run"}]}'
+  exit 0
+fi
+echo "ran by $0"
+`
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		interpreter string
+		expectValid bool
+	}{
+		{name: "executed directly", interpreter: "", expectValid: false},
+		{name: "run by interpreter", interpreter: "/usr/bin/env bash", expectValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Interpreter = tt.interpreter
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			if valid := manager.IsValidScript(scriptPath); valid != tt.expectValid {
+				t.Fatalf("Expected IsValidScript to return %v, got %v", tt.expectValid, valid)
+			}
+			if !tt.expectValid {
+				return
+			}
+
+			if err := manager.AddService(scriptPath); err != nil {
+				t.Fatalf("AddService failed: %v", err)
+			}
+			if _, exists := manager.services["PlainService"]; !exists {
+				t.Error("Expected the non-executable script to be loaded through the interpreter")
+			}
+		})
+	}
+}
+
+func TestManager_IsValidScriptSkipsOversizedScripts(t *testing.T) {
+	tempDir := t.TempDir()
+	var logOutput syncBuffer
+	logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.MaxScriptSizeBytes = 1024
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// The probe leaves a marker, so a skipped script must never have run
+	marker := filepath.Join(tempDir, "probed")
+	scriptContent := `#!/usr/bin/env bash
+touch "` + marker + `"
+if [[ "$1" == "info" ]]; then
+  echo '{"name":"TestService","version":"1.0.0","endpoints":[{"name":"Test","subject":"test"}]}'
+  exit 0
+fi
+`
+	smallPath := filepath.Join(tempDir, "small.sh")
+	if err := os.WriteFile(smallPath, []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	if !manager.IsValidScript(smallPath) {
+		t.Error("Expected script within max_script_size_bytes to be valid")
+	}
+	os.Remove(marker)
+
+	largePath := filepath.Join(tempDir, "large.sh")
+	padding := "# " + strings.Repeat("x", 2048) + "\n"
+	if err := os.WriteFile(largePath, []byte(scriptContent+padding), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	if manager.IsValidScript(largePath) {
+		t.Error("Expected script larger than max_script_size_bytes to be skipped")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the oversized script never to run")
+	}
+	if !strings.Contains(logOutput.String(), "Skipping script larger than max_script_size_bytes") {
+		t.Errorf("Expected a warning for the oversized script, got: %s", logOutput.String())
+	}
+}
+
+func TestManager_PermissionPollSkipsOversizedScripts(t *testing.T) {
+	tempDir := t.TempDir()
+	var logOutput syncBuffer
+	logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	cfg := config.DefaultConfig()
+	cfg.MaxScriptSizeBytes = 1024
+	manager := NewManager(tempDir, natsConn, logger, cfg)
+
+	// The probe leaves a marker, so a skipped script must never have run
+	marker := filepath.Join(tempDir, "probed")
+	scriptContent := `#!/usr/bin/env bash
+touch "` + marker + `"
+if [[ "$1" == "info" ]]; then
+  echo '{"name":"LargeService","version":"1.0.0","endpoints":[{"name":"Test","subject":"test"}]}'
+  exit 0
+fi
+` + "# " + strings.Repeat("x", 2048) + "\n"
+	largePath := filepath.Join(tempDir, "large.sh")
+	if err := os.WriteFile(largePath, []byte(scriptContent), 0644); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	// The first poll records the script as non-executable, the next sees the chmod
+	manager.checkExecutableStatusChanges()
+	if err := os.Chmod(largePath, 0755); err != nil {
+		t.Fatalf("Failed to chmod test script: %v", err)
+	}
+	manager.checkExecutableStatusChanges()
+
+	if _, exists := manager.services["LargeService"]; exists {
+		t.Error("Expected the oversized script not to be loaded after chmod +x")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the oversized script never to run")
+	}
+	if !strings.Contains(logOutput.String(), "Skipping script larger than max_script_size_bytes") {
+		t.Errorf("Expected a warning for the oversized script, got: %s", logOutput.String())
+	}
+}
+
 func TestManager_String(t *testing.T) {
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
@@ -809,3 +2371,83 @@ func TestManager_String(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, manager.String())
 	}
 }
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes from background goroutines
+type syncBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// newTestLogger returns a JSON logger writing to w at level, leaving the logging
+// package's global setup alone. zerolog drops events below its global level, so
+// a lower level is let through for the test and the previous one restored after.
+func newTestLogger(t *testing.T, w io.Writer, level zerolog.Level) zerolog.Logger {
+	t.Helper()
+	if previous := zerolog.GlobalLevel(); level < previous {
+		zerolog.SetGlobalLevel(level)
+		t.Cleanup(func() { zerolog.SetGlobalLevel(previous) })
+	}
+	return zerolog.New(w).Level(level).With().Timestamp().Logger()
+}
+
+func TestManager_WaitRefusesServeStartingDuringShutdown(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	manager := NewManager(tempDir, nil, logger, config.DefaultConfig())
+	managedService := NewManagedService(filepath.Join(tempDir, "late.sh"), nil, logger, config.DefaultConfig())
+	managedService.serves = &manager.serves
+
+	// A Serve already running holds Wait until it returns
+	if !manager.serves.begin() {
+		t.Fatal("Expected a Serve call to be tracked before shutdown")
+	}
+	waited := make(chan struct{})
+	go func() {
+		manager.Wait()
+		close(waited)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		manager.serves.mutex.Lock()
+		closed := manager.serves.closed
+		manager.serves.mutex.Unlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Wait did not start in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A restart suture launches now must not register a service shutdown can't wait for
+	if err := managedService.Serve(context.Background()); !errors.Is(err, suture.ErrDoNotRestart) {
+		t.Errorf("Expected Serve to refuse to start during shutdown, got %v", err)
+	}
+
+	select {
+	case <-waited:
+		t.Fatal("Expected Wait to block on the running Serve call")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	manager.serves.end()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after the running Serve call ended")
+	}
+}
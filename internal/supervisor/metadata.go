@@ -0,0 +1,64 @@
+package supervisor
+
+import "encoding/json"
+
+// metadataDepth is how deeply metadata nests: a map of plain values is 1, and each
+// map or array inside adds a level
+func metadataDepth(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		deepest := 0
+		for _, item := range v {
+			deepest = max(deepest, metadataDepth(item))
+		}
+		return deepest + 1
+	case []interface{}:
+		deepest := 0
+		for _, item := range v {
+			deepest = max(deepest, metadataDepth(item))
+		}
+		return deepest + 1
+	default:
+		return 0
+	}
+}
+
+// flattenMetadata limits metadata to maxDepth levels, replacing maps and arrays
+// at the deepest allowed level with their JSON encoding
+func flattenMetadata(metadata map[string]interface{}, maxDepth int) map[string]interface{} {
+	flattened, _ := flattenMetadataValue(metadata, maxDepth).(map[string]interface{})
+	return flattened
+}
+
+func flattenMetadataValue(value interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if depth <= 0 {
+			return metadataJSON(v)
+		}
+		flattened := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			flattened[key] = flattenMetadataValue(item, depth-1)
+		}
+		return flattened
+	case []interface{}:
+		if depth <= 0 {
+			return metadataJSON(v)
+		}
+		flattened := make([]interface{}, len(v))
+		for i, item := range v {
+			flattened[i] = flattenMetadataValue(item, depth-1)
+		}
+		return flattened
+	default:
+		return value
+	}
+}
+
+func metadataJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
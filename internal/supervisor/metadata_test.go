@@ -0,0 +1,101 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+func TestMetadataDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		expected int
+	}{
+		{name: "flat", metadata: `{"owner": "ops"}`, expected: 1},
+		{name: "nested object", metadata: `{"parameters": {"name": {"type": "string"}}}`, expected: 3},
+		{name: "array of objects", metadata: `{"examples": [{"name": "Alice"}]}`, expected: 3},
+		{name: "empty", metadata: `{}`, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metadata map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.metadata), &metadata); err != nil {
+				t.Fatalf("Failed to decode metadata: %v", err)
+			}
+			if got := metadataDepth(metadata); got != tt.expected {
+				t.Errorf("Expected depth %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFlattenMetadata(t *testing.T) {
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"owner": "ops", "parameters": {"name": {"type": "string"}}, "tags": [["a"]]}`), &metadata); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+
+	flattened := flattenMetadata(metadata, 2)
+	expected := map[string]interface{}{
+		"owner":      "ops",
+		"parameters": map[string]interface{}{"name": `{"type":"string"}`},
+		"tags":       []interface{}{`["a"]`},
+	}
+	if !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("Expected %v, got %v", expected, flattened)
+	}
+	if depth := metadataDepth(flattened); depth != 2 {
+		t.Errorf("Expected flattened depth 2, got %d", depth)
+	}
+}
+
+func TestManagedService_InitializeFlattensDeepMetadata(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := logging.SetupLoggerWithWriter(&logOutput, "info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.MaxMetadataDepth = 2
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.logger = logger // Capture warnings logged before Initialize replaces it
+
+	managedService.scripts["test.sh"] = &MockScriptRunner{
+		infoResponse: `{
+			"name": "DeepService",
+			"endpoints": [
+				{"name": "Deep", "subject": "deep.run", "metadata": {"a": {"b": {"c": {"d": 1}}}}},
+				{"name": "Shallow", "subject": "shallow.run", "metadata": {"a": {"b": 1}}}
+			]
+		}`,
+	}
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	metadata := map[string]map[string]interface{}{}
+	for _, endpoint := range managedService.definition.Endpoints {
+		metadata[endpoint.Name] = endpoint.Metadata
+	}
+
+	expectedDeep := map[string]interface{}{"a": map[string]interface{}{"b": `{"c":{"d":1}}`}}
+	if !reflect.DeepEqual(metadata["Deep"], expectedDeep) {
+		t.Errorf("Expected deep metadata flattened to %v, got %v", expectedDeep, metadata["Deep"])
+	}
+	expectedShallow := map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}
+	if !reflect.DeepEqual(metadata["Shallow"], expectedShallow) {
+		t.Errorf("Expected shallow metadata unchanged, got %v", metadata["Shallow"])
+	}
+
+	if !strings.Contains(logOutput.String(), "Flattening endpoint metadata nested deeper than max_metadata_depth") ||
+		!strings.Contains(logOutput.String(), `"endpoint":"Deep"`) {
+		t.Errorf("Expected a warning for the Deep endpoint, got: %s", logOutput.String())
+	}
+}
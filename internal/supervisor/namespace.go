@@ -0,0 +1,24 @@
+package supervisor
+
+import "sort"
+
+// namespaceGroups lists the names of the loaded services in each namespace,
+// sorted. Services that declare no namespace are left out. Callers hold sm.mutex.
+func (sm *ServiceManager) namespaceGroups() map[string][]string {
+	var groups map[string][]string
+	for serviceName, managedService := range sm.services {
+		namespace := managedService.definition.Namespace
+		if namespace == "" {
+			continue
+		}
+		if groups == nil {
+			groups = make(map[string][]string)
+		}
+		groups[namespace] = append(groups[namespace], serviceName)
+	}
+
+	for _, serviceNames := range groups {
+		sort.Strings(serviceNames)
+	}
+	return groups
+}
@@ -0,0 +1,114 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+func TestManager_GroupsServicesByNamespace(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	manager := NewManager(t.TempDir(), natsConn, logger, cfg)
+
+	definitions := []service.ServiceDefinition{
+		{Name: "BackupService", Namespace: "storage", Endpoints: []service.Endpoint{{Name: "Run", Subject: "backup.run"}}},
+		{Name: "ArchiveService", Namespace: "storage", Endpoints: []service.Endpoint{{Name: "Put", Subject: "archive.put"}}},
+		{Name: "DeployService", Namespace: "ops", Endpoints: []service.Endpoint{{Name: "Roll", Subject: "deploy.roll"}}},
+		{Name: "GreetingService", Endpoints: []service.Endpoint{{Name: "Hello", Subject: "greeting.hello"}}},
+	}
+	for _, definition := range definitions {
+		managedService := NewManagedService(definition.Name+".sh", natsConn, logger, cfg)
+		managedService.definition = definition
+		manager.services[definition.Name] = managedService
+	}
+
+	expected := map[string][]string{
+		"ops":     {"DeployService"},
+		"storage": {"ArchiveService", "BackupService"},
+	}
+
+	docs := manager.Docs()
+	if !reflect.DeepEqual(docs.Namespaces, expected) {
+		t.Errorf("Expected docs namespaces %v, got %v", expected, docs.Namespaces)
+	}
+	for _, serviceDocs := range docs.Services {
+		if serviceDocs.Name == "BackupService" && serviceDocs.Namespace != "storage" {
+			t.Errorf("Expected BackupService docs in namespace storage, got %q", serviceDocs.Namespace)
+		}
+	}
+
+	summary := manager.StartupSummary()
+	if !reflect.DeepEqual(summary.Namespaces, expected) {
+		t.Errorf("Expected summary namespaces %v, got %v", expected, summary.Namespaces)
+	}
+
+	// The groups reach clients of the docs subject as JSON
+	data, err := json.Marshal(docs)
+	if err != nil {
+		t.Fatalf("Failed to encode docs: %v", err)
+	}
+	var decoded struct {
+		Namespaces map[string][]string `json:"namespaces"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode docs: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Namespaces, expected) {
+		t.Errorf("Expected encoded namespaces %v, got %v", expected, decoded.Namespaces)
+	}
+}
+
+func TestManagedService_NamespaceSubjects(t *testing.T) {
+	tests := []struct {
+		name              string
+		namespaceSubjects bool
+		expectedSubject   string
+	}{
+		{name: "namespace kept out of subjects", namespaceSubjects: false, expectedSubject: "web01.backup.run"},
+		{name: "namespace in subjects", namespaceSubjects: true, expectedSubject: "web01.storage.backup.run"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{Hostname: "web01", NamespaceSubjects: tt.namespaceSubjects}
+			managedService := NewManagedService("test.sh", nil, zerolog.Nop(), cfg)
+
+			mockRunner := &MockScriptRunner{
+				infoResponse: `{
+					"name": "BackupService",
+					"namespace": "storage",
+					"endpoints": [{"name": "Run", "subject": "backup.run"}]
+				}`,
+				executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{}`)},
+			}
+			managedService.scripts["test.sh"] = mockRunner
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			subject := managedService.definition.Endpoints[0].Subject
+			if subject != tt.expectedSubject {
+				t.Fatalf("Expected subject %s, got %s", tt.expectedSubject, subject)
+			}
+
+			// Requests reach the script with the subject it declared
+			request := &MockRequest{subject: subject, data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+			if mockRunner.lastSubject != "backup.run" {
+				t.Errorf("Expected script to receive backup.run, got %s", mockRunner.lastSubject)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/service"
+)
+
+// overrideScriptRunner serves a script on the endpoints configured in
+// endpoint_overrides instead of the ones its info response declares
+type overrideScriptRunner struct {
+	*service.ScriptRunner
+	scriptPath string
+	config     config.Config
+
+	mutex sync.RWMutex
+	// Override subject -> subject the script declared for the endpoint of the same
+	// name, so the script still sees the subjects it knows how to handle
+	declaredSubjects map[string]string
+}
+
+func newOverrideScriptRunner(runner *service.ScriptRunner, scriptPath string, cfg config.Config) *overrideScriptRunner {
+	return &overrideScriptRunner{
+		ScriptRunner:     runner,
+		scriptPath:       scriptPath,
+		config:           cfg,
+		declaredSubjects: make(map[string]string),
+	}
+}
+
+// GetServiceDefinition probes the script for its name and version, then swaps in
+// the override endpoints when one matches the script path or service name
+func (r *overrideScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	def, err := r.ScriptRunner.GetServiceDefinition(ctx)
+	if err != nil {
+		return def, err
+	}
+	return r.withOverrides(def), nil
+}
+
+// withOverrides swaps the override endpoints into a definition probed from the
+// script, remembering the subjects the script declared for them
+func (r *overrideScriptRunner) withOverrides(def service.ServiceDefinition) service.ServiceDefinition {
+	endpoints, ok := r.config.EndpointOverrideFor(r.scriptPath, def.Name)
+	if !ok {
+		return def
+	}
+
+	declared := make(map[string]string, len(def.Endpoints))
+	for _, endpoint := range def.Endpoints {
+		declared[endpoint.Name] = endpoint.Subject
+	}
+
+	declaredSubjects := make(map[string]string, len(endpoints))
+	for _, endpoint := range endpoints {
+		if subject, exists := declared[endpoint.Name]; exists {
+			declaredSubjects[endpoint.Subject] = subject
+		}
+	}
+
+	r.mutex.Lock()
+	r.declaredSubjects = declaredSubjects
+	r.mutex.Unlock()
+
+	def.Endpoints = append([]service.Endpoint(nil), endpoints...)
+	return def
+}
+
+// ExecuteRequest runs the script with the subject it declared for the overridden endpoint
+func (r *overrideScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	r.mutex.RLock()
+	if declared, exists := r.declaredSubjects[subject]; exists {
+		subject = declared
+	}
+	r.mutex.RUnlock()
+
+	return r.ScriptRunner.ExecuteRequest(ctx, subject, payload)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package supervisor
+
+import "os"
+
+// fileOwner is unknown off Unix, so require_script_owner rejects every script there
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+func TestManager_RequireScriptOwner(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	tests := []struct {
+		name        string
+		owner       string
+		expectValid bool
+	}{
+		{name: "owned by required user", owner: strconv.Itoa(uid), expectValid: true},
+		{name: "owned by required user and group", owner: strconv.Itoa(uid) + ":" + strconv.Itoa(gid), expectValid: true},
+		{name: "wrong user", owner: strconv.Itoa(uid + 1), expectValid: false},
+		{name: "wrong group", owner: strconv.Itoa(uid) + ":" + strconv.Itoa(gid+1), expectValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+			cfg := config.DefaultConfig()
+			cfg.RequireScriptOwner = tt.owner
+			manager := NewManager(tempDir, natsConn, logger, cfg)
+
+			// The probe leaves a marker, so a rejected script must never have run
+			marker := filepath.Join(tempDir, "probed")
+			scriptPath := filepath.Join(tempDir, "greeting.sh")
+			scriptContent := `#!/usr/bin/env bash
+touch "` + marker + `"
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "GreetingService", "version": "1.0.0", "endpoints": [{"name": "Hello", "subject": "greeting.hello"}]}'
+  exit 0
+fi
+`
+			if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+				t.Fatalf("Failed to create test script: %v", err)
+			}
+
+			if valid := manager.IsValidScript(scriptPath); valid != tt.expectValid {
+				t.Errorf("Expected IsValidScript to return %v, got %v", tt.expectValid, valid)
+			}
+
+			err := manager.AddService(scriptPath)
+			if tt.expectValid && err != nil {
+				t.Errorf("Expected AddService to succeed, got %v", err)
+			}
+			if !tt.expectValid && err == nil {
+				t.Error("Expected AddService to reject the wrongly-owned script")
+			}
+
+			if _, registered := manager.services["GreetingService"]; registered != tt.expectValid {
+				t.Errorf("Expected GreetingService registered to be %v, got %v", tt.expectValid, registered)
+			}
+			if _, err := os.Stat(marker); !tt.expectValid && err == nil {
+				t.Error("Expected the wrongly-owned script never to run")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StartPacer spaces out script process starts so a burst of requests doesn't fork
+// many processes at once: no more than rate starts fall within any interval
+type StartPacer struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	slots    []time.Time // start times of the most recent rate starts, oldest first
+	now      func() time.Time
+}
+
+// NewStartPacer allows rate process starts per interval
+func NewStartPacer(rate int, interval time.Duration) *StartPacer {
+	if rate < 1 {
+		rate = 1
+	}
+	return &StartPacer{
+		interval: interval,
+		slots:    make([]time.Time, 0, rate),
+		now:      time.Now,
+	}
+}
+
+// Wait blocks until a process may start, or returns the context's error
+func (p *StartPacer) Wait(ctx context.Context) error {
+	delay := p.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve claims the earliest start time that keeps every interval within the rate
+// and returns how long to wait for it
+func (p *StartPacer) reserve() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	start := now
+	if len(p.slots) == cap(p.slots) {
+		// The start rate places before this one must be at least an interval earlier
+		if earliest := p.slots[0].Add(p.interval); earliest.After(start) {
+			start = earliest
+		}
+		p.slots = append(p.slots[:0], p.slots[1:]...)
+	}
+	p.slots = append(p.slots, start)
+
+	return start.Sub(now)
+}
@@ -0,0 +1,29 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartPacer_Reserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	pacer := NewStartPacer(2, 100*time.Millisecond)
+	pacer.now = func() time.Time { return now }
+
+	// A burst of rate starts runs at once, each later start waits an interval after
+	// the start rate places before it
+	expected := []time.Duration{0, 0, 100 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range expected {
+		if delay := pacer.reserve(); delay != want {
+			t.Errorf("Start %d: expected delay %v, got %v", i, want, delay)
+		}
+	}
+
+	// After a quiet period the full burst is available again
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if delay := pacer.reserve(); delay > 0 {
+			t.Errorf("Expected start %d after a quiet period to run at once, got delay %v", i, delay)
+		}
+	}
+}
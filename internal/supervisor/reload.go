@@ -0,0 +1,197 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
+)
+
+// Reload rescans the scripts directory and brings the services in line with it,
+// for operators who bulk-deploy scripts: services of scripts that vanished or
+// are no longer valid are removed, scripts whose info changed have their service
+// restarted, and new scripts are added. Reloads run one at a time; the file
+// watcher keeps running, and whichever of the two sees a change first handles it.
+func (sm *ServiceManager) Reload() error {
+	sm.reloadMutex.Lock()
+	defer sm.reloadMutex.Unlock()
+
+	logging.LogManagerOperation(sm.logger, "reloading", map[string]interface{}{
+		"path": sm.scriptsPath,
+	})
+
+	sm.loadIgnoreRules()
+
+	found, err := sm.scanScriptPaths()
+	if err != nil {
+		return fmt.Errorf("failed to rescan scripts directory: %w", err)
+	}
+
+	sm.mutex.RLock()
+	tracked := make(map[string]*ManagedService, len(sm.scriptToService))
+	for scriptPath, serviceName := range sm.scriptToService {
+		tracked[scriptPath] = sm.services[serviceName]
+	}
+	sm.mutex.RUnlock()
+
+	trackedPaths := make([]string, 0, len(tracked))
+	for scriptPath := range tracked {
+		trackedPaths = append(trackedPaths, scriptPath)
+	}
+	sort.Strings(trackedPaths)
+
+	var removed, restarted, added int
+	restartedServices := make(map[*ManagedService]bool)
+	for _, scriptPath := range trackedPaths {
+		managedService := tracked[scriptPath]
+		if managedService == nil {
+			continue
+		}
+
+		changed, err := sm.scriptChanged(managedService, scriptPath, found)
+		if err != nil {
+			sm.logger.Info().
+				Err(err).
+				Str("script", scriptPath).
+				Msg("Script is gone or no longer valid - removing service")
+
+			if err := sm.RemoveService(scriptPath); err != nil {
+				logging.LogError(sm.logger, err, "failed to remove service for "+scriptPath)
+				continue
+			}
+			removed++
+			continue
+		}
+
+		// A restart reloads every script of the service, so once is enough
+		if !changed || restartedServices[managedService] {
+			continue
+		}
+
+		if err := sm.RestartServiceGracefully(scriptPath); err != nil {
+			logging.LogError(sm.logger, err, "failed to restart service for "+scriptPath)
+			continue
+		}
+		restartedServices[managedService] = true
+		restarted++
+	}
+
+	foundPaths := make([]string, 0, len(found))
+	for scriptPath := range found {
+		foundPaths = append(foundPaths, scriptPath)
+	}
+	sort.Strings(foundPaths)
+
+	for _, scriptPath := range foundPaths {
+		sm.mutex.RLock()
+		_, exists := sm.scriptToService[scriptPath]
+		sm.mutex.RUnlock()
+		if exists {
+			continue
+		}
+
+		definition, err := sm.validateAndLoad(scriptPath)
+		if err != nil {
+			continue
+		}
+		if err := sm.addLoadedService(scriptPath, definition); err != nil {
+			logging.LogError(sm.logger, err, "failed to add service for "+scriptPath)
+			continue
+		}
+		added++
+	}
+
+	logging.LogManagerOperation(sm.logger, "reload_completed", map[string]interface{}{
+		"added":     added,
+		"removed":   removed,
+		"restarted": restarted,
+	})
+
+	return nil
+}
+
+// scriptChanged reports whether a loaded script's info differs from when its
+// service was last initialized. An error means the script must be removed: it
+// vanished, is no longer valid, or now names a different service, in which case
+// Reload adds it again under the new name.
+func (sm *ServiceManager) scriptChanged(managedService *ManagedService, scriptPath string, found map[string]struct{}) (bool, error) {
+	if _, exists := found[scriptPath]; !exists {
+		return false, fmt.Errorf("script not found in %s", sm.scriptsPath)
+	}
+	if err := sm.checkScriptFile(scriptPath); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	definition, previous, err := managedService.probeScript(ctx, scriptPath)
+	if err != nil {
+		return false, err
+	}
+	if definition.Name != managedService.definition.Name {
+		return false, fmt.Errorf("script now belongs to service %q", definition.Name)
+	}
+	return !reflect.DeepEqual(definition, previous), nil
+}
+
+// scanScriptPaths lists the files under the scripts directory that discovery
+// would consider, without running them
+func (sm *ServiceManager) scanScriptPaths() (map[string]struct{}, error) {
+	found := make(map[string]struct{})
+	if _, err := os.Stat(sm.scriptsPath); os.IsNotExist(err) {
+		return found, nil
+	}
+
+	err := filepath.Walk(sm.scriptsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue walking
+		}
+
+		if sm.isIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if sm.exceedsDiscoveryDepth(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if sm.isScriptName(path) {
+			found[path] = struct{}{}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// probeScript runs one of the service's scripts for its info, through the runner
+// the service serves it with, and returns it with the definition the script had
+// at the last Initialize
+func (ms *ManagedService) probeScript(ctx context.Context, scriptPath string) (service.ServiceDefinition, service.ServiceDefinition, error) {
+	ms.scriptsMutex.RLock()
+	runner, exists := ms.scripts[scriptPath]
+	previous := ms.scriptDefinitions[scriptPath]
+	ms.scriptsMutex.RUnlock()
+
+	if !exists {
+		return service.ServiceDefinition{}, previous, fmt.Errorf("script %s is not part of service %s", scriptPath, ms.definition.Name)
+	}
+
+	definition, err := runner.GetServiceDefinition(ctx)
+	if err != nil {
+		return service.ServiceDefinition{}, previous, fmt.Errorf("failed to get service definition: %w", err)
+	}
+	return definition, previous, nil
+}
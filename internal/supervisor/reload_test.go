@@ -0,0 +1,126 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// reloadTestScript answers info for a service with the given endpoint subjects
+func reloadTestScript(serviceName string, subjects ...string) string {
+	endpoints := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		endpoints = append(endpoints, `{"name": "`+strings.ReplaceAll(subject, ".", "_")+`", "subject": "`+subject+`"}`)
+	}
+	return `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "` + serviceName + `", "version": "1.0.0", "endpoints": [` + strings.Join(endpoints, ", ") + `]}'
+  exit 0
+fi
+echo '{}'
+`
+}
+
+// reloadSummary returns the added, removed and restarted counts of the
+// reload_completed line in a log
+func reloadSummary(t *testing.T, output string) [3]int {
+	t.Helper()
+
+	for _, line := range strings.Split(output, "\n") {
+		var entry struct {
+			Action    string `json:"action"`
+			Added     int    `json:"added"`
+			Removed   int    `json:"removed"`
+			Restarted int    `json:"restarted"`
+		}
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Action == "reload_completed" {
+			return [3]int{entry.Added, entry.Removed, entry.Restarted}
+		}
+	}
+	t.Fatalf("Expected a reload_completed log line, got %s", output)
+	return [3]int{}
+}
+
+func TestManager_Reload(t *testing.T) {
+	tempDir := t.TempDir()
+	var logBuf syncBuffer
+	logger := newTestLogger(t, &logBuf, zerolog.InfoLevel)
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+
+	writeScript := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	writeScript("keep.sh", reloadTestScript("KeepService", "keep.get"))
+	writeScript("change.sh", reloadTestScript("ChangeService", "change.get"))
+	writeScript("gone.sh", reloadTestScript("GoneService", "gone.get"))
+	writeScript("rename.sh", reloadTestScript("OldNameService", "rename.get"))
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	if err := manager.DiscoverServices(); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	keepService := manager.services["KeepService"]
+
+	// A bulk deploy the file watcher didn't see
+	if err := os.Remove(filepath.Join(tempDir, "gone.sh")); err != nil {
+		t.Fatalf("Failed to remove gone.sh: %v", err)
+	}
+	writeScript("change.sh", reloadTestScript("ChangeService", "change.get", "change.set"))
+	writeScript("rename.sh", reloadTestScript("NewNameService", "rename.get"))
+	writeScript("new.sh", reloadTestScript("NewService", "new.get"))
+	discoveryLog := len(logBuf.String())
+
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"KeepService":    true,
+		"ChangeService":  true,
+		"NewService":     true,
+		"NewNameService": true,
+		"GoneService":    false,
+		"OldNameService": false,
+	}
+	for serviceName, registered := range expected {
+		if _, exists := manager.services[serviceName]; exists != registered {
+			t.Errorf("Expected %s registered=%v after reload, got %v", serviceName, registered, exists)
+		}
+	}
+
+	if manager.services["KeepService"] != keepService {
+		t.Error("Expected the unchanged service to be kept as is")
+	}
+
+	changed := manager.services["ChangeService"]
+	if changed == nil || len(changed.definition.Endpoints) != 2 {
+		t.Fatalf("Expected the changed service to serve 2 endpoints, got %+v", changed)
+	}
+
+	output := logBuf.String()[discoveryLog:]
+	if count := strings.Count(output, `"action":"restarted"`); count != 1 {
+		t.Errorf("Expected exactly one restart, got %d", count)
+	}
+	if summary := reloadSummary(t, output); summary != [3]int{2, 2, 1} {
+		t.Errorf("Expected 2 added, 2 removed and 1 restarted, got %v", summary)
+	}
+
+	// Nothing changed since, so a second reload leaves everything alone
+	firstReloadLog := len(logBuf.String())
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if summary := reloadSummary(t, logBuf.String()[firstReloadLog:]); summary != [3]int{0, 0, 0} {
+		t.Errorf("Expected an idempotent second reload, got %v added, removed and restarted", summary)
+	}
+}
@@ -0,0 +1,50 @@
+package supervisor
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// RequestIDHeader carries a caller's request ID, reused instead of generating one
+// so a request can be traced across services
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDEnv is the environment variable scripts receive the request ID in
+const requestIDEnv = "NATS_REQUEST_ID"
+
+// requestIDKey carries the ID of the request being served in a context
+type requestIDKey struct{}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requestIDFor returns the request's X-Request-ID header, or a new ID when it has none
+func requestIDFor(req Request) string {
+	if id := headerValue(req.Headers(), RequestIDHeader); id != "" {
+		return id
+	}
+	return newRequestID()
+}
+
+// withRequestID returns a context carrying the request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestLogger returns the service logger with the context's request ID, if any
+func (ms *ManagedService) requestLogger(ctx context.Context) zerolog.Logger {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		return ms.logger.With().Str("request_id", id).Logger()
+	}
+	return ms.logger
+}
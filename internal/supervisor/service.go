@@ -1,10 +1,17 @@
 package supervisor
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hiway/natshd/internal/config"
 	"github.com/hiway/natshd/internal/logging"
@@ -21,72 +28,240 @@ type ScriptRunner interface {
 	ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error)
 }
 
+// ScriptInitializer is implemented by runners that can run a script's "init" setup
+type ScriptInitializer interface {
+	RunInit(ctx context.Context) error
+}
+
+// scriptRoute is the script serving a prefixed subject, with the endpoint as the
+// script declared it
+type scriptRoute struct {
+	subject    string // prefixed subject the endpoint is registered on, possibly a wildcard
+	scriptPath string
+	runner     ScriptRunner
+	endpoint   service.Endpoint
+}
+
 // ManagedService represents a supervised NATS microservice backed by shell script(s)
 type ManagedService struct {
 	scripts      map[string]ScriptRunner // scriptPath -> runner mapping
+	routes       map[string]scriptRoute  // prefixed subject -> script, rebuilt by Initialize
+	healthChecks map[string]ScriptRunner // scriptPath -> runner of scripts declaring health_check, rebuilt by Initialize
+	scriptsMutex sync.RWMutex            // guards scripts and routes against removal during in-flight requests
 	natsConn     *nats.Conn
 	logger       zerolog.Logger
 	definition   service.ServiceDefinition
-	natsService  micro.Service
+	natsService  micro.Service // registered by the running Serve, read through microService
+	natsMutex    sync.Mutex    // guards natsService, which restarts read while Serve runs
 	initialized  bool
 	serviceToken suture.ServiceToken
 	config       config.Config
+	restartMutex sync.Mutex    // one restart of the service at a time
+	serves       *serveTracker // tracks Serve calls for coordinated shutdown
+	// Shared concurrency budget owned by the manager (nil = unlimited)
+	requestLimiter *WeightedSemaphore
+	// This service's own cap on concurrent executions, max_concurrent (nil = unlimited)
+	concurrencyLimit *ConcurrencyLimit
+	// Shared pacing of script process starts owned by the manager (nil = unpaced)
+	startPacer *StartPacer
+	// Shared access log owned by the manager (nil = disabled)
+	accessLog *logging.AccessLog
+	// Shared StatsD client owned by the manager (nil = disabled)
+	statsd *StatsD
+	// Requests still executing, drained when the service stops or is removed
+	inflight inflightRequests
+	// Async endpoint jobs running in the background, by job ID
+	jobs asyncJobs
+	// Per-endpoint breakers for repeated timeouts (nil = disabled)
+	breakers *CircuitBreakers
+	// Post-processing applied to successful output (nil = none)
+	outputFilter *service.OutputFilter
+	// Replies "warming up" while endpoints are not registered (warmup_reply)
+	warmup warmupPlaceholder
+	// Script modification times as of the last Initialize, for telling edited
+	// scripts apart from scripts whose info output changes on its own
+	scriptModTimes map[string]time.Time
+	// Each script's definition as of the last Initialize, so a reload can tell
+	// which scripts changed; guarded by scriptsMutex
+	scriptDefinitions map[string]service.ServiceDefinition
+	// Exit code counts per endpoint, reported in micro's endpoint stats
+	exitCodes ExitCodeCounts
+	// Registers an endpoint on the micro service (nil = micro.Service.AddEndpoint)
+	addEndpoint func(svc micro.Service, name string, handler micro.Handler, opts ...micro.EndpointOpt) error
 }
 
 // NewManagedService creates a new managed service with the provided config
 func NewManagedService(scriptPath string, natsConn *nats.Conn, logger zerolog.Logger, cfg config.Config) *ManagedService {
 	serviceLogger := logging.NewContextLogger(os.Stderr, logger.GetLevel(), "", scriptPath)
-	return &ManagedService{
+	ms := &ManagedService{
 		scripts:  make(map[string]ScriptRunner),
 		natsConn: natsConn,
 		logger:   serviceLogger,
 		config:   cfg,
 	}
+	if cfg.CircuitBreakerThreshold > 0 {
+		cooldown := time.Duration(cfg.CircuitBreakerCooldownMs) * time.Millisecond
+		ms.breakers = NewCircuitBreakers(cfg.CircuitBreakerThreshold, cooldown)
+	}
+	if filter, err := service.NewOutputFilter(cfg.OutputFilter, cfg.OutputFilterCommand); err != nil {
+		serviceLogger.Error().Err(err).Msg("Ignoring invalid output filter")
+	} else {
+		ms.outputFilter = filter
+	}
+	return ms
 }
 
 // AddScript adds a script to this managed service (for grouping scripts by service name)
 func (ms *ManagedService) AddScript(scriptPath string) {
-	ms.scripts[scriptPath] = service.NewScriptRunner(scriptPath)
+	ms.scriptsMutex.Lock()
+	defer ms.scriptsMutex.Unlock()
+
+	runner := newScriptRunner(ms.config, scriptPath, ms.definition.Name)
+	if len(ms.config.EndpointOverrides) > 0 {
+		ms.scripts[scriptPath] = newOverrideScriptRunner(runner, scriptPath, ms.config)
+		return
+	}
+	ms.scripts[scriptPath] = runner
+}
+
+// RemoveScript removes a script from this managed service and returns how many remain
+func (ms *ManagedService) RemoveScript(scriptPath string) int {
+	ms.scriptsMutex.Lock()
+	defer ms.scriptsMutex.Unlock()
+	delete(ms.scripts, scriptPath)
+	delete(ms.healthChecks, scriptPath)
+	for subject, route := range ms.routes {
+		if route.scriptPath == scriptPath {
+			delete(ms.routes, subject)
+		}
+	}
+	return len(ms.scripts)
+}
+
+// route looks up the script serving a prefixed subject, either registered as
+// is or, for a concrete request subject, through a wildcard endpoint
+func (ms *ManagedService) route(subject string) (scriptRoute, bool) {
+	ms.scriptsMutex.RLock()
+	defer ms.scriptsMutex.RUnlock()
+	if route, ok := ms.routes[subject]; ok {
+		return route, true
+	}
+
+	pattern, ok := bestWildcardMatch(ms.routes, subject)
+	if !ok {
+		return scriptRoute{}, false
+	}
+	return ms.routes[pattern], true
+}
+
+// scriptRunners returns a snapshot of the scripts that is safe to iterate while
+// scripts are added or removed concurrently
+func (ms *ManagedService) scriptRunners() map[string]ScriptRunner {
+	ms.scriptsMutex.RLock()
+	defer ms.scriptsMutex.RUnlock()
+
+	scripts := make(map[string]ScriptRunner, len(ms.scripts))
+	for path, runner := range ms.scripts {
+		scripts[path] = runner
+	}
+	return scripts
+}
+
+// newScriptRunner creates a script runner honoring the execution options in config
+// and the resource limits of the named service (empty before the name is known)
+func newScriptRunner(cfg config.Config, scriptPath, serviceName string) *service.ScriptRunner {
+	return service.NewScriptRunnerWithOptions(scriptPath, cfg.RunnerOptions(scriptPath, serviceName))
 }
 
 // Initialize loads the service definition from the scripts and validates it
 func (ms *ManagedService) Initialize(ctx context.Context) error {
-	if len(ms.scripts) == 0 {
+	return ms.initialize(ctx, nil)
+}
+
+// initializeWith initializes the service like Initialize, reusing the definition
+// the manager already probed from scriptPath instead of running its info again
+func (ms *ManagedService) initializeWith(ctx context.Context, scriptPath string, definition service.ServiceDefinition) error {
+	return ms.initialize(ctx, map[string]service.ServiceDefinition{scriptPath: definition})
+}
+
+// scriptDefinition returns a script's definition from the definitions already
+// loaded, with endpoint overrides applied as the runner would, or probes it
+func scriptDefinition(ctx context.Context, scriptPath string, runner ScriptRunner, loaded map[string]service.ServiceDefinition) (service.ServiceDefinition, error) {
+	definition, ok := loaded[scriptPath]
+	if !ok {
+		return runner.GetServiceDefinition(ctx)
+	}
+	if overrides, ok := runner.(*overrideScriptRunner); ok {
+		return overrides.withOverrides(definition), nil
+	}
+	return definition, nil
+}
+
+// initialize loads the service definition, probing each script once and not at
+// all for the scripts in loaded
+func (ms *ManagedService) initialize(ctx context.Context, loaded map[string]service.ServiceDefinition) error {
+	scripts := ms.scriptRunners()
+	if len(scripts) == 0 {
 		return fmt.Errorf("no scripts added to service")
 	}
 
 	// Get first script path for logging purposes
 	var firstScriptPath string
-	for path := range ms.scripts {
+	for path := range scripts {
 		firstScriptPath = path
 		break
 	}
 
 	logging.LogServiceLifecycle(ms.logger, "initializing", "", firstScriptPath)
 
-	// Get service definition from the first script to establish the service name
-	var firstRunner ScriptRunner
-	for _, runner := range ms.scripts {
-		firstRunner = runner
-		break
+	// Visit scripts in path order so "keeping first" on collisions is deterministic
+	scriptPaths := make([]string, 0, len(scripts))
+	for scriptPath := range scripts {
+		scriptPaths = append(scriptPaths, scriptPath)
 	}
+	sort.Strings(scriptPaths)
 
-	definition, err := firstRunner.GetServiceDefinition(ctx)
+	// Get service definition from the first script to establish the service name and version
+	definition, err := scriptDefinition(ctx, scriptPaths[0], scripts[scriptPaths[0]], loaded)
 	if err != nil {
 		logging.LogError(ms.logger, err, "failed to get service definition")
 		return fmt.Errorf("failed to get service definition: %w", err)
 	}
 
-	// Start with the first script's definition
-	ms.definition = definition
+	// Guard against empty names that would collide as a map key in the manager
+	if err := validateServiceName(definition.Name); err != nil {
+		ms.logger.Error().
+			Str("script", firstScriptPath).
+			Str("name", definition.Name).
+			Msg("Rejecting script with empty service name")
+		return fmt.Errorf("script %s: %w", firstScriptPath, err)
+	}
+
+	// Every endpoint of the service shares the prefix policy of the first script,
+	// unless the config overrides it for this service
+	prefix := ms.config.ServicePrefix(definition.Name, definition.Prefix)
 
 	// Collect all unique endpoints from all scripts with the same service name
 	allEndpoints := make(map[string]service.Endpoint) // subject -> endpoint
-	for scriptPath, runner := range ms.scripts {
-		scriptDef, err := runner.GetServiceDefinition(ctx)
-		if err != nil {
-			logging.LogError(ms.logger, err, "failed to get service definition from script "+scriptPath)
-			continue // Skip this script but continue with others
+	endpointNames := make(map[string]string)          // name -> subject, micro requires unique names
+	routes := make(map[string]scriptRoute)            // subject -> script, so requests need no info probe
+	healthChecks := make(map[string]ScriptRunner)
+	scriptDefinitions := make(map[string]service.ServiceDefinition, len(scriptPaths))
+	metadata := make(map[string]string)
+	var collisions []string // subjects declared by more than one script, for strict_grouping
+
+	// The first script's definition was loaded above
+	scriptDefinitions[scriptPaths[0]] = definition
+	for _, scriptPath := range scriptPaths {
+		runner := scripts[scriptPath]
+		scriptDef, probed := scriptDefinitions[scriptPath]
+		if !probed {
+			scriptDef, err = scriptDefinition(ctx, scriptPath, runner, loaded)
+			if err != nil {
+				logging.LogError(ms.logger, err, "failed to get service definition from script "+scriptPath)
+				continue // Skip this script but continue with others
+			}
+			scriptDefinitions[scriptPath] = scriptDef
 		}
 
 		// Verify service name matches
@@ -99,13 +274,71 @@ func (ms *ManagedService) Initialize(ctx context.Context) error {
 			continue
 		}
 
+		// Verify version is compatible with the pinned service version
+		if !service.VersionsCompatible(ms.config.GroupVersionPolicy, definition.Version, scriptDef.Version) {
+			ms.logger.Warn().
+				Str("script", scriptPath).
+				Str("expected_version", definition.Version).
+				Str("actual_version", scriptDef.Version).
+				Str("policy", ms.config.GroupVersionPolicy).
+				Msg("Script version incompatible with service group, skipping")
+			continue
+		}
+
+		// Run the script's one-time setup before any of its endpoints are served
+		if scriptDef.SupportsInit {
+			if initializer, ok := runner.(ScriptInitializer); ok {
+				if err := initializer.RunInit(ctx); err != nil {
+					logging.LogError(ms.logger, err, "init failed for script "+scriptPath)
+					return fmt.Errorf("script %s: %w", scriptPath, err)
+				}
+			}
+		}
+
+		if scriptDef.HealthCheck {
+			healthChecks[scriptPath] = runner
+		}
+
+		// Service metadata is merged across scripts; like the name and version,
+		// the first script in path order wins a conflicting key
+		for key, value := range scriptDef.Metadata {
+			if existing, exists := metadata[key]; exists {
+				if existing != value {
+					ms.logger.Warn().
+						Str("script", scriptPath).
+						Str("key", key).
+						Str("value", value).
+						Str("existing_value", existing).
+						Msg("Conflicting service metadata across scripts, keeping first")
+				}
+				continue
+			}
+			metadata[key] = value
+		}
+
 		// Add endpoints from this script
 		for _, endpoint := range scriptDef.Endpoints {
-			// Apply hostname prefixing to the subject
+			// Deeply nested metadata is expensive to encode and clutters service info
+			if limit := ms.config.MaxMetadataDepth; limit > 0 && metadataDepth(endpoint.Metadata) > limit {
+				ms.logger.Warn().
+					Str("script", scriptPath).
+					Str("endpoint", endpoint.Name).
+					Int("depth", metadataDepth(endpoint.Metadata)).
+					Int("max_metadata_depth", limit).
+					Msg("Flattening endpoint metadata nested deeper than max_metadata_depth")
+				endpoint.Metadata = flattenMetadata(endpoint.Metadata, limit)
+			}
+			declared := endpoint
+
+			// Apply the service's subject prefix (the hostname by default)
 			originalSubject := endpoint.Subject
-			endpoint.Subject = ms.config.PrefixSubject(originalSubject)
+			endpoint.Subject = ms.config.PrefixSubjectWith(prefix, ms.config.NamespaceSubject(definition.Namespace, originalSubject))
 
 			if existing, exists := allEndpoints[endpoint.Subject]; exists {
+				if ms.config.StrictGrouping {
+					collisions = append(collisions, fmt.Sprintf("%s (%s and %s)", originalSubject, routes[endpoint.Subject].scriptPath, scriptPath))
+					continue
+				}
 				ms.logger.Warn().
 					Str("subject", endpoint.Subject).
 					Str("original_subject", originalSubject).
@@ -114,16 +347,55 @@ func (ms *ManagedService) Initialize(ctx context.Context) error {
 					Msg("Duplicate endpoint subject found, keeping first")
 				continue
 			}
+			if existingSubject, exists := endpointNames[endpoint.Name]; exists {
+				ms.logger.Warn().
+					Str("script", scriptPath).
+					Str("name", endpoint.Name).
+					Str("subject", endpoint.Subject).
+					Str("existing_subject", existingSubject).
+					Msg("Duplicate endpoint name found across scripts, keeping first")
+				continue
+			}
+			endpointNames[endpoint.Name] = endpoint.Subject
 			allEndpoints[endpoint.Subject] = endpoint
+			routes[endpoint.Subject] = scriptRoute{subject: endpoint.Subject, scriptPath: scriptPath, runner: runner, endpoint: declared}
 		}
 	}
 
+	if len(collisions) > 0 {
+		return fmt.Errorf("strict_grouping: scripts of service %s declare the same subjects: %s", definition.Name, strings.Join(collisions, ", "))
+	}
+
 	// Convert map back to slice
 	endpoints := make([]service.Endpoint, 0, len(allEndpoints))
 	for _, endpoint := range allEndpoints {
 		endpoints = append(endpoints, endpoint)
 	}
-	ms.definition.Endpoints = endpoints
+	// The first script's definition, with every script's endpoints and metadata
+	definition.Endpoints = endpoints
+	definition.Metadata = nil
+	if len(metadata) > 0 {
+		definition.Metadata = metadata
+	}
+	ms.definition = definition
+	ms.scriptModTimes = scriptModTimes(scriptPaths)
+
+	// The health endpoint can't share a subject with one the scripts declared
+	if len(healthChecks) > 0 {
+		if existing, exists := allEndpoints[ms.healthSubject()]; exists {
+			ms.logger.Warn().
+				Str("subject", existing.Subject).
+				Str("endpoint", existing.Name).
+				Msg("Endpoint uses the health check subject, not serving health checks")
+			healthChecks = nil
+		}
+	}
+
+	ms.scriptsMutex.Lock()
+	ms.routes = routes
+	ms.healthChecks = healthChecks
+	ms.scriptDefinitions = scriptDefinitions
+	ms.scriptsMutex.Unlock()
 
 	// Update logger with service name only (script path is already in context)
 	ms.logger = logging.NewContextLogger(os.Stderr, ms.logger.GetLevel(), definition.Name, firstScriptPath)
@@ -136,9 +408,17 @@ func (ms *ManagedService) Initialize(ctx context.Context) error {
 
 // Serve implements the suture.Service interface
 func (ms *ManagedService) Serve(ctx context.Context) error {
+	if ms.serves != nil {
+		// Shutdown is already waiting for the running calls, so don't register a new one
+		if !ms.serves.begin() {
+			return suture.ErrDoNotRestart
+		}
+		defer ms.serves.end()
+	}
+
 	// Get first script path for logging
 	var firstScriptPath string
-	for path := range ms.scripts {
+	for path := range ms.scriptRunners() {
 		firstScriptPath = path
 		break
 	}
@@ -150,27 +430,61 @@ func (ms *ManagedService) Serve(ctx context.Context) error {
 		return fmt.Errorf("NATS connection is nil")
 	}
 
-	// Create NATS microservice
-	config := micro.Config{
-		Name:        ms.definition.Name,
-		Version:     ms.definition.Version,
-		Description: ms.definition.Description,
-	}
-
 	// Add service to NATS
-	service, err := micro.AddService(ms.natsConn, config)
+	service, err := micro.AddService(ms.natsConn, ms.microConfig())
 	if err != nil {
 		return fmt.Errorf("failed to add NATS microservice: %w", err)
 	}
 
+	// A registration failure must not leave a half-registered service answering
+	// discovery, since suture restarts Serve and registers a new one each time
+	registered := false
+	defer func() {
+		if registered {
+			return
+		}
+		if stopped, err := stopMicroService(service, ms.serviceStopTimeout()); !stopped {
+			ms.logger.Warn().Msg("Timed out stopping partially registered NATS service")
+		} else if err != nil {
+			ms.logger.Error().Err(err).Msg("Error stopping partially registered NATS service")
+		}
+	}()
+
+	// Event endpoints use plain subscriptions; they are drained on shutdown and
+	// unsubscribed here if Serve fails before reaching that point
+	var eventSubscriptions []*nats.Subscription
+	defer func() {
+		for _, sub := range eventSubscriptions {
+			if err := sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+				ms.logger.Error().Err(err).Str("subject", sub.Subject).Msg("Error unsubscribing event endpoint")
+			}
+		}
+	}()
+
 	// Add endpoints
 	for _, endpoint := range ms.definition.Endpoints {
 		endpoint := endpoint // capture loop variable
 
+		if !endpoint.AcceptsRequests() {
+			// Event-only endpoints never reply, so they bypass the micro framework;
+			// with a queue group each event is handled by one member only
+			sub, err := ms.natsConn.QueueSubscribe(endpoint.Subject, endpoint.QueueGroup, func(msg *nats.Msg) {
+				ms.HandleRequest(&eventRequest{subject: msg.Subject, data: msg.Data, headers: msg.Header, logger: ms.logger})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to subscribe event endpoint %s: %w", endpoint.Name, err)
+			}
+			eventSubscriptions = append(eventSubscriptions, sub)
+			continue
+		}
+
 		// Prepare endpoint options
 		opts := []micro.EndpointOpt{
 			micro.WithEndpointSubject(endpoint.Subject),
 		}
+		if endpoint.QueueGroup != "" {
+			opts = append(opts, micro.WithEndpointQueueGroup(endpoint.QueueGroup))
+		}
 
 		// Convert metadata to NATS format if present
 		if endpoint.Metadata != nil {
@@ -199,7 +513,12 @@ func (ms *ManagedService) Serve(ctx context.Context) error {
 			opts = append(opts, micro.WithEndpointMetadata(natsMetadata))
 		}
 
-		err := service.AddEndpoint(endpoint.Name, micro.HandlerFunc(func(req micro.Request) {
+		err := ms.registerEndpoint(ctx, service, endpoint.Name, micro.HandlerFunc(func(req micro.Request) {
+			if endpoint.AcceptsEvents() && req.Reply() == "" {
+				// A plain publish on a "both" endpoint is ingested without a reply
+				ms.HandleRequest(&eventRequest{subject: req.Subject(), data: req.Data(), headers: req.Headers(), logger: ms.logger})
+				return
+			}
 			ms.HandleRequest(&NATSRequestWrapper{req: req})
 		}), opts...)
 		if err != nil {
@@ -207,22 +526,72 @@ func (ms *ManagedService) Serve(ctx context.Context) error {
 		}
 	}
 
-	// Store service for cleanup
+	// Scripts declaring health_check are run with "health" on <service>.health
+	if ms.servesHealthChecks() {
+		err := ms.registerEndpoint(ctx, service, healthEndpointName, micro.HandlerFunc(ms.handleHealthCheck),
+			micro.WithEndpointSubject(ms.healthSubject()))
+		if err != nil {
+			return fmt.Errorf("failed to add endpoint %s: %w", healthEndpointName, err)
+		}
+	}
+
+	// Publish the service so a restart can stop it and wait for its deregistration
+	registered = true
+	ms.natsMutex.Lock()
 	ms.natsService = service
+	ms.natsMutex.Unlock()
+
+	// Every endpoint is registered, so the real handlers take over from the placeholder
+	ms.stopWarmup()
+	ms.replayBufferedRequests()
 
 	// Wait for context cancellation
 	<-ctx.Done()
 
-	// Cleanup
-	if ms.natsService != nil {
-		if err := ms.natsService.Stop(); err != nil {
-			ms.logger.Error().Err(err).Msg("Error stopping NATS service")
+	// Cleanup: stop taking new messages (draining the subscriptions) and let in-flight
+	// requests respond before returning, since the caller may close NATS afterwards.
+	// Only this call's service is stopped; a later Serve may have registered another.
+	stopTimeout := ms.serviceStopTimeout()
+	if stopped, err := stopMicroService(service, stopTimeout); !stopped {
+		ms.logger.Warn().Dur("stop_timeout", stopTimeout).Msg("Timed out stopping NATS service")
+	} else if err != nil {
+		ms.logger.Error().Err(err).Msg("Error stopping NATS service")
+	}
+	ms.natsMutex.Lock()
+	if ms.natsService == service {
+		ms.natsService = nil
+	}
+	ms.natsMutex.Unlock()
+	for _, sub := range eventSubscriptions {
+		if err := sub.Drain(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			ms.logger.Error().Err(err).Str("subject", sub.Subject).Msg("Error draining event endpoint")
 		}
 	}
+	eventSubscriptions = nil
+
+	drainTimeout := time.Duration(ms.config.DrainTimeoutMs) * time.Millisecond
+	if drainTimeout <= 0 {
+		drainTimeout = 5 * time.Second
+	}
+	if !ms.inflight.wait(drainTimeout) {
+		ms.logger.Warn().
+			Int("inflight_requests", ms.inflight.active()).
+			Int("async_jobs", ms.jobs.count()).
+			Dur("drain_timeout", drainTimeout).
+			Msg("Gave up waiting for in-flight requests to finish")
+	}
 
 	return ctx.Err()
 }
 
+// microService returns the micro service registered by the running Serve, or nil
+// when none is serving
+func (ms *ManagedService) microService() micro.Service {
+	ms.natsMutex.Lock()
+	defer ms.natsMutex.Unlock()
+	return ms.natsService
+}
+
 // createHandler creates a NATS micro handler for the given subject
 func (ms *ManagedService) createHandler(subject string) micro.Handler {
 	return micro.HandlerFunc(func(req micro.Request) {
@@ -232,97 +601,530 @@ func (ms *ManagedService) createHandler(subject string) micro.Handler {
 
 // HandleRequest processes an incoming NATS request by executing the script
 func (ms *ManagedService) HandleRequest(req Request) {
+	ms.inflight.begin()
+	defer ms.inflight.end()
+
 	ctx := context.Background()
 
-	// Find the script that handles this subject
-	var runner ScriptRunner
+	_, isEvent := req.(*eventRequest)
+	if ms.accessLog != nil || ms.statsd != nil {
+		recorded := &recordedRequest{Request: req}
+		start := time.Now()
+		defer ms.recordRequest(recorded, start)
+		req = recorded
+	}
+
+	// Find the script that handles this subject, from the definitions cached by Initialize
 	requestSubject := req.Subject()
+	route, ok := ms.route(requestSubject)
+	if !ok {
+		req.RespondError(fmt.Errorf("no script found for subject: %s", requestSubject))
+		return
+	}
+	runnerPath, matchedEndpoint := route.scriptPath, route.endpoint
+	ctx = service.WithRequestSubjects(ctx, requestSubject, req.Reply())
 
-	for _, scriptRunner := range ms.scripts {
-		// Get the service definition for this script
-		def, err := scriptRunner.GetServiceDefinition(ctx)
-		if err != nil {
-			continue // Skip scripts that can't provide definition
+	// Tell a script behind a wildcard endpoint which tokens the request filled in
+	if service.IsWildcardSubject(route.subject) {
+		tokens := wildcardTokens(route.subject, requestSubject)
+		ctx = service.WithRequestEnv(ctx, []string{wildcardTokensEnv + "=" + strings.Join(tokens, " ")})
+	}
+
+	// Tag the request for tracing, keeping the caller's ID when it sent one
+	requestID := requestIDFor(req)
+	ctx = withRequestID(ctx, requestID)
+	ctx = service.WithRequestEnv(ctx, []string{requestIDEnv + "=" + requestID})
+
+	// Reject bodies that don't match the endpoint's declared request type
+	payload := req.Data()
+	if matchedEndpoint.RequestType == service.RequestTypeJSON && !json.Valid(payload) {
+		err := &RequestError{
+			Code:    "400",
+			Message: "invalid request payload: expected " + service.RequestTypeJSON,
 		}
+		logging.LogRequestResponseWithScript(ms.requestLogger(ctx), requestSubject, runnerPath, payload, nil, err)
+		req.RespondError(err)
+		return
+	}
 
-		// Check if this script handles the requested subject
-		// We need to compare against the hostname-prefixed subjects
-		for _, endpoint := range def.Endpoints {
-			prefixedSubject := ms.config.PrefixSubject(endpoint.Subject)
-			if prefixedSubject == requestSubject {
-				runner = scriptRunner
-				break
+	// Reject requests missing a header the endpoint requires, and pass the ones
+	// present to the script's environment
+	if len(matchedEndpoint.RequiredHeaders) > 0 {
+		env, missing := requiredHeaderEnv(req.Headers(), matchedEndpoint.RequiredHeaders)
+		if len(missing) > 0 {
+			err := &RequestError{
+				Code:    "400",
+				Message: "missing required headers: " + strings.Join(missing, ", "),
 			}
+			logging.LogRequestResponseWithScript(ms.requestLogger(ctx), requestSubject, runnerPath, payload, nil, err)
+			req.RespondError(err)
+			return
 		}
+		ctx = service.WithRequestEnv(ctx, env)
+	}
 
-		if runner != nil {
-			break
+	// Apply the endpoint's input transform, if any, before the payload reaches the script
+	if matchedEndpoint.Transform != nil {
+		transformed, err := matchedEndpoint.Transform.Apply(payload)
+		if err != nil {
+			logging.LogRequestResponseWithScript(ms.requestLogger(ctx), requestSubject, runnerPath, payload, nil, err)
+			req.RespondError(fmt.Errorf("invalid request payload: %w", err))
+			return
 		}
+		payload = transformed
 	}
 
-	if runner == nil {
-		req.RespondError(fmt.Errorf("no script found for subject: %s", requestSubject))
+	// Async endpoints acknowledge right away and publish the result when the script finishes;
+	// plain publishes on them have nobody waiting for an ack and run as usual
+	if matchedEndpoint.Async && !isEvent {
+		ms.startAsyncJob(ctx, req, route, payload)
+		return
+	}
+
+	response, exitCode, err := ms.executeScript(ctx, route, requestSubject, req.Data(), payload)
+	if err != nil {
+		req.RespondError(err)
 		return
 	}
 
+	// Send successful response, with the exit code as a header if the endpoint asks for it
+	if responder, ok := req.(HeaderResponder); ok && matchedEndpoint.ExitCodeHeader {
+		err = responder.RespondWithHeaders(response, map[string][]string{ExitCodeHeader: {strconv.Itoa(exitCode)}})
+	} else {
+		err = req.Respond(response)
+	}
+	if err != nil {
+		logging.LogError(ms.logger, err, "failed to send response")
+	}
+}
+
+// waitTimeoutError is the error for a request whose timeout ran out while it
+// waited to run, before its script started
+func waitTimeoutError(timeout time.Duration, waitingFor string) *RequestError {
+	return &RequestError{Code: "504", Message: fmt.Sprintf("request timed out after %s waiting for %s", timeout, waitingFor)}
+}
+
+// requiredHeaderEnv looks up the required headers (case-insensitively, as header
+// names are) and returns their first values as script environment variables,
+// along with the names of any that are missing or empty
+func requiredHeaderEnv(headers map[string][]string, required []string) ([]string, []string) {
+	var env, missing []string
+	for _, name := range required {
+		value := headerValue(headers, name)
+		if value == "" {
+			missing = append(missing, name)
+			continue
+		}
+		env = append(env, service.HeaderEnvName(name)+"="+value)
+	}
+	return env, missing
+}
+
+// headerValue returns the first value of a header, looked up case-insensitively
+// as header names are, or "" when it is missing
+func headerValue(headers map[string][]string, name string) string {
+	for key, values := range headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// executeScript runs the matched script and returns the response to send along
+// with the script's exit code, or the error to report to the requester. Breakers
+// and exit code counts are kept per endpoint, under the route's registered subject,
+// so every subject a wildcard endpoint matches shares them.
+func (ms *ManagedService) executeScript(ctx context.Context, route scriptRoute, requestSubject string, requestData, payload []byte) ([]byte, int, error) {
+	runner, runnerPath, endpoint := route.runner, route.scriptPath, route.endpoint
+
+	// Fail fast while the endpoint's breaker is open from repeated timeouts, before
+	// the request waits for or holds any slot. A trial request that doesn't get to
+	// run is handed back so the next request can try.
+	executed := false
+	if ms.breakers != nil {
+		if allowed, retryIn := ms.breakers.Allow(route.subject); !allowed {
+			message := "endpoint is failing with repeated timeouts, circuit breaker is open"
+			if retryIn > 0 {
+				message += fmt.Sprintf(", retry in %s", retryIn.Round(time.Second))
+			}
+			return nil, 0, &RequestError{Code: "503", Message: message}
+		}
+		defer func() {
+			if !executed {
+				ms.breakers.Release(route.subject)
+			}
+		}()
+	}
+
+	// The request timeout covers waiting for slots as well as running the script,
+	// so a request queued past it is answered instead of running long after the
+	// client gave up
+	execCtx := ctx
+	timeout := ms.requestTimeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Keep a burst of requests to one service from forking unbounded processes
+	if ms.concurrencyLimit != nil {
+		if err := ms.concurrencyLimit.Acquire(execCtx); err != nil {
+			if errors.Is(err, errTooBusy) {
+				ms.logger.Warn().
+					Str("subject", requestSubject).
+					Int("max_concurrent", ms.concurrencyLimit.Limit()).
+					Msg("Rejecting request, service is too busy")
+				return nil, 0, &RequestError{Code: "503", Message: fmt.Sprintf("service %s is too busy, retry later", ms.definition.Name)}
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, 0, waitTimeoutError(timeout, "a service slot")
+			}
+			return nil, 0, fmt.Errorf("failed to acquire service slot: %w", err)
+		}
+		defer ms.concurrencyLimit.Release()
+	}
+
+	// Hold the endpoint's cost in the shared concurrency budget while the script runs,
+	// accounted to this service so fair scheduling can round-robin between services
+	if ms.requestLimiter != nil {
+		held, err := ms.requestLimiter.AcquireFor(execCtx, ms.definition.Name, int64(endpoint.Cost))
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, 0, waitTimeoutError(timeout, "an execution slot")
+			}
+			return nil, 0, fmt.Errorf("failed to acquire execution slot: %w", err)
+		}
+		defer ms.requestLimiter.Release(held)
+	}
+
+	// Smooth bursts of process starts
+	if ms.startPacer != nil {
+		if err := ms.startPacer.Wait(execCtx); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, 0, waitTimeoutError(timeout, "a process start")
+			}
+			return nil, 0, fmt.Errorf("failed to wait for process start: %w", err)
+		}
+	}
+
 	// Execute the script with the original (unprefixed) subject
-	// We need to pass the original subject to the script, not the hostname-prefixed one
-	originalSubject := ms.stripHostnamePrefix(requestSubject)
-	result, err := runner.ExecuteRequest(ctx, originalSubject, req.Data())
+	// We need to pass the original subject to the script, not the prefixed one
+	originalSubject := ms.stripSubjectPrefix(requestSubject)
+	startTime := time.Now()
+	executed = true
+	result, err := runner.ExecuteRequest(execCtx, originalSubject, payload)
+	duration := time.Since(startTime)
+
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if ms.breakers != nil {
+		if state := ms.breakers.Record(route.subject, timedOut); state == breakerOpen && timedOut {
+			ms.logger.Warn().
+				Str("subject", requestSubject).
+				Int("cooldown_ms", ms.config.CircuitBreakerCooldownMs).
+				Msg("Circuit breaker open after repeated timeouts")
+		}
+	}
+
+	if result.Truncated {
+		ms.logger.Warn().
+			Str("subject", requestSubject).
+			Str("script", runnerPath).
+			Int64("max_output_bytes", ms.config.MaxOutputBytes).
+			Msg("Script output exceeded max_output_bytes and was truncated")
+	}
+
+	// Count exit codes of scripts that ran to completion
+	if err == nil {
+		ms.exitCodes.Record(route.subject, result.ExitCode)
+	}
+
+	// Exit codes the endpoint declares as successful carry data rather than failure
+	succeeded := result.Success || (err == nil && endpoint.SucceedsWith(result.ExitCode))
 
 	// Log the request/response
 	var responseData []byte
-	if result.Success {
+	if succeeded {
 		responseData = result.Stdout
 	}
 
-	logging.LogRequestResponse(ms.logger, requestSubject, req.Data(), responseData, err)
+	logging.LogRequestResponseWithScript(ms.requestLogger(ctx), requestSubject, runnerPath, requestData, responseData, err)
+
+	if timedOut {
+		return nil, 0, &RequestError{Code: "504", Message: fmt.Sprintf("script timed out after %s", timeout)}
+	}
 
-	// Send response
 	if err != nil {
 		// Script execution failed
-		req.RespondError(fmt.Errorf("script execution failed: %w", err))
-		return
+		return nil, 0, fmt.Errorf("script execution failed: %w", err)
 	}
 
-	if !result.Success {
+	if !succeeded {
 		// Script returned non-zero exit code
 		errorMsg := fmt.Sprintf("script failed with exit code %d", result.ExitCode)
 		if len(result.Stderr) > 0 {
 			errorMsg += fmt.Sprintf(": %s", string(result.Stderr))
 		}
-		req.RespondError(fmt.Errorf("%s", errorMsg))
-		return
+		return nil, 0, fmt.Errorf("%s", errorMsg)
 	}
 
-	// Send successful response
-	if err := req.Respond(result.Stdout); err != nil {
-		logging.LogError(ms.logger, err, "failed to send response")
+	response := result.Stdout
+	if ms.outputFilter != nil {
+		response, err = ms.outputFilter.Apply(ctx, response)
+		if err != nil {
+			logging.LogError(ms.logger, err, "output filter failed for "+requestSubject)
+			return nil, 0, fmt.Errorf("output filter failed: %w", err)
+		}
 	}
+
+	if ms.config.WrapResponses {
+		response, err = wrapResponse(response, ms.definition.Name, duration)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to wrap response: %w", err)
+		}
+	}
+
+	// Reject responses the NATS server would refuse to deliver
+	if ms.natsConn != nil {
+		if maxPayload := ms.natsConn.MaxPayload(); maxPayload > 0 && int64(len(response)) > maxPayload {
+			return nil, 0, &RequestError{
+				Code:    "413",
+				Message: fmt.Sprintf("response too large: %d bytes exceeds NATS max payload of %d bytes", len(response), maxPayload),
+			}
+		}
+	}
+
+	return response, result.ExitCode, nil
 }
 
-// stripHostnamePrefix removes the hostname prefix from a subject
-// Returns the original subject without the hostname prefix
-func (ms *ManagedService) stripHostnamePrefix(subject string) string {
-	hostname, err := ms.config.ResolveHostname()
-	if err != nil {
-		// If we can't resolve hostname, return the subject as-is
-		return subject
+// responseEnvelope is the standard wrapper used when wrap_responses is enabled
+type responseEnvelope struct {
+	Data interface{}  `json:"data"`
+	Meta responseMeta `json:"meta"`
+}
+
+type responseMeta struct {
+	Service    string `json:"service"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// wrapResponse embeds script output in a response envelope, as raw JSON when the
+// output is valid JSON and as a string otherwise
+func wrapResponse(stdout []byte, serviceName string, duration time.Duration) ([]byte, error) {
+	var data interface{} = string(stdout)
+	if trimmed := bytes.TrimSpace(stdout); len(trimmed) > 0 && json.Valid(trimmed) {
+		data = json.RawMessage(trimmed)
+	}
+
+	return json.Marshal(responseEnvelope{
+		Data: data,
+		Meta: responseMeta{
+			Service:    serviceName,
+			DurationMs: duration.Milliseconds(),
+		},
+	})
+}
+
+// microConfig describes this service to the NATS micro framework
+func (ms *ManagedService) microConfig() micro.Config {
+	return micro.Config{
+		Name:         ms.definition.Name,
+		Version:      ms.definition.Version,
+		Description:  ms.definition.Description,
+		Metadata:     ms.definition.Metadata,
+		StatsHandler: ms.endpointStats,
+	}
+}
+
+// prefixSubject applies this service's namespace and subject prefix policy to a subject
+func (ms *ManagedService) prefixSubject(subject string) string {
+	subject = ms.config.NamespaceSubject(ms.definition.Namespace, subject)
+	return ms.config.PrefixSubjectWith(ms.config.ServicePrefix(ms.definition.Name, ms.definition.Prefix), subject)
+}
+
+// stripSubjectPrefix removes this service's subject prefix (the hostname by default)
+// and namespace. Returns the original subject without the prefix
+func (ms *ManagedService) stripSubjectPrefix(subject string) string {
+	subject = ms.config.StripSubjectPrefixWith(ms.config.ServicePrefix(ms.definition.Name, ms.definition.Prefix), subject)
+	return ms.config.StripNamespaceSubject(ms.definition.Namespace, subject)
+}
+
+// requestTimeout is how long a script may run for one request, zero for no limit
+func (ms *ManagedService) requestTimeout() time.Duration {
+	switch {
+	case ms.config.RequestTimeoutMs < 0:
+		return 0
+	case ms.config.RequestTimeoutMs == 0:
+		return 30 * time.Second
 	}
+	return time.Duration(ms.config.RequestTimeoutMs) * time.Millisecond
+}
+
+// serviceStopTimeout is how long stopping the micro service may take
+func (ms *ManagedService) serviceStopTimeout() time.Duration {
+	timeout := time.Duration(ms.config.ServiceStopTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return timeout
+}
+
+// Endpoint registration attempts before Serve gives up on the whole service
+const (
+	endpointRegistrationAttempts = 3
+	endpointRegistrationBackoff  = 100 * time.Millisecond
+)
 
-	prefix := hostname + "."
-	if len(subject) > len(prefix) && subject[:len(prefix)] == prefix {
-		return subject[len(prefix):]
+// registerEndpoint adds an endpoint to the micro service, retrying a failed
+// registration a few times so one flaky endpoint doesn't tear down every other
+// endpoint of the service with it
+func (ms *ManagedService) registerEndpoint(ctx context.Context, svc micro.Service, name string, handler micro.Handler, opts ...micro.EndpointOpt) error {
+	addEndpoint := ms.addEndpoint
+	if addEndpoint == nil {
+		addEndpoint = func(svc micro.Service, name string, handler micro.Handler, opts ...micro.EndpointOpt) error {
+			return svc.AddEndpoint(name, handler, opts...)
+		}
 	}
 
-	// If no prefix found, return as-is
-	return subject
+	var err error
+	for attempt := 1; attempt <= endpointRegistrationAttempts; attempt++ {
+		if err = addEndpoint(svc, name, handler, opts...); err == nil {
+			return nil
+		}
+		if attempt == endpointRegistrationAttempts {
+			break
+		}
+
+		backoff := time.Duration(attempt) * endpointRegistrationBackoff
+		ms.logger.Warn().
+			Err(err).
+			Str("endpoint", name).
+			Int("attempt", attempt).
+			Dur("retry_in", backoff).
+			Msg("Endpoint registration failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+	return err
+}
+
+// stopMicroService stops a micro service, giving up after timeout so an unresponsive
+// NATS connection can't stall a restart or shutdown. Returns false on timeout, in
+// which case Stop keeps running in the background.
+func stopMicroService(svc micro.Service, timeout time.Duration) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Stop()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return true, err
+	case <-timer.C:
+		return false, nil
+	}
+}
+
+// scriptModTimes records the modification time of each script that can be stat'ed
+func scriptModTimes(scriptPaths []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(scriptPaths))
+	for _, scriptPath := range scriptPaths {
+		if info, err := os.Stat(scriptPath); err == nil {
+			modTimes[scriptPath] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// scriptsModifiedSince reports whether any script was added, removed, or modified
+// compared to the given modification times
+func (ms *ManagedService) scriptsModifiedSince(previous map[string]time.Time) bool {
+	if len(previous) != len(ms.scriptModTimes) {
+		return true
+	}
+	for scriptPath, modTime := range ms.scriptModTimes {
+		if previousModTime, exists := previous[scriptPath]; !exists || !previousModTime.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// inflightRequests counts requests being handled so shutdown can wait for them.
+// Unlike a sync.WaitGroup it allows new requests to begin while someone is waiting.
+type inflightRequests struct {
+	mutex sync.Mutex
+	count int
+	idle  chan struct{} // closed when count drops back to zero
+}
+
+func (r *inflightRequests) begin() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.count++
+	if r.count == 1 {
+		r.idle = make(chan struct{})
+	}
+}
+
+func (r *inflightRequests) end() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.count--
+	if r.count == 0 {
+		close(r.idle)
+	}
+}
+
+func (r *inflightRequests) active() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.count
+}
+
+// wait blocks until no requests are in flight, reporting false if the timeout expired first
+func (r *inflightRequests) wait(timeout time.Duration) bool {
+	r.mutex.Lock()
+	if r.count == 0 {
+		r.mutex.Unlock()
+		return true
+	}
+	idle := r.idle
+	r.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// validateServiceName rejects service names that are empty or only whitespace
+func validateServiceName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("service name is empty or whitespace-only")
+	}
+	return nil
 }
 
 // String implements fmt.Stringer for better logging
 func (ms *ManagedService) String() string {
 	// Get first script path for string representation
-	for path := range ms.scripts {
+	for path := range ms.scriptRunners() {
 		return fmt.Sprintf("ManagedService(%s)", path)
 	}
 	return fmt.Sprintf("ManagedService(%s)", ms.definition.Name)
@@ -337,6 +1139,10 @@ func (w *NATSRequestWrapper) Subject() string {
 	return w.req.Subject()
 }
 
+func (w *NATSRequestWrapper) Reply() string {
+	return w.req.Reply()
+}
+
 func (w *NATSRequestWrapper) Data() []byte {
 	return w.req.Data()
 }
@@ -358,13 +1164,97 @@ func (w *NATSRequestWrapper) Respond(data []byte) error {
 	return w.req.Respond(data)
 }
 
+func (w *NATSRequestWrapper) RespondWithHeaders(data []byte, headers map[string][]string) error {
+	return w.req.Respond(data, micro.WithHeaders(micro.Headers(headers)))
+}
+
+// RespondError sends a micro error response. The micro framework counts it in the
+// endpoint's num_errors/last_error stats only if the response is actually sent, and
+// it refuses empty codes or descriptions, so both are always filled in here.
 func (w *NATSRequestWrapper) RespondError(err error) error {
-	return w.req.Error("500", err.Error(), nil)
+	code, description := errorCodeAndDescription(err)
+	return w.req.Error(code, description, nil)
+}
+
+// errorCodeAndDescription maps an error to a micro error code and a non-empty description
+func errorCodeAndDescription(err error) (string, string) {
+	code, description := "500", ""
+	if err != nil {
+		description = err.Error()
+	}
+
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		code, description = requestErr.Code, requestErr.Message
+		if code == "" {
+			code = "500"
+		}
+	}
+
+	if strings.TrimSpace(description) == "" {
+		description = "internal error"
+	}
+
+	return code, description
+}
+
+// eventRequest adapts a published message without a reply subject to the Request
+// interface. Responses are discarded and errors are only logged.
+type eventRequest struct {
+	subject string
+	data    []byte
+	headers map[string][]string
+	logger  zerolog.Logger
+}
+
+func (e *eventRequest) Subject() string {
+	return e.subject
+}
+
+func (e *eventRequest) Reply() string {
+	return ""
+}
+
+func (e *eventRequest) Data() []byte {
+	return e.data
+}
+
+func (e *eventRequest) Headers() map[string][]string {
+	return e.headers
+}
+
+func (e *eventRequest) Respond(data []byte) error {
+	return nil
+}
+
+func (e *eventRequest) RespondError(err error) error {
+	e.logger.Warn().Err(err).Str("subject", e.subject).Msg("Event processing failed")
+	return nil
+}
+
+// RequestError is an error response with a specific NATS micro error code
+type RequestError struct {
+	Code    string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// ExitCodeHeader carries the script's exit code on replies from endpoints that opt in
+const ExitCodeHeader = "Exit-Code"
+
+// HeaderResponder is implemented by requests that can reply with headers
+type HeaderResponder interface {
+	RespondWithHeaders(data []byte, headers map[string][]string) error
 }
 
 // Request interface abstracts NATS requests for easier testing
 type Request interface {
 	Subject() string
+	// Reply is the subject to respond on, empty for plain publishes
+	Reply() string
 	Data() []byte
 	Headers() map[string][]string
 	Respond(data []byte) error
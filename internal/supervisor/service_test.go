@@ -1,8 +1,19 @@
 package supervisor
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +21,8 @@ import (
 	"github.com/hiway/natshd/internal/logging"
 	"github.com/hiway/natshd/internal/service"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog"
 )
 
 func TestNewManagedService(t *testing.T) {
@@ -197,6 +210,130 @@ func TestManagedService_InitializeWithMetadata(t *testing.T) {
 	}
 }
 
+func TestManagedService_ServiceMetadataReachesMicroConfig(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	managedService := NewManagedService("a.sh", natsConn, logger, config.DefaultConfig())
+
+	// Grouped scripts: the first in path order wins the conflicting "team" key
+	managedService.scripts["a.sh"] = &MockScriptRunner{infoResponse: `{
+		"name": "StorageService",
+		"version": "1.0.0",
+		"metadata": {"team": "storage", "docs_url": "https://wiki.example.com/storage"},
+		"endpoints": [{"name": "List", "subject": "storage.list"}]
+	}`}
+	managedService.scripts["b.sh"] = &MockScriptRunner{infoResponse: `{
+		"name": "StorageService",
+		"version": "1.0.0",
+		"metadata": {"team": "platform", "oncall": "#storage-oncall"},
+		"endpoints": [{"name": "Get", "subject": "storage.get"}]
+	}`}
+
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"team":     "storage",
+		"docs_url": "https://wiki.example.com/storage",
+		"oncall":   "#storage-oncall",
+	}
+	microConfig := managedService.microConfig()
+	if !reflect.DeepEqual(microConfig.Metadata, expected) {
+		t.Errorf("Expected micro config metadata %v, got %v", expected, microConfig.Metadata)
+	}
+	if microConfig.Name != "StorageService" || microConfig.Version != "1.0.0" {
+		t.Errorf("Expected StorageService 1.0.0, got %s %s", microConfig.Name, microConfig.Version)
+	}
+}
+
+func TestManagedService_ServiceMetadataOmittedWhenUndeclared(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	managedService := NewManagedService("test.sh", natsConn, logger, config.DefaultConfig())
+	managedService.scripts["test.sh"] = &MockScriptRunner{infoResponse: `{
+		"name": "GreetingService",
+		"endpoints": [{"name": "Hello", "subject": "greeting.hello"}]
+	}`}
+
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if metadata := managedService.microConfig().Metadata; metadata != nil {
+		t.Errorf("Expected no micro config metadata, got %v", metadata)
+	}
+}
+
+func TestManagedService_StrictGrouping(t *testing.T) {
+	tests := []struct {
+		name           string
+		strict         bool
+		expectError    bool
+		expectedRoutes map[string]string
+	}{
+		{
+			name:           "lenient keeps first script",
+			strict:         false,
+			expectError:    false,
+			expectedRoutes: map[string]string{"shared.get": "a.sh", "a.only": "a.sh", "b.only": "b.sh"},
+		},
+		{
+			name:        "strict fails",
+			strict:      true,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.SetupLogger("info")
+			cfg := config.DefaultConfig()
+			cfg.SubjectPrefixMode = "none"
+			cfg.StrictGrouping = tt.strict
+			managedService := NewManagedService("a.sh", nil, logger, cfg)
+
+			managedService.scripts["a.sh"] = &MockScriptRunner{infoResponse: `{
+				"name": "SharedService",
+				"endpoints": [{"name": "GetA", "subject": "shared.get"}, {"name": "OnlyA", "subject": "a.only"}]
+			}`}
+			managedService.scripts["b.sh"] = &MockScriptRunner{infoResponse: `{
+				"name": "SharedService",
+				"endpoints": [{"name": "GetB", "subject": "shared.get"}, {"name": "OnlyB", "subject": "b.only"}]
+			}`}
+
+			err := managedService.Initialize(context.Background())
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected strict grouping to fail on the shared subject")
+				}
+				for _, want := range []string{"shared.get", "a.sh", "b.sh"} {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to mention %s, got: %v", want, err)
+					}
+				}
+				if strings.Contains(err.Error(), "only") {
+					t.Errorf("Expected error to list only colliding subjects, got: %v", err)
+				}
+				if len(managedService.definition.Endpoints) != 0 {
+					t.Errorf("Expected a failed Initialize to leave no endpoints, got %d", len(managedService.definition.Endpoints))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			for subject, script := range tt.expectedRoutes {
+				route, ok := managedService.route(subject)
+				if !ok || route.scriptPath != script {
+					t.Errorf("Expected %s to be served by %s, got %q", subject, script, route.scriptPath)
+				}
+			}
+		})
+	}
+}
+
 func TestManagedService_Serve(t *testing.T) {
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
@@ -311,78 +448,1638 @@ func TestManagedService_HandleRequestWithError(t *testing.T) {
 	}
 }
 
-func TestManagedService_String(t *testing.T) {
+func TestManagedService_HandleRequestWithTransform(t *testing.T) {
 	logger := logging.SetupLogger("info")
 	natsConn := (*nats.Conn)(nil) // Use nil for testing
-	managedService := NewManagedService("/path/to/test.sh", natsConn, logger, config.DefaultConfig())
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
 
-	// Add the script to the service (new service grouping structure)
-	managedService.AddScript("/path/to/test.sh")
+	mockRunner := &MockScriptRunner{
+		infoResponse: `{
+			"name": "GreetingService",
+			"endpoints": [
+				{
+					"name": "Greet",
+					"subject": "greeting.greet",
+					"transform": {"rename": {"username": "name"}}
+				}
+			]
+		}`,
+		executeResponse: service.ExecutionResult{
+			Success: true,
+			Stdout:  []byte(`{"message": "Hello"}`),
+		},
+	}
+	managedService.scripts["test.sh"] = mockRunner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
 
-	expected := "ManagedService(/path/to/test.sh)"
-	if managedService.String() != expected {
-		t.Errorf("Expected %s, got %s", expected, managedService.String())
+	request := &MockRequest{
+		subject: cfg.PrefixSubject("greeting.greet"),
+		data:    []byte(`{"username": "Alice"}`),
+	}
+
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+
+	var received map[string]interface{}
+	if err := json.Unmarshal(mockRunner.lastPayload, &received); err != nil {
+		t.Fatalf("Script received invalid JSON: %v", err)
+	}
+
+	if received["name"] != "Alice" {
+		t.Errorf("Expected script to receive renamed field 'name', got %s", string(mockRunner.lastPayload))
+	}
+
+	if _, exists := received["username"]; exists {
+		t.Errorf("Expected original field 'username' to be removed, got %s", string(mockRunner.lastPayload))
 	}
 }
 
-// Mock implementations for testing
+func TestManagedService_HandleRequestWrapsResponses(t *testing.T) {
+	tests := []struct {
+		name         string
+		stdout       string
+		expectedData interface{}
+	}{
+		{
+			name:         "JSON output embedded as JSON",
+			stdout:       `{"message": "Hello"}` + "\n",
+			expectedData: map[string]interface{}{"message": "Hello"},
+		},
+		{
+			name:         "plain text output embedded as string",
+			stdout:       "Hello, World",
+			expectedData: "Hello, World",
+		},
+	}
 
-type MockScriptRunner struct {
-	infoResponse    string
-	executeResponse service.ExecutionResult
-	executeError    error
-	lastSubject     string
-	lastPayload     []byte
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			cfg.WrapResponses = true
+			managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+			managedService.scripts["test.sh"] = &MockScriptRunner{
+				infoResponse: `{"name": "GreetingService", "endpoints": [{"name": "Greet", "subject": "greeting.greet"}]}`,
+				executeResponse: service.ExecutionResult{
+					Success: true,
+					Stdout:  []byte(tt.stdout),
+				},
+			}
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			request := &MockRequest{subject: cfg.PrefixSubject("greeting.greet"), data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+
+			var envelope struct {
+				Data interface{}            `json:"data"`
+				Meta map[string]interface{} `json:"meta"`
+			}
+			if err := json.Unmarshal(request.responseData, &envelope); err != nil {
+				t.Fatalf("Expected JSON envelope, got %s: %v", string(request.responseData), err)
+			}
+
+			if !reflect.DeepEqual(envelope.Data, tt.expectedData) {
+				t.Errorf("Expected data %v, got %v", tt.expectedData, envelope.Data)
+			}
+
+			if envelope.Meta["service"] != "GreetingService" {
+				t.Errorf("Expected meta.service 'GreetingService', got %v", envelope.Meta["service"])
+			}
+
+			if _, ok := envelope.Meta["duration_ms"].(float64); !ok {
+				t.Errorf("Expected numeric meta.duration_ms, got %v", envelope.Meta["duration_ms"])
+			}
+		})
+	}
 }
 
-func (m *MockScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
-	if m.infoResponse == "" {
-		return service.ServiceDefinition{}, nil
+func TestManagedService_HandleRequestEnforcesRequiredHeaders(t *testing.T) {
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "tenant.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TenantService", "endpoints": [{"name": "Get", "subject": "tenant.get", "required_headers": ["X-Tenant-ID"]}]}'
+  exit 0
+fi
+echo "tenant=$NATSHD_HEADER_X_TENANT_ID"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
 	}
 
-	var def service.ServiceDefinition
-	err := json.Unmarshal([]byte(m.infoResponse), &def)
-	if err != nil {
-		return service.ServiceDefinition{}, err
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
 	}
 
-	return def, def.Validate()
+	// Missing the header: rejected before the script runs
+	request := &MockRequest{subject: cfg.PrefixSubject("tenant.get"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	var requestErr *RequestError
+	if !errors.As(request.responseError, &requestErr) {
+		t.Fatalf("Expected a RequestError, got %v", request.responseError)
+	}
+	if requestErr.Code != "400" || !strings.Contains(requestErr.Message, "X-Tenant-ID") {
+		t.Errorf("Expected a 400 naming X-Tenant-ID, got %s: %s", requestErr.Code, requestErr.Message)
+	}
+
+	// With the header (in any case): the script runs and sees it in its environment
+	request = &MockRequest{
+		subject: cfg.PrefixSubject("tenant.get"),
+		data:    []byte(`{}`),
+		headers: map[string][]string{"x-tenant-id": {"acme"}},
+	}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+	if string(request.responseData) != "tenant=acme\n" {
+		t.Errorf("Expected the script to receive the tenant header, got %q", string(request.responseData))
+	}
 }
 
-func (m *MockScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
-	m.lastSubject = subject
-	m.lastPayload = payload
-	return m.executeResponse, m.executeError
+func TestManagedService_HandleRequestUsesCachedDefinitions(t *testing.T) {
+	tempDir := t.TempDir()
+	probes := filepath.Join(tempDir, "probes")
+	scriptPath := filepath.Join(tempDir, "greeting.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo probe >> "` + probes + `"
+  echo '{"name": "GreetingService", "endpoints": [{"name": "Hello", "subject": "greeting.hello"}]}'
+  exit 0
+fi
+echo '{"hello": "world"}'
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	countProbes := func() int {
+		data, err := os.ReadFile(probes)
+		if err != nil {
+			t.Fatalf("Failed to read probe log: %v", err)
+		}
+		return strings.Count(string(data), "probe")
+	}
+	initialized := countProbes()
+
+	for i := 0; i < 3; i++ {
+		request := &MockRequest{subject: cfg.PrefixSubject("greeting.hello"), data: []byte(`{}`)}
+		managedService.HandleRequest(request)
+		if request.responseError != nil {
+			t.Fatalf("Unexpected error response: %v", request.responseError)
+		}
+	}
+	if probes := countProbes(); probes != initialized {
+		t.Errorf("Expected requests not to run info again, got %d probes after Initialize's %d", probes, initialized)
+	}
+
+	// A removed script no longer serves its subjects
+	managedService.RemoveScript(scriptPath)
+	request := &MockRequest{subject: cfg.PrefixSubject("greeting.hello"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+	if request.responseError == nil {
+		t.Error("Expected an error for a subject of a removed script")
+	}
 }
 
-type MockRequest struct {
-	subject       string
-	data          []byte
-	responded     bool
-	responseData  []byte
-	responseError error
+func TestManagedService_CountsExitCodesPerSubject(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+	mockRunner := &MockScriptRunner{
+		infoResponse: `{
+			"name": "SyncService",
+			"endpoints": [
+				{"name": "Pull", "subject": "sync.pull"},
+				{"name": "Push", "subject": "sync.push"}
+			]
+		}`,
+	}
+	managedService.scripts["test.sh"] = mockRunner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	requests := []struct {
+		subject  string
+		exitCode int
+	}{
+		{"sync.pull", 0},
+		{"sync.pull", 2},
+		{"sync.pull", 2},
+		{"sync.pull", 0},
+		{"sync.pull", 0},
+		{"sync.push", 1},
+	}
+	for _, r := range requests {
+		mockRunner.executeResponse = service.ExecutionResult{Success: r.exitCode == 0, ExitCode: r.exitCode, Stdout: []byte(`{}`)}
+		managedService.HandleRequest(&MockRequest{subject: cfg.PrefixSubject(r.subject), data: []byte(`{}`)})
+	}
+
+	pull := managedService.exitCodes.Counts(cfg.PrefixSubject("sync.pull"))
+	if !reflect.DeepEqual(pull, map[int]int64{0: 3, 2: 2}) {
+		t.Errorf("Expected sync.pull exit codes {0: 3, 2: 2}, got %v", pull)
+	}
+	push := managedService.exitCodes.Counts(cfg.PrefixSubject("sync.push"))
+	if !reflect.DeepEqual(push, map[int]int64{1: 1}) {
+		t.Errorf("Expected sync.push exit codes {1: 1}, got %v", push)
+	}
+
+	// The counts are reported as custom data in micro's endpoint stats
+	stats := managedService.endpointStats(&micro.Endpoint{EndpointConfig: micro.EndpointConfig{Subject: cfg.PrefixSubject("sync.pull")}})
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Failed to encode endpoint stats: %v", err)
+	}
+	if string(data) != `{"exit_codes":{"0":3,"2":2}}` {
+		t.Errorf("Expected exit codes in endpoint stats, got %s", data)
+	}
 }
 
-func (m *MockRequest) Subject() string {
-	return m.subject
+func TestManagedService_WritesAccessLogLines(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.definition.Name = "EchoService"
+
+	var accessOutput bytes.Buffer
+	accessLog, err := logging.NewAccessLog(&accessOutput, logging.DefaultAccessLogFormat)
+	if err != nil {
+		t.Fatalf("Failed to create access log: %v", err)
+	}
+	managedService.accessLog = accessLog
+
+	managedService.scripts["test.sh"] = &MockScriptRunner{
+		infoResponse: `{
+			"name": "EchoService",
+			"endpoints": [{"name": "Echo", "subject": "echo", "request_type": "application/json"}]
+		}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"ok":true}`)},
+	}
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	subject := cfg.PrefixSubject("echo")
+	managedService.HandleRequest(&MockRequest{subject: subject, data: []byte(`{"message":"hi"}`)})
+	managedService.HandleRequest(&MockRequest{subject: subject, data: []byte(`not json`)})
+
+	lines := strings.Split(strings.TrimSuffix(accessOutput.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 access log lines, got %d: %q", len(lines), accessOutput.String())
+	}
+
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`^EchoService - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "` + regexp.QuoteMeta(subject) + `" 200 11 16 \d+$`),
+		regexp.MustCompile(`^EchoService - - \[[^\]]+\] "` + regexp.QuoteMeta(subject) + `" 400 0 8 \d+$`),
+	}
+	for i, pattern := range expected {
+		if !pattern.MatchString(lines[i]) {
+			t.Errorf("Expected access log line %d to match %s, got %q", i, pattern, lines[i])
+		}
+	}
 }
 
-func (m *MockRequest) Data() []byte {
-	return m.data
+func TestManagedService_HandleRequestEnforcesJSONRequestType(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+	mockRunner := &MockScriptRunner{
+		infoResponse: `{
+			"name": "UserService",
+			"endpoints": [{"name": "Create", "subject": "user.create", "request_type": "application/json"}]
+		}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"id": 1}`)},
+	}
+	managedService.scripts["test.sh"] = mockRunner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	request := &MockRequest{subject: cfg.PrefixSubject("user.create"), data: []byte(`name=Alice`)}
+	managedService.HandleRequest(request)
+
+	var requestErr *RequestError
+	if !errors.As(request.responseError, &requestErr) {
+		t.Fatalf("Expected a RequestError, got %v", request.responseError)
+	}
+
+	if requestErr.Code != "400" {
+		t.Errorf("Expected error code 400, got %s", requestErr.Code)
+	}
+
+	if mockRunner.lastPayload != nil {
+		t.Errorf("Expected script not to run, but it received %s", string(mockRunner.lastPayload))
+	}
+
+	// Valid JSON still reaches the script
+	request = &MockRequest{subject: cfg.PrefixSubject("user.create"), data: []byte(`{"name": "Alice"}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+
+	if string(request.responseData) != `{"id": 1}` {
+		t.Errorf("Expected script response, got %s", string(request.responseData))
+	}
 }
 
-func (m *MockRequest) Headers() map[string][]string {
-	return nil
+func TestManagedService_HandleRequestLogsHandlerScript(t *testing.T) {
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("/scripts/system-facts.sh", natsConn, logging.SetupLogger("info"), cfg)
+
+	managedService.scripts["/scripts/system-facts.sh"] = &MockScriptRunner{
+		infoResponse:    `{"name": "SystemService", "endpoints": [{"name": "Facts", "subject": "system.facts"}]}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"os": "linux"}`)},
+	}
+	managedService.scripts["/scripts/system-hardware.sh"] = &MockScriptRunner{
+		infoResponse:    `{"name": "SystemService", "endpoints": [{"name": "Hardware", "subject": "system.hardware"}]}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"cpu": 4}`)},
+	}
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	managedService.logger = newTestLogger(t, &buf, zerolog.DebugLevel)
+
+	request := &MockRequest{subject: cfg.PrefixSubject("system.hardware"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+
+	var logEntry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+		t.Fatalf("Failed to parse log as JSON: %v (%s)", err, buf.String())
+	}
+
+	if logEntry["handler_script"] != "/scripts/system-hardware.sh" {
+		t.Errorf("Expected handler_script '/scripts/system-hardware.sh', got %v", logEntry["handler_script"])
+	}
 }
 
-func (m *MockRequest) Respond(data []byte) error {
-	m.responded = true
-	m.responseData = data
-	return nil
+func TestManagedService_HandleRequestPassesSubjectEnv(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "subjects.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SubjectService", "endpoints": [{"name": "Show", "subject": "subjects.show"}]}'
+  exit 0
+fi
+echo -n "$NATS_SUBJECT $NATS_FULL_SUBJECT $NATS_REPLY"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = filepath.Dir(scriptPath)
+	cfg.Hostname = "web-01"
+	managedService := NewManagedService(scriptPath, natsConn, logging.SetupLogger("info"), cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	request := &MockRequest{subject: "web-01.subjects.show", reply: "_INBOX.abc123", data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+
+	expected := "subjects.show web-01.subjects.show _INBOX.abc123"
+	if string(request.responseData) != expected {
+		t.Errorf("Expected script to see %q, got %q", expected, request.responseData)
+	}
 }
 
-func (m *MockRequest) RespondError(err error) error {
-	m.responded = true
-	m.responseError = err
-	return nil
+func TestManagedService_HandleRequestRoutesWildcardSubjects(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "metrics.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "MetricsService", "endpoints": [{"name": "Metric", "subject": "metrics.*"}, {"name": "Event", "subject": "events.>"}]}'
+  exit 0
+fi
+echo -n "$1"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = filepath.Dir(scriptPath)
+	cfg.Hostname = "web-01"
+
+	// Wildcard subjects are refused unless allow_wildcards is set
+	refused := NewManagedService(scriptPath, natsConn, logging.SetupLogger("info"), cfg)
+	refused.AddScript(scriptPath)
+	if err := refused.Initialize(context.Background()); err == nil {
+		t.Fatal("Expected Initialize to reject wildcard subjects without allow_wildcards")
+	}
+
+	cfg.AllowWildcards = true
+	managedService := NewManagedService(scriptPath, natsConn, logging.SetupLogger("info"), cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	tests := []struct {
+		subject     string
+		expected    string
+		expectError bool
+	}{
+		{subject: "web-01.metrics.cpu", expected: "metrics.cpu"},
+		{subject: "web-01.metrics.memory", expected: "metrics.memory"},
+		{subject: "web-01.events.user.created", expected: "events.user.created"},
+		{subject: "web-01.metrics.cpu.load", expectError: true},
+		{subject: "web-02.metrics.cpu", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			request := &MockRequest{subject: tt.subject, data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+
+			if tt.expectError {
+				if request.responseError == nil {
+					t.Errorf("Expected no route for %s, got response %q", tt.subject, request.responseData)
+				}
+				return
+			}
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+			if string(request.responseData) != tt.expected {
+				t.Errorf("Expected script to get %q as $1, got %q", tt.expected, request.responseData)
+			}
+		})
+	}
+}
+
+func TestManagedService_WildcardEndpointSharesExitCodesAndBreaker(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.AllowWildcards = true
+	cfg.RequestTimeoutMs = 20
+	cfg.CircuitBreakerThreshold = 2
+	cfg.CircuitBreakerCooldownMs = 60000
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+	runner := &HangingScriptRunner{definition: service.ServiceDefinition{
+		Name:      "MetricsService",
+		Endpoints: []service.Endpoint{{Name: "Metric", Subject: "metrics.*"}},
+	}}
+	managedService.scripts["test.sh"] = runner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	pattern := cfg.PrefixSubject("metrics.*")
+	for _, metric := range []string{"cpu", "memory", "disk"} {
+		request := &MockRequest{subject: cfg.PrefixSubject("metrics." + metric), data: []byte(`{}`)}
+		managedService.HandleRequest(request)
+		if request.responseError != nil {
+			t.Fatalf("Unexpected error response for %s: %v", metric, request.responseError)
+		}
+	}
+
+	// Exit codes of every matched subject are counted under the endpoint's subject
+	stats := managedService.endpointStats(&micro.Endpoint{EndpointConfig: micro.EndpointConfig{Subject: pattern}})
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Failed to encode endpoint stats: %v", err)
+	}
+	if string(data) != `{"exit_codes":{"0":3}}` {
+		t.Errorf("Expected the wildcard endpoint to report its exit codes, got %s", data)
+	}
+
+	// Timeouts on different subjects add up to open the endpoint's one breaker
+	runner.hanging.Store(true)
+	for _, metric := range []string{"cpu", "memory"} {
+		managedService.HandleRequest(&MockRequest{subject: cfg.PrefixSubject("metrics." + metric), data: []byte(`{}`)})
+	}
+	if state := managedService.breakers.State(pattern); state != breakerOpen {
+		t.Fatalf("Expected the wildcard endpoint's breaker to be open, got %s", state)
+	}
+
+	request := &MockRequest{subject: cfg.PrefixSubject("metrics.network"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+	var requestErr *RequestError
+	if !errors.As(request.responseError, &requestErr) || requestErr.Code != "503" {
+		t.Errorf("Expected a subject not seen before to fail fast with 503, got %v", request.responseError)
+	}
+
+	// Client-chosen subjects don't grow the per-endpoint state
+	managedService.breakers.mutex.Lock()
+	breakers := len(managedService.breakers.endpoints)
+	managedService.breakers.mutex.Unlock()
+	if breakers != 1 {
+		t.Errorf("Expected 1 breaker for the wildcard endpoint, got %d", breakers)
+	}
+	managedService.exitCodes.mutex.Lock()
+	counted := len(managedService.exitCodes.endpoints)
+	managedService.exitCodes.mutex.Unlock()
+	if counted != 1 {
+		t.Errorf("Expected exit codes counted for 1 endpoint, got %d", counted)
+	}
+}
+
+func TestManagedService_HandleRequestPassesWildcardTokens(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "metrics.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "MetricsService", "endpoints": [{"name": "Metric", "subject": "metrics.*"}, {"name": "Event", "subject": "events.>"}, {"name": "Status", "subject": "status"}]}'
+  exit 0
+fi
+echo -n "$1|${NATS_WILDCARD_TOKENS-unset}"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = filepath.Dir(scriptPath)
+	cfg.Hostname = "web-01"
+	cfg.AllowWildcards = true
+	managedService := NewManagedService(scriptPath, natsConn, logging.SetupLogger("info"), cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// One script serves every concrete subject under its wildcard endpoints
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{subject: "web-01.metrics.cpu", expected: "metrics.cpu|cpu"},
+		{subject: "web-01.metrics.memory", expected: "metrics.memory|memory"},
+		{subject: "web-01.events.user.created", expected: "events.user.created|user created"},
+		{subject: "web-01.status", expected: "status|unset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			request := &MockRequest{subject: tt.subject, data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+			if string(request.responseData) != tt.expected {
+				t.Errorf("Expected script to see %q, got %q", tt.expected, request.responseData)
+			}
+		})
+	}
+}
+
+func TestManagedService_HandleRequestRequestID(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "traced.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "TracedService", "endpoints": [{"name": "Trace", "subject": "traced.trace"}]}'
+  exit 0
+fi
+echo -n "$NATS_REQUEST_ID"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		name       string
+		headers    map[string][]string
+		expectedID string // empty expects a generated UUID
+	}{
+		{name: "generated", headers: nil},
+		{name: "propagated", headers: map[string][]string{"X-Request-ID": {"trace-abc-123"}}, expectedID: "trace-abc-123"},
+		{name: "propagated case-insensitively", headers: map[string][]string{"x-request-id": {"trace-def-456"}}, expectedID: "trace-def-456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			cfg.ScriptsPath = filepath.Dir(scriptPath)
+			managedService := NewManagedService(scriptPath, natsConn, logging.SetupLogger("info"), cfg)
+			managedService.AddScript(scriptPath)
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			var buf bytes.Buffer
+			managedService.logger = newTestLogger(t, &buf, zerolog.DebugLevel)
+
+			request := &MockRequest{subject: cfg.PrefixSubject("traced.trace"), data: []byte(`{}`), headers: tt.headers}
+			managedService.HandleRequest(request)
+
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+
+			scriptID := string(request.responseData)
+			if tt.expectedID != "" && scriptID != tt.expectedID {
+				t.Errorf("Expected script to see request ID %q, got %q", tt.expectedID, scriptID)
+			}
+			if tt.expectedID == "" && !uuidPattern.MatchString(scriptID) {
+				t.Errorf("Expected script to see a generated UUID, got %q", scriptID)
+			}
+
+			var logEntry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+				t.Fatalf("Failed to parse log as JSON: %v (%s)", err, buf.String())
+			}
+			if logEntry["request_id"] != scriptID {
+				t.Errorf("Expected request_id %q in the log, got %v", scriptID, logEntry["request_id"])
+			}
+		})
+	}
+}
+
+func TestManagedService_HandleRequestLogsTruncatedOutput(t *testing.T) {
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.MaxOutputBytes = 4
+	managedService := NewManagedService("/scripts/chatty.sh", natsConn, logging.SetupLogger("info"), cfg)
+
+	managedService.scripts["/scripts/chatty.sh"] = &MockScriptRunner{
+		infoResponse:    `{"name": "ChattyService", "endpoints": [{"name": "Talk", "subject": "chatty.talk"}]}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte("blah"), Truncated: true},
+	}
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	managedService.logger = logging.SetupLoggerWithWriter(&buf, "info")
+
+	request := &MockRequest{subject: cfg.PrefixSubject("chatty.talk"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+	if string(request.responseData) != "blah" {
+		t.Errorf("Expected the truncated output as the response, got %q", request.responseData)
+	}
+
+	if !strings.Contains(buf.String(), "truncated") || !strings.Contains(buf.String(), `"max_output_bytes":4`) {
+		t.Errorf("Expected a truncation warning in the log, got: %s", buf.String())
+	}
+}
+
+func TestManagedService_InitializeRejectsWhitespaceName(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	managedService := NewManagedService("test.sh", natsConn, logger, config.DefaultConfig())
+
+	// A runner that skips definition validation, as a lax or transformed definition might
+	managedService.scripts["test.sh"] = &StaticScriptRunner{
+		definition: service.ServiceDefinition{
+			Name:      "   ",
+			Endpoints: []service.Endpoint{{Name: "Test", Subject: "test.endpoint"}},
+		},
+	}
+
+	err := managedService.Initialize(context.Background())
+	if err == nil {
+		t.Fatal("Expected whitespace-only service name to be rejected")
+	}
+
+	if !strings.Contains(err.Error(), "service name is empty") || !strings.Contains(err.Error(), "test.sh") {
+		t.Errorf("Expected clear error naming the script, got: %v", err)
+	}
+
+	if managedService.initialized {
+		t.Error("Expected service to remain uninitialized")
+	}
+}
+
+func TestManagedService_InitializeSkipsDuplicateEndpointNamesAcrossScripts(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("a.sh", natsConn, logger, cfg)
+
+	managedService.scripts["a.sh"] = &MockScriptRunner{
+		infoResponse: `{"name": "UserService", "endpoints": [{"name": "Get", "subject": "user.get"}]}`,
+	}
+	managedService.scripts["b.sh"] = &MockScriptRunner{
+		infoResponse: `{"name": "UserService", "endpoints": [
+			{"name": "Get", "subject": "account.get"},
+			{"name": "Delete", "subject": "account.delete"}
+		]}`,
+	}
+
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	subjects := make(map[string]string)
+	for _, endpoint := range managedService.definition.Endpoints {
+		if _, exists := subjects[endpoint.Name]; exists {
+			t.Errorf("Expected endpoint name %s to be registered once", endpoint.Name)
+		}
+		subjects[endpoint.Name] = endpoint.Subject
+	}
+
+	if len(subjects) != 2 {
+		t.Errorf("Expected 2 endpoints, got %d", len(managedService.definition.Endpoints))
+	}
+
+	if subjects["Get"] != cfg.PrefixSubject("user.get") {
+		t.Errorf("Expected Get from the first script (%s), got %s", cfg.PrefixSubject("user.get"), subjects["Get"])
+	}
+
+	if subjects["Delete"] != cfg.PrefixSubject("account.delete") {
+		t.Errorf("Expected Delete on %s, got %s", cfg.PrefixSubject("account.delete"), subjects["Delete"])
+	}
+}
+
+func TestManagedService_HandleRequestConsumesEndpointCost(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.requestLimiter = NewWeightedSemaphore(10)
+
+	runner := &BlockingScriptRunner{
+		MockScriptRunner: MockScriptRunner{
+			infoResponse: `{
+				"name": "BuildService",
+				"endpoints": [{"name": "Compile", "subject": "build.compile", "cost": 4}]
+			}`,
+			executeResponse: service.ExecutionResult{Success: true, Stdout: []byte("ok")},
+		},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	managedService.scripts["test.sh"] = runner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	request := &MockRequest{subject: cfg.PrefixSubject("build.compile"), data: []byte(`{}`)}
+	done := make(chan struct{})
+	go func() {
+		managedService.HandleRequest(request)
+		close(done)
+	}()
+
+	<-runner.started
+	if available := managedService.requestLimiter.Available(); available != 6 {
+		t.Errorf("Expected a cost-4 request to leave 6 units available, got %d", available)
+	}
+
+	close(runner.release)
+	<-done
+
+	if available := managedService.requestLimiter.Available(); available != 10 {
+		t.Errorf("Expected capacity to be restored after the request, got %d", available)
+	}
+}
+
+func TestManagedService_MaxConcurrent(t *testing.T) {
+	tests := []struct {
+		name         string
+		overflow     string
+		expectReject bool
+	}{
+		{name: "queue", overflow: ConcurrencyOverflowQueue, expectReject: false},
+		{name: "reject", overflow: ConcurrencyOverflowReject, expectReject: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			managedService := NewManagedService("busy.sh", natsConn, logger, cfg)
+			managedService.concurrencyLimit = NewConcurrencyLimit(1, cfg.ConcurrencyQueueSize, tt.overflow)
+
+			gate := make(chan struct{})
+			completions := make(chan string, 2)
+			managedService.scripts["busy.sh"] = &GatedScriptRunner{
+				definition: service.ServiceDefinition{
+					Name:      "BusyService",
+					Endpoints: []service.Endpoint{{Name: "Work", Subject: "busy.work"}},
+				},
+				gate:        gate,
+				completions: completions,
+			}
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			waitFor := func(description string, condition func() bool) {
+				deadline := time.Now().Add(2 * time.Second)
+				for !condition() {
+					if time.Now().After(deadline) {
+						t.Fatalf("Timed out waiting for %s", description)
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}
+
+			// The first request holds the only slot until the gate opens
+			first := &MockRequest{subject: cfg.PrefixSubject("busy.work"), data: []byte(`{}`)}
+			firstDone := make(chan struct{})
+			go func() {
+				managedService.HandleRequest(first)
+				close(firstDone)
+			}()
+			waitFor("the first request to start", func() bool { return managedService.concurrencyLimit.Active() == 1 })
+
+			second := &MockRequest{subject: cfg.PrefixSubject("busy.work"), data: []byte(`{}`)}
+			secondDone := make(chan struct{})
+			go func() {
+				managedService.HandleRequest(second)
+				close(secondDone)
+			}()
+
+			if tt.expectReject {
+				<-secondDone
+				var requestErr *RequestError
+				if !errors.As(second.responseError, &requestErr) || requestErr.Code != "503" || !strings.Contains(requestErr.Message, "too busy") {
+					t.Errorf("Expected a 503 too busy error, got %v", second.responseError)
+				}
+				gate <- struct{}{}
+				<-firstDone
+			} else {
+				waitFor("the second request to queue", func() bool { return managedService.concurrencyLimit.Queued() == 1 })
+				select {
+				case <-secondDone:
+					t.Fatal("Expected the second request to wait for a slot")
+				default:
+				}
+				gate <- struct{}{}
+				gate <- struct{}{}
+				<-firstDone
+				<-secondDone
+				if second.responseError != nil || string(second.responseData) != "ok" {
+					t.Errorf("Expected the queued request to succeed, got %q, %v", second.responseData, second.responseError)
+				}
+			}
+
+			if first.responseError != nil || string(first.responseData) != "ok" {
+				t.Errorf("Expected the first request to succeed, got %q, %v", first.responseData, first.responseError)
+			}
+			if active := managedService.concurrencyLimit.Active(); active != 0 {
+				t.Errorf("Expected every slot released, got %d in use", active)
+			}
+		})
+	}
+}
+
+func TestManagedService_FairSchedulingServesLightService(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	limiter := NewFairWeightedSemaphore(1)
+
+	gate := make(chan struct{})
+	completions := make(chan string, 16)
+
+	newService := func(name, subject string) *ManagedService {
+		ms := NewManagedService(name+".sh", natsConn, logger, cfg)
+		ms.scripts[name+".sh"] = &GatedScriptRunner{
+			definition: service.ServiceDefinition{
+				Name:      name,
+				Endpoints: []service.Endpoint{{Name: "Handle", Subject: subject}},
+			},
+			gate:        gate,
+			completions: completions,
+		}
+		if err := ms.Initialize(context.Background()); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		ms.requestLimiter = limiter
+		return ms
+	}
+
+	flooding := newService("FloodService", "flood.handle")
+	light := newService("LightService", "light.handle")
+
+	waitForQueue := func(expected int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for limiter.Waiting() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d queued requests, got %d", expected, limiter.Waiting())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// One flood request holds the only slot, the rest queue up behind it
+	const floodRequests = 5
+	for i := 0; i < floodRequests; i++ {
+		go flooding.HandleRequest(&MockRequest{subject: cfg.PrefixSubject("flood.handle"), data: []byte(`{}`)})
+	}
+	waitForQueue(floodRequests - 1)
+
+	go light.HandleRequest(&MockRequest{subject: cfg.PrefixSubject("light.handle"), data: []byte(`{}`)})
+	waitForQueue(floodRequests)
+
+	var order []string
+	for i := 0; i < floodRequests+1; i++ {
+		gate <- struct{}{}
+		order = append(order, <-completions)
+	}
+
+	if order[1] != "LightService" {
+		t.Errorf("Expected the light service to run right after the in-flight flood request, got order %v", order)
+	}
+}
+
+func TestManagedService_HandleRequestAppliesOutputFilter(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.OutputFilterCommand = "tr a-z A-Z"
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+	mockRunner := &MockScriptRunner{
+		infoResponse: `{
+			"name": "GreetingService",
+			"endpoints": [{"name": "Hello", "subject": "greeting.hello"}]
+		}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"message": "hello"}`)},
+	}
+	managedService.scripts["test.sh"] = mockRunner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	request := &MockRequest{subject: cfg.PrefixSubject("greeting.hello"), data: []byte(`{}`)}
+	managedService.HandleRequest(request)
+
+	if request.responseError != nil {
+		t.Fatalf("Unexpected error response: %v", request.responseError)
+	}
+
+	if string(request.responseData) != `{"MESSAGE": "HELLO"}` {
+		t.Errorf("Expected filtered response, got %s", string(request.responseData))
+	}
+}
+
+func TestManagedService_HandleRequestExitCodeHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		exitCodeHeader bool
+		result         service.ExecutionResult
+		expectHeader   string
+	}{
+		{
+			name:           "zero exit code",
+			exitCodeHeader: true,
+			result:         service.ExecutionResult{Success: true, ExitCode: 0, Stdout: []byte(`{"found": true}`)},
+			expectHeader:   "0",
+		},
+		{
+			name:           "declared success exit code",
+			exitCodeHeader: true,
+			result:         service.ExecutionResult{Success: false, ExitCode: 3, Stdout: []byte(`{"found": true}`)},
+			expectHeader:   "3",
+		},
+		{
+			name:           "header not requested",
+			exitCodeHeader: false,
+			result:         service.ExecutionResult{Success: true, ExitCode: 0, Stdout: []byte(`{"found": true}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+			managedService.scripts["test.sh"] = &MockScriptRunner{
+				infoResponse: fmt.Sprintf(`{
+					"name": "LookupService",
+					"endpoints": [{"name": "Find", "subject": "lookup.find", "exit_code_header": %t, "success_exit_codes": [3]}]
+				}`, tt.exitCodeHeader),
+				executeResponse: tt.result,
+			}
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			request := &MockRequest{subject: cfg.PrefixSubject("lookup.find"), data: []byte(`{}`)}
+			managedService.HandleRequest(request)
+
+			if request.responseError != nil {
+				t.Fatalf("Unexpected error response: %v", request.responseError)
+			}
+
+			if string(request.responseData) != `{"found": true}` {
+				t.Errorf("Expected script output, got %s", string(request.responseData))
+			}
+
+			got := request.responseHeaders[ExitCodeHeader]
+			if tt.expectHeader == "" {
+				if got != nil {
+					t.Errorf("Expected no %s header, got %v", ExitCodeHeader, got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != tt.expectHeader {
+				t.Errorf("Expected %s header %q, got %v", ExitCodeHeader, tt.expectHeader, got)
+			}
+		})
+	}
+}
+
+// slowMicroService is a micro.Service whose Stop takes stopDelay to return
+type slowMicroService struct {
+	micro.Service
+	stopDelay time.Duration
+	stopErr   error
+}
+
+func (s *slowMicroService) Stop() error {
+	time.Sleep(s.stopDelay)
+	return s.stopErr
+}
+
+func TestStopMicroService_HonorsTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		stopDelay     time.Duration
+		stopErr       error
+		expectStopped bool
+	}{
+		{name: "fast stop", stopDelay: 0, expectStopped: true},
+		{name: "fast stop with error", stopDelay: 0, stopErr: errors.New("drain failed"), expectStopped: true},
+		{name: "hung stop", stopDelay: 2 * time.Second, expectStopped: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &slowMicroService{stopDelay: tt.stopDelay, stopErr: tt.stopErr}
+
+			start := time.Now()
+			stopped, err := stopMicroService(svc, 100*time.Millisecond)
+			elapsed := time.Since(start)
+
+			if stopped != tt.expectStopped {
+				t.Errorf("Expected stopped=%v, got %v", tt.expectStopped, stopped)
+			}
+			if !errors.Is(err, tt.stopErr) {
+				t.Errorf("Expected error %v, got %v", tt.stopErr, err)
+			}
+			if elapsed > time.Second {
+				t.Errorf("Expected stop to return within the timeout, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestManagedService_CircuitBreakerOpensOnRepeatedTimeoutsAndRecovers(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.RequestTimeoutMs = 20
+	cfg.CircuitBreakerThreshold = 2
+	cfg.CircuitBreakerCooldownMs = 100
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+	runner := &HangingScriptRunner{definition: service.ServiceDefinition{
+		Name:      "ReportService",
+		Endpoints: []service.Endpoint{{Name: "Build", Subject: "reports.build"}},
+	}}
+	runner.hanging.Store(true)
+	managedService.scripts["test.sh"] = runner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	subject := cfg.PrefixSubject("reports.build")
+	expectCode := func(step, code string) {
+		t.Helper()
+		request := &MockRequest{subject: subject, data: []byte(`{}`)}
+		managedService.HandleRequest(request)
+
+		if code == "" {
+			if request.responseError != nil {
+				t.Fatalf("%s: expected success, got %v", step, request.responseError)
+			}
+			return
+		}
+		var requestErr *RequestError
+		if !errors.As(request.responseError, &requestErr) || requestErr.Code != code {
+			t.Fatalf("%s: expected error code %s, got %v", step, code, request.responseError)
+		}
+	}
+
+	// Consecutive timeouts up to the threshold open the breaker
+	expectCode("first timeout", "504")
+	expectCode("second timeout", "504")
+	if state := managedService.breakers.State(subject); state != breakerOpen {
+		t.Fatalf("Expected breaker to be open, got %s", state)
+	}
+
+	// While open, requests fail fast without running the script
+	executions := runner.executions.Load()
+	expectCode("open breaker", "503")
+	if runner.executions.Load() != executions {
+		t.Error("Expected open breaker to skip script execution")
+	}
+
+	// After the cooldown a trial request runs, and its success closes the breaker
+	runner.hanging.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	expectCode("trial request", "")
+	if state := managedService.breakers.State(subject); state != breakerClosed {
+		t.Errorf("Expected breaker to close after a successful trial, got %s", state)
+	}
+	expectCode("after recovery", "")
+}
+
+func TestManagedService_RequestTimeoutBoundsSlotWaits(t *testing.T) {
+	tests := []struct {
+		name     string
+		occupy   func(t *testing.T, ms *ManagedService) // takes the only slot of one kind
+		expected string
+	}{
+		{
+			name: "service slot",
+			occupy: func(t *testing.T, ms *ManagedService) {
+				ms.concurrencyLimit = NewConcurrencyLimit(1, 10, ConcurrencyOverflowQueue)
+				if err := ms.concurrencyLimit.Acquire(context.Background()); err != nil {
+					t.Fatalf("Failed to take the slot: %v", err)
+				}
+			},
+			expected: "waiting for a service slot",
+		},
+		{
+			name: "execution slot",
+			occupy: func(t *testing.T, ms *ManagedService) {
+				ms.requestLimiter = NewWeightedSemaphore(1)
+				if _, err := ms.requestLimiter.AcquireFor(context.Background(), "OtherService", 1); err != nil {
+					t.Fatalf("Failed to take the slot: %v", err)
+				}
+			},
+			expected: "waiting for an execution slot",
+		},
+		{
+			name: "process start",
+			occupy: func(t *testing.T, ms *ManagedService) {
+				ms.startPacer = NewStartPacer(1, time.Hour)
+				if err := ms.startPacer.Wait(context.Background()); err != nil {
+					t.Fatalf("Failed to take the start: %v", err)
+				}
+			},
+			expected: "waiting for a process start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.SetupLogger("info")
+			natsConn := (*nats.Conn)(nil) // Use nil for testing
+			cfg := config.DefaultConfig()
+			cfg.RequestTimeoutMs = 50
+			managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+
+			runner := &HangingScriptRunner{definition: service.ServiceDefinition{
+				Name:      "ReportService",
+				Endpoints: []service.Endpoint{{Name: "Build", Subject: "reports.build"}},
+			}}
+			managedService.scripts["test.sh"] = runner
+			if err := managedService.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			tt.occupy(t, managedService)
+
+			done := make(chan *MockRequest, 1)
+			go func() {
+				request := &MockRequest{subject: cfg.PrefixSubject("reports.build"), data: []byte(`{}`)}
+				managedService.HandleRequest(request)
+				done <- request
+			}()
+
+			select {
+			case request := <-done:
+				var requestErr *RequestError
+				if !errors.As(request.responseError, &requestErr) || requestErr.Code != "504" {
+					t.Fatalf("Expected a 504 once the request timeout ran out, got %v", request.responseError)
+				}
+				if !strings.Contains(requestErr.Message, tt.expected) {
+					t.Errorf("Expected the error to say %q, got %q", tt.expected, requestErr.Message)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Expected the request timeout to end the wait")
+			}
+			if executions := runner.executions.Load(); executions != 0 {
+				t.Errorf("Expected the timed out request not to run the script, got %d executions", executions)
+			}
+		})
+	}
+}
+
+func TestManagedService_OpenBreakerFailsFastWithoutWaitingForASlot(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.CircuitBreakerThreshold = 1
+	cfg.CircuitBreakerCooldownMs = 60000
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.concurrencyLimit = NewConcurrencyLimit(1, 10, ConcurrencyOverflowQueue)
+
+	runner := &HangingScriptRunner{definition: service.ServiceDefinition{
+		Name:      "ReportService",
+		Endpoints: []service.Endpoint{{Name: "Build", Subject: "reports.build"}},
+	}}
+	managedService.scripts["test.sh"] = runner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	subject := cfg.PrefixSubject("reports.build")
+	managedService.breakers.Record(subject, true)
+
+	// Another request holds the service's only slot
+	if err := managedService.concurrencyLimit.Acquire(context.Background()); err != nil {
+		t.Fatalf("Failed to take the slot: %v", err)
+	}
+	defer managedService.concurrencyLimit.Release()
+
+	done := make(chan *MockRequest, 1)
+	go func() {
+		request := &MockRequest{subject: subject, data: []byte(`{}`)}
+		managedService.HandleRequest(request)
+		done <- request
+	}()
+
+	select {
+	case request := <-done:
+		var requestErr *RequestError
+		if !errors.As(request.responseError, &requestErr) || requestErr.Code != "503" {
+			t.Errorf("Expected a 503 from the open breaker, got %v", request.responseError)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the open breaker to fail fast instead of queueing for a slot")
+	}
+	if queued := managedService.concurrencyLimit.Queued(); queued != 0 {
+		t.Errorf("Expected no request queued for a slot, got %d", queued)
+	}
+}
+
+func TestManagedService_StartPacerSpacesProcessStarts(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.startPacer = NewStartPacer(2, 100*time.Millisecond)
+
+	runner := &RecordingScriptRunner{definition: service.ServiceDefinition{
+		Name:      "BurstService",
+		Endpoints: []service.Endpoint{{Name: "Run", Subject: "burst.run"}},
+	}}
+	managedService.scripts["test.sh"] = runner
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	const requests = 6
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			managedService.HandleRequest(&MockRequest{subject: cfg.PrefixSubject("burst.run"), data: []byte(`{}`)})
+		}()
+	}
+	wg.Wait()
+
+	starts := runner.startTimes()
+	if len(starts) != requests {
+		t.Fatalf("Expected %d process starts, got %d", requests, len(starts))
+	}
+
+	// No more than 2 starts may fall within any 100ms window
+	for i := 0; i+2 < len(starts); i++ {
+		if gap := starts[i+2].Sub(starts[i]); gap < 95*time.Millisecond {
+			t.Errorf("Expected starts %d and %d to be at least 100ms apart, got %v", i, i+2, gap)
+		}
+	}
+}
+
+func TestNATSRequestWrapper_RespondErrorAlwaysSendsResponse(t *testing.T) {
+	tests := []struct {
+		name                string
+		err                 error
+		expectedCode        string
+		expectedDescription string
+	}{
+		{"plain error", fmt.Errorf("boom"), "500", "boom"},
+		{"coded error", &RequestError{Code: "400", Message: "bad request"}, "400", "bad request"},
+		{"empty message", fmt.Errorf(""), "500", "internal error"},
+		{"empty coded error", &RequestError{}, "500", "internal error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			microReq := &FakeMicroRequest{}
+			wrapper := &NATSRequestWrapper{req: microReq}
+
+			if err := wrapper.RespondError(tt.err); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if microReq.errorCode != tt.expectedCode {
+				t.Errorf("Expected code %s, got %s", tt.expectedCode, microReq.errorCode)
+			}
+
+			if microReq.errorDescription != tt.expectedDescription {
+				t.Errorf("Expected description %q, got %q", tt.expectedDescription, microReq.errorDescription)
+			}
+		})
+	}
+}
+
+func TestManagedService_String(t *testing.T) {
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	managedService := NewManagedService("/path/to/test.sh", natsConn, logger, config.DefaultConfig())
+
+	// Add the script to the service (new service grouping structure)
+	managedService.AddScript("/path/to/test.sh")
+
+	expected := "ManagedService(/path/to/test.sh)"
+	if managedService.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, managedService.String())
+	}
+}
+
+// Mock implementations for testing
+
+type MockScriptRunner struct {
+	infoResponse    string
+	executeResponse service.ExecutionResult
+	executeError    error
+	lastSubject     string
+	lastPayload     []byte
+}
+
+func (m *MockScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	if m.infoResponse == "" {
+		return service.ServiceDefinition{}, nil
+	}
+
+	var def service.ServiceDefinition
+	err := json.Unmarshal([]byte(m.infoResponse), &def)
+	if err != nil {
+		return service.ServiceDefinition{}, err
+	}
+
+	return def, def.Validate()
+}
+
+func (m *MockScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	m.lastSubject = subject
+	m.lastPayload = payload
+	return m.executeResponse, m.executeError
+}
+
+// BlockingScriptRunner signals when a request starts and waits to be released
+type BlockingScriptRunner struct {
+	MockScriptRunner
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *BlockingScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	close(b.started)
+	<-b.release
+	return b.MockScriptRunner.ExecuteRequest(ctx, subject, payload)
+}
+
+// GatedScriptRunner runs one request per value sent on gate and reports its service name on completion
+type GatedScriptRunner struct {
+	definition  service.ServiceDefinition
+	gate        chan struct{}
+	completions chan string
+}
+
+func (g *GatedScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	return g.definition, nil
+}
+
+func (g *GatedScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	<-g.gate
+	g.completions <- g.definition.Name
+	return service.ExecutionResult{Success: true, Stdout: []byte("ok")}, nil
+}
+
+// HangingScriptRunner blocks until the request context ends while hanging is set
+type HangingScriptRunner struct {
+	definition service.ServiceDefinition
+	hanging    atomic.Bool
+	executions atomic.Int32
+}
+
+func (h *HangingScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	return h.definition, nil
+}
+
+func (h *HangingScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	h.executions.Add(1)
+	if h.hanging.Load() {
+		<-ctx.Done()
+		return service.ExecutionResult{}, fmt.Errorf("script execution timeout: %w", ctx.Err())
+	}
+	return service.ExecutionResult{Success: true, Stdout: []byte(`{"report": "done"}`)}, nil
+}
+
+// RecordingScriptRunner records when each request starts executing
+type RecordingScriptRunner struct {
+	definition service.ServiceDefinition
+	mutex      sync.Mutex
+	starts     []time.Time
+}
+
+func (r *RecordingScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	return r.definition, nil
+}
+
+func (r *RecordingScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	r.mutex.Lock()
+	r.starts = append(r.starts, time.Now())
+	r.mutex.Unlock()
+	return service.ExecutionResult{Success: true, Stdout: []byte(`{}`)}, nil
+}
+
+// startTimes returns the recorded start times in order
+func (r *RecordingScriptRunner) startTimes() []time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	starts := append([]time.Time(nil), r.starts...)
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+// StaticScriptRunner returns a fixed definition without validating it
+type StaticScriptRunner struct {
+	definition service.ServiceDefinition
+}
+
+func (s *StaticScriptRunner) GetServiceDefinition(ctx context.Context) (service.ServiceDefinition, error) {
+	return s.definition, nil
+}
+
+func (s *StaticScriptRunner) ExecuteRequest(ctx context.Context, subject string, payload []byte) (service.ExecutionResult, error) {
+	return service.ExecutionResult{Success: true}, nil
+}
+
+type MockRequest struct {
+	subject         string
+	reply           string
+	data            []byte
+	headers         map[string][]string
+	responded       bool
+	responseData    []byte
+	responseHeaders map[string][]string
+	responseError   error
+}
+
+func (m *MockRequest) Subject() string {
+	return m.subject
+}
+
+func (m *MockRequest) Reply() string {
+	return m.reply
+}
+
+func (m *MockRequest) Data() []byte {
+	return m.data
+}
+
+func (m *MockRequest) Headers() map[string][]string {
+	return m.headers
+}
+
+func (m *MockRequest) Respond(data []byte) error {
+	m.responded = true
+	m.responseData = data
+	return nil
+}
+
+func (m *MockRequest) RespondWithHeaders(data []byte, headers map[string][]string) error {
+	m.responded = true
+	m.responseData = data
+	m.responseHeaders = headers
+	return nil
+}
+
+func (m *MockRequest) RespondError(err error) error {
+	m.responded = true
+	m.responseError = err
+	return nil
+}
+
+// FakeMicroRequest implements micro.Request and records responses
+type FakeMicroRequest struct {
+	subject          string
+	reply            string
+	data             []byte
+	headers          micro.Headers
+	responseData     []byte
+	responseHeaders  micro.Headers
+	errorCode        string
+	errorDescription string
+}
+
+func (f *FakeMicroRequest) Respond(data []byte, opts ...micro.RespondOpt) error {
+	f.responseData = data
+	msg := &nats.Msg{}
+	for _, opt := range opts {
+		opt(msg)
+	}
+	f.responseHeaders = micro.Headers(msg.Header)
+	return nil
+}
+
+func (f *FakeMicroRequest) RespondJSON(data any, opts ...micro.RespondOpt) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return f.Respond(encoded, opts...)
+}
+
+func (f *FakeMicroRequest) Error(code, description string, data []byte, opts ...micro.RespondOpt) error {
+	if code == "" || description == "" {
+		return fmt.Errorf("code and description are required")
+	}
+	f.errorCode = code
+	f.errorDescription = description
+	return nil
+}
+
+func (f *FakeMicroRequest) Data() []byte {
+	return f.data
+}
+
+func (f *FakeMicroRequest) Headers() micro.Headers {
+	return f.headers
+}
+
+func (f *FakeMicroRequest) Subject() string {
+	return f.subject
+}
+
+func (f *FakeMicroRequest) Reply() string {
+	return f.reply
 }
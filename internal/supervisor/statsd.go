@@ -0,0 +1,54 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsD metric names emitted for each handled request
+const (
+	statsdRequests = "natshd.requests"
+	statsdErrors   = "natshd.errors"
+	statsdDuration = "natshd.duration"
+)
+
+// StatsD sends request metrics to a StatsD server over UDP. Sends never block on
+// the server and failures are ignored, so metrics cannot slow down requests.
+type StatsD struct {
+	conn net.Conn
+}
+
+// NewStatsD creates a StatsD client sending to addr ("host:port")
+func NewStatsD(addr string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open statsd connection to %s: %w", addr, err)
+	}
+	return &StatsD{conn: conn}, nil
+}
+
+// Request records one handled request, in a single packet
+func (s *StatsD) Request(duration time.Duration, failed bool) {
+	if s == nil {
+		return
+	}
+
+	metrics := []string{
+		statsdRequests + ":1|c",
+		fmt.Sprintf("%s:%d|ms", statsdDuration, duration.Milliseconds()),
+	}
+	if failed {
+		metrics = append(metrics, statsdErrors+":1|c")
+	}
+	s.conn.Write([]byte(strings.Join(metrics, "\n")))
+}
+
+// Close closes the UDP socket
+func (s *StatsD) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
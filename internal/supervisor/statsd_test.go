@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
+	"github.com/nats-io/nats.go"
+)
+
+func TestManagedService_EmitsStatsDMetrics(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for UDP: %v", err)
+	}
+	defer listener.Close()
+
+	statsd, err := NewStatsD(listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to create StatsD client: %v", err)
+	}
+	defer statsd.Close()
+
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	managedService := NewManagedService("test.sh", natsConn, logger, cfg)
+	managedService.statsd = statsd
+	managedService.scripts["test.sh"] = &MockScriptRunner{
+		infoResponse: `{
+			"name": "EchoService",
+			"endpoints": [{"name": "Echo", "subject": "echo", "request_type": "application/json"}]
+		}`,
+		executeResponse: service.ExecutionResult{Success: true, Stdout: []byte(`{"ok":true}`)},
+	}
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	readPacket := func() string {
+		t.Helper()
+		buf := make([]byte, 1024)
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected a StatsD packet: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	subject := cfg.PrefixSubject("echo")
+	managedService.HandleRequest(&MockRequest{subject: subject, data: []byte(`{}`)})
+	success := readPacket()
+	if !regexp.MustCompile(`^natshd\.requests:1\|c\nnatshd\.duration:\d+\|ms$`).MatchString(success) {
+		t.Errorf("Unexpected metrics for a successful request: %q", success)
+	}
+
+	managedService.HandleRequest(&MockRequest{subject: subject, data: []byte(`not json`)})
+	failure := readPacket()
+	if !regexp.MustCompile(`^natshd\.requests:1\|c\nnatshd\.duration:\d+\|ms\nnatshd\.errors:1\|c$`).MatchString(failure) {
+		t.Errorf("Unexpected metrics for a failed request: %q", failure)
+	}
+}
+
+func TestStatsD_NilIsNoOp(t *testing.T) {
+	var statsd *StatsD
+	statsd.Request(time.Millisecond, true)
+	if err := statsd.Close(); err != nil {
+		t.Errorf("Expected nil StatsD Close to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// StartupSummary describes what the manager ended up serving after discovery
+type StartupSummary struct {
+	Services       int      `json:"services"`
+	Endpoints      int      `json:"endpoints"`
+	Subjects       []string `json:"subjects"`
+	NatsURL        string   `json:"nats_url"`
+	HostnamePrefix string   `json:"hostname_prefix"`
+	// Healthy is false while any required service is missing
+	Healthy         bool     `json:"healthy"`
+	MissingServices []string `json:"missing_services,omitempty"`
+	// Namespaces lists service names by the namespace they declared
+	Namespaces map[string][]string `json:"namespaces,omitempty"`
+}
+
+// StartupSummary collects the registered services and their endpoint subjects
+func (sm *ServiceManager) StartupSummary() StartupSummary {
+	summary := StartupSummary{
+		Subjects: []string{},
+		NatsURL:  sm.config.NatsURL,
+	}
+
+	// The prefix of services that don't choose their own, empty for "none"
+	summary.HostnamePrefix = sm.config.SubjectPrefix("")
+
+	summary.MissingServices = sm.MissingServices()
+	summary.Healthy = len(summary.MissingServices) == 0
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	for _, managedService := range sm.services {
+		summary.Services++
+		for _, endpoint := range managedService.definition.Endpoints {
+			summary.Endpoints++
+			summary.Subjects = append(summary.Subjects, endpoint.Subject)
+		}
+	}
+	sort.Strings(summary.Subjects)
+	summary.Namespaces = sm.namespaceGroups()
+
+	return summary
+}
+
+// emitStartupSummary logs the startup summary as a single line and, when a
+// summary subject is configured, publishes it as JSON
+func (sm *ServiceManager) emitStartupSummary() {
+	summary := sm.StartupSummary()
+
+	sm.logger.Info().
+		Str("action", "startup_summary").
+		Int("services", summary.Services).
+		Int("endpoints", summary.Endpoints).
+		Strs("subjects", summary.Subjects).
+		Str("nats_url", summary.NatsURL).
+		Str("hostname_prefix", summary.HostnamePrefix).
+		Bool("healthy", summary.Healthy).
+		Strs("missing_services", summary.MissingServices).
+		Msg("Startup complete")
+
+	subject := sm.config.StartupSummarySubject
+	if subject == "" || sm.natsConn == nil {
+		return
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		sm.logger.Warn().Err(err).Msg("Failed to encode startup summary")
+		return
+	}
+	if err := sm.natsConn.Publish(subject, data); err != nil {
+		sm.logger.Warn().Err(err).Str("subject", subject).Msg("Failed to publish startup summary")
+	}
+}
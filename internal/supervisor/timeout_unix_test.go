@@ -0,0 +1,75 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+func TestManagedService_HandleRequestKillsScriptAfterRequestTimeout(t *testing.T) {
+	tempDir := t.TempDir()
+	pidFile := filepath.Join(tempDir, "pid")
+	scriptPath := filepath.Join(tempDir, "slow.sh")
+	script := `#!/usr/bin/env bash
+if [[ "$1" == "info" ]]; then
+  echo '{"name": "SlowService", "endpoints": [{"name": "Wait", "subject": "slow.wait"}]}'
+  exit 0
+fi
+echo $$ > "` + pidFile + `"
+exec sleep 10
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.ScriptsPath = tempDir
+	cfg.RequestTimeoutMs = 200
+	managedService := NewManagedService(scriptPath, natsConn, logger, cfg)
+	managedService.AddScript(scriptPath)
+	if err := managedService.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	request := &MockRequest{subject: cfg.PrefixSubject("slow.wait"), data: []byte(`{}`)}
+	start := time.Now()
+	managedService.HandleRequest(request)
+	elapsed := time.Since(start)
+
+	var requestErr *RequestError
+	if !errors.As(request.responseError, &requestErr) {
+		t.Fatalf("Expected a RequestError, got %v", request.responseError)
+	}
+	if requestErr.Code != "504" || !strings.Contains(requestErr.Message, "timed out") {
+		t.Errorf("Expected a 504 timeout error, got %s: %s", requestErr.Code, requestErr.Message)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Expected the request to end near the timeout, took %s", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read pid file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse pid: %v", err)
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("Expected the timed out script (pid %d) to be killed, got %v", pid, err)
+	}
+}
@@ -0,0 +1,234 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+// TopologySubject is the admin subject (prefixed with the hostname) that answers
+// with the topology this host is serving
+const TopologySubject = "natshd.topology"
+
+// Topology is what a host is serving, in a stable order so exports from two hosts
+// can be compared line by line. Subjects leave out the service's prefix and script
+// paths are relative to scripts_path, so hosts only differ where they really do.
+type Topology struct {
+	Services []TopologyService `json:"services"`
+}
+
+// TopologyService is one service in a Topology
+type TopologyService struct {
+	Name      string             `json:"name"`
+	Version   string             `json:"version"`
+	Namespace string             `json:"namespace,omitempty"`
+	Prefix    string             `json:"prefix"`
+	Scripts   []string           `json:"scripts"`
+	Endpoints []TopologyEndpoint `json:"endpoints"`
+}
+
+// TopologyEndpoint is one endpoint of a TopologyService
+type TopologyEndpoint struct {
+	Name       string `json:"name"`
+	Subject    string `json:"subject"`
+	Mode       string `json:"mode,omitempty"`
+	QueueGroup string `json:"queue_group,omitempty"`
+	Script     string `json:"script"`
+}
+
+// Topology resolves the services, endpoints and scripts this host is serving,
+// sorted by service name, endpoint subject and script path
+func (sm *ServiceManager) Topology() Topology {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	topology := Topology{Services: make([]TopologyService, 0, len(sm.services))}
+	for _, managedService := range sm.services {
+		definition := managedService.definition
+		policy := sm.config.ServicePrefix(definition.Name, definition.Prefix)
+		prefix := policy
+		if prefix == "" {
+			prefix = sm.config.DefaultPrefixPolicy()
+		}
+
+		topologyService := TopologyService{
+			Name:      definition.Name,
+			Version:   definition.Version,
+			Namespace: definition.Namespace,
+			Prefix:    prefix,
+			Scripts:   []string{},
+			Endpoints: make([]TopologyEndpoint, 0, len(definition.Endpoints)),
+		}
+		for scriptPath := range managedService.scriptRunners() {
+			topologyService.Scripts = append(topologyService.Scripts, sm.relativeScriptPath(scriptPath))
+		}
+
+		for _, endpoint := range definition.Endpoints {
+			topologyEndpoint := TopologyEndpoint{
+				Name:       endpoint.Name,
+				Subject:    sm.config.StripSubjectPrefixWith(policy, endpoint.Subject),
+				Mode:       endpoint.Mode,
+				QueueGroup: endpoint.QueueGroup,
+			}
+			if route, ok := managedService.route(endpoint.Subject); ok {
+				topologyEndpoint.Script = sm.relativeScriptPath(route.scriptPath)
+			}
+			topologyService.Endpoints = append(topologyService.Endpoints, topologyEndpoint)
+		}
+
+		sort.Strings(topologyService.Scripts)
+		sort.Slice(topologyService.Endpoints, func(i, j int) bool {
+			a, b := topologyService.Endpoints[i], topologyService.Endpoints[j]
+			if a.Subject != b.Subject {
+				return a.Subject < b.Subject
+			}
+			return a.Name < b.Name
+		})
+		topology.Services = append(topology.Services, topologyService)
+	}
+
+	sort.Slice(topology.Services, func(i, j int) bool {
+		return topology.Services[i].Name < topology.Services[j].Name
+	})
+	return topology
+}
+
+// relativeScriptPath reports a script path relative to the scripts directory,
+// or as-is when it lies outside it
+func (sm *ServiceManager) relativeScriptPath(scriptPath string) string {
+	relative, err := filepath.Rel(sm.scriptsPath, scriptPath)
+	if err != nil || !filepath.IsLocal(relative) {
+		return scriptPath
+	}
+	return filepath.ToSlash(relative)
+}
+
+// DiffTopology lists what changed from one topology to another, one line per
+// difference in a stable order: "+" for additions, "-" for removals and "~" for
+// changed fields. An empty result means the topologies match.
+func DiffTopology(from, to Topology) []string {
+	var changes []string
+
+	fromServices := topologyServicesByName(from)
+	toServices := topologyServicesByName(to)
+	for _, name := range sortedUnion(fromServices, toServices) {
+		before, inFrom := fromServices[name]
+		after, inTo := toServices[name]
+		switch {
+		case !inTo:
+			changes = append(changes, fmt.Sprintf("- service %s", name))
+			continue
+		case !inFrom:
+			changes = append(changes, fmt.Sprintf("+ service %s", name))
+			continue
+		}
+
+		changes = appendFieldChange(changes, "service "+name, "version", before.Version, after.Version)
+		changes = appendFieldChange(changes, "service "+name, "namespace", before.Namespace, after.Namespace)
+		changes = appendFieldChange(changes, "service "+name, "prefix", before.Prefix, after.Prefix)
+
+		fromScripts := make(map[string]struct{}, len(before.Scripts))
+		for _, script := range before.Scripts {
+			fromScripts[script] = struct{}{}
+		}
+		toScripts := make(map[string]struct{}, len(after.Scripts))
+		for _, script := range after.Scripts {
+			toScripts[script] = struct{}{}
+		}
+		for _, script := range sortedUnion(fromScripts, toScripts) {
+			if _, ok := toScripts[script]; !ok {
+				changes = append(changes, fmt.Sprintf("- script %s/%s", name, script))
+			} else if _, ok := fromScripts[script]; !ok {
+				changes = append(changes, fmt.Sprintf("+ script %s/%s", name, script))
+			}
+		}
+
+		fromEndpoints := topologyEndpointsByName(before)
+		toEndpoints := topologyEndpointsByName(after)
+		for _, endpointName := range sortedUnion(fromEndpoints, toEndpoints) {
+			beforeEndpoint, inFrom := fromEndpoints[endpointName]
+			afterEndpoint, inTo := toEndpoints[endpointName]
+			label := "endpoint " + name + "/" + endpointName
+			switch {
+			case !inTo:
+				changes = append(changes, fmt.Sprintf("- %s %s", label, beforeEndpoint.Subject))
+			case !inFrom:
+				changes = append(changes, fmt.Sprintf("+ %s %s", label, afterEndpoint.Subject))
+			default:
+				changes = appendFieldChange(changes, label, "subject", beforeEndpoint.Subject, afterEndpoint.Subject)
+				changes = appendFieldChange(changes, label, "mode", beforeEndpoint.Mode, afterEndpoint.Mode)
+				changes = appendFieldChange(changes, label, "queue_group", beforeEndpoint.QueueGroup, afterEndpoint.QueueGroup)
+				changes = appendFieldChange(changes, label, "script", beforeEndpoint.Script, afterEndpoint.Script)
+			}
+		}
+	}
+
+	return changes
+}
+
+func appendFieldChange(changes []string, label, field, before, after string) []string {
+	if before == after {
+		return changes
+	}
+	return append(changes, fmt.Sprintf("~ %s %s %q -> %q", label, field, before, after))
+}
+
+func topologyServicesByName(topology Topology) map[string]TopologyService {
+	services := make(map[string]TopologyService, len(topology.Services))
+	for _, topologyService := range topology.Services {
+		services[topologyService.Name] = topologyService
+	}
+	return services
+}
+
+func topologyEndpointsByName(topologyService TopologyService) map[string]TopologyEndpoint {
+	endpoints := make(map[string]TopologyEndpoint, len(topologyService.Endpoints))
+	for _, endpoint := range topologyService.Endpoints {
+		endpoints[endpoint.Name] = endpoint
+	}
+	return endpoints
+}
+
+// sortedUnion returns the keys of both maps, sorted
+func sortedUnion[A, B any](a map[string]A, b map[string]B) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setupTopologyEndpoint answers requests on the hostname-prefixed topology subject
+func (sm *ServiceManager) setupTopologyEndpoint() error {
+	if sm.natsConn == nil {
+		return nil
+	}
+
+	subject := sm.config.PrefixSubject(TopologySubject)
+	subscription, err := sm.natsConn.Subscribe(subject, func(msg *nats.Msg) {
+		data, err := json.Marshal(sm.Topology())
+		if err != nil {
+			logging.LogError(sm.logger, err, "failed to encode topology")
+			return
+		}
+		if err := msg.Respond(data); err != nil {
+			logging.LogError(sm.logger, err, "failed to send topology")
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	sm.topologySubscription = subscription
+	return nil
+}
@@ -0,0 +1,208 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/hiway/natshd/internal/service"
+	"github.com/nats-io/nats.go"
+)
+
+// newTopologyTestManager loads two services into a manager for the given host,
+// one of them spread over two scripts
+func newTopologyTestManager(t *testing.T, scriptsPath, hostname string) *ServiceManager {
+	t.Helper()
+
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Use nil for testing
+	cfg := config.DefaultConfig()
+	cfg.Hostname = hostname
+	manager := NewManager(scriptsPath, natsConn, logger, cfg)
+
+	type script struct {
+		path      string
+		endpoints []service.Endpoint
+	}
+	services := []struct {
+		definition service.ServiceDefinition
+		scripts    []script
+	}{
+		{
+			definition: service.ServiceDefinition{Name: "ZoneService", Version: "1.0.0", Prefix: service.PrefixNone},
+			scripts: []script{
+				{path: "zone.sh", endpoints: []service.Endpoint{{Name: "List", Subject: "zone.list"}}},
+			},
+		},
+		{
+			definition: service.ServiceDefinition{Name: "BackupService", Version: "2.1.0", Namespace: "storage"},
+			scripts: []script{
+				{path: "backup/run.sh", endpoints: []service.Endpoint{{Name: "Run", Subject: "backup.run", Mode: "event"}}},
+				{path: "backup/list.sh", endpoints: []service.Endpoint{
+					{Name: "Status", Subject: "backup.status"},
+					{Name: "List", Subject: "backup.list", QueueGroup: "backups"},
+				}},
+			},
+		},
+	}
+	for _, s := range services {
+		managedService := NewManagedService(filepath.Join(scriptsPath, s.scripts[0].path), natsConn, logger, cfg)
+		managedService.routes = make(map[string]scriptRoute)
+		for _, sc := range s.scripts {
+			scriptPath := filepath.Join(scriptsPath, sc.path)
+			managedService.AddScript(scriptPath)
+			for _, endpoint := range sc.endpoints {
+				endpoint.Subject = cfg.PrefixSubjectWith(s.definition.Prefix, endpoint.Subject)
+				s.definition.Endpoints = append(s.definition.Endpoints, endpoint)
+				managedService.routes[endpoint.Subject] = scriptRoute{scriptPath: scriptPath, endpoint: endpoint}
+			}
+		}
+		managedService.definition = s.definition
+		manager.services[s.definition.Name] = managedService
+	}
+	return manager
+}
+
+func TestManager_TopologyIsSorted(t *testing.T) {
+	scriptsPath := t.TempDir()
+	manager := newTopologyTestManager(t, scriptsPath, "web01")
+
+	expected := Topology{Services: []TopologyService{
+		{
+			Name:      "BackupService",
+			Version:   "2.1.0",
+			Namespace: "storage",
+			Prefix:    service.PrefixHost,
+			Scripts:   []string{"backup/list.sh", "backup/run.sh"},
+			Endpoints: []TopologyEndpoint{
+				{Name: "List", Subject: "backup.list", QueueGroup: "backups", Script: "backup/list.sh"},
+				{Name: "Run", Subject: "backup.run", Mode: "event", Script: "backup/run.sh"},
+				{Name: "Status", Subject: "backup.status", Script: "backup/list.sh"},
+			},
+		},
+		{
+			Name:      "ZoneService",
+			Version:   "1.0.0",
+			Prefix:    service.PrefixNone,
+			Scripts:   []string{"zone.sh"},
+			Endpoints: []TopologyEndpoint{{Name: "List", Subject: "zone.list", Script: "zone.sh"}},
+		},
+	}}
+
+	topology := manager.Topology()
+	if !reflect.DeepEqual(topology, expected) {
+		t.Fatalf("Expected topology %+v, got %+v", expected, topology)
+	}
+
+	// Map iteration order varies between calls, the export must not
+	first, err := json.Marshal(topology)
+	if err != nil {
+		t.Fatalf("Failed to encode topology: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := json.Marshal(manager.Topology())
+		if err != nil {
+			t.Fatalf("Failed to encode topology: %v", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatalf("Expected identical exports, got:\n%s\n%s", first, again)
+		}
+	}
+
+	// Another host serving the same scripts exports the same topology
+	other := newTopologyTestManager(t, scriptsPath, "web02").Topology()
+	if changes := DiffTopology(topology, other); len(changes) > 0 {
+		t.Errorf("Expected no differences between hosts, got %q", changes)
+	}
+}
+
+func TestDiffTopology(t *testing.T) {
+	base := Topology{Services: []TopologyService{
+		{
+			Name:    "GreetingService",
+			Version: "1.0.0",
+			Prefix:  service.PrefixHost,
+			Scripts: []string{"greeting.sh"},
+			Endpoints: []TopologyEndpoint{
+				{Name: "Farewell", Subject: "greeting.farewell", Script: "greeting.sh"},
+				{Name: "Greet", Subject: "greeting.greet", Script: "greeting.sh"},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		modify   func(topology *Topology)
+		expected []string
+	}{
+		{
+			name:     "identical",
+			modify:   func(topology *Topology) {},
+			expected: nil,
+		},
+		{
+			name: "service added",
+			modify: func(topology *Topology) {
+				topology.Services = append(topology.Services, TopologyService{Name: "SystemService"})
+			},
+			expected: []string{"+ service SystemService"},
+		},
+		{
+			name: "service removed",
+			modify: func(topology *Topology) {
+				topology.Services = nil
+			},
+			expected: []string{"- service GreetingService"},
+		},
+		{
+			name: "version and script changed",
+			modify: func(topology *Topology) {
+				topology.Services[0].Version = "1.1.0"
+				topology.Services[0].Scripts = []string{"hello.sh"}
+			},
+			expected: []string{
+				`~ service GreetingService version "1.0.0" -> "1.1.0"`,
+				"- script GreetingService/greeting.sh",
+				"+ script GreetingService/hello.sh",
+			},
+		},
+		{
+			name: "endpoint changed",
+			modify: func(topology *Topology) {
+				topology.Services[0].Endpoints = []TopologyEndpoint{
+					{Name: "Greet", Subject: "greeting.hello", Script: "greeting.sh"},
+					{Name: "Wave", Subject: "greeting.wave", Script: "greeting.sh"},
+				}
+			},
+			expected: []string{
+				"- endpoint GreetingService/Farewell greeting.farewell",
+				`~ endpoint GreetingService/Greet subject "greeting.greet" -> "greeting.hello"`,
+				"+ endpoint GreetingService/Wave greeting.wave",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Round trip through JSON for an independent copy, as an import would
+			data, err := json.Marshal(base)
+			if err != nil {
+				t.Fatalf("Failed to encode topology: %v", err)
+			}
+			var modified Topology
+			if err := json.Unmarshal(data, &modified); err != nil {
+				t.Fatalf("Failed to decode topology: %v", err)
+			}
+			tt.modify(&modified)
+
+			changes := DiffTopology(base, modified)
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("Expected changes %q, got %q", tt.expected, changes)
+			}
+		})
+	}
+}
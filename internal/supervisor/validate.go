@@ -0,0 +1,36 @@
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScriptError is a script named like a service script that failed to load
+type ScriptError struct {
+	Script string
+	Err    error
+}
+
+func (e ScriptError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Script, e.Err)
+}
+
+func (e ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// Validate discovers services the way Start does, without serving them, and
+// returns every script that failed to load. It needs no NATS connection, so CI
+// can check a scripts directory before deploying it. Missing required services
+// are an error, whatever required_services_policy says.
+func (sm *ServiceManager) Validate() ([]ScriptError, error) {
+	scriptErrors, err := sm.discoverServices()
+	if err != nil {
+		return scriptErrors, fmt.Errorf("failed to discover services: %w", err)
+	}
+
+	if missing := sm.MissingServices(); len(missing) > 0 {
+		return scriptErrors, fmt.Errorf("required services not loaded: %s", strings.Join(missing, ", "))
+	}
+	return scriptErrors, nil
+}
@@ -0,0 +1,64 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hiway/natshd/internal/config"
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+func TestManager_ValidateReportsInvalidScripts(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := logging.SetupLogger("info")
+	natsConn := (*nats.Conn)(nil) // Validation never connects
+
+	scripts := map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"valid.sh": {content: `#!/usr/bin/env bash
+echo '{"name": "ValidService", "endpoints": [{"name": "Run", "subject": "valid.run"}]}'
+`, mode: 0755},
+		"broken.sh": {content: `#!/usr/bin/env bash
+echo '{"name": "BrokenService", "endpoints": ['
+`, mode: 0755},
+		"unnamed.sh": {content: `#!/usr/bin/env bash
+echo '{"name": "", "endpoints": [{"name": "Run", "subject": "unnamed.run"}]}'
+`, mode: 0755},
+		// Not executable, so not a script natshd would load
+		"library.sh": {content: "helper() { :; }\n", mode: 0644},
+	}
+	for fileName, script := range scripts {
+		if err := os.WriteFile(filepath.Join(tempDir, fileName), []byte(script.content), script.mode); err != nil {
+			t.Fatalf("Failed to create test script: %v", err)
+		}
+	}
+
+	manager := NewManager(tempDir, natsConn, logger, config.DefaultConfig())
+	scriptErrors, err := manager.Validate()
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	invalid := make(map[string]error)
+	for _, scriptError := range scriptErrors {
+		invalid[filepath.Base(scriptError.Script)] = scriptError.Err
+	}
+	if len(invalid) != 2 || invalid["broken.sh"] == nil || invalid["unnamed.sh"] == nil {
+		t.Errorf("Expected broken.sh and unnamed.sh to be invalid, got %v", scriptErrors)
+	}
+	if _, exists := manager.services["ValidService"]; !exists {
+		t.Error("Expected ValidService to be discovered")
+	}
+
+	// A required service that failed to load fails validation
+	cfg := config.DefaultConfig()
+	cfg.RequiredServices = []string{"BrokenService"}
+	cfg.RequiredServicesPolicy = "unhealthy"
+	if _, err := NewManager(tempDir, natsConn, logger, cfg).Validate(); err == nil {
+		t.Error("Expected an error for a missing required service")
+	}
+}
@@ -0,0 +1,188 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hiway/natshd/internal/logging"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// warmupPlaceholder answers requests on a service's subjects with a retriable 503
+// error while its endpoints are not (yet) registered, so clients arriving during
+// startup or a restart get a prompt error instead of a timeout. It joins the endpoint's
+// queue group, so each request gets a single reply while both are subscribed.
+// With restart_buffer_size set it buffers the requests instead, and they are replayed
+// to the new handlers once the endpoints are registered.
+type warmupPlaceholder struct {
+	mutex         sync.Mutex
+	subscriptions []*nats.Subscription
+	// Separate from mutex, which is held while waiting for subscriptions to drain
+	bufferMutex sync.Mutex
+	buffered    []bufferedRequest
+}
+
+// bufferedRequest is a request held by the placeholder until it can be replayed
+type bufferedRequest struct {
+	msg        *nats.Msg
+	receivedAt time.Time
+}
+
+// drainWaitTimeout bounds how long stopping a buffering placeholder waits for its
+// subscriptions to hand over every delivered request
+const drainWaitTimeout = time.Second
+
+// startWarmup subscribes the placeholder to the service's request subjects,
+// replacing any placeholder subscriptions left from an earlier definition
+func (ms *ManagedService) startWarmup() error {
+	if ms.natsConn == nil || (!ms.config.WarmupReply && ms.config.RestartBufferSize <= 0) {
+		return nil
+	}
+
+	ms.stopWarmup()
+
+	ms.warmup.mutex.Lock()
+	defer ms.warmup.mutex.Unlock()
+
+	description := fmt.Sprintf("service %s is warming up, retry shortly", ms.definition.Name)
+	for _, endpoint := range ms.definition.Endpoints {
+		if !endpoint.AcceptsRequests() {
+			continue
+		}
+
+		queueGroup := endpoint.QueueGroup
+		if queueGroup == "" {
+			queueGroup = micro.DefaultQueueGroup
+		}
+		sub, err := ms.natsConn.QueueSubscribe(endpoint.Subject, queueGroup, func(msg *nats.Msg) {
+			if msg.Reply == "" {
+				return
+			}
+			if ms.bufferRequest(msg) {
+				return
+			}
+			ms.respondUnavailable(msg, description)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe warmup placeholder for %s: %w", endpoint.Subject, err)
+		}
+		ms.warmup.subscriptions = append(ms.warmup.subscriptions, sub)
+	}
+	return nil
+}
+
+// stopWarmup removes the placeholder subscriptions, if any. They are drained rather
+// than unsubscribed so requests already delivered to them still get a reply.
+func (ms *ManagedService) stopWarmup() {
+	ms.warmup.mutex.Lock()
+	defer ms.warmup.mutex.Unlock()
+
+	for _, sub := range ms.warmup.subscriptions {
+		if err := sub.Drain(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			ms.logger.Error().Err(err).Str("subject", sub.Subject).Msg("Error draining warmup placeholder")
+		}
+	}
+	if ms.config.RestartBufferSize > 0 {
+		// Buffered requests are only safe to replay once no more can arrive
+		for _, sub := range ms.warmup.subscriptions {
+			waitForDrained(sub, drainWaitTimeout)
+		}
+	}
+	ms.warmup.subscriptions = nil
+}
+
+// waitForDrained waits until a draining subscription has processed its pending messages
+func waitForDrained(sub *nats.Subscription, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for sub.IsValid() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// bufferRequest holds a request for replay if buffering is enabled and the buffer
+// has room, and reports whether it did
+func (ms *ManagedService) bufferRequest(msg *nats.Msg) bool {
+	if ms.config.RestartBufferSize <= 0 {
+		return false
+	}
+
+	ms.warmup.bufferMutex.Lock()
+	defer ms.warmup.bufferMutex.Unlock()
+
+	if len(ms.warmup.buffered) >= ms.config.RestartBufferSize {
+		ms.logger.Warn().
+			Str("subject", msg.Subject).
+			Int("restart_buffer_size", ms.config.RestartBufferSize).
+			Msg("Restart buffer full, rejecting request")
+		return false
+	}
+	ms.warmup.buffered = append(ms.warmup.buffered, bufferedRequest{msg: msg, receivedAt: time.Now()})
+	return true
+}
+
+// takeBufferedRequests empties the restart buffer and returns what it held
+func (ms *ManagedService) takeBufferedRequests() []bufferedRequest {
+	ms.warmup.bufferMutex.Lock()
+	defer ms.warmup.bufferMutex.Unlock()
+
+	buffered := ms.warmup.buffered
+	ms.warmup.buffered = nil
+	return buffered
+}
+
+// replayBufferedRequests republishes buffered requests, keeping their reply
+// subjects, so the newly registered handlers answer the original requesters.
+// Requests older than restart_buffer_timeout_ms get a 503 reply instead.
+func (ms *ManagedService) replayBufferedRequests() {
+	buffered := ms.takeBufferedRequests()
+	if len(buffered) == 0 {
+		return
+	}
+
+	timeout := time.Duration(ms.config.RestartBufferTimeoutMs) * time.Millisecond
+	replayed := 0
+	for _, request := range buffered {
+		if timeout > 0 && time.Since(request.receivedAt) > timeout {
+			ms.respondUnavailable(request.msg, fmt.Sprintf("service %s restart took longer than the buffer timeout, retry", ms.definition.Name))
+			continue
+		}
+
+		replay := &nats.Msg{
+			Subject: request.msg.Subject,
+			Reply:   request.msg.Reply,
+			Header:  request.msg.Header,
+			Data:    request.msg.Data,
+		}
+		if err := ms.natsConn.PublishMsg(replay); err != nil {
+			logging.LogError(ms.logger, err, "failed to replay buffered request on "+request.msg.Subject)
+			continue
+		}
+		replayed++
+	}
+
+	ms.logger.Info().
+		Int("replayed", replayed).
+		Int("expired", len(buffered)-replayed).
+		Msg("Replayed requests buffered during restart")
+}
+
+// rejectBufferedRequests answers buffered requests with a 503 when the service is
+// going away instead of coming back
+func (ms *ManagedService) rejectBufferedRequests() {
+	for _, request := range ms.takeBufferedRequests() {
+		ms.respondUnavailable(request.msg, fmt.Sprintf("service %s was removed", ms.definition.Name))
+	}
+}
+
+// respondUnavailable replies to a request with a retriable 503 micro error
+func (ms *ManagedService) respondUnavailable(msg *nats.Msg, description string) {
+	reply := nats.NewMsg(msg.Reply)
+	reply.Header.Set(micro.ErrorCodeHeader, "503")
+	reply.Header.Set(micro.ErrorHeader, description)
+	if err := msg.RespondMsg(reply); err != nil {
+		ms.logger.Debug().Err(err).Str("subject", msg.Subject).Msg("Failed to send unavailable reply")
+	}
+}
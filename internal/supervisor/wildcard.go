@@ -0,0 +1,77 @@
+package supervisor
+
+import (
+	"strings"
+
+	"github.com/hiway/natshd/internal/service"
+)
+
+// wildcardTokensEnv passes a script the request subject tokens its wildcard
+// endpoint matched, space-separated, e.g. "cpu" for metrics.cpu on metrics.*
+const wildcardTokensEnv = "NATS_WILDCARD_TOKENS"
+
+// subjectMatches reports whether a concrete subject is delivered to a
+// subscription on pattern, where "*" matches one token and a final ">" matches
+// one or more trailing tokens
+func subjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" && i == len(patternTokens)-1 {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// bestWildcardMatch finds the wildcard route a concrete subject belongs to. When
+// several match, the one with the most literal tokens wins, so "metrics.cpu.*"
+// beats "metrics.>", with ties broken by subject order to stay deterministic.
+func bestWildcardMatch(routes map[string]scriptRoute, subject string) (string, bool) {
+	var best string
+	bestLiterals := -1
+	for pattern := range routes {
+		if !service.IsWildcardSubject(pattern) || !subjectMatches(pattern, subject) {
+			continue
+		}
+
+		literals := 0
+		for _, token := range strings.Split(pattern, ".") {
+			if token != "*" && token != ">" {
+				literals++
+			}
+		}
+		if literals > bestLiterals || (literals == bestLiterals && pattern < best) {
+			best, bestLiterals = pattern, literals
+		}
+	}
+	return best, bestLiterals >= 0
+}
+
+// wildcardTokens returns the tokens of a concrete subject that fill the wildcards
+// of the pattern it matched, in order; a final ">" contributes every remaining token
+func wildcardTokens(pattern, subject string) []string {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	var tokens []string
+	for i, token := range patternTokens {
+		if i >= len(subjectTokens) {
+			break
+		}
+		switch token {
+		case "*":
+			tokens = append(tokens, subjectTokens[i])
+		case ">":
+			tokens = append(tokens, subjectTokens[i:]...)
+		}
+	}
+	return tokens
+}
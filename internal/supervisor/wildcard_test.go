@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		subject  string
+		expected bool
+	}{
+		{"web-01.metrics.*", "web-01.metrics.cpu", true},
+		{"web-01.metrics.*", "web-01.metrics.cpu.load", false},
+		{"web-01.metrics.*", "web-01.metrics", false},
+		{"web-01.*.cpu", "web-01.metrics.cpu", true},
+		{"web-01.events.>", "web-01.events.user.created", true},
+		{"web-01.events.>", "web-01.events", false},
+		{"web-01.metrics.cpu", "web-01.metrics.cpu", true},
+		{"web-01.metrics.cpu", "web-01.metrics.disk", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.subject, func(t *testing.T) {
+			if got := subjectMatches(tt.pattern, tt.subject); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBestWildcardMatch(t *testing.T) {
+	routes := map[string]scriptRoute{
+		"metrics.>":     {scriptPath: "all.sh"},
+		"metrics.*":     {scriptPath: "single.sh"},
+		"metrics.cpu.*": {scriptPath: "cpu.sh"},
+		"metrics.disk":  {scriptPath: "disk.sh"},
+	}
+
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{"metrics.cpu.load", "metrics.cpu.*"},
+		{"metrics.memory", "metrics.*"},
+		{"metrics.memory.free", "metrics.>"},
+		{"events.created", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			pattern, ok := bestWildcardMatch(routes, tt.subject)
+			if ok != (tt.expected != "") {
+				t.Fatalf("Expected match %v, got %v", tt.expected != "", ok)
+			}
+			if pattern != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, pattern)
+			}
+		})
+	}
+}
+
+func TestWildcardTokens(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		subject  string
+		expected string
+	}{
+		{"web-01.metrics.*", "web-01.metrics.cpu", "cpu"},
+		{"web-01.*.usage.*", "web-01.disk.usage.sda1", "disk sda1"},
+		{"web-01.events.>", "web-01.events.user.created", "user created"},
+		{"web-01.*.>", "web-01.events.user.created", "events user created"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.subject, func(t *testing.T) {
+			if got := strings.Join(wildcardTokens(tt.pattern, tt.subject), " "); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}